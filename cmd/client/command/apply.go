@@ -0,0 +1,457 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	objectCategoriesURL = apiURL + "/object-categories"
+	objectNormalizeURL  = apiURL + "/objects/normalize"
+)
+
+type (
+	categoryKinds struct {
+		Category string   `yaml:"category"`
+		Kinds    []string `yaml:"kinds"`
+	}
+
+	// applyObject is an object to be applied or pruned.
+	applyObject struct {
+		kind string
+		name string
+		doc  string
+		// order is the index of the category of the object,
+		// the lower ones are applied earlier and pruned later.
+		order int
+
+		// local is the spec normalized by the server, it's empty if the
+		// object is to be pruned; live is the one stored in the server,
+		// it's empty if the object doesn't exist.
+		local string
+		live  string
+	}
+
+	// applyPlan is the objects to be applied and pruned in order.
+	applyPlan struct {
+		objects []*applyObject
+		prunes  []*applyObject
+	}
+)
+
+// The exit status of diff command.
+const (
+	diffExitNoDifferences = 0
+	diffExitDifferences   = 1
+	diffExitFailure       = 2
+)
+
+// ApplyCmd defines apply command.
+func ApplyCmd() *cobra.Command {
+	var files, pruneNames []string
+	var recursive, prune bool
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Create or update objects from yaml files or directories",
+		Long: `Create or update objects from yaml files or directories.
+The objects are applied in the order of system controllers, business controllers,
+pipelines and traffic gates. The unchanged objects are skipped, and the objects
+not declared in the files are deleted if --prune is specified. Only the objects
+of the kinds in the files and with names matching --prune-names are pruned.`,
+		Example: "egctl apply -f <object_spec.yaml> -f <object_spec_dir> --prune --prune-names 'demo-*'",
+		Run: func(cmd *cobra.Command, args []string) {
+			plan := mustNewApplyPlan(files, recursive, prune, pruneNames, cmd)
+			err := plan.apply(os.Stdout)
+			if err != nil {
+				ExitWithErrorf("%s failed: %v", cmd.Short, err)
+			}
+		},
+	}
+
+	addApplyFlags(cmd, &files, &recursive, &pruneNames)
+	cmd.Flags().BoolVar(&prune, "prune", false, "Delete the objects not declared in the files, it requires --prune-names.")
+
+	return cmd
+}
+
+// DiffCmd defines diff command.
+func DiffCmd() *cobra.Command {
+	var files, pruneNames []string
+	var recursive, prune bool
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Show the differences between the live objects and the ones in yaml files or directories",
+		Long: `Show the unified diff between the live objects and the ones in yaml files or directories.
+The objects in files are normalized by the server, so the default values make no differences.
+Exit status 0 means no differences, 1 means differences found, and 2 means failure.`,
+		Example: "egctl diff -f <object_spec_dir> --prune --prune-names 'demo-*'",
+		Run: func(cmd *cobra.Command, args []string) {
+			code, err := runDiff(os.Stdout, files, recursive, prune, pruneNames)
+			if err != nil {
+				CommandExitWithErrorf(cmd, "%s failed: %v", cmd.Short, err)
+			}
+			os.Exit(code)
+		},
+		// NOTE: 1 means differences found, so the failures,
+		// including the invalid flags, exit with another status.
+		Annotations: map[string]string{exitCodeAnnotation: strconv.Itoa(diffExitFailure)},
+	}
+
+	addApplyFlags(cmd, &files, &recursive, &pruneNames)
+	cmd.Flags().BoolVar(&prune, "prune", false, "Show the objects not declared in the files as deleted, it requires --prune-names.")
+
+	return cmd
+}
+
+func addApplyFlags(cmd *cobra.Command, files *[]string, recursive *bool, pruneNames *[]string) {
+	cmd.Flags().StringSliceVarP(files, "file", "f", nil, "The yaml files or directories specifying the objects, - means stdin.")
+	cmd.Flags().BoolVarP(recursive, "recursive", "R", false, "Process the directories recursively.")
+	cmd.Flags().StringSliceVar(pruneNames, "prune-names", nil, "The name patterns(in the syntax of path.Match) of the objects to prune, * means all of them.")
+	cmd.MarkFlagRequired("file")
+}
+
+// runDiff shows the differences between the live objects and the ones
+// in files, and returns the exit status of diff command.
+func runDiff(w io.Writer, files []string, recursive, prune bool, pruneNames []string) (int, error) {
+	objects, err := readApplyObjects(files, recursive)
+	if err != nil {
+		return diffExitFailure, err
+	}
+
+	plan, err := newApplyPlan(objects, prune, pruneNames)
+	if err != nil {
+		return diffExitFailure, err
+	}
+
+	changed, err := plan.diff(w)
+	if err != nil {
+		return diffExitFailure, err
+	}
+	if changed {
+		return diffExitDifferences, nil
+	}
+
+	return diffExitNoDifferences, nil
+}
+
+func mustNewApplyPlan(files []string, recursive, prune bool, pruneNames []string, cmd *cobra.Command) *applyPlan {
+	objects, err := readApplyObjects(files, recursive)
+	if err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+
+	plan, err := newApplyPlan(objects, prune, pruneNames)
+	if err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+
+	return plan
+}
+
+// readApplyObjects reads the objects from files, directories and stdin.
+func readApplyObjects(files []string, recursive bool) ([]*applyObject, error) {
+	var paths []string
+	for _, file := range files {
+		if file == "-" {
+			paths = append(paths, file)
+			continue
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, file)
+			continue
+		}
+
+		err = filepath.Walk(file, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if path != file && !recursive {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			switch filepath.Ext(path) {
+			case ".yaml", ".yml", ".json":
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	objects := []*applyObject{}
+	names := map[string]string{}
+	for _, path := range paths {
+		var buff []byte
+		var err error
+		if path == "-" {
+			buff, err = io.ReadAll(os.Stdin)
+		} else {
+			buff, err = os.ReadFile(path)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		NewSpecVisitor(string(buff)).Visit(func(s *spec) {
+			objects = append(objects, &applyObject{kind: s.Kind, name: s.Name, doc: s.doc})
+		})
+
+		for _, o := range objects[len(names):] {
+			if existed, ok := names[o.name]; ok {
+				return nil, fmt.Errorf("object %s declared in both %s and %s", o.name, existed, path)
+			}
+			names[o.name] = path
+		}
+	}
+
+	return objects, nil
+}
+
+func getObjectCategories() ([]*categoryKinds, error) {
+	code, body, err := sendRequest(http.MethodGet, makeURL(objectCategoriesURL), nil)
+	if err != nil {
+		return nil, err
+	}
+	if !successfulStatusCode(code) {
+		return nil, fmt.Errorf("get object categories failed: %d: %s", code, apiErrMessage(body))
+	}
+
+	categories := []*categoryKinds{}
+	err = yaml.Unmarshal(body, &categories)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal object categories failed: %v", err)
+	}
+
+	return categories, nil
+}
+
+// newApplyPlan normalizes the objects and gets the live ones from the server,
+// all objects are validated by the server before anything is changed.
+// The objects not declared are pruned only if they are of the declared kinds
+// and their names match pruneNames, so that the objects managed by others
+// are kept.
+func newApplyPlan(objects []*applyObject, prune bool, pruneNames []string) (*applyPlan, error) {
+	if prune && len(pruneNames) == 0 {
+		return nil, fmt.Errorf("--prune requires --prune-names to select the objects to prune")
+	}
+	for _, pattern := range pruneNames {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid prune name pattern %s: %v", pattern, err)
+		}
+	}
+
+	categories, err := getObjectCategories()
+	if err != nil {
+		return nil, err
+	}
+	orders := map[string]int{}
+	for i, ck := range categories {
+		for _, kind := range ck.Kinds {
+			orders[kind] = i
+		}
+	}
+
+	for _, o := range objects {
+		order, ok := orders[o.kind]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown kind %s", o.name, o.kind)
+		}
+		o.order = order
+
+		code, body, err := sendRequest(http.MethodPost, makeURL(objectNormalizeURL), []byte(o.doc))
+		if err != nil {
+			return nil, err
+		}
+		if !successfulStatusCode(code) {
+			return nil, fmt.Errorf("%s/%s is invalid: %s", o.kind, o.name, apiErrMessage(body))
+		}
+		o.local = string(body)
+
+		code, body, err = sendRequest(http.MethodGet, makeURL(objectURL, o.name), nil)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case code == http.StatusNotFound:
+		case successfulStatusCode(code):
+			o.live = string(body)
+		default:
+			return nil, fmt.Errorf("get %s failed: %d: %s", o.name, code, apiErrMessage(body))
+		}
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		return objects[i].order < objects[j].order
+	})
+
+	plan := &applyPlan{objects: objects}
+	if !prune {
+		return plan, nil
+	}
+
+	code, body, err := sendRequest(http.MethodGet, makeURL(objectsURL), nil)
+	if err != nil {
+		return nil, err
+	}
+	if !successfulStatusCode(code) {
+		return nil, fmt.Errorf("list objects failed: %d: %s", code, apiErrMessage(body))
+	}
+	var liveObjects []map[string]interface{}
+	err = yaml.Unmarshal(body, &liveObjects)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal objects failed: %v", err)
+	}
+
+	declared, kinds := map[string]bool{}, map[string]bool{}
+	for _, o := range objects {
+		declared[o.name] = true
+		kinds[o.kind] = true
+	}
+	for _, m := range liveObjects {
+		name, _ := m["name"].(string)
+		kind, _ := m["kind"].(string)
+		if declared[name] || !kinds[kind] || !matchPruneNames(pruneNames, name) {
+			continue
+		}
+		live, err := yaml.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		plan.prunes = append(plan.prunes, &applyObject{
+			kind:  kind,
+			name:  name,
+			order: orders[kind],
+			live:  string(live),
+		})
+	}
+	// NOTE: Prune in the reverse order, the same with the closing sequence.
+	sort.SliceStable(plan.prunes, func(i, j int) bool {
+		return plan.prunes[i].order > plan.prunes[j].order
+	})
+
+	return plan, nil
+}
+
+func matchPruneNames(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// changed compares the specs semantically rather than literally.
+func (o *applyObject) changed() bool {
+	var local, live interface{}
+	yaml.Unmarshal([]byte(o.local), &local)
+	yaml.Unmarshal([]byte(o.live), &live)
+	return !reflect.DeepEqual(local, live)
+}
+
+func (o *applyObject) id() string {
+	return o.kind + "/" + o.name
+}
+
+func (p *applyPlan) apply(w io.Writer) error {
+	for _, o := range p.objects {
+		var method, url, result string
+		switch {
+		case o.live == "":
+			method, url, result = http.MethodPost, makeURL(objectsURL), "created"
+		case o.changed():
+			method, url, result = http.MethodPut, makeURL(objectURL, o.name), "configured"
+		default:
+			fmt.Fprintf(w, "%s unchanged\n", o.id())
+			continue
+		}
+
+		code, body, err := sendRequest(method, url, []byte(o.doc))
+		if err != nil {
+			return err
+		}
+		if !successfulStatusCode(code) {
+			return fmt.Errorf("apply %s failed: %d: %s", o.id(), code, apiErrMessage(body))
+		}
+		fmt.Fprintf(w, "%s %s\n", o.id(), result)
+	}
+
+	for _, o := range p.prunes {
+		code, body, err := sendRequest(http.MethodDelete, makeURL(objectURL, o.name), nil)
+		if err != nil {
+			return err
+		}
+		if !successfulStatusCode(code) && code != http.StatusNotFound {
+			return fmt.Errorf("prune %s failed: %d: %s", o.id(), code, apiErrMessage(body))
+		}
+		fmt.Fprintf(w, "%s pruned\n", o.id())
+	}
+
+	return nil
+}
+
+// diff writes the unified diff of the changed objects, and returns true
+// if there are any.
+func (p *applyPlan) diff(w io.Writer) (bool, error) {
+	changed := false
+	for _, o := range append(p.objects, p.prunes...) {
+		if !o.changed() {
+			continue
+		}
+		changed = true
+
+		text, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(o.live),
+			B:        difflib.SplitLines(o.local),
+			FromFile: "live/" + o.id(),
+			ToFile:   "local/" + o.id(),
+			Context:  3,
+		})
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprint(w, text)
+		if !strings.HasSuffix(text, "\n") {
+			fmt.Fprintln(w)
+		}
+	}
+
+	return changed, nil
+}
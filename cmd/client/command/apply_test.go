@@ -0,0 +1,269 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+// fakeServer mocks the object APIs, it normalizes
+// the specs by filling the default value of field timeout.
+type fakeServer struct {
+	mutex   sync.Mutex
+	objects map[string]map[string]interface{}
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	readSpec := func() map[string]interface{} {
+		body, _ := io.ReadAll(r.Body)
+		m := map[string]interface{}{}
+		yaml.Unmarshal(body, &m)
+		if _, ok := m["timeout"]; !ok {
+			m["timeout"] = "30s"
+		}
+		return m
+	}
+	write := func(v interface{}) {
+		buff, _ := yaml.Marshal(v)
+		w.Write(buff)
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, apiURL)
+	switch {
+	case path == "/object-categories":
+		write([]*categoryKinds{
+			{Category: "SystemController", Kinds: []string{"ServiceRegistry"}},
+			{Category: "Pipeline", Kinds: []string{"HTTPPipeline"}},
+			{Category: "TrafficGate", Kinds: []string{"HTTPServer"}},
+			{Category: "BusinessController", Kinds: []string{"EaseMonitorMetrics"}},
+		})
+	case path == "/objects/normalize":
+		write(readSpec())
+	case path == "/objects" && r.Method == http.MethodGet:
+		names := []string{}
+		for name := range s.objects {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		list := []map[string]interface{}{}
+		for _, name := range names {
+			list = append(list, s.objects[name])
+		}
+		write(list)
+	case path == "/objects" && r.Method == http.MethodPost:
+		m := readSpec()
+		s.objects[m["name"].(string)] = m
+		w.WriteHeader(http.StatusCreated)
+	default:
+		name := strings.TrimPrefix(path, "/objects/")
+		m, ok := s.objects[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			write(m)
+		case http.MethodPut:
+			s.objects[name] = readSpec()
+		case http.MethodDelete:
+			delete(s.objects, name)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	s := &fakeServer{objects: map[string]map[string]interface{}{
+		"legacy-pipeline": {"kind": "HTTPPipeline", "name": "legacy-pipeline", "timeout": "30s"},
+		// Not selected by the prune names.
+		"team-pipeline": {"kind": "HTTPPipeline", "name": "team-pipeline", "timeout": "30s"},
+		// Not of the kinds in the files.
+		"legacy-monitor": {"kind": "EaseMonitorMetrics", "name": "legacy-monitor"},
+	}}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	CommandlineGlobalFlags = GlobalFlags{Server: server.URL}
+	httpClient = http.DefaultClient
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "pipelines"), 0o700)
+	os.WriteFile(filepath.Join(dir, "server.yaml"), []byte(`
+kind: HTTPServer
+name: demo-server
+port: 10080
+---
+kind: ServiceRegistry
+name: demo-registry
+`), 0o600)
+	os.WriteFile(filepath.Join(dir, "pipelines", "pipeline.yaml"), []byte(`
+kind: HTTPPipeline
+name: demo-pipeline
+timeout: 30s
+`), 0o600)
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("# not a spec"), 0o600)
+
+	objects, err := readApplyObjects([]string{dir}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 {
+		t.Fatalf("expected 2 objects in the top directory, got %d", len(objects))
+	}
+
+	pruneNames := []string{"demo-*", "legacy-*"}
+	apply := func(prune bool) string {
+		objects, err := readApplyObjects([]string{dir}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plan, err := newApplyPlan(objects, prune, pruneNames)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := &bytes.Buffer{}
+		if err := plan.apply(out); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+
+	expected := `ServiceRegistry/demo-registry created
+HTTPPipeline/demo-pipeline created
+HTTPServer/demo-server created
+`
+	if out := apply(false); out != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	os.WriteFile(filepath.Join(dir, "pipelines", "pipeline.yaml"), []byte(`
+kind: HTTPPipeline
+name: demo-pipeline
+timeout: 10s
+`), 0o600)
+
+	objects, _ = readApplyObjects([]string{dir}, true)
+	if _, err := newApplyPlan(objects, true, nil); err == nil {
+		t.Errorf("prune without names should fail")
+	}
+	if _, err := newApplyPlan(objects, true, []string{"[demo"}); err == nil {
+		t.Errorf("invalid prune name pattern should fail")
+	}
+	plan, err := newApplyPlan(objects, true, pruneNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	changed, err := plan.diff(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Errorf("diff should be found")
+	}
+	for _, s := range []string{"-timeout: 30s", "+timeout: 10s", "--- live/HTTPPipeline/legacy-pipeline", "-name: legacy-pipeline"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("diff should contain %q:\n%s", s, out)
+		}
+	}
+	for _, s := range []string{"demo-server", "team-pipeline", "legacy-monitor"} {
+		if strings.Contains(out.String(), s) {
+			t.Errorf("diff should not contain %q:\n%s", s, out)
+		}
+	}
+
+	expected = `ServiceRegistry/demo-registry unchanged
+HTTPPipeline/demo-pipeline configured
+HTTPServer/demo-server unchanged
+HTTPPipeline/legacy-pipeline pruned
+`
+	if out := apply(true); out != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+	if _, ok := s.objects["legacy-pipeline"]; ok {
+		t.Errorf("legacy-pipeline should be pruned")
+	}
+	for _, name := range []string{"team-pipeline", "legacy-monitor"} {
+		if _, ok := s.objects[name]; !ok {
+			t.Errorf("%s should not be pruned", name)
+		}
+	}
+}
+
+func TestDiffExitStatus(t *testing.T) {
+	s := &fakeServer{objects: map[string]map[string]interface{}{
+		"demo-pipeline": {"kind": "HTTPPipeline", "name": "demo-pipeline", "timeout": "30s"},
+	}}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	CommandlineGlobalFlags = GlobalFlags{Server: server.URL}
+	httpClient = http.DefaultClient
+
+	file := filepath.Join(t.TempDir(), "pipeline.yaml")
+	writeTimeout := func(timeout string) {
+		os.WriteFile(file, []byte("kind: HTTPPipeline\nname: demo-pipeline\ntimeout: "+timeout+"\n"), 0o600)
+	}
+	diff := func(files []string, prune bool, pruneNames []string) int {
+		code, err := runDiff(io.Discard, files, false, prune, pruneNames)
+		if (err != nil) != (code == diffExitFailure) {
+			t.Errorf("exit status %d doesn't match error %v", code, err)
+		}
+		return code
+	}
+
+	writeTimeout("30s")
+	if code := diff([]string{file}, false, nil); code != diffExitNoDifferences {
+		t.Errorf("expected exit status %d, got %d", diffExitNoDifferences, code)
+	}
+	writeTimeout("10s")
+	if code := diff([]string{file}, false, nil); code != diffExitDifferences {
+		t.Errorf("expected exit status %d, got %d", diffExitDifferences, code)
+	}
+
+	// Failures never exit with the status of differences found.
+	if code := diff([]string{file + ".missing"}, false, nil); code != diffExitFailure {
+		t.Errorf("missing file: expected exit status %d, got %d", diffExitFailure, code)
+	}
+	if code := diff([]string{file}, true, nil); code != diffExitFailure {
+		t.Errorf("prune without names: expected exit status %d, got %d", diffExitFailure, code)
+	}
+	server.Close()
+	if code := diff([]string{file}, false, nil); code != diffExitFailure {
+		t.Errorf("server down: expected exit status %d, got %d", diffExitFailure, code)
+	}
+
+	if code := failureExitCode(DiffCmd()); code != diffExitFailure {
+		t.Errorf("expected failure exit status %d of diff, got %d", diffExitFailure, code)
+	}
+	if code := failureExitCode(ApplyCmd()); code != 1 {
+		t.Errorf("expected failure exit status 1 of apply, got %d", code)
+	}
+}
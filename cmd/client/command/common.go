@@ -23,6 +23,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"strings"
 
 	yamljsontool "github.com/ghodss/yaml"
 	"github.com/spf13/cobra"
@@ -32,8 +33,17 @@ import (
 type (
 	// GlobalFlags is the global flags for the whole client.
 	GlobalFlags struct {
-		Server       string
-		OutputFormat string
+		Server             string
+		OutputFormat       string
+		Token              string
+		User               string
+		Password           string
+		CACert             string
+		Cert               string
+		Key                string
+		InsecureSkipVerify bool
+		ConfigFile         string
+		Context            string
 	}
 
 	// APIErr is the standard return of error.
@@ -58,12 +68,26 @@ const (
 	objectsURL     = apiURL + "/objects"
 	objectURL      = apiURL + "/objects/%s"
 
+	objectValidateURL = apiURL + "/objects/validate"
+
+	objectHistoryURL  = apiURL + "/objects/%s/history"
+	objectRevisionURL = apiURL + "/objects/%s/history/%d"
+	objectRollbackURL = apiURL + "/objects/%s/rollback?revision=%d"
+
 	statusObjectURL  = apiURL + "/status/objects/%s"
 	statusObjectsURL = apiURL + "/status/objects"
 
+	watchObjectsURL = apiURL + "/watch/objects"
+
 	wasmCodeURL = apiURL + "/wasm/code"
 	wasmDataURL = apiURL + "/wasm/data/%s/%s"
 
+	httpCacheURL = apiURL + "/httpcache/%s/%s"
+
+	loggingURL      = apiURL + "/logging"
+	loggingLevelURL = apiURL + "/logging/level"
+	loggingDebugURL = apiURL + "/logging/debugs/%s"
+
 	// MeshTenantsURL is the mesh tenant prefix.
 	MeshTenantsURL = apiURL + "/mesh/tenants"
 
@@ -107,8 +131,19 @@ const (
 	MeshIngressURL = apiURL + "/mesh/ingresses/%s"
 )
 
+// makeURL uses the scheme in the server address if there is,
+// otherwise it chooses https if any TLS flag is set.
 func makeURL(urlTemplate string, a ...interface{}) string {
-	return "http://" + CommandlineGlobalFlags.Server + fmt.Sprintf(urlTemplate, a...)
+	server := CommandlineGlobalFlags.Server
+	if !strings.Contains(server, "://") {
+		if CommandlineGlobalFlags.useTLS() {
+			server = "https://" + server
+		} else {
+			server = "http://" + server
+		}
+	}
+
+	return strings.TrimSuffix(server, "/") + fmt.Sprintf(urlTemplate, a...)
 }
 
 func successfulStatusCode(code int) bool {
@@ -116,34 +151,58 @@ func successfulStatusCode(code int) bool {
 }
 
 func handleRequest(httpMethod string, url string, reqBody []byte, cmd *cobra.Command) {
+	code, body, err := sendRequest(httpMethod, url, reqBody)
+	if err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+
+	if !successfulStatusCode(code) {
+		ExitWithErrorf("%d: %s", code, apiErrMessage(body))
+	}
+
+	if len(body) != 0 {
+		printBody(body)
+	}
+}
+
+// sendRequest returns the status code and the body of the response,
+// it's up to the caller to handle the unsuccessful status code.
+func sendRequest(httpMethod string, url string, reqBody []byte) (int, []byte, error) {
 	req, err := http.NewRequest(httpMethod, url, bytes.NewReader(reqBody))
 	if err != nil {
-		ExitWithError(err)
+		return 0, nil, err
 	}
+	setCredential(req)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+		return 0, nil, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+		return 0, nil, err
 	}
 
-	if !successfulStatusCode(resp.StatusCode) {
-		msg := string(body)
-		apiErr := &APIErr{}
-		err = yaml.Unmarshal(body, apiErr)
-		if err == nil {
-			msg = apiErr.Message
-		}
-		ExitWithErrorf("%d: %s", apiErr.Code, msg)
+	return resp.StatusCode, body, nil
+}
+
+func apiErrMessage(body []byte) string {
+	apiErr := &APIErr{}
+	err := yaml.Unmarshal(body, apiErr)
+	if err != nil || apiErr.Message == "" {
+		return string(body)
 	}
+	return apiErr.Message
+}
 
-	if len(body) != 0 {
-		printBody(body)
+func setCredential(req *http.Request) {
+	switch {
+	case CommandlineGlobalFlags.Token != "":
+		req.Header.Set("Authorization", "Bearer "+CommandlineGlobalFlags.Token)
+	case CommandlineGlobalFlags.User != "":
+		req.SetBasicAuth(CommandlineGlobalFlags.User, CommandlineGlobalFlags.Password)
 	}
 }
 
@@ -163,7 +222,7 @@ func printBody(body []byte) {
 	fmt.Printf("%s", output)
 }
 
-func buildVisitorFromFileOrStdin(specFile string, cmd *cobra.Command) SpecVisitor {
+func readFromFileOrStdin(specFile string, cmd *cobra.Command) []byte {
 	var buff []byte
 	var err error
 	if specFile != "" {
@@ -177,5 +236,9 @@ func buildVisitorFromFileOrStdin(specFile string, cmd *cobra.Command) SpecVisito
 			ExitWithErrorf("%s failed: %v", cmd.Short, err)
 		}
 	}
-	return NewSpecVisitor(string(buff))
+	return buff
+}
+
+func buildVisitorFromFileOrStdin(specFile string, cmd *cobra.Command) SpecVisitor {
+	return NewSpecVisitor(string(readFromFileOrStdin(specFile, cmd)))
 }
@@ -0,0 +1,405 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+type (
+	// config is the kubeconfig-style config of egctl, a context binds
+	// a cluster with a user, so that operators can switch between clusters
+	// by switching the current context.
+	config struct {
+		CurrentContext string          `yaml:"current-context"`
+		Clusters       []*namedCluster `yaml:"clusters"`
+		Users          []*namedUser    `yaml:"users"`
+		Contexts       []*namedContext `yaml:"contexts"`
+	}
+
+	namedCluster struct {
+		Name    string       `yaml:"name"`
+		Cluster *clusterInfo `yaml:"cluster"`
+	}
+
+	clusterInfo struct {
+		Server                string `yaml:"server"`
+		CertificateAuthority  string `yaml:"certificate-authority,omitempty"`
+		InsecureSkipTLSVerify bool   `yaml:"insecure-skip-tls-verify,omitempty"`
+	}
+
+	namedUser struct {
+		Name string    `yaml:"name"`
+		User *userInfo `yaml:"user"`
+	}
+
+	userInfo struct {
+		ClientCertificate string `yaml:"client-certificate,omitempty"`
+		ClientKey         string `yaml:"client-key,omitempty"`
+		Token             string `yaml:"token,omitempty"`
+		Username          string `yaml:"username,omitempty"`
+		Password          string `yaml:"password,omitempty"`
+	}
+
+	namedContext struct {
+		Name    string       `yaml:"name"`
+		Context *contextInfo `yaml:"context"`
+	}
+
+	contextInfo struct {
+		Cluster string `yaml:"cluster"`
+		User    string `yaml:"user,omitempty"`
+	}
+)
+
+const (
+	configEnv = "EGCTL_CONFIG"
+
+	redacted = "REDACTED"
+)
+
+// httpClient is the client to send requests to Easegress,
+// it's initialized by InitGlobalFlags.
+var httpClient = http.DefaultClient
+
+// DefaultConfigFile returns the default path of the config file of egctl.
+func DefaultConfigFile() string {
+	if file := os.Getenv(configEnv); file != "" {
+		return file
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".egctl", "config")
+}
+
+func loadConfig(file string) (*config, error) {
+	c := &config{}
+	if file == "" {
+		return c, nil
+	}
+
+	buff, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = yaml.UnmarshalStrict(buff, c)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s failed: %v", file, err)
+	}
+
+	return c, nil
+}
+
+func (c *config) save(file string) error {
+	if file == "" {
+		return fmt.Errorf("empty config file")
+	}
+
+	buff, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(file), 0o700)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, buff, 0o600)
+}
+
+func (c *config) getContext(name string) *contextInfo {
+	for _, ctx := range c.Contexts {
+		if ctx.Name == name {
+			return ctx.Context
+		}
+	}
+	return nil
+}
+
+func (c *config) getCluster(name string) *clusterInfo {
+	for _, cluster := range c.Clusters {
+		if cluster.Name == name {
+			return cluster.Cluster
+		}
+	}
+	return nil
+}
+
+func (c *config) getUser(name string) *userInfo {
+	for _, user := range c.Users {
+		if user.Name == name {
+			return user.User
+		}
+	}
+	return nil
+}
+
+// applyContext fills the global flags which are not set in command line
+// with the cluster and user of the context.
+func (c *config) applyContext(name string, flags *pflag.FlagSet) error {
+	ctx := c.getContext(name)
+	if ctx == nil {
+		return fmt.Errorf("context %s not found", name)
+	}
+
+	cluster := c.getCluster(ctx.Cluster)
+	if cluster == nil {
+		return fmt.Errorf("cluster %s of context %s not found", ctx.Cluster, name)
+	}
+
+	user := &userInfo{}
+	if ctx.User != "" {
+		user = c.getUser(ctx.User)
+		if user == nil {
+			return fmt.Errorf("user %s of context %s not found", ctx.User, name)
+		}
+	}
+
+	g := &CommandlineGlobalFlags
+	setString := func(flag string, p *string, value string) {
+		if !flags.Changed(flag) && value != "" {
+			*p = value
+		}
+	}
+
+	setString("server", &g.Server, cluster.Server)
+	setString("cacert", &g.CACert, cluster.CertificateAuthority)
+	setString("cert", &g.Cert, user.ClientCertificate)
+	setString("key", &g.Key, user.ClientKey)
+	setString("token", &g.Token, user.Token)
+	setString("user", &g.User, user.Username)
+	setString("password", &g.Password, user.Password)
+	if !flags.Changed("insecure-skip-verify") && cluster.InsecureSkipTLSVerify {
+		g.InsecureSkipVerify = true
+	}
+
+	return nil
+}
+
+// InitGlobalFlags applies the context in the config file to the global flags,
+// and initializes the HTTP client with them.
+func InitGlobalFlags(flags *pflag.FlagSet) error {
+	g := &CommandlineGlobalFlags
+
+	c, err := loadConfig(g.ConfigFile)
+	if err != nil {
+		return err
+	}
+
+	contextName := g.Context
+	if contextName == "" {
+		contextName = c.CurrentContext
+	}
+	if contextName != "" {
+		err = c.applyContext(contextName, flags)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !g.useTLS() {
+		return nil
+	}
+
+	if (g.Cert == "") != (g.Key == "") {
+		return fmt.Errorf("cert and key must be specified together")
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: g.InsecureSkipVerify}
+
+	if g.CACert != "" {
+		pem, err := os.ReadFile(g.CACert)
+		if err != nil {
+			return fmt.Errorf("read cacert failed: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in cacert %s", g.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if g.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(g.Cert, g.Key)
+		if err != nil {
+			return fmt.Errorf("load cert and key failed: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	httpClient = &http.Client{Transport: transport}
+
+	return nil
+}
+
+func (g *GlobalFlags) useTLS() bool {
+	return g.CACert != "" || g.Cert != "" || g.InsecureSkipVerify
+}
+
+// ConfigCmd defines config command.
+func ConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "View and switch the contexts in the config file of egctl",
+		// NOTE: Override the root one, since the current context may be
+		// broken, and it's what the config command is for.
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	}
+
+	cmd.AddCommand(viewConfigCmd())
+	cmd.AddCommand(getContextsCmd())
+	cmd.AddCommand(currentContextCmd())
+	cmd.AddCommand(useContextCmd())
+	return cmd
+}
+
+func mustLoadConfig(cmd *cobra.Command) *config {
+	c, err := loadConfig(CommandlineGlobalFlags.ConfigFile)
+	if err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+	return c
+}
+
+func viewConfigCmd() *cobra.Command {
+	var raw bool
+	cmd := &cobra.Command{
+		Use:   "view",
+		Short: "View the config file, with the secrets redacted",
+		Run: func(cmd *cobra.Command, args []string) {
+			c := mustLoadConfig(cmd)
+			if !raw {
+				for _, user := range c.Users {
+					if user.User == nil {
+						continue
+					}
+					if user.User.Token != "" {
+						user.User.Token = redacted
+					}
+					if user.User.Password != "" {
+						user.User.Password = redacted
+					}
+				}
+			}
+
+			buff, err := yaml.Marshal(c)
+			if err != nil {
+				ExitWithErrorf("%s failed: %v", cmd.Short, err)
+			}
+			fmt.Printf("%s", buff)
+		},
+	}
+
+	cmd.Flags().BoolVar(&raw, "raw", false, "Display the secrets")
+
+	return cmd
+}
+
+func getContextsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get-contexts",
+		Short: "List the contexts in the config file",
+		Run: func(cmd *cobra.Command, args []string) {
+			c := mustLoadConfig(cmd)
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+			fmt.Fprintln(w, "CURRENT\tNAME\tCLUSTER\tUSER")
+			for _, ctx := range c.Contexts {
+				current := ""
+				if ctx.Name == c.CurrentContext {
+					current = "*"
+				}
+				cluster, user := "", ""
+				if ctx.Context != nil {
+					cluster, user = ctx.Context.Cluster, ctx.Context.User
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", current, ctx.Name, cluster, user)
+			}
+			w.Flush()
+		},
+	}
+
+	return cmd
+}
+
+func currentContextCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "current-context",
+		Short: "Display the current context",
+		Run: func(cmd *cobra.Command, args []string) {
+			c := mustLoadConfig(cmd)
+			if c.CurrentContext == "" {
+				ExitWithErrorf("current context is not set")
+			}
+			fmt.Println(c.CurrentContext)
+		},
+	}
+
+	return cmd
+}
+
+func useContextCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "use-context <context name>",
+		Short:   "Set the current context",
+		Example: "egctl config use-context <context name>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one context name to be used")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			c := mustLoadConfig(cmd)
+			if c.getContext(args[0]) == nil {
+				ExitWithErrorf("context %s not found", args[0])
+			}
+
+			c.CurrentContext = args[0]
+			err := c.save(CommandlineGlobalFlags.ConfigFile)
+			if err != nil {
+				ExitWithErrorf("%s failed: %v", cmd.Short, err)
+			}
+			fmt.Printf("switched to context %s\n", args[0])
+		},
+	}
+
+	return cmd
+}
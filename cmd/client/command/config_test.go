@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+const testConfig = `
+current-context: prod
+clusters:
+- name: prod
+  cluster:
+    server: https://prod.example.com:2381
+    insecure-skip-tls-verify: true
+- name: test
+  cluster:
+    server: test.example.com:2381
+users:
+- name: admin
+  user:
+    token: admin-token
+contexts:
+- name: prod
+  context:
+    cluster: prod
+    user: admin
+- name: test
+  context:
+    cluster: test
+`
+
+func TestInitGlobalFlags(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(file, []byte(testConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	newFlags := func(args ...string) *pflag.FlagSet {
+		CommandlineGlobalFlags = GlobalFlags{ConfigFile: file}
+		flags := pflag.NewFlagSet("egctl", pflag.ContinueOnError)
+		flags.StringVar(&CommandlineGlobalFlags.Server, "server", "localhost:2381", "")
+		flags.StringVar(&CommandlineGlobalFlags.Token, "token", "", "")
+		flags.StringVar(&CommandlineGlobalFlags.Context, "context", "", "")
+		flags.Parse(args)
+		return flags
+	}
+
+	if err := InitGlobalFlags(newFlags()); err != nil {
+		t.Fatal(err)
+	}
+	if makeURL(healthURL) != "https://prod.example.com:2381/apis/v1/healthz" {
+		t.Errorf("unexpected url %s", makeURL(healthURL))
+	}
+	if CommandlineGlobalFlags.Token != "admin-token" || !CommandlineGlobalFlags.InsecureSkipVerify {
+		t.Errorf("user and cluster of the current context should be applied")
+	}
+	if httpClient == nil || httpClient.Transport == nil {
+		t.Errorf("tls client should be initialized")
+	}
+
+	if err := InitGlobalFlags(newFlags("--context", "test", "--token", "my-token")); err != nil {
+		t.Fatal(err)
+	}
+	if makeURL(healthURL) != "http://test.example.com:2381/apis/v1/healthz" {
+		t.Errorf("unexpected url %s", makeURL(healthURL))
+	}
+	if CommandlineGlobalFlags.Token != "my-token" {
+		t.Errorf("command line flags should override the context")
+	}
+
+	if err := InitGlobalFlags(newFlags("--context", "dev")); err == nil {
+		t.Errorf("unknown context should be rejected")
+	}
+}
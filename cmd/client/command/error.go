@@ -20,10 +20,16 @@ package command
 import (
 	"fmt"
 	"os"
+	"strconv"
 
 	"github.com/fatih/color"
+	"github.com/spf13/cobra"
 )
 
+// exitCodeAnnotation is the annotation of the commands
+// whose failures exit with the status other than 1.
+const exitCodeAnnotation = "exitCode"
+
 func appendError(err, err1 error) error {
 	if err != nil {
 		return fmt.Errorf("%s\n%s", err, err1)
@@ -35,14 +41,42 @@ func appendError(err, err1 error) error {
 // ExitWithError exits with self-defined message not the one of cobra(such as usage).
 func ExitWithError(err error) {
 	if err != nil {
-		color.New(color.FgRed).Fprint(os.Stderr, "Error: ")
-		fmt.Fprintf(os.Stderr, "%s\n", err)
+		printError(err)
 		os.Exit(1)
 	}
 	os.Exit(0)
 }
 
+func printError(err error) {
+	color.New(color.FgRed).Fprint(os.Stderr, "Error: ")
+	fmt.Fprintf(os.Stderr, "%s\n", err)
+}
+
 // ExitWithErrorf wraps ExitWithError with format.
 func ExitWithErrorf(format string, a ...interface{}) {
 	ExitWithError(fmt.Errorf(format, a...))
 }
+
+// CommandExitWithError is like ExitWithError, but exits with
+// the failure status of cmd if the error isn't nil.
+func CommandExitWithError(cmd *cobra.Command, err error) {
+	if err != nil {
+		printError(err)
+		os.Exit(failureExitCode(cmd))
+	}
+	os.Exit(0)
+}
+
+// CommandExitWithErrorf wraps CommandExitWithError with format.
+func CommandExitWithErrorf(cmd *cobra.Command, format string, a ...interface{}) {
+	CommandExitWithError(cmd, fmt.Errorf(format, a...))
+}
+
+func failureExitCode(cmd *cobra.Command) int {
+	if cmd != nil {
+		if code, err := strconv.Atoi(cmd.Annotations[exitCodeAnnotation]); err == nil {
+			return code
+		}
+	}
+	return 1
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/cobra"
+)
+
+// HTTPCacheCmd defines httpcache command.
+func HTTPCacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "httpcache",
+		Short: "Manage cached responses of HTTPCache filters",
+	}
+
+	cmd.AddCommand(httpCachePurgeCmd())
+	return cmd
+}
+
+func httpCachePurgeCmd() *cobra.Command {
+	var key, prefix string
+
+	cmd := &cobra.Command{
+		Use:     "purge",
+		Short:   "Purge cached responses of a HTTPCache filter in all members",
+		Example: "egctl httpcache purge <pipeline> <filter> [--key <key> | --prefix <prefix>]",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("requires pipeline and filter name")
+			}
+			if key != "" && prefix != "" {
+				return fmt.Errorf("key and prefix are mutually exclusive")
+			}
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			query := url.Values{}
+			if key != "" {
+				query.Set("key", key)
+			}
+			if prefix != "" {
+				query.Set("prefix", prefix)
+			}
+
+			u := makeURL(httpCacheURL, args[0], args[1])
+			if len(query) > 0 {
+				u += "?" + query.Encode()
+			}
+			handleRequest(http.MethodDelete, u, nil, cmd)
+		},
+	}
+	cmd.Flags().StringVar(&key, "key", "", "The cache key to purge.")
+	cmd.Flags().StringVar(&prefix, "prefix", "", "The prefix of cache keys to purge, all keys are purged if both key and prefix are empty.")
+
+	return cmd
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// LoggingCmd defines logging command.
+func LoggingCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "logging",
+		Short: "Manage the log level and debugging of objects in all members",
+	}
+
+	cmd.AddCommand(getLoggingCmd())
+	cmd.AddCommand(setLevelCmd())
+	cmd.AddCommand(resetLevelCmd())
+	cmd.AddCommand(debugObjectCmd())
+	cmd.AddCommand(undebugObjectCmd())
+	return cmd
+}
+
+func marshalRequest(v interface{}) []byte {
+	buff, err := yaml.Marshal(v)
+	if err != nil {
+		ExitWithErrorf("marshal %#v to yaml failed: %v", v, err)
+	}
+	return buff
+}
+
+func getLoggingCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get",
+		Short: "Get the log level and objects being debugged",
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(loggingURL), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func setLevelCmd() *cobra.Command {
+	var ttl string
+
+	cmd := &cobra.Command{
+		Use:     "set-level",
+		Short:   "Set the log level of all members",
+		Example: "egctl logging set-level <DEBUG|INFO|WARN|ERROR> [--ttl 30m]",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("requires one log level")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			body := marshalRequest(map[string]string{"level": args[0], "ttl": ttl})
+			handleRequest(http.MethodPut, makeURL(loggingLevelURL), body, cmd)
+		},
+	}
+	cmd.Flags().StringVar(&ttl, "ttl", "", "The time before reverting to the level at startup, empty means never.")
+
+	return cmd
+}
+
+func resetLevelCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reset-level",
+		Short: "Reset the log level of all members to the one at startup",
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodDelete, makeURL(loggingLevelURL), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func debugObjectCmd() *cobra.Command {
+	var filter, ttl string
+	var dump bool
+
+	cmd := &cobra.Command{
+		Use:     "debug",
+		Short:   "Log the debug logs of an object or a filter regardless of the log level",
+		Example: "egctl logging debug <object> [--filter <filter>] [--dump] [--ttl 10m]",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("requires one object name")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			body := marshalRequest(map[string]interface{}{"filter": filter, "dump": dump, "ttl": ttl})
+			handleRequest(http.MethodPut, makeURL(loggingDebugURL, args[0]), body, cmd)
+		},
+	}
+	cmd.Flags().StringVar(&filter, "filter", "", "The filter in the object to debug, empty means the whole object.")
+	cmd.Flags().BoolVar(&dump, "dump", false, "Dump the requests and responses to filter_http_dump.log.")
+	cmd.Flags().StringVar(&ttl, "ttl", "", "The time to debug, 10m by default.")
+
+	return cmd
+}
+
+func undebugObjectCmd() *cobra.Command {
+	var filter string
+
+	cmd := &cobra.Command{
+		Use:     "undebug",
+		Short:   "Stop debugging an object or a filter before it expires",
+		Example: "egctl logging undebug <object> [--filter <filter>]",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("requires one object name")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			u := makeURL(loggingDebugURL, args[0])
+			if cmd.Flags().Changed("filter") {
+				u += "?" + url.Values{"filter": []string{filter}}.Encode()
+			}
+			handleRequest(http.MethodDelete, u, nil, cmd)
+		},
+	}
+	cmd.Flags().StringVar(&filter, "filter", "", "The filter to stop debugging, all targets of the object are stopped if absent.")
+
+	return cmd
+}
@@ -18,10 +18,20 @@
 package command
 
 import (
+	"bufio"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
 
+	yamljsontool "github.com/ghodss/yaml"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
 )
 
 // ObjectCmd defines object command.
@@ -39,6 +49,9 @@ func ObjectCmd() *cobra.Command {
 	cmd.AddCommand(updateObjectCmd())
 	cmd.AddCommand(deleteObjectCmd())
 	cmd.AddCommand(statusObjectCmd())
+	cmd.AddCommand(historyObjectCmd())
+	cmd.AddCommand(rollbackObjectCmd())
+	cmd.AddCommand(watchObjectCmd())
 
 	return cmd
 }
@@ -57,10 +70,15 @@ func objectKindsCmd() *cobra.Command {
 
 func createObjectCmd() *cobra.Command {
 	var specFile string
+	var dryRun bool
 	cmd := &cobra.Command{
 		Use:   "create",
 		Short: "Create an object from a yaml file or stdin",
 		Run: func(cmd *cobra.Command, args []string) {
+			if dryRun {
+				validateObjects(specFile, cmd)
+				return
+			}
 			visitor := buildVisitorFromFileOrStdin(specFile, cmd)
 			visitor.Visit(func(s *spec) {
 				handleRequest(http.MethodPost, makeURL(objectsURL), []byte(s.doc), cmd)
@@ -69,16 +87,22 @@ func createObjectCmd() *cobra.Command {
 	}
 
 	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file specifying the object.")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only validate the objects by the server without changing anything.")
 
 	return cmd
 }
 
 func updateObjectCmd() *cobra.Command {
 	var specFile string
+	var dryRun bool
 	cmd := &cobra.Command{
 		Use:   "update",
 		Short: "Update an object from a yaml file or stdin",
 		Run: func(cmd *cobra.Command, args []string) {
+			if dryRun {
+				validateObjects(specFile, cmd)
+				return
+			}
 			visitor := buildVisitorFromFileOrStdin(specFile, cmd)
 			visitor.Visit(func(s *spec) {
 				handleRequest(http.MethodPut, makeURL(objectURL, s.Name), []byte(s.doc), cmd)
@@ -87,10 +111,38 @@ func updateObjectCmd() *cobra.Command {
 	}
 
 	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file specifying the object.")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only validate the objects by the server without changing anything.")
 
 	return cmd
 }
 
+// validateObjects validates all objects in the file by the server at once,
+// so that they could refer to each other, and exits with 1 if any is invalid.
+func validateObjects(specFile string, cmd *cobra.Command) {
+	buff := readFromFileOrStdin(specFile, cmd)
+
+	code, body, err := sendRequest(http.MethodPost, makeURL(objectValidateURL), buff)
+	if err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+	if !successfulStatusCode(code) {
+		ExitWithErrorf("%d: %s", code, apiErrMessage(body))
+	}
+
+	printBody(body)
+
+	result := struct {
+		Valid bool `yaml:"valid"`
+	}{}
+	err = yaml.Unmarshal(body, &result)
+	if err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+	if !result.Valid {
+		os.Exit(1)
+	}
+}
+
 func deleteObjectCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "delete",
@@ -192,3 +244,153 @@ func listStatusObjectsCmd() *cobra.Command {
 
 	return cmd
 }
+
+func historyObjectCmd() *cobra.Command {
+	var revision int64
+	cmd := &cobra.Command{
+		Use:     "history",
+		Short:   "View the revision history of an object",
+		Example: "egctl object history <object_name> [--revision <revision>]",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one object name to be retrieved")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			if revision == 0 {
+				handleRequest(http.MethodGet, makeURL(objectHistoryURL, args[0]), nil, cmd)
+			} else {
+				handleRequest(http.MethodGet, makeURL(objectRevisionURL, args[0], revision), nil, cmd)
+			}
+		},
+	}
+
+	cmd.Flags().Int64Var(&revision, "revision", 0, "The revision to view with the spec.")
+
+	return cmd
+}
+
+func rollbackObjectCmd() *cobra.Command {
+	var revision int64
+	cmd := &cobra.Command{
+		Use:     "rollback",
+		Short:   "Roll back an object to a previous revision",
+		Example: "egctl object rollback <object_name> --revision <revision>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one object name to be rolled back")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodPost, makeURL(objectRollbackURL, args[0], revision), nil, cmd)
+		},
+	}
+
+	cmd.Flags().Int64Var(&revision, "revision", 0, "The revision to roll back to.")
+	cmd.MarkFlagRequired("revision")
+
+	return cmd
+}
+
+func watchObjectCmd() *cobra.Command {
+	var kind string
+	var revision int64
+	var statusInterval time.Duration
+	cmd := &cobra.Command{
+		Use:     "watch",
+		Short:   "Watch the changes of objects",
+		Example: "egctl object watch [<object_name>] [--kind <kind>] [--revision <revision>] [--status-interval <interval>]",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				return errors.New("requires at most one object name to be watched")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			query := url.Values{}
+			if len(args) == 1 {
+				query.Set("name", args[0])
+			}
+			if kind != "" {
+				query.Set("kind", kind)
+			}
+			if revision != 0 {
+				query.Set("revision", strconv.FormatInt(revision, 10))
+			}
+			if statusInterval != 0 {
+				query.Set("statusInterval", statusInterval.String())
+			}
+
+			watchObjects(makeURL(watchObjectsURL)+"?"+query.Encode(), cmd)
+		},
+	}
+
+	cmd.Flags().StringVar(&kind, "kind", "", "Only watch the objects of the kind.")
+	cmd.Flags().Int64Var(&revision, "revision", 0, "Resume watching the changes after the revision.")
+	cmd.Flags().DurationVar(&statusInterval, "status-interval", 0, "The interval to watch the changes of status, 0 means not to watch status.")
+
+	return cmd
+}
+
+// watchObjects prints the events until the server ends the stream,
+// and exits with 1 if the stream is ended by an error event.
+func watchObjects(url string, cmd *cobra.Command) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+	setCredential(req)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+	defer resp.Body.Close()
+
+	if !successfulStatusCode(resp.StatusCode) {
+		body, _ := io.ReadAll(resp.Body)
+		ExitWithErrorf("%d: %s", resp.StatusCode, apiErrMessage(body))
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	// NOTE: The spec of an object may exceed the default 64KB.
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		event := struct {
+			Type string `json:"type"`
+		}{}
+		err := json.Unmarshal(line, &event)
+		if err != nil {
+			ExitWithErrorf("unmarshal event %s failed: %v", line, err)
+		}
+
+		switch CommandlineGlobalFlags.OutputFormat {
+		case "json":
+			fmt.Printf("%s\n", line)
+		default:
+			output, err := yamljsontool.JSONToYAML(line)
+			if err != nil {
+				ExitWithErrorf("json %s to yaml failed: %v", line, err)
+			}
+			fmt.Printf("---\n%s", output)
+		}
+
+		if event.Type == "error" {
+			os.Exit(1)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+}
@@ -47,6 +47,9 @@ var exampleUsage = `  # List APIs.
   # Create an object from a yaml file.
   egctl object create -f <object_spec.yaml>
 
+  # Validate objects without creating them.
+  egctl object create --dry-run -f <object_spec.yaml>
+
   # Create an object from stdout.
   cat <object_spec.yaml> | egctl object create
 
@@ -70,6 +73,30 @@ var exampleUsage = `  # List APIs.
 
   # Get object status
   egctl object status get <object_name>
+
+  # View the revision history of an object.
+  egctl object history <object_name>
+
+  # Roll back an object to a previous revision.
+  egctl object rollback <object_name> --revision <revision>
+
+  # Watch the changes of objects along with their status.
+  egctl object watch --status-interval 5s
+
+  # Create or update objects from a directory of yaml files.
+  egctl apply -f <object_spec_dir>
+
+  # Show the differences between live objects and yaml files.
+  egctl diff -f <object_spec_dir>
+
+  # List contexts in the config file.
+  egctl config get-contexts
+
+  # Switch to another context.
+  egctl config use-context <context_name>
+
+  # Connect to an endpoint over mutual TLS.
+  egctl --server https://<host>:<port> --cacert <ca.crt> --cert <client.crt> --key <client.key> member list
 `
 
 func main() {
@@ -82,9 +109,14 @@ func main() {
 			switch command.CommandlineGlobalFlags.OutputFormat {
 			case "yaml", "json":
 			default:
-				command.ExitWithErrorf("unsupported output format: %s",
+				command.CommandExitWithErrorf(cmd, "unsupported output format: %s",
 					command.CommandlineGlobalFlags.OutputFormat)
 			}
+
+			err := command.InitGlobalFlags(cmd.Flags())
+			if err != nil {
+				command.CommandExitWithError(cmd, err)
+			}
 		},
 	}
 
@@ -110,16 +142,39 @@ func main() {
 		command.ObjectCmd(),
 		command.MemberCmd(),
 		command.WasmCmd(),
+		command.HTTPCacheCmd(),
+		command.LoggingCmd(),
+		command.ConfigCmd(),
+		command.ApplyCmd(),
+		command.DiffCmd(),
 		completionCmd,
 	)
 
 	rootCmd.PersistentFlags().StringVar(&command.CommandlineGlobalFlags.Server,
-		"server", "localhost:2381", "The address of the Easegress endpoint")
+		"server", "localhost:2381", "The address of the Easegress endpoint, in the form of [scheme://]host:port")
 	rootCmd.PersistentFlags().StringVarP(&command.CommandlineGlobalFlags.OutputFormat,
 		"output", "o", "yaml", "Output format(json, yaml)")
-
-	err := rootCmd.Execute()
+	rootCmd.PersistentFlags().StringVar(&command.CommandlineGlobalFlags.Token,
+		"token", "", "The bearer token to authenticate to the Easegress endpoint")
+	rootCmd.PersistentFlags().StringVar(&command.CommandlineGlobalFlags.User,
+		"user", "", "The user name of basic auth to authenticate to the Easegress endpoint")
+	rootCmd.PersistentFlags().StringVar(&command.CommandlineGlobalFlags.Password,
+		"password", "", "The password of basic auth to authenticate to the Easegress endpoint")
+	rootCmd.PersistentFlags().StringVar(&command.CommandlineGlobalFlags.CACert,
+		"cacert", "", "The CA certificate file to verify the Easegress endpoint")
+	rootCmd.PersistentFlags().StringVar(&command.CommandlineGlobalFlags.Cert,
+		"cert", "", "The client certificate file for mutual TLS")
+	rootCmd.PersistentFlags().StringVar(&command.CommandlineGlobalFlags.Key,
+		"key", "", "The client key file for mutual TLS")
+	rootCmd.PersistentFlags().BoolVar(&command.CommandlineGlobalFlags.InsecureSkipVerify,
+		"insecure-skip-verify", false, "Skip verifying the certificate of the Easegress endpoint")
+	rootCmd.PersistentFlags().StringVar(&command.CommandlineGlobalFlags.ConfigFile,
+		"egctl-config", command.DefaultConfigFile(), "The config file holding the contexts of egctl, $EGCTL_CONFIG overrides the default one")
+	rootCmd.PersistentFlags().StringVar(&command.CommandlineGlobalFlags.Context,
+		"context", "", "The context in the config file to use, the current context is used if not specified")
+
+	cmd, err := rootCmd.ExecuteC()
 	if err != nil {
-		command.ExitWithError(err)
+		command.CommandExitWithError(cmd, err)
 	}
 }
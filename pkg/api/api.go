@@ -39,6 +39,9 @@ const (
 	// APIPrefix is the prefix of api.
 	APIPrefix = "/apis/v1"
 
+	// HealthzPath is the path of health check, it needs no authentication.
+	HealthzPath = "/healthz"
+
 	lockKey = "/config/lock"
 
 	// ConfigVersionKey is the key of header for config version.
@@ -98,6 +101,9 @@ func (s *Server) registerAPIs() {
 	group.Entries = append(group.Entries, s.listAPIEntries()...)
 	group.Entries = append(group.Entries, s.memberAPIEntries()...)
 	group.Entries = append(group.Entries, s.objectAPIEntries()...)
+	group.Entries = append(group.Entries, s.objectHistoryAPIEntries()...)
+	group.Entries = append(group.Entries, s.watchAPIEntries()...)
+	group.Entries = append(group.Entries, s.loggingAPIEntries()...)
 	group.Entries = append(group.Entries, s.metadataAPIEntries()...)
 	group.Entries = append(group.Entries, s.healthAPIEntries()...)
 	group.Entries = append(group.Entries, s.aboutAPIEntries()...)
@@ -123,7 +129,7 @@ func (s *Server) healthAPIEntries() []*Entry {
 	return []*Entry{
 		{
 			// https://stackoverflow.com/a/43381061/1705845
-			Path:    "/healthz",
+			Path:    HealthzPath,
 			Method:  "GET",
 			Handler: func(w http.ResponseWriter, r *http.Request) { /* 200 by default */ },
 		},
@@ -0,0 +1,540 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/bcrypt"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+)
+
+const (
+	verbGet    = "get"
+	verbCreate = "create"
+	verbUpdate = "update"
+	verbDelete = "delete"
+
+	authRealm = "easegress"
+
+	// memberUser is the user of the requests from the other members,
+	// it's allowed to do everything like the members themselves.
+	memberUser = "easegress:member"
+)
+
+var (
+	memberTokensMutex sync.Mutex
+	// memberTokens caches the member tokens of the clusters,
+	// the token never changes once it's created.
+	memberTokens = map[cluster.Cluster]string{}
+)
+
+type (
+	// authSpec is the authentication and authorization config of the admin API.
+	authSpec struct {
+		Tokens            []*tokenSpec       `yaml:"tokens"`
+		BasicAuthUserFile string             `yaml:"basicAuthUserFile"`
+		ClientCertificate bool               `yaml:"clientCertificate"`
+		Roles             []*roleSpec        `yaml:"roles"`
+		RoleBindings      []*roleBindingSpec `yaml:"roleBindings"`
+	}
+
+	tokenSpec struct {
+		User  string `yaml:"user"`
+		Token string `yaml:"token"`
+	}
+
+	roleSpec struct {
+		Name  string      `yaml:"name"`
+		Rules []*ruleSpec `yaml:"rules"`
+	}
+
+	// ruleSpec allows the verbs on the objects, empty kinds or names
+	// means all of them, and the patterns of kinds and names are in
+	// the syntax of path.Match.
+	ruleSpec struct {
+		Verbs []string `yaml:"verbs"`
+		Kinds []string `yaml:"kinds"`
+		Names []string `yaml:"names"`
+	}
+
+	roleBindingSpec struct {
+		Role  string   `yaml:"role"`
+		Users []string `yaml:"users"`
+	}
+
+	apiAuth struct {
+		spec *authSpec
+
+		// users are the bcrypt hashes of passwords of users.
+		users map[string][]byte
+		// rules are the rules of users from all their roles.
+		rules map[string][]*ruleSpec
+	}
+
+	// apiResource is the resource requested by an API, kind and
+	// name are empty for the APIs not about objects.
+	apiResource struct {
+		// verb overrides the one mapped from the method if not empty.
+		verb string
+		kind string
+		name string
+		// list is true for the APIs listing objects, the objects
+		// the user can't get are filtered by the handlers.
+		list bool
+	}
+
+	authUserKey struct{}
+)
+
+func newAPIAuth(filename string) (*apiAuth, error) {
+	if filename == "" {
+		return nil, nil
+	}
+
+	buff, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &authSpec{}
+	err = yaml.UnmarshalStrict(buff, spec)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s failed: %v", filename, err)
+	}
+
+	a := &apiAuth{
+		spec:  spec,
+		rules: map[string][]*ruleSpec{},
+	}
+
+	if len(spec.Tokens) == 0 && spec.BasicAuthUserFile == "" && !spec.ClientCertificate {
+		return nil, fmt.Errorf("no authentication method")
+	}
+
+	for _, t := range spec.Tokens {
+		if t.User == "" || t.Token == "" {
+			return nil, fmt.Errorf("empty user or token")
+		}
+		if t.User == memberUser {
+			return nil, fmt.Errorf("user %s is reserved", memberUser)
+		}
+	}
+
+	if spec.BasicAuthUserFile != "" {
+		a.users, err = loadUserFile(spec.BasicAuthUserFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	roles := map[string]*roleSpec{}
+	for _, role := range spec.Roles {
+		if _, exists := roles[role.Name]; exists {
+			return nil, fmt.Errorf("conflict role name: %s", role.Name)
+		}
+		for _, rule := range role.Rules {
+			if err := rule.validate(); err != nil {
+				return nil, fmt.Errorf("role %s: %v", role.Name, err)
+			}
+		}
+		roles[role.Name] = role
+	}
+
+	for _, binding := range spec.RoleBindings {
+		role, exists := roles[binding.Role]
+		if !exists {
+			return nil, fmt.Errorf("role %s not found", binding.Role)
+		}
+		for _, user := range binding.Users {
+			a.rules[user] = append(a.rules[user], role.Rules...)
+		}
+	}
+
+	return a, nil
+}
+
+// loadUserFile loads users from the file in the format of htpasswd,
+// every line is user:password-hash, only bcrypt hash is supported.
+func loadUserFile(filename string) (map[string][]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	users := map[string][]byte{}
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		idx := strings.IndexByte(line, ':')
+		if idx <= 0 {
+			return nil, fmt.Errorf("%s:%d: invalid format", filename, lineNo)
+		}
+
+		user, hash := line[:idx], []byte(line[idx+1:])
+		if user == memberUser {
+			return nil, fmt.Errorf("%s:%d: user %s is reserved", filename, lineNo, memberUser)
+		}
+		if _, err := bcrypt.Cost(hash); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid bcrypt hash: %v", filename, lineNo, err)
+		}
+		users[user] = hash
+	}
+
+	return users, scanner.Err()
+}
+
+func (rule *ruleSpec) validate() error {
+	if len(rule.Verbs) == 0 {
+		return fmt.Errorf("empty verbs")
+	}
+
+	for _, verb := range rule.Verbs {
+		switch verb {
+		case "*", verbGet, verbCreate, verbUpdate, verbDelete:
+		default:
+			return fmt.Errorf("invalid verb: %s", verb)
+		}
+	}
+
+	for _, pattern := range append(rule.Kinds, rule.Names...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %s: %v", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+func matchPatterns(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if pattern == "*" {
+			return true
+		}
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (rule *ruleSpec) match(verb, kind, name string) bool {
+	return matchPatterns(rule.Verbs, verb) &&
+		matchPatterns(rule.Kinds, kind) &&
+		matchPatterns(rule.Names, name)
+}
+
+// authenticate returns the user of the request.
+func (a *apiAuth) authenticate(r *http.Request) (string, error) {
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" {
+		if a.spec.ClientCertificate && r.TLS != nil &&
+			len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			return r.TLS.VerifiedChains[0][0].Subject.CommonName, nil
+		}
+		return "", fmt.Errorf("no credential")
+	}
+
+	idx := strings.IndexByte(authorization, ' ')
+	if idx < 0 {
+		return "", fmt.Errorf("invalid authorization header")
+	}
+
+	switch scheme := authorization[:idx]; {
+	case strings.EqualFold(scheme, "Bearer"):
+		token := []byte(strings.TrimSpace(authorization[idx+1:]))
+		for _, t := range a.spec.Tokens {
+			if subtle.ConstantTimeCompare([]byte(t.Token), token) == 1 {
+				return t.User, nil
+			}
+		}
+		return "", fmt.Errorf("invalid token")
+
+	case strings.EqualFold(scheme, "Basic") && a.users != nil:
+		user, password, _ := r.BasicAuth()
+		hash, exists := a.users[user]
+		if !exists {
+			return user, fmt.Errorf("unknown user")
+		}
+		if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+			return user, fmt.Errorf("invalid password")
+		}
+		return user, nil
+
+	default:
+		return "", fmt.Errorf("unsupported authorization scheme: %s", scheme)
+	}
+}
+
+// getMemberToken returns the token shared by the members of the cluster,
+// it's created by the first member asking for it.
+func getMemberToken(cls cluster.Cluster) (string, error) {
+	memberTokensMutex.Lock()
+	defer memberTokensMutex.Unlock()
+
+	if token, exists := memberTokens[cls]; exists {
+		return token, nil
+	}
+
+	key := cls.Layout().MemberToken()
+	value, err := cls.Get(key)
+	if err != nil {
+		return "", err
+	}
+
+	if value == nil {
+		mutex, err := cls.Mutex(lockKey)
+		if err != nil {
+			return "", err
+		}
+		if err := mutex.Lock(); err != nil {
+			return "", err
+		}
+		defer mutex.Unlock()
+
+		// NOTE: Another member may have created it.
+		value, err = cls.Get(key)
+		if err != nil {
+			return "", err
+		}
+		if value == nil {
+			buff := make([]byte, 32)
+			if _, err := rand.Read(buff); err != nil {
+				return "", err
+			}
+			token := hex.EncodeToString(buff)
+			if err := cls.Put(key, token); err != nil {
+				return "", err
+			}
+			value = &token
+		}
+	}
+
+	memberTokens[cls] = *value
+	return *value, nil
+}
+
+// authenticateMember returns true if the request carries the member token.
+func (s *Server) authenticateMember(r *http.Request) bool {
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) < 7 || !strings.EqualFold(authorization[:7], "Bearer ") || s.cluster == nil {
+		return false
+	}
+
+	token, err := getMemberToken(s.cluster)
+	if err != nil {
+		logger.Errorf("get member token failed: %v", err)
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(strings.TrimSpace(authorization[7:]))) == 1
+}
+
+// challenge sets the header to tell the client how to authenticate.
+func (a *apiAuth) challenge(w http.ResponseWriter) {
+	if a.users != nil {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", authRealm))
+	} else if len(a.spec.Tokens) != 0 {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q", authRealm))
+	}
+}
+
+func (a *apiAuth) authorize(user, verb, kind, name string) bool {
+	if user == memberUser {
+		return true
+	}
+	for _, rule := range a.rules[user] {
+		if rule.match(verb, kind, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeVerb returns true if the user can do the verb on any object.
+func (a *apiAuth) authorizeVerb(user, verb string) bool {
+	if user == memberUser {
+		return true
+	}
+	for _, rule := range a.rules[user] {
+		if matchPatterns(rule.Verbs, verb) {
+			return true
+		}
+	}
+	return false
+}
+
+func methodVerb(method string) string {
+	switch method {
+	case http.MethodPost:
+		return verbCreate
+	case http.MethodPut, http.MethodPatch:
+		return verbUpdate
+	case http.MethodDelete:
+		return verbDelete
+	default:
+		return verbGet
+	}
+}
+
+func authUser(r *http.Request) (string, bool) {
+	user, ok := r.Context().Value(authUserKey{}).(string)
+	return user, ok
+}
+
+func withAuthUser(r *http.Request, user string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), authUserKey{}, user))
+}
+
+// authorized returns true if the user of the request can do
+// the verb on the object, it's used by the APIs listing objects.
+func (s *Server) authorized(r *http.Request, verb, kind, name string) bool {
+	user, ok := authUser(r)
+	if s.auth == nil || !ok {
+		return true
+	}
+	return s.auth.authorize(user, verb, kind, name)
+}
+
+// readObjectMeta reads the kind and name of the object spec in the body,
+// and the body is kept for the handler.
+func readObjectMeta(r *http.Request) (kind, name string, err error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", "", fmt.Errorf("read body failed: %v", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	meta := struct {
+		Kind string `yaml:"kind"`
+		Name string `yaml:"name"`
+	}{}
+	if err := yaml.Unmarshal(body, &meta); err != nil {
+		return "", "", fmt.Errorf("unmarshal spec failed: %v", err)
+	}
+
+	return meta.Kind, meta.Name, nil
+}
+
+func (s *Server) requestResource(r *http.Request) (*apiResource, error) {
+	pattern := strings.TrimPrefix(chi.RouteContext(r.Context()).RoutePattern(), APIPrefix)
+
+	switch pattern {
+	case ObjectKindsPrefix, ObjectCategoriesPrefix:
+		return &apiResource{list: true}, nil
+
+	case WatchObjectPrefix:
+		// NOTE: The events are filtered by the objects the user could get.
+		return &apiResource{verb: verbGet, list: true}, nil
+
+	case ObjectValidatePath:
+		// NOTE: There may be many objects in the body, and nothing is changed.
+		return &apiResource{verb: verbGet, list: true}, nil
+
+	case ObjectNormalizePath:
+		kind, name, err := readObjectMeta(r)
+		if err != nil {
+			return nil, err
+		}
+		return &apiResource{verb: verbGet, kind: kind, name: name}, nil
+
+	case ObjectPrefix, StatusObjectPrefix:
+		if r.Method != http.MethodPost {
+			return &apiResource{list: true}, nil
+		}
+		kind, name, err := readObjectMeta(r)
+		if err != nil {
+			return nil, err
+		}
+		return &apiResource{kind: kind, name: name}, nil
+
+	case ObjectHistoryPath, ObjectRevisionPath, ObjectRollbackPath:
+		// NOTE: The history is kept after the object deleted,
+		// so the kind falls back to the one of the latest revision.
+		res := &apiResource{name: chi.URLParam(r, "name"), verb: verbGet}
+		spec := s._getObject(res.name)
+		if spec != nil {
+			res.kind = spec.Kind()
+		} else if revs := s._listObjectRevisions(res.name); len(revs) != 0 {
+			res.kind = revs[len(revs)-1].Kind
+		}
+		if pattern == ObjectRollbackPath {
+			res.verb = verbUpdate
+			if spec == nil {
+				res.verb = verbCreate
+			}
+		}
+		return res, nil
+
+	case LoggingDebugPath:
+		// NOTE: Debugging an object is treated as updating it.
+		res := &apiResource{name: chi.URLParam(r, "name"), verb: verbUpdate}
+		if spec := s._getObject(res.name); spec != nil {
+			res.kind = spec.Kind()
+		}
+		return res, nil
+
+	case ObjectPrefix + "/{name}", StatusObjectPrefix + "/{name}":
+		res := &apiResource{name: chi.URLParam(r, "name")}
+		if spec := s._getObject(res.name); spec != nil {
+			res.kind = spec.Kind()
+		} else if r.Method == http.MethodPut {
+			kind, _, err := readObjectMeta(r)
+			if err != nil {
+				return nil, err
+			}
+			res.kind = kind
+		}
+		return res, nil
+	}
+
+	// The APIs about filters, such as the ones of WasmHost and HTTPCache,
+	// are treated as the ones of the pipeline.
+	if pipeline := chi.URLParam(r, "pipeline"); pipeline != "" {
+		return &apiResource{kind: httppipeline.Kind, name: pipeline}, nil
+	}
+
+	return &apiResource{}, nil
+}
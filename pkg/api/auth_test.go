@@ -0,0 +1,251 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+const testAuthSpec = `
+tokens:
+- user: ci
+  token: ci-token
+basicAuthUserFile: %s
+clientCertificate: true
+roles:
+- name: admin
+  rules:
+  - verbs: ["*"]
+- name: pipeline-editor
+  rules:
+  - verbs: [get, create, update]
+    kinds: [HTTPPipeline]
+    names: ["demo-*"]
+roleBindings:
+- role: admin
+  users: [root]
+- role: pipeline-editor
+  users: [ci, alice]
+`
+
+func newTestAPIAuth(t *testing.T) *apiAuth {
+	dir := t.TempDir()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("alice-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userFile := filepath.Join(dir, "users")
+	content := fmt.Sprintf("# users\nalice:%s\n", hash)
+	if err := os.WriteFile(userFile, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	authFile := filepath.Join(dir, "auth.yaml")
+	if err := os.WriteFile(authFile, []byte(fmt.Sprintf(testAuthSpec, userFile)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := newAPIAuth(authFile)
+	if err != nil {
+		t.Fatalf("load auth file failed: %v", err)
+	}
+	return a
+}
+
+func TestNewAPIAuth(t *testing.T) {
+	a, err := newAPIAuth("")
+	if a != nil || err != nil {
+		t.Errorf("auth should be disabled without auth file")
+	}
+
+	dir := t.TempDir()
+	for _, spec := range []string{
+		"roles: []",
+		"tokens: [{user: ci}]",
+		"tokens: [{user: ci, token: x}]\nroleBindings: [{role: admin, users: [ci]}]",
+		"tokens: [{user: ci, token: x}]\nroles: [{name: admin, rules: [{verbs: [list]}]}]",
+		"tokens: [{user: ci, token: x}]\nunknownField: true",
+		"tokens: [{user: \"easegress:member\", token: x}]",
+	} {
+		authFile := filepath.Join(dir, "auth.yaml")
+		os.WriteFile(authFile, []byte(spec), 0o600)
+		if _, err := newAPIAuth(authFile); err == nil {
+			t.Errorf("auth spec should be invalid:\n%s", spec)
+		}
+	}
+
+	newTestAPIAuth(t)
+}
+
+func TestAuthenticate(t *testing.T) {
+	a := newTestAPIAuth(t)
+
+	newRequest := func(authorization string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/apis/v1/objects", nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		return r
+	}
+
+	r := newRequest("Bearer ci-token")
+	if user, err := a.authenticate(r); err != nil || user != "ci" {
+		t.Errorf("token should be authenticated as ci, got %s: %v", user, err)
+	}
+
+	r = newRequest("Bearer wrong-token")
+	if _, err := a.authenticate(r); err == nil {
+		t.Errorf("wrong token should be rejected")
+	}
+
+	r = newRequest("")
+	r.SetBasicAuth("alice", "alice-password")
+	if user, err := a.authenticate(r); err != nil || user != "alice" {
+		t.Errorf("basic auth should be authenticated as alice, got %s: %v", user, err)
+	}
+
+	r = newRequest("")
+	r.SetBasicAuth("alice", "wrong-password")
+	if _, err := a.authenticate(r); err == nil {
+		t.Errorf("wrong password should be rejected")
+	}
+
+	r = newRequest("")
+	if _, err := a.authenticate(r); err == nil {
+		t.Errorf("request without credential should be rejected")
+	}
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "root"}}
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	if user, err := a.authenticate(r); err != nil || user != "root" {
+		t.Errorf("client certificate should be authenticated as root, got %s: %v", user, err)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	a := newTestAPIAuth(t)
+
+	cases := []struct {
+		user, verb, kind, name string
+		allowed                bool
+	}{
+		{"root", verbDelete, "HTTPServer", "server", true},
+		{"root", verbDelete, "", "", true},
+		{"ci", verbUpdate, "HTTPPipeline", "demo-pipeline", true},
+		{"ci", verbDelete, "HTTPPipeline", "demo-pipeline", false},
+		{"ci", verbGet, "HTTPPipeline", "prod-pipeline", false},
+		{"ci", verbGet, "HTTPServer", "demo-server", false},
+		{"ci", verbGet, "", "", false},
+		{"bob", verbGet, "HTTPPipeline", "demo-pipeline", false},
+	}
+
+	for _, c := range cases {
+		if a.authorize(c.user, c.verb, c.kind, c.name) != c.allowed {
+			t.Errorf("%s %s %s/%s: expected allowed %v", c.user, c.verb, c.kind, c.name, c.allowed)
+		}
+	}
+
+	if !a.authorizeVerb("ci", verbGet) || a.authorizeVerb("ci", verbDelete) {
+		t.Errorf("ci should only be able to get, create and update objects")
+	}
+}
+
+func TestAuthMiddlewares(t *testing.T) {
+	cls := clustertest.New(map[string]string{"/config/member-token": "member-token"})
+	m := &dynamicMux{server: &Server{auth: newTestAPIAuth(t), cluster: cls}}
+
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	router := chi.NewMux()
+	router.Use(m.newAuthenticator)
+	apiRouter := router.With(m.newAuthorizer)
+	apiRouter.Get(APIPrefix+HealthzPath, handler)
+	apiRouter.Get(APIPrefix+"/status/members", handler)
+	apiRouter.Post(APIPrefix+ObjectPrefix, handler)
+	apiRouter.Delete(APIPrefix+"/httpcache/{pipeline}/{filter}", handler)
+
+	cases := []struct {
+		method, path, body, token string
+		code                      int
+	}{
+		{http.MethodGet, "/healthz", "", "", http.StatusOK},
+		{http.MethodGet, "/status/members", "", "", http.StatusUnauthorized},
+		{http.MethodGet, "/status/members", "", "ci-token", http.StatusForbidden},
+		{http.MethodPost, ObjectPrefix, "kind: HTTPPipeline\nname: demo-pipeline", "ci-token", http.StatusOK},
+		{http.MethodPost, ObjectPrefix, "kind: HTTPPipeline\nname: prod-pipeline", "ci-token", http.StatusForbidden},
+		{http.MethodDelete, "/httpcache/demo-pipeline/cache", "", "ci-token", http.StatusForbidden},
+		{http.MethodGet, "/status/members", "", "member-token", http.StatusOK},
+		{http.MethodPost, ObjectPrefix, "kind: HTTPPipeline\nname: prod-pipeline", "member-token", http.StatusOK},
+		{http.MethodDelete, "/httpcache/demo-pipeline/cache", "", "member-token", http.StatusOK},
+		{http.MethodGet, "/status/members", "", "wrong-member-token", http.StatusUnauthorized},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, APIPrefix+c.path, strings.NewReader(c.body))
+		if c.token != "" {
+			r.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		if w.Code != c.code {
+			t.Errorf("%s %s: expected code %d, got %d: %s", c.method, c.path, c.code, w.Code, w.Body)
+		}
+	}
+}
+
+func TestGetMemberToken(t *testing.T) {
+	cls := clustertest.New(nil)
+
+	token, err := getMemberToken(cls)
+	if err != nil || len(token) != 64 {
+		t.Fatalf("unexpected token %q: %v", token, err)
+	}
+	if cls.KVs()[cls.Layout().MemberToken()] != token {
+		t.Errorf("token is not stored in the cluster")
+	}
+
+	if token2, err := getMemberToken(cls); err != nil || token2 != token {
+		t.Errorf("token changed from %q to %q: %v", token, token2, err)
+	}
+
+	// Another member of the cluster gets the same token.
+	other := clustertest.New(cls.KVs())
+	if token2, err := getMemberToken(other); err != nil || token2 != token {
+		t.Errorf("expected the shared token %q, got %q: %v", token, token2, err)
+	}
+}
@@ -83,6 +83,41 @@ func (s *Server) _getObject(name string) *supervisor.Spec {
 	return spec
 }
 
+func (s *Server) isFilterExist(pipeline, filter, kind string) bool {
+	spec := s._getObject(pipeline)
+	if spec == nil {
+		return false
+	}
+
+	rawSpec := spec.RawSpec()
+	var filters []interface{}
+	if f := rawSpec["filters"]; f != nil {
+		filters, _ = f.([]interface{})
+	}
+	if filters == nil {
+		return false
+	}
+
+	for i := range filters {
+		f, _ := filters[i].(map[interface{}]interface{})
+		if f == nil {
+			continue
+		}
+
+		if n := f["name"]; n == nil || n != filter {
+			continue
+		}
+
+		if k := f["kind"]; k == nil || k != kind {
+			continue
+		}
+
+		return true
+	}
+
+	return false
+}
+
 func (s *Server) _listObjects() []*supervisor.Spec {
 	kvs, err := s.cluster.GetPrefix(s.cluster.Layout().ConfigObjectPrefix())
 	if err != nil {
@@ -101,16 +136,24 @@ func (s *Server) _listObjects() []*supervisor.Spec {
 	return specs
 }
 
-func (s *Server) _putObject(spec *supervisor.Spec) {
-	err := s.cluster.Put(s.cluster.Layout().ConfigObjectKey(spec.Name()),
-		spec.YAMLConfig())
+// _putObject puts the object along with the revision in its history.
+func (s *Server) _putObject(spec *supervisor.Spec, rev *objectRevision) {
+	kvs := s._revisionKVs(spec.Name(), rev)
+	value := spec.YAMLConfig()
+	kvs[s.cluster.Layout().ConfigObjectKey(spec.Name())] = &value
+
+	err := s.cluster.PutAndDelete(kvs)
 	if err != nil {
 		ClusterPanic(err)
 	}
 }
 
-func (s *Server) _deleteObject(name string) {
-	err := s.cluster.Delete(s.cluster.Layout().ConfigObjectKey(name))
+// _deleteObject deletes the object, and records the deletion in its history.
+func (s *Server) _deleteObject(name string, rev *objectRevision) {
+	kvs := s._revisionKVs(name, rev)
+	kvs[s.cluster.Layout().ConfigObjectKey(name)] = nil
+
+	err := s.cluster.PutAndDelete(kvs)
 	if err != nil {
 		ClusterPanic(err)
 	}
@@ -26,20 +26,27 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/prometheushelper"
 )
 
+// MetricsPath is the path of Prometheus metrics, it is not under APIPrefix
+// because it is the default path of Prometheus scraping.
+const MetricsPath = "/metrics"
+
 type (
 	dynamicMux struct {
-		server *Server
-		done   chan struct{}
-		router atomic.Value
+		server  *Server
+		done    chan struct{}
+		router  atomic.Value
+		metrics http.Handler
 	}
 )
 
 func newDynamicMux(server *Server) *dynamicMux {
 	m := &dynamicMux{
-		server: server,
-		done:   make(chan struct{}),
+		server:  server,
+		done:    make(chan struct{}),
+		metrics: prometheushelper.Handler(server.opt.Name),
 	}
 
 	m.router.Store(chi.NewRouter())
@@ -80,6 +87,12 @@ func (m *dynamicMux) reloadAPIs() {
 	router.Use(m.newAPILogger)
 	router.Use(m.newConfigVersionAttacher)
 	router.Use(m.newRecoverer)
+	router.Use(m.newAuthenticator)
+
+	// NOTE: The authorizer is used after routing, so it can get URL parameters.
+	apiRouter := router.With(m.newAuthorizer)
+
+	apiRouter.Method(http.MethodGet, MetricsPath, m.metrics)
 
 	for _, apiGroup := range apiGroups {
 		for _, api := range apiGroup.Entries {
@@ -87,23 +100,23 @@ func (m *dynamicMux) reloadAPIs() {
 
 			switch api.Method {
 			case "GET":
-				router.Get(path, api.Handler)
+				apiRouter.Get(path, api.Handler)
 			case "HEAD":
-				router.Head(path, api.Handler)
+				apiRouter.Head(path, api.Handler)
 			case "PUT":
-				router.Put(path, api.Handler)
+				apiRouter.Put(path, api.Handler)
 			case "POST":
-				router.Post(path, api.Handler)
+				apiRouter.Post(path, api.Handler)
 			case "PATCH":
-				router.Patch(path, api.Handler)
+				apiRouter.Patch(path, api.Handler)
 			case "DELETE":
-				router.Delete(path, api.Handler)
+				apiRouter.Delete(path, api.Handler)
 			case "CONNECT":
-				router.Connect(path, api.Handler)
+				apiRouter.Connect(path, api.Handler)
 			case "OPTIONS":
-				router.Options(path, api.Handler)
+				apiRouter.Options(path, api.Handler)
 			case "TRACE":
-				router.Trace(path, api.Handler)
+				apiRouter.Trace(path, api.Handler)
 			default:
 				logger.Errorf("BUG: group %s unsupported method: %s",
 					apiGroup.Group, api.Method)
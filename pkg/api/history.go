@@ -0,0 +1,274 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// ObjectHistoryPath is the path of the revision history of an object.
+	ObjectHistoryPath = ObjectPrefix + "/{name}/history"
+
+	// ObjectRevisionPath is the path of a revision of an object.
+	ObjectRevisionPath = ObjectHistoryPath + "/{revision}"
+
+	// ObjectRollbackPath is the path to roll back an object.
+	ObjectRollbackPath = ObjectPrefix + "/{name}/rollback"
+
+	revisionCreate   = "create"
+	revisionUpdate   = "update"
+	revisionDelete   = "delete"
+	revisionRollback = "rollback"
+)
+
+type (
+	// objectRevision is a revision in the history of an object,
+	// the spec is empty if the object was deleted in the revision.
+	objectRevision struct {
+		Revision   int64  `yaml:"revision"`
+		Operation  string `yaml:"operation"`
+		Kind       string `yaml:"kind"`
+		User       string `yaml:"user,omitempty"`
+		RemoteAddr string `yaml:"remoteAddr"`
+		Time       string `yaml:"time"`
+		// RollbackFrom is the revision rolled back from.
+		RollbackFrom int64  `yaml:"rollbackFrom,omitempty"`
+		Spec         string `yaml:"spec,omitempty"`
+	}
+
+	revisionList []*objectRevision
+)
+
+func (l revisionList) Less(i, j int) bool { return l[i].Revision < l[j].Revision }
+func (l revisionList) Len() int           { return len(l) }
+func (l revisionList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+func (s *Server) objectHistoryAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    ObjectHistoryPath,
+			Method:  "GET",
+			Handler: s.listObjectRevisions,
+		},
+		{
+			Path:    ObjectRevisionPath,
+			Method:  "GET",
+			Handler: s.getObjectRevision,
+		},
+		{
+			Path:    ObjectRollbackPath,
+			Method:  "POST",
+			Handler: s.rollbackObject,
+		},
+	}
+}
+
+func newObjectRevision(r *http.Request, operation, kind string, spec *supervisor.Spec) *objectRevision {
+	rev := &objectRevision{
+		Operation:  operation,
+		Kind:       kind,
+		RemoteAddr: r.RemoteAddr,
+		Time:       time.Now().Format(time.RFC3339),
+	}
+	if user, ok := authUser(r); ok {
+		rev.User = user
+	}
+	if spec != nil {
+		rev.Spec = spec.YAMLConfig()
+	}
+
+	return rev
+}
+
+// _listObjectRevisions returns the revisions of the object in ascending order.
+func (s *Server) _listObjectRevisions(name string) revisionList {
+	kvs, err := s.cluster.GetPrefix(s.cluster.Layout().ConfigHistoryPrefix(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	revs := make(revisionList, 0, len(kvs))
+	for _, v := range kvs {
+		rev := &objectRevision{}
+		err := yaml.Unmarshal([]byte(v), rev)
+		if err != nil {
+			panic(fmt.Errorf("unmarshal %s to yaml failed: %v", v, err))
+		}
+		revs = append(revs, rev)
+	}
+	sort.Sort(revs)
+
+	return revs
+}
+
+// _revisionKVs assigns the next revision number to rev, and returns the
+// kvs to put it and delete the oldest revisions beyond the limit.
+func (s *Server) _revisionKVs(name string, rev *objectRevision) map[string]*string {
+	kvs := map[string]*string{}
+
+	limit := s.opt.ObjectHistoryLimit
+	if limit == 0 {
+		return kvs
+	}
+
+	layout := s.cluster.Layout()
+	revs := s._listObjectRevisions(name)
+
+	rev.Revision = 1
+	if len(revs) != 0 {
+		rev.Revision = revs[len(revs)-1].Revision + 1
+	}
+	buff, err := yaml.Marshal(rev)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", rev, err))
+	}
+	value := string(buff)
+	kvs[layout.ConfigHistoryKey(name, rev.Revision)] = &value
+
+	for i := 0; i < len(revs)+1-limit; i++ {
+		kvs[layout.ConfigHistoryKey(name, revs[i].Revision)] = nil
+	}
+
+	return kvs
+}
+
+func (s *Server) listObjectRevisions(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	revs := s._listObjectRevisions(name)
+	if len(revs) == 0 {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	// NOTE: The specs are omitted in the list, get the revision to see it.
+	for _, rev := range revs {
+		rev.Spec = ""
+	}
+
+	buff, err := yaml.Marshal(revs)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", revs, err))
+	}
+
+	w.Header().Set("Content-Type", "text/vnd.yaml")
+
+	w.Write(buff)
+}
+
+func (s *Server) _getObjectRevision(name string, revision string) (*objectRevision, error) {
+	number, err := strconv.ParseInt(revision, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid revision %s", revision)
+	}
+
+	value, err := s.cluster.Get(s.cluster.Layout().ConfigHistoryKey(name, number))
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	rev := &objectRevision{}
+	err = yaml.Unmarshal([]byte(*value), rev)
+	if err != nil {
+		panic(fmt.Errorf("unmarshal %s to yaml failed: %v", *value, err))
+	}
+
+	return rev, nil
+}
+
+func (s *Server) getObjectRevision(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	rev, err := s._getObjectRevision(name, chi.URLParam(r, "revision"))
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if rev == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	buff, err := yaml.Marshal(rev)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", rev, err))
+	}
+
+	w.Header().Set("Content-Type", "text/vnd.yaml")
+
+	w.Write(buff)
+}
+
+// rollbackObject creates or updates the object with the spec of a previous
+// revision, the spec is validated again since the objects may have changed.
+func (s *Server) rollbackObject(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	s.Lock()
+	defer s.Unlock()
+
+	rev, err := s._getObjectRevision(name, r.URL.Query().Get("revision"))
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if rev == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	if rev.Spec == "" {
+		HandleAPIError(w, r, http.StatusBadRequest,
+			fmt.Errorf("revision %d deleted the object", rev.Revision))
+		return
+	}
+
+	spec, err := s.super.NewSpec(rev.Spec)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	existedSpec := s._getObject(name)
+	if existedSpec != nil && existedSpec.Kind() != spec.Kind() {
+		HandleAPIError(w, r, http.StatusBadRequest,
+			fmt.Errorf("different kinds: %s, %s",
+				existedSpec.Kind(), spec.Kind()))
+		return
+	}
+
+	newRev := newObjectRevision(r, revisionRollback, spec.Kind(), spec)
+	newRev.RollbackFrom = rev.Revision
+	s._putObject(spec, newRev)
+	s.upgradeConfigVersion(w, r)
+
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "%s rolled back to revision %d\n", name, rev.Revision)
+}
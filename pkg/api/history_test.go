@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+func TestObjectHistory(t *testing.T) {
+	s := &Server{
+		opt:     &option.Options{ObjectHistoryLimit: 3},
+		cluster: clustertest.New(nil),
+	}
+	router := chi.NewMux()
+	for _, entry := range append(s.objectAPIEntries(), s.objectHistoryAPIEntries()...) {
+		router.Method(entry.Method, APIPrefix+entry.Path, entry.Handler)
+	}
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, APIPrefix+path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	pipeline := func(ttl string) string {
+		return `
+kind: HTTPPipeline
+name: demo
+filters:
+- kind: HTTPCache
+  name: cache
+  maxBytes: 1024
+  maxEntryBytes: 1024
+  methods: [GET]
+  codes: [200]
+  defaultTTL: ` + ttl
+	}
+	revisions := func() revisionList {
+		w := request(http.MethodGet, "/objects/demo/history", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("list history failed: %d: %s", w.Code, w.Body)
+		}
+		revs := revisionList{}
+		yaml.Unmarshal(w.Body.Bytes(), &revs)
+		return revs
+	}
+
+	if w := request(http.MethodGet, "/objects/demo/history", ""); w.Code != http.StatusNotFound {
+		t.Errorf("history of unknown object should not be found, got %d", w.Code)
+	}
+
+	if w := request(http.MethodPost, "/objects", pipeline("1s")); w.Code != http.StatusCreated {
+		t.Fatalf("create object failed: %d: %s", w.Code, w.Body)
+	}
+	request(http.MethodPut, "/objects/demo", pipeline("2s"))
+	request(http.MethodPut, "/objects/demo", pipeline("3s"))
+	request(http.MethodDelete, "/objects/demo", "")
+
+	revs := revisions()
+	if len(revs) != 3 || revs[0].Revision != 2 || revs[2].Revision != 4 {
+		t.Fatalf("expected revision 2 to 4 in history, got %+v", revs)
+	}
+	if revs[2].Operation != revisionDelete || revs[2].Kind != "HTTPPipeline" || revs[0].Spec != "" {
+		t.Errorf("unexpected history %+v", revs)
+	}
+
+	w := request(http.MethodGet, "/objects/demo/history/3", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "defaultTTL: 3s") {
+		t.Errorf("revision 3 should have the spec, got %d: %s", w.Code, w.Body)
+	}
+	if w := request(http.MethodGet, "/objects/demo/history/1", ""); w.Code != http.StatusNotFound {
+		t.Errorf("revision 1 should be deleted, got %d", w.Code)
+	}
+
+	if w := request(http.MethodPost, "/objects/demo/rollback?revision=4", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("rollback to deletion should fail, got %d", w.Code)
+	}
+	if w := request(http.MethodPost, "/objects/demo/rollback?revision=2", ""); w.Code != http.StatusOK {
+		t.Fatalf("rollback failed: %d: %s", w.Code, w.Body)
+	}
+
+	w = request(http.MethodGet, "/objects/demo", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "defaultTTL: 2s") {
+		t.Errorf("object should be rolled back to revision 2, got %d: %s", w.Code, w.Body)
+	}
+	revs = revisions()
+	last := revs[len(revs)-1]
+	if last.Revision != 5 || last.Operation != revisionRollback || last.RollbackFrom != 2 {
+		t.Errorf("unexpected rollback revision %+v", last)
+	}
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/filter/httpcache"
+)
+
+// httpCachePurgeEventTTL is how long purge events are kept in the cluster,
+// members which are offline longer than it don't need them anymore.
+const httpCachePurgeEventTTL = 10 * time.Minute
+
+func (s *Server) httpCachePurge(w http.ResponseWriter, r *http.Request) {
+	pipeline := chi.URLParam(r, "pipeline")
+	filter := chi.URLParam(r, "filter")
+	if !s.isFilterExist(pipeline, filter, httpcache.Kind) {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	query := r.URL.Query()
+	event := &httpcache.PurgeEvent{
+		Key:    query.Get("key"),
+		Prefix: query.Get("prefix"),
+		Time:   time.Now(),
+	}
+	if event.Key != "" && event.Prefix != "" {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("key and prefix are mutually exclusive"))
+		return
+	}
+
+	buf, err := yaml.Marshal(event)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", event, err))
+	}
+
+	c := s.cluster
+	prefix := c.Layout().HTTPCachePurgePrefix(pipeline, filter)
+	events, err := c.GetPrefix(prefix)
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	value := string(buf)
+	kvs := map[string]*string{
+		c.Layout().HTTPCachePurgeKey(pipeline, filter, event.Time.UnixNano()): &value,
+	}
+	for k := range events {
+		unixNano, err := strconv.ParseInt(k[len(prefix):], 10, 64)
+		if err != nil || event.Time.Sub(time.Unix(0, unixNano)) > httpCachePurgeEventTTL {
+			kvs[k] = nil
+		}
+	}
+
+	if err = c.PutAndDelete(kvs); err != nil {
+		ClusterPanic(err)
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "httpcache purge event posted at: %s\n", event.Time.Format(time.RFC3339Nano))
+}
+
+func appendHTTPCacheAPI(s *Server, group *Group) {
+	entry := &Entry{
+		Path:    "/httpcache/{pipeline}/{filter}",
+		Method:  http.MethodDelete,
+		Handler: s.httpCachePurge,
+	}
+	group.Entries = append(group.Entries, entry)
+}
+
+func init() {
+	appendAddonAPIs = append(appendAddonAPIs, appendHTTPCacheAPI)
+}
@@ -0,0 +1,403 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	// LoggingPrefix is the prefix of logging APIs.
+	LoggingPrefix = "/logging"
+
+	// LoggingLevelPath is the path of the runtime log level.
+	LoggingLevelPath = LoggingPrefix + "/level"
+
+	// LoggingDebugPath is the path of debugging an object.
+	LoggingDebugPath = LoggingPrefix + "/debugs/{name}"
+
+	// defaultDebugTTL is the default time to debug an object.
+	defaultDebugTTL = 10 * time.Minute
+
+	// loggingSyncInterval is the interval to pull the logging
+	// config in case of missing any change.
+	loggingSyncInterval = time.Minute
+)
+
+type (
+	// loggingConfig is the runtime logging config shared by all members.
+	loggingConfig struct {
+		// Level is empty if every member uses the level at startup.
+		Level         string                `yaml:"level,omitempty"`
+		LevelExpireAt *time.Time            `yaml:"levelExpireAt,omitempty"`
+		Debugs        []*logger.DebugTarget `yaml:"debugs,omitempty"`
+	}
+
+	// loggingStatus is the logging config along with the level
+	// in effect of the member serving the request.
+	loggingStatus struct {
+		loggingConfig `yaml:",inline"`
+
+		Member      string `yaml:"member"`
+		MemberLevel string `yaml:"memberLevel"`
+	}
+
+	levelRequest struct {
+		Level string `yaml:"level"`
+		// TTL is the time before reverting to the level at startup,
+		// empty means never.
+		TTL string `yaml:"ttl"`
+	}
+
+	debugRequest struct {
+		Filter string `yaml:"filter"`
+		Dump   bool   `yaml:"dump"`
+		TTL    string `yaml:"ttl"`
+	}
+)
+
+func (s *Server) loggingAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    LoggingPrefix,
+			Method:  http.MethodGet,
+			Handler: s.getLogging,
+		},
+		{
+			Path:    LoggingLevelPath,
+			Method:  http.MethodPut,
+			Handler: s.setLoggingLevel,
+		},
+		{
+			Path:    LoggingLevelPath,
+			Method:  http.MethodDelete,
+			Handler: s.resetLoggingLevel,
+		},
+		{
+			Path:    LoggingDebugPath,
+			Method:  http.MethodPut,
+			Handler: s.setObjectDebug,
+		},
+		{
+			Path:    LoggingDebugPath,
+			Method:  http.MethodDelete,
+			Handler: s.deleteObjectDebug,
+		},
+	}
+}
+
+// activate removes the expired items of the config, and returns
+// the time to the expiration of the level, zero means never.
+func (c *loggingConfig) activate(now time.Time) time.Duration {
+	var ttl time.Duration
+	if c.LevelExpireAt != nil {
+		ttl = c.LevelExpireAt.Sub(now)
+		if ttl <= 0 {
+			c.Level, c.LevelExpireAt, ttl = "", nil, 0
+		}
+	}
+
+	debugs := []*logger.DebugTarget{}
+	for _, t := range c.Debugs {
+		if now.Before(t.ExpireAt) {
+			debugs = append(debugs, t)
+		}
+	}
+	c.Debugs = debugs
+
+	return ttl
+}
+
+// apply applies the config to the logger of the member.
+func (c *loggingConfig) apply() {
+	level := logger.DefaultLevel()
+	if c.Level != "" {
+		l, err := logger.ParseLevel(c.Level)
+		if err != nil {
+			logger.Errorf("BUG: invalid log level %s: %v", c.Level, err)
+		} else {
+			level = l
+		}
+	}
+
+	if level != logger.Level() {
+		logger.Infof("log level changed from %s to %s", logger.Level().CapitalString(), level.CapitalString())
+		logger.SetLevel(level)
+	}
+	logger.SetDebugTargets(c.Debugs)
+}
+
+// syncLogging applies the logging config in the cluster to
+// the member, and reverts the level after it expires.
+func (s *Server) syncLogging() {
+	syncer, err := s.cluster.Syncer(loggingSyncInterval)
+	if err != nil {
+		logger.Errorf("get cluster syncer failed: %v", err)
+		return
+	}
+	defer syncer.Close()
+
+	ch, err := syncer.Sync(s.cluster.Layout().LoggingConfig())
+	if err != nil {
+		logger.Errorf("sync logging config failed: %v", err)
+		return
+	}
+
+	config := &loggingConfig{}
+	var timer *time.Timer
+	var expired <-chan time.Time
+	for {
+		select {
+		case <-s.done:
+			return
+		case value, ok := <-ch:
+			if !ok {
+				return
+			}
+			config = &loggingConfig{}
+			if value != nil {
+				if err := yaml.Unmarshal([]byte(*value), config); err != nil {
+					logger.Errorf("unmarshal logging config failed: %v", err)
+					continue
+				}
+			}
+		case <-expired:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+		timer, expired = nil, nil
+		if ttl := config.activate(time.Now()); ttl > 0 {
+			timer = time.NewTimer(ttl)
+			expired = timer.C
+		}
+		config.apply()
+	}
+}
+
+func (s *Server) _getLoggingConfig() *loggingConfig {
+	value, err := s.cluster.Get(s.cluster.Layout().LoggingConfig())
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	config := &loggingConfig{}
+	if value == nil {
+		return config
+	}
+
+	err = yaml.Unmarshal([]byte(*value), config)
+	if err != nil {
+		panic(fmt.Errorf("unmarshal %s to yaml failed: %v", *value, err))
+	}
+	config.activate(time.Now())
+
+	return config
+}
+
+func (s *Server) _putLoggingConfig(config *loggingConfig) {
+	buff, err := yaml.Marshal(config)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", config, err))
+	}
+
+	err = s.cluster.Put(s.cluster.Layout().LoggingConfig(), string(buff))
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func parseTTL(s string, defaultTTL time.Duration) (time.Duration, error) {
+	if s == "" {
+		return defaultTTL, nil
+	}
+
+	ttl, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ttl %s: %v", s, err)
+	}
+	if ttl <= 0 {
+		return 0, fmt.Errorf("invalid ttl %s: must be positive", s)
+	}
+
+	return ttl, nil
+}
+
+func readYAMLBody(r *http.Request, v interface{}) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("read body failed: %v", err)
+	}
+
+	err = yaml.Unmarshal(body, v)
+	if err != nil {
+		return fmt.Errorf("unmarshal body failed: %v", err)
+	}
+
+	return nil
+}
+
+func (s *Server) getLogging(w http.ResponseWriter, r *http.Request) {
+	status := &loggingStatus{
+		loggingConfig: *s._getLoggingConfig(),
+		Member:        s.opt.Name,
+		MemberLevel:   logger.Level().CapitalString(),
+	}
+
+	buff, err := yaml.Marshal(status)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", status, err))
+	}
+
+	w.Header().Set("Content-Type", "text/vnd.yaml")
+	w.Write(buff)
+}
+
+func (s *Server) setLoggingLevel(w http.ResponseWriter, r *http.Request) {
+	req := &levelRequest{}
+	if err := readYAMLBody(r, req); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if _, err := logger.ParseLevel(req.Level); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	ttl, err := parseTTL(req.TTL, 0)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	config := s._getLoggingConfig()
+	config.Level, config.LevelExpireAt = req.Level, nil
+	if ttl > 0 {
+		expireAt := time.Now().Add(ttl)
+		config.LevelExpireAt = &expireAt
+	}
+	s._putLoggingConfig(config)
+
+	w.Header().Set("Content-Type", "text/plain")
+	if ttl > 0 {
+		fmt.Fprintf(w, "log level changed to %s until %s\n", req.Level, config.LevelExpireAt.Format(time.RFC3339))
+	} else {
+		fmt.Fprintf(w, "log level changed to %s\n", req.Level)
+	}
+}
+
+func (s *Server) resetLoggingLevel(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	config := s._getLoggingConfig()
+	config.Level, config.LevelExpireAt = "", nil
+	s._putLoggingConfig(config)
+
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "log level reset to the one at startup\n")
+}
+
+func (s *Server) setObjectDebug(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	req := &debugRequest{}
+	if err := readYAMLBody(r, req); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	ttl, err := parseTTL(req.TTL, defaultDebugTTL)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	value, err := s.cluster.Get(s.cluster.Layout().ConfigObjectKey(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if value == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	target := &logger.DebugTarget{
+		Object:   name,
+		Filter:   req.Filter,
+		Dump:     req.Dump,
+		ExpireAt: time.Now().Add(ttl),
+	}
+
+	// NOTE: The target of the same object and filter is replaced.
+	config := s._getLoggingConfig()
+	debugs := []*logger.DebugTarget{target}
+	for _, t := range config.Debugs {
+		if t.Object != target.Object || t.Filter != target.Filter {
+			debugs = append(debugs, t)
+		}
+	}
+	config.Debugs = debugs
+	s._putLoggingConfig(config)
+
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "debugging %s until %s\n", debugTargetName(target), target.ExpireAt.Format(time.RFC3339))
+}
+
+func (s *Server) deleteObjectDebug(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	// NOTE: The targets of all filters are deleted if the filter is absent.
+	filter, filterOnly := r.URL.Query()["filter"]
+
+	s.Lock()
+	defer s.Unlock()
+
+	config := s._getLoggingConfig()
+	debugs := []*logger.DebugTarget{}
+	for _, t := range config.Debugs {
+		if t.Object != name || filterOnly && t.Filter != filter[0] {
+			debugs = append(debugs, t)
+		}
+	}
+	if len(debugs) == len(config.Debugs) {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	config.Debugs = debugs
+	s._putLoggingConfig(config)
+}
+
+func debugTargetName(t *logger.DebugTarget) string {
+	if t.Filter == "" {
+		return t.Object
+	}
+	return t.Object + "/" + t.Filter
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+func TestLoggingAPIs(t *testing.T) {
+	s := &Server{
+		opt: &option.Options{Name: "member-1"},
+		cluster: clustertest.New(map[string]string{
+			"/config/objects/demo": "kind: HTTPPipeline\nname: demo\n",
+		}),
+	}
+	router := chi.NewMux()
+	for _, entry := range s.loggingAPIEntries() {
+		router.Method(entry.Method, APIPrefix+entry.Path, entry.Handler)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, APIPrefix+path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	get := func() *loggingStatus {
+		w := do(http.MethodGet, LoggingPrefix, "")
+		status := &loggingStatus{}
+		if err := yaml.Unmarshal(w.Body.Bytes(), status); err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+
+	if w := do(http.MethodPut, LoggingLevelPath, "level: TRACE"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid level should be rejected: %d", w.Code)
+	}
+	if w := do(http.MethodPut, LoggingLevelPath, "level: DEBUG\nttl: 1h"); w.Code != http.StatusOK {
+		t.Fatalf("set level failed: %d: %s", w.Code, w.Body)
+	}
+	status := get()
+	if status.Level != "DEBUG" || status.LevelExpireAt == nil || status.Member != "member-1" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+
+	if w := do(http.MethodPut, "/logging/debugs/unknown", "dump: true"); w.Code != http.StatusNotFound {
+		t.Errorf("debugging unknown object should be not found: %d", w.Code)
+	}
+	do(http.MethodPut, "/logging/debugs/demo", "dump: true")
+	do(http.MethodPut, "/logging/debugs/demo", "filter: proxy\nttl: 1m")
+	do(http.MethodPut, "/logging/debugs/demo", "filter: proxy\nttl: 2m")
+	status = get()
+	if len(status.Debugs) != 2 {
+		t.Fatalf("expected 2 debug targets, got %d", len(status.Debugs))
+	}
+	if d := status.Debugs[0]; d.Filter != "proxy" || time.Until(d.ExpireAt) < time.Minute {
+		t.Errorf("the target of the same filter should be replaced: %+v", d)
+	}
+
+	if w := do(http.MethodDelete, "/logging/debugs/demo?filter=", ""); w.Code != http.StatusOK {
+		t.Errorf("delete debug target failed: %d", w.Code)
+	}
+	if status = get(); len(status.Debugs) != 1 || status.Debugs[0].Filter != "proxy" {
+		t.Errorf("only the target of the whole object should be deleted: %+v", status.Debugs)
+	}
+	do(http.MethodDelete, "/logging/debugs/demo", "")
+	if w := do(http.MethodDelete, "/logging/debugs/demo", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected not found: %d", w.Code)
+	}
+
+	do(http.MethodDelete, LoggingLevelPath, "")
+	if status = get(); status.Level != "" || status.LevelExpireAt != nil {
+		t.Errorf("level should be reset: %+v", status)
+	}
+}
+
+func TestLoggingConfigApply(t *testing.T) {
+	defer logger.SetLevel(logger.DefaultLevel())
+	defer logger.SetDebugTargets(nil)
+
+	now := time.Now()
+	expireAt := now.Add(time.Minute)
+	config := &loggingConfig{
+		Level:         "WARN",
+		LevelExpireAt: &expireAt,
+		Debugs: []*logger.DebugTarget{
+			{Object: "demo", Filter: "proxy", ExpireAt: now.Add(time.Minute)},
+			{Object: "expired", ExpireAt: now.Add(-time.Minute)},
+		},
+	}
+
+	if ttl := config.activate(now); ttl != time.Minute {
+		t.Errorf("expected ttl 1m, got %v", ttl)
+	}
+	config.apply()
+	if logger.Level() != zapcore.WarnLevel {
+		t.Errorf("expected level WARN, got %s", logger.Level())
+	}
+	if enabled, _ := logger.ObjectDebugEnabled("demo", "proxy"); !enabled {
+		t.Errorf("filter proxy of demo should be debugged")
+	}
+	if enabled, _ := logger.ObjectDebugEnabled("demo", ""); enabled {
+		t.Errorf("the whole demo should not be debugged")
+	}
+	if enabled, _ := logger.ObjectDebugEnabled("expired", ""); enabled {
+		t.Errorf("expired target should not be debugged")
+	}
+
+	if ttl := config.activate(now.Add(2 * time.Minute)); ttl != 0 {
+		t.Errorf("expected no ttl after expired, got %v", ttl)
+	}
+	config.apply()
+	if logger.Level() != logger.DefaultLevel() || len(logger.DebugTargets()) != 0 {
+		t.Errorf("level and targets should be reverted after expired")
+	}
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+// memberTransport sets the member token to the requests.
+type memberTransport struct {
+	cls  cluster.Cluster
+	next http.RoundTripper
+}
+
+// NewMemberClient returns the HTTP client to access the admin API of the
+// other members, the requests are authenticated by the member token, and
+// the TLS options of the admin API are used to access it over HTTPS.
+func NewMemberClient(opt *option.Options, cls cluster.Cluster) (*http.Client, error) {
+	tlsConfig, err := newMemberTLSConfig(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{
+		Transport: &memberTransport{
+			cls:  cls,
+			next: transport,
+		},
+	}, nil
+}
+
+// newMemberTLSConfig returns the TLS config to access the admin API of the
+// other members, which are supposed to share the TLS options. Their
+// certificates are verified by the CA file, or the client CA file if it's
+// not specified. With mutual TLS enabled, the member presents its own
+// certificate, so it must be valid for client authentication too.
+func newMemberTLSConfig(opt *option.Options) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	caFile := opt.APICAFile
+	if caFile == "" {
+		caFile = opt.APIClientCAFile
+	}
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("load ca file failed: %v", err)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if opt.APIClientCAFile != "" {
+		cert, err := tls.LoadX509KeyPair(opt.APICertFile, opt.APIKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load key pair failed: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *memberTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := getMemberToken(t.cls)
+	if err != nil {
+		return nil, fmt.Errorf("get member token failed: %v", err)
+	}
+
+	// NOTE: RoundTrip must not modify the request.
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return t.next.RoundTrip(req)
+}
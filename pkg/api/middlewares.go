@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"net/http"
 	"runtime/debug"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
@@ -69,3 +70,60 @@ func (m *dynamicMux) newConfigVersionAttacher(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+func (m *dynamicMux) newAuthenticator(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := m.server.auth
+		if auth == nil || strings.TrimSuffix(r.URL.Path, "/") == APIPrefix+HealthzPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if m.server.authenticateMember(r) {
+			next.ServeHTTP(w, withAuthUser(r, memberUser))
+			return
+		}
+
+		user, err := auth.authenticate(r)
+		if err != nil {
+			logger.APIAudit(r.Method, r.RemoteAddr, r.URL.Path, user, err.Error())
+			auth.challenge(w)
+			HandleAPIError(w, r, http.StatusUnauthorized, fmt.Errorf("unauthorized"))
+			return
+		}
+
+		next.ServeHTTP(w, withAuthUser(r, user))
+	})
+}
+
+// newAuthorizer must be used after routing, because it needs the URL
+// parameters to know which object is requested.
+func (m *dynamicMux) newAuthorizer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := m.server.auth
+		user, ok := authUser(r)
+		if auth == nil || !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		res, err := m.server.requestResource(r)
+		if err != nil {
+			HandleAPIError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		verb := res.verb
+		if verb == "" {
+			verb = methodVerb(r.Method)
+		}
+		if res.list && auth.authorizeVerb(user, verb) || auth.authorize(user, verb, res.kind, res.name) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		reason := fmt.Sprintf("%s kind:%s name:%s", verb, res.kind, res.name)
+		logger.APIAudit(r.Method, r.RemoteAddr, r.URL.Path, user, reason)
+		HandleAPIError(w, r, http.StatusForbidden, fmt.Errorf("forbidden: user %s can't %s", user, reason))
+	})
+}
@@ -36,6 +36,12 @@ const (
 	// ObjectKindsPrefix is the object-kinds prefix.
 	ObjectKindsPrefix = "/object-kinds"
 
+	// ObjectCategoriesPrefix is the object-categories prefix.
+	ObjectCategoriesPrefix = "/object-categories"
+
+	// ObjectNormalizePath is the path to normalize an object spec.
+	ObjectNormalizePath = ObjectPrefix + "/normalize"
+
 	// StatusObjectPrefix is the prefix of object status.
 	StatusObjectPrefix = "/status/objects"
 )
@@ -47,6 +53,21 @@ func (s *Server) objectAPIEntries() []*Entry {
 			Method:  "GET",
 			Handler: s.listObjectKinds,
 		},
+		{
+			Path:    ObjectCategoriesPrefix,
+			Method:  "GET",
+			Handler: s.listObjectCategories,
+		},
+		{
+			Path:    ObjectNormalizePath,
+			Method:  "POST",
+			Handler: s.normalizeObject,
+		},
+		{
+			Path:    ObjectValidatePath,
+			Method:  "POST",
+			Handler: s.validateObjects,
+		},
 		{
 			Path:    ObjectPrefix,
 			Method:  "POST",
@@ -127,7 +148,7 @@ func (s *Server) createObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s._putObject(spec)
+	s._putObject(spec, newObjectRevision(r, revisionCreate, spec.Kind(), spec))
 	s.upgradeConfigVersion(w, r)
 
 	w.WriteHeader(http.StatusCreated)
@@ -135,6 +156,20 @@ func (s *Server) createObject(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Location", location)
 }
 
+// normalizeObject returns the spec in the form of being stored,
+// which is validated and filled with default values, without storing it.
+func (s *Server) normalizeObject(w http.ResponseWriter, r *http.Request) {
+	spec, err := s.readObjectSpec(w, r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/vnd.yaml")
+
+	w.Write([]byte(spec.YAMLConfig()))
+}
+
 func (s *Server) deleteObject(w http.ResponseWriter, r *http.Request) {
 	name := chi.URLParam(r, "name")
 
@@ -147,7 +182,7 @@ func (s *Server) deleteObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s._deleteObject(name)
+	s._deleteObject(name, newObjectRevision(r, revisionDelete, spec.Kind(), nil))
 	s.upgradeConfigVersion(w, r)
 }
 
@@ -193,14 +228,19 @@ func (s *Server) updateObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s._putObject(spec)
+	s._putObject(spec, newObjectRevision(r, revisionUpdate, spec.Kind(), spec))
 	s.upgradeConfigVersion(w, r)
 }
 
 func (s *Server) listObjects(w http.ResponseWriter, r *http.Request) {
 	// No need to lock.
 
-	specs := specList(s._listObjects())
+	specs := specList{}
+	for _, spec := range s._listObjects() {
+		if s.authorized(r, verbGet, spec.Kind(), spec.Name()) {
+			specs = append(specs, spec)
+		}
+	}
 	// NOTE: Keep it consistent.
 	sort.Sort(specs)
 
@@ -242,6 +282,18 @@ func (s *Server) listStatusObjects(w http.ResponseWriter, r *http.Request) {
 
 	status := s._listStatusObjects()
 
+	if s.auth != nil {
+		kinds := map[string]string{}
+		for _, spec := range s._listObjects() {
+			kinds[spec.Name()] = spec.Kind()
+		}
+		for name := range status {
+			if !s.authorized(r, verbGet, kinds[name], name) {
+				delete(status, name)
+			}
+		}
+	}
+
 	buff, err := yaml.Marshal(status)
 	if err != nil {
 		panic(fmt.Errorf("marshal %#v to yaml failed: %v", status, err))
@@ -252,6 +304,16 @@ func (s *Server) listStatusObjects(w http.ResponseWriter, r *http.Request) {
 	w.Write(buff)
 }
 
+func (s *Server) listObjectCategories(w http.ResponseWriter, r *http.Request) {
+	categories := supervisor.ObjectCategoryKinds()
+	buff, err := yaml.Marshal(categories)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", categories, err))
+	}
+
+	w.Write(buff)
+}
+
 type specList []*supervisor.Spec
 
 func (s specList) Less(i, j int) bool { return s[i].Name() < s[j].Name() }
@@ -19,11 +19,16 @@ package api
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"net/http"
+	"os"
 	"sync"
 	"time"
 
 	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/common"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/option"
 	"github.com/megaease/easegress/pkg/supervisor"
@@ -37,6 +42,10 @@ type (
 		router  *dynamicMux
 		cluster cluster.Cluster
 		super   *supervisor.Supervisor
+		auth    *apiAuth
+		// done is closed when the server is closing,
+		// to end the long-running requests like watching.
+		done chan struct{}
 
 		mutex      cluster.Mutex
 		mutexMutex sync.Mutex
@@ -58,15 +67,28 @@ type (
 
 // MustNewServer creates an api server.
 func MustNewServer(opt *option.Options, cluster cluster.Cluster, super *supervisor.Supervisor) *Server {
+	auth, err := newAPIAuth(opt.APIAuthFile)
+	if err != nil {
+		common.Exit(1, fmt.Sprintf("load api auth file %s failed: %v", opt.APIAuthFile, err))
+	}
+
 	s := &Server{
 		opt:     opt,
 		cluster: cluster,
 		super:   super,
+		auth:    auth,
+		done:    make(chan struct{}),
 	}
 	s.router = newDynamicMux(s)
 	s.server = http.Server{Addr: opt.APIAddr, Handler: s.router}
 
-	_, err := s.getMutex()
+	tlsConfig, err := newTLSConfig(opt)
+	if err != nil {
+		common.Exit(1, fmt.Sprintf("load api tls config failed: %v", err))
+	}
+	s.server.TLSConfig = tlsConfig
+
+	_, err = s.getMutex()
 	if err != nil {
 		logger.Errorf("get cluster mutex %s failed: %v", lockKey, err)
 	}
@@ -74,18 +96,70 @@ func MustNewServer(opt *option.Options, cluster cluster.Cluster, super *supervis
 	s.initMetadata()
 	s.registerAPIs()
 
+	go s.syncLogging()
+
 	go func() {
-		logger.Infof("api server running in %s", opt.APIAddr)
-		s.server.ListenAndServe()
+		if tlsConfig == nil {
+			logger.Infof("api server running in %s", opt.APIAddr)
+			s.server.ListenAndServe()
+		} else {
+			logger.Infof("api server running in %s with tls", opt.APIAddr)
+			s.server.ListenAndServeTLS("", "")
+		}
 	}()
 
 	return s
 }
 
+// newTLSConfig returns nil if the api server is not served over TLS.
+func newTLSConfig(opt *option.Options) (*tls.Config, error) {
+	if opt.APICertFile == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(opt.APICertFile, opt.APIKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load key pair failed: %v", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if opt.APIClientCAFile != "" {
+		pool, err := loadCertPool(opt.APIClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client ca file failed: %v", err)
+		}
+
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+func loadCertPool(filename string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", filename)
+	}
+
+	return pool, nil
+}
+
 // Close closes Server.
 func (s *Server) Close(wg *sync.WaitGroup) {
 	defer wg.Done()
 
+	close(s.done)
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -0,0 +1,221 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+// writeCert generates a certificate signed by parent, or a self-signed
+// one if parent is nil, and writes the certificate and key to dir.
+func writeCert(t *testing.T, dir, name string, tmpl *x509.Certificate,
+	parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	os.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0o600)
+	os.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0o600)
+
+	return cert, key
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	file := func(name string) string { return filepath.Join(dir, name) }
+
+	ca, caKey := writeCert(t, dir, "ca", &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	writeCert(t, dir, "server", &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "server"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	writeCert(t, dir, "client", &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "root"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	tlsConfig, err := newTLSConfig(&option.Options{})
+	if tlsConfig != nil || err != nil {
+		t.Errorf("tls should be disabled without cert file")
+	}
+
+	_, err = newTLSConfig(&option.Options{APICertFile: file("server.crt"), APIKeyFile: file("client.key")})
+	if err == nil {
+		t.Errorf("mismatched cert and key should be rejected")
+	}
+
+	tlsConfig, err = newTLSConfig(&option.Options{
+		APICertFile:     file("server.crt"),
+		APIKeyFile:      file("server.key"),
+		APIClientCAFile: file("ca.crt"),
+	})
+	if err != nil {
+		t.Fatalf("load tls config failed: %v", err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.CommonName))
+	}))
+	server.TLS = tlsConfig
+	server.StartTLS()
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		transport := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: certs}}
+		return &http.Client{Transport: transport}
+	}
+
+	if _, err := newClient().Get(server.URL); err == nil {
+		t.Errorf("client without certificate should be rejected")
+	}
+
+	clientCert, err := tls.LoadX509KeyPair(file("client.crt"), file("client.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := newClient(clientCert).Get(server.URL)
+	if err != nil {
+		t.Fatalf("client with certificate should be accepted: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestNewMemberClient(t *testing.T) {
+	dir := t.TempDir()
+	file := func(name string) string { return filepath.Join(dir, name) }
+
+	ca, caKey := writeCert(t, dir, "ca", &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	writeCert(t, dir, "member", &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "member"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	opt := &option.Options{
+		APICertFile:     file("member.crt"),
+		APIKeyFile:      file("member.key"),
+		APIClientCAFile: file("ca.crt"),
+	}
+	tlsConfig, err := newTLSConfig(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.CommonName + " " + r.Header.Get("Authorization")))
+	}))
+	server.TLS = tlsConfig
+	server.StartTLS()
+	defer server.Close()
+
+	cls := clustertest.New(map[string]string{"/config/member-token": "member-token"})
+
+	client, err := NewMemberClient(opt, cls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("member should be accepted: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "member Bearer member-token" {
+		t.Errorf("unexpected response: %s", body)
+	}
+
+	// The CA file takes precedence over the client CA file.
+	writeCert(t, dir, "other-ca", &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "other-ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	opt.APICAFile = file("other-ca.crt")
+	client, err = NewMemberClient(opt, cls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(server.URL); err == nil {
+		t.Errorf("server certificate should not be trusted by a wrong CA")
+	}
+
+	opt.APICAFile = file("missing.crt")
+	if _, err := NewMemberClient(opt, cls); err == nil {
+		t.Errorf("missing CA file should be rejected")
+	}
+
+	client, err = NewMemberClient(&option.Options{}, cls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(server.URL); err == nil {
+		t.Errorf("member without TLS options should be rejected")
+	}
+}
@@ -0,0 +1,333 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/filter/proxy"
+	"github.com/megaease/easegress/pkg/filter/ratelimiter"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/v"
+)
+
+const (
+	// ObjectValidatePath is the path to validate object specs.
+	ObjectValidatePath = ObjectPrefix + "/validate"
+
+	// errTypeReference is the type of errors of references to other objects.
+	errTypeReference = "reference"
+
+	// NOTE: It's the same with httpserver.Kind, which is not imported
+	// to keep the admin API away from the whole HTTP server stack.
+	httpServerKind = "HTTPServer"
+)
+
+type (
+	// validateResult is the result of validating object specs,
+	// it's valid only if all objects are valid.
+	validateResult struct {
+		Valid   bool                    `yaml:"valid"`
+		Objects []*objectValidateResult `yaml:"objects"`
+	}
+
+	objectValidateResult struct {
+		Kind   string          `yaml:"kind"`
+		Name   string          `yaml:"name"`
+		Valid  bool            `yaml:"valid"`
+		Errors []*v.FieldError `yaml:"errors,omitempty"`
+	}
+
+	// referenceChecker checks the references of the object to other objects,
+	// the known objects are the ones in the cluster and the request,
+	// which is a map from name to kind.
+	referenceChecker func(rawSpec map[interface{}]interface{}, known map[string]string) []*v.FieldError
+)
+
+// referenceCheckers is keyed by the kind of object.
+var referenceCheckers = map[string]referenceChecker{
+	httpServerKind:    checkHTTPServerReferences,
+	httppipeline.Kind: checkHTTPPipelineReferences,
+}
+
+// validateObjects validates the specs in the body, which could contain many
+// documents, without changing anything. Besides the validation of creating
+// objects, it checks the references to other objects too, and the objects
+// in the same request could refer to each other.
+func (s *Server) validateObjects(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+		return
+	}
+
+	var docs []map[interface{}]interface{}
+	decoder := yaml.NewDecoder(bytes.NewReader(body))
+	for {
+		var doc map[interface{}]interface{}
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("unmarshal yaml failed: %v", err))
+			return
+		}
+		if doc != nil {
+			docs = append(docs, doc)
+		}
+	}
+	if len(docs) == 0 {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("empty spec"))
+		return
+	}
+
+	known := map[string]string{}
+	for _, spec := range s._listObjects() {
+		known[spec.Name()] = spec.Kind()
+	}
+	requested := map[string]bool{}
+	for _, doc := range docs {
+		name, kind := stringField(doc, "name"), stringField(doc, "kind")
+		if name != "" {
+			known[name] = kind
+		}
+	}
+
+	result := &validateResult{Valid: true}
+	for _, doc := range docs {
+		res := &objectValidateResult{
+			Kind: stringField(doc, "kind"),
+			Name: stringField(doc, "name"),
+		}
+
+		if requested[res.Name] {
+			res.Errors = append(res.Errors, &v.FieldError{
+				Field:   "name",
+				Type:    v.ErrTypeGeneral,
+				Message: fmt.Sprintf("duplicated name %s in the request", res.Name),
+			})
+		}
+		requested[res.Name] = true
+
+		res.Errors = append(res.Errors, s.validateSpec(doc)...)
+		if checker := referenceCheckers[res.Kind]; checker != nil {
+			res.Errors = append(res.Errors, checker(doc, known)...)
+		}
+
+		res.Valid = len(res.Errors) == 0
+		result.Valid = result.Valid && res.Valid
+		result.Objects = append(result.Objects, res)
+	}
+
+	buff, err := yaml.Marshal(result)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", result, err))
+	}
+
+	w.Header().Set("Content-Type", "text/vnd.yaml")
+
+	w.Write(buff)
+}
+
+func fieldErrors(err error, prefix string) []*v.FieldError {
+	vr, ok := err.(*v.ValidateRecorder)
+	if !ok {
+		return []*v.FieldError{{Field: prefix, Type: v.ErrTypeGeneral, Message: err.Error()}}
+	}
+
+	errs := vr.FieldErrors()
+	for _, fe := range errs {
+		fe.Field = strings.TrimSuffix(prefix+"."+fe.Field, ".")
+		fe.Field = strings.TrimPrefix(fe.Field, ".")
+	}
+	return errs
+}
+
+func (s *Server) validateSpec(doc map[interface{}]interface{}) []*v.FieldError {
+	buff, err := yaml.Marshal(doc)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", doc, err))
+	}
+
+	_, err = s.super.NewSpec(string(buff))
+	if err == nil {
+		return nil
+	}
+	errs := fieldErrors(err, "")
+
+	if stringField(doc, "kind") != httppipeline.Kind {
+		return errs
+	}
+
+	// NOTE: The filters are validated as a whole by the pipeline, so the
+	// errors of them are located at the root. Validate them one by one
+	// for the accurate fields, and drop the root ones if they are found.
+	var filterErrs []*v.FieldError
+	for i, filter := range listField(doc, "filters") {
+		m, ok := filter.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		rawSpec := map[string]interface{}{}
+		for k, v := range m {
+			rawSpec[fmt.Sprintf("%v", k)] = v
+		}
+		_, err := httppipeline.NewFilterSpec(rawSpec, nil)
+		if err != nil {
+			filterErrs = append(filterErrs, fieldErrors(err, fmt.Sprintf("filters.%d", i))...)
+		}
+	}
+	if len(filterErrs) == 0 {
+		return errs
+	}
+
+	result := filterErrs
+	for _, fe := range errs {
+		if fe.Field == "" && fe.Type == v.ErrTypeGeneral && strings.HasPrefix(fe.Message, "filters: ") {
+			continue
+		}
+		result = append(result, fe)
+	}
+	return result
+}
+
+func stringField(m interface{}, key string) string {
+	s, _ := mapField(m, key).(string)
+	return s
+}
+
+func listField(m interface{}, key string) []interface{} {
+	l, _ := mapField(m, key).([]interface{})
+	return l
+}
+
+func mapField(m interface{}, key string) interface{} {
+	switch m := m.(type) {
+	case map[interface{}]interface{}:
+		return m[key]
+	case map[string]interface{}:
+		return m[key]
+	}
+	return nil
+}
+
+func kindCategory(kind string) supervisor.ObjectCategory {
+	for _, ck := range supervisor.ObjectCategoryKinds() {
+		for _, k := range ck.Kinds {
+			if k == kind {
+				return ck.Category
+			}
+		}
+	}
+	return supervisor.CategoryAll
+}
+
+func checkHTTPServerReferences(rawSpec map[interface{}]interface{}, known map[string]string) []*v.FieldError {
+	var errs []*v.FieldError
+	for i, rule := range listField(rawSpec, "rules") {
+		for j, path := range listField(rule, "paths") {
+			backend := stringField(path, "backend")
+			if backend == "" {
+				continue
+			}
+
+			field := fmt.Sprintf("rules.%d.paths.%d.backend", i, j)
+			kind, exists := known[backend]
+			switch {
+			case !exists:
+				errs = append(errs, &v.FieldError{Field: field, Type: errTypeReference,
+					Message: fmt.Sprintf("pipeline %s not found", backend)})
+			case kindCategory(kind) != supervisor.CategoryPipeline:
+				errs = append(errs, &v.FieldError{Field: field, Type: errTypeReference,
+					Message: fmt.Sprintf("%s is a %s, not a pipeline", backend, kind)})
+			}
+		}
+	}
+
+	return errs
+}
+
+func checkHTTPPipelineReferences(rawSpec map[interface{}]interface{}, known map[string]string) []*v.FieldError {
+	var errs []*v.FieldError
+
+	checkPool := func(pool interface{}, field string) {
+		registry := stringField(pool, "serviceRegistry")
+		if registry == "" {
+			return
+		}
+
+		field += ".serviceRegistry"
+		kind, exists := known[registry]
+		switch {
+		case !exists:
+			errs = append(errs, &v.FieldError{Field: field, Type: errTypeReference,
+				Message: fmt.Sprintf("service registry %s not found", registry)})
+		case !strings.HasSuffix(kind, "ServiceRegistry"):
+			errs = append(errs, &v.FieldError{Field: field, Type: errTypeReference,
+				Message: fmt.Sprintf("%s is a %s, not a service registry", registry, kind)})
+		}
+	}
+
+	for i, filter := range listField(rawSpec, "filters") {
+		prefix := fmt.Sprintf("filters.%d", i)
+
+		switch stringField(filter, "kind") {
+		case proxy.Kind:
+			if pool := mapField(filter, "mainPool"); pool != nil {
+				checkPool(pool, prefix+".mainPool")
+			}
+			if pool := mapField(filter, "mirrorPool"); pool != nil {
+				checkPool(pool, prefix+".mirrorPool")
+			}
+			for j, pool := range listField(filter, "candidatePools") {
+				checkPool(pool, fmt.Sprintf("%s.candidatePools.%d", prefix, j))
+			}
+
+		case ratelimiter.Kind:
+			policies := map[string]bool{}
+			for _, policy := range listField(filter, "policies") {
+				policies[stringField(policy, "name")] = true
+			}
+
+			defaultRef := stringField(filter, "defaultPolicyRef")
+			if defaultRef != "" && !policies[defaultRef] {
+				errs = append(errs, &v.FieldError{Field: prefix + ".defaultPolicyRef", Type: errTypeReference,
+					Message: fmt.Sprintf("policy %s not found", defaultRef)})
+			}
+
+			for j, url := range listField(filter, "urls") {
+				ref := stringField(url, "policyRef")
+				if ref == "" || policies[ref] {
+					continue
+				}
+				errs = append(errs, &v.FieldError{Field: fmt.Sprintf("%s.urls.%d.policyRef", prefix, j),
+					Type: errTypeReference, Message: fmt.Sprintf("policy %s not found", ref)})
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/v"
+)
+
+func TestValidateObjects(t *testing.T) {
+	s := &Server{
+		opt:     &option.Options{},
+		cluster: clustertest.New(nil),
+	}
+
+	validate := func(body string) *validateResult {
+		r := httptest.NewRequest(http.MethodPost, APIPrefix+ObjectValidatePath, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.validateObjects(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("validate failed: %d: %s", w.Code, w.Body)
+		}
+		result := &validateResult{}
+		if err := yaml.Unmarshal(w.Body.Bytes(), result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	hasError := func(res *objectValidateResult, field, typ string) bool {
+		for _, fe := range res.Errors {
+			if fe.Field == field && fe.Type == typ {
+				return true
+			}
+		}
+		return false
+	}
+
+	const pipeline = `
+kind: HTTPPipeline
+name: demo-pipeline
+filters:
+- kind: Proxy
+  name: proxy
+  mainPool:
+    servers:
+    - url: http://127.0.0.1:9095
+    loadBalance:
+      policy: roundRobin
+`
+	result := validate(pipeline)
+	if !result.Valid || len(result.Objects) != 1 {
+		t.Errorf("pipeline should be valid: %+v", result.Objects[0].Errors[0])
+	}
+
+	result = validate(pipeline + `---
+kind: HTTPPipeline
+name: other-pipeline
+filters:
+- kind: Proxy
+  name: proxy
+  mainPool:
+    serviceRegistry: demo-pipeline
+    serviceName: demo
+    loadBalance:
+      policy: roundRobin
+`)
+	if result.Valid || !hasError(result.Objects[1], "filters.0.mainPool.serviceRegistry", errTypeReference) {
+		t.Errorf("reference to pipeline as service registry should be reported: %+v", result.Objects[1])
+	}
+
+	result = validate(`
+kind: HTTPPipeline
+name: demo-pipeline
+filters:
+- kind: HTTPCache
+  name: cache
+  maxBytes: 0
+  maxEntryBytes: 1024
+  methods: [GET]
+  codes: [200]
+  defaultTTL: 10
+- kind: Proxy
+  name: proxy
+  mainPool:
+    serviceRegistry: nacos
+    serviceName: demo
+- kind: RateLimiter
+  name: limiter
+  policies:
+  - name: policy1
+  urls:
+  - policyRef: policy2
+    url:
+      prefix: /
+`)
+	res := result.Objects[0]
+	for _, fe := range []struct{ field, typ string }{
+		{"filters.0.maxBytes", v.ErrTypeJSONSchema},
+		{"filters.0.defaultTTL", v.ErrTypeFormat},
+		{"filters.1.mainPool.serviceRegistry", errTypeReference},
+		{"filters.2.urls.0.policyRef", errTypeReference},
+	} {
+		if !hasError(res, fe.field, fe.typ) {
+			t.Errorf("error of %s should be reported: %+v", fe.field, res)
+		}
+	}
+	for _, fe := range res.Errors {
+		if fe.Field == "" {
+			t.Errorf("errors of filters should be located: %+v", fe)
+		}
+	}
+
+	result = validate(pipeline + "---" + pipeline)
+	if !hasError(result.Objects[1], "name", v.ErrTypeGeneral) {
+		t.Errorf("duplicated names should be reported: %+v", result.Objects[1])
+	}
+}
+
+func TestCheckHTTPServerReferences(t *testing.T) {
+	rawSpec := map[interface{}]interface{}{}
+	yaml.Unmarshal([]byte(`
+kind: HTTPServer
+name: demo-server
+rules:
+- paths:
+  - backend: demo-pipeline
+  - backend: missing-pipeline
+- paths:
+  - backend: demo-server
+`), &rawSpec)
+
+	known := map[string]string{
+		"demo-pipeline": "HTTPPipeline",
+		"demo-server":   httpServerKind,
+	}
+	errs := checkHTTPServerReferences(rawSpec, known)
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %d", len(errs))
+	}
+	if errs[0].Field != "rules.0.paths.1.backend" || errs[1].Field != "rules.1.paths.0.backend" {
+		t.Errorf("unexpected errors %+v %+v", errs[0], errs[1])
+	}
+}
@@ -0,0 +1,393 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	yamljsontool "github.com/ghodss/yaml"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// WatchObjectPrefix is the prefix to watch the changes of objects.
+	WatchObjectPrefix = "/watch/objects"
+
+	watchEventSync     = "sync"
+	watchEventBookmark = "bookmark"
+	watchEventCreate   = "create"
+	watchEventUpdate   = "update"
+	watchEventDelete   = "delete"
+	watchEventStatus   = "status"
+	watchEventError    = "error"
+
+	minWatchStatusInterval = time.Second
+)
+
+type (
+	// watchEvent is the event sent to the watching client, the revision
+	// is the one of the store, which could be used to resume watching.
+	watchEvent struct {
+		Type     string          `json:"type"`
+		Revision int64           `json:"revision,omitempty"`
+		Kind     string          `json:"kind,omitempty"`
+		Name     string          `json:"name,omitempty"`
+		Spec     json.RawMessage `json:"spec,omitempty"`
+		Status   json.RawMessage `json:"status,omitempty"`
+		Error    string          `json:"error,omitempty"`
+	}
+
+	watchOptions struct {
+		revision       int64
+		kind           string
+		name           string
+		statusInterval time.Duration
+	}
+
+	// watchStream writes events in JSON lines,
+	// or in server-sent events if the client accepts it.
+	watchStream struct {
+		w       http.ResponseWriter
+		flusher http.Flusher
+		sse     bool
+	}
+)
+
+func (s *Server) watchAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    WatchObjectPrefix,
+			Method:  "GET",
+			Handler: s.watchObjects,
+		},
+	}
+}
+
+func parseWatchOptions(r *http.Request) (*watchOptions, error) {
+	query := r.URL.Query()
+	opt := &watchOptions{
+		kind: query.Get("kind"),
+		name: query.Get("name"),
+	}
+
+	// NOTE: The EventSource of browsers resumes by Last-Event-ID.
+	revision := query.Get("revision")
+	if revision == "" {
+		revision = r.Header.Get("Last-Event-ID")
+	}
+	if revision != "" {
+		rev, err := strconv.ParseInt(revision, 10, 64)
+		if err != nil || rev <= 0 {
+			return nil, fmt.Errorf("invalid revision %s", revision)
+		}
+		opt.revision = rev
+	}
+
+	if interval := query.Get("statusInterval"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status interval %s: %v", interval, err)
+		}
+		if d < minWatchStatusInterval {
+			return nil, fmt.Errorf("status interval %s is less than %s", d, minWatchStatusInterval)
+		}
+		opt.statusInterval = d
+	}
+
+	return opt, nil
+}
+
+func (opt *watchOptions) match(kind, name string) bool {
+	if opt.kind != "" && opt.kind != kind {
+		return false
+	}
+	if opt.name != "" && opt.name != name {
+		return false
+	}
+	return true
+}
+
+func newWatchStream(w http.ResponseWriter, r *http.Request) (*watchStream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("streaming is not supported")
+	}
+
+	ws := &watchStream{
+		w:       w,
+		flusher: flusher,
+		sse:     strings.Contains(r.Header.Get("Accept"), "text/event-stream"),
+	}
+
+	if ws.sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return ws, nil
+}
+
+func (ws *watchStream) send(event *watchEvent) {
+	buff, err := json.Marshal(event)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to json failed: %v", event, err))
+	}
+
+	// NOTE: The failure of writing means the client has gone,
+	// which will be caught by the context of the request.
+	if ws.sse {
+		if event.Revision != 0 {
+			fmt.Fprintf(ws.w, "id: %d\n", event.Revision)
+		}
+		fmt.Fprintf(ws.w, "event: %s\ndata: %s\n\n", event.Type, buff)
+	} else {
+		ws.w.Write(buff)
+		ws.w.Write([]byte("\n"))
+	}
+}
+
+func (ws *watchStream) flush() {
+	ws.flusher.Flush()
+}
+
+func specKind(value []byte) string {
+	meta := struct {
+		Kind string `yaml:"kind"`
+	}{}
+	yaml.Unmarshal(value, &meta)
+	return meta.Kind
+}
+
+func yamlToJSON(value []byte) json.RawMessage {
+	buff, err := yamljsontool.YAMLToJSON(value)
+	if err != nil {
+		panic(fmt.Errorf("yaml %s to json failed: %v", value, err))
+	}
+	return buff
+}
+
+// newObjectWatchEvent returns nil if the event is not about an object.
+func (s *Server) newObjectWatchEvent(event *clientv3.Event) *watchEvent {
+	prefix := s.cluster.Layout().ConfigObjectPrefix()
+	name := strings.TrimPrefix(string(event.Kv.Key), prefix)
+	if name == "" || strings.Contains(name, "/") {
+		return nil
+	}
+
+	e := &watchEvent{
+		Revision: event.Kv.ModRevision,
+		Name:     name,
+	}
+
+	switch event.Type {
+	case mvccpb.PUT:
+		e.Type = watchEventUpdate
+		if event.IsCreate() {
+			e.Type = watchEventCreate
+		}
+		e.Kind = specKind(event.Kv.Value)
+		e.Spec = yamlToJSON(event.Kv.Value)
+	case mvccpb.DELETE:
+		e.Type = watchEventDelete
+		if event.PrevKv != nil {
+			e.Kind = specKind(event.PrevKv.Value)
+		}
+	default:
+		return nil
+	}
+
+	return e
+}
+
+// statusWatchEvents returns the events of the objects whose status changed
+// since the last time, and updates the last status.
+func (s *Server) statusWatchEvents(kinds map[string]string, last map[string]string) []*watchEvent {
+	status := s._listStatusObjects()
+
+	events := []*watchEvent{}
+	for name := range last {
+		if _, exists := kinds[name]; !exists {
+			delete(last, name)
+		}
+	}
+	for name := range kinds {
+		st, exists := status[name]
+		if !exists {
+			continue
+		}
+
+		buff, err := yaml.Marshal(st)
+		if err != nil {
+			panic(fmt.Errorf("marshal %#v to yaml failed: %v", st, err))
+		}
+		value := string(yamlToJSON(buff))
+		if last[name] == value {
+			continue
+		}
+		last[name] = value
+
+		events = append(events, &watchEvent{
+			Type:   watchEventStatus,
+			Kind:   kinds[name],
+			Name:   name,
+			Status: json.RawMessage(value),
+		})
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].Name < events[j].Name })
+
+	return events
+}
+
+func (s *Server) watchObjects(w http.ResponseWriter, r *http.Request) {
+	opt, err := parseWatchOptions(r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	watcher, err := s.cluster.Watcher()
+	if err != nil {
+		ClusterPanic(err)
+	}
+	defer watcher.Close()
+
+	prefix := s.cluster.Layout().ConfigObjectPrefix()
+	kvs, revision, err := s.cluster.GetRawPrefixWithRevision(prefix)
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	// NOTE: Resuming from the given revision, the existing objects are
+	// only used to tell the kinds of the objects in the status events.
+	resume := opt.revision != 0
+	if resume {
+		revision = opt.revision
+	}
+
+	respChan, err := watcher.WatchRawPrefixFromRevision(prefix, revision+1)
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	ws, err := newWatchStream(w, r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	// kinds records the kinds of the watched objects by names.
+	kinds := map[string]string{}
+	allowed := func(kind, name string) bool {
+		return opt.match(kind, name) && s.authorized(r, verbGet, kind, name)
+	}
+
+	syncEvents := []*watchEvent{}
+	for key, kv := range kvs {
+		name := strings.TrimPrefix(key, prefix)
+		kind := specKind(kv.Value)
+		if !allowed(kind, name) {
+			continue
+		}
+		kinds[name] = kind
+		syncEvents = append(syncEvents, &watchEvent{
+			Type:     watchEventSync,
+			Revision: kv.ModRevision,
+			Kind:     kind,
+			Name:     name,
+			Spec:     yamlToJSON(kv.Value),
+		})
+	}
+	if !resume {
+		sort.Slice(syncEvents, func(i, j int) bool { return syncEvents[i].Name < syncEvents[j].Name })
+		for _, event := range syncEvents {
+			ws.send(event)
+		}
+		ws.send(&watchEvent{Type: watchEventBookmark, Revision: revision})
+	}
+
+	lastStatus := map[string]string{}
+	var statusChan <-chan time.Time
+	if opt.statusInterval != 0 {
+		ticker := time.NewTicker(opt.statusInterval)
+		defer ticker.Stop()
+		statusChan = ticker.C
+
+		for _, event := range s.statusWatchEvents(kinds, lastStatus) {
+			ws.send(event)
+		}
+	}
+
+	ws.flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		case <-statusChan:
+			for _, event := range s.statusWatchEvents(kinds, lastStatus) {
+				ws.send(event)
+			}
+			ws.flush()
+		case resp, ok := <-respChan:
+			if !ok {
+				ws.send(&watchEvent{Type: watchEventError, Error: "watching stopped"})
+				ws.flush()
+				return
+			}
+			if err := resp.Err(); err != nil {
+				msg := err.Error()
+				if resp.CompactRevision != 0 {
+					msg = fmt.Sprintf("the changes after revision %d have been compacted, "+
+						"please watch again without revision", revision)
+				}
+				ws.send(&watchEvent{Type: watchEventError, Error: msg})
+				ws.flush()
+				return
+			}
+
+			for _, event := range resp.Events {
+				e := s.newObjectWatchEvent(event)
+				if e == nil || !allowed(e.Kind, e.Name) {
+					continue
+				}
+				if e.Type == watchEventDelete {
+					delete(kinds, e.Name)
+				} else {
+					kinds[e.Name] = e.Kind
+				}
+				ws.send(e)
+			}
+			ws.flush()
+		}
+	}
+}
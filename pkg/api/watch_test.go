@@ -0,0 +1,262 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+)
+
+type mockWatcher struct {
+	cluster.Watcher
+
+	revision int64
+	respChan chan *clientv3.WatchResponse
+}
+
+func (w *mockWatcher) WatchRawPrefixFromRevision(prefix string, revision int64) (<-chan *clientv3.WatchResponse, error) {
+	w.revision = revision
+	return w.respChan, nil
+}
+
+func (w *mockWatcher) Close() {}
+
+// mockWatchCluster is the MockedCluster at the revision.
+type mockWatchCluster struct {
+	*clustertest.MockedCluster
+
+	revision int64
+	watcher  *mockWatcher
+}
+
+func (c *mockWatchCluster) Watcher() (cluster.Watcher, error) { return c.watcher, nil }
+
+func (c *mockWatchCluster) GetRawPrefixWithRevision(prefix string) (map[string]*mvccpb.KeyValue, int64, error) {
+	kvs, _ := c.GetPrefix(prefix)
+	rawKVs := map[string]*mvccpb.KeyValue{}
+	for k, v := range kvs {
+		rawKVs[k] = &mvccpb.KeyValue{Key: []byte(k), Value: []byte(v), ModRevision: c.revision}
+	}
+	return rawKVs, c.revision, nil
+}
+
+func newMockWatchServer() (*Server, *mockWatcher) {
+	watcher := &mockWatcher{respChan: make(chan *clientv3.WatchResponse, 10)}
+	s := &Server{
+		cluster: &mockWatchCluster{
+			MockedCluster: clustertest.New(map[string]string{
+				"/config/objects/demo":   "kind: HTTPPipeline\nname: demo\n",
+				"/config/objects/server": "kind: HTTPServer\nname: server\n",
+			}),
+			revision: 10,
+			watcher:  watcher,
+		},
+	}
+	return s, watcher
+}
+
+func putEvent(name, value string, createRevision, modRevision int64) *clientv3.Event {
+	return &clientv3.Event{
+		Type: mvccpb.PUT,
+		Kv: &mvccpb.KeyValue{
+			Key:            []byte("/config/objects/" + name),
+			Value:          []byte(value),
+			CreateRevision: createRevision,
+			ModRevision:    modRevision,
+		},
+	}
+}
+
+func TestWatchObjects(t *testing.T) {
+	s, watcher := newMockWatchServer()
+	router := chi.NewMux()
+	for _, entry := range s.watchAPIEntries() {
+		router.Method(entry.Method, APIPrefix+entry.Path, entry.Handler)
+	}
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + APIPrefix + WatchObjectPrefix + "?revision=abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid revision should be rejected, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(server.URL + APIPrefix + WatchObjectPrefix + "?kind=HTTPPipeline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("content type should be json lines, got %s", ct)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	next := func() *watchEvent {
+		if !scanner.Scan() {
+			return nil
+		}
+		event := &watchEvent{}
+		if err := json.Unmarshal(scanner.Bytes(), event); err != nil {
+			t.Fatalf("unmarshal %s failed: %v", scanner.Text(), err)
+		}
+		return event
+	}
+
+	e := next()
+	if e == nil || e.Type != watchEventSync || e.Name != "demo" || e.Kind != "HTTPPipeline" {
+		t.Fatalf("want sync event of demo, got %+v", e)
+	}
+	if string(e.Spec) != `{"kind":"HTTPPipeline","name":"demo"}` {
+		t.Errorf("spec should be in json, got %s", e.Spec)
+	}
+	e = next()
+	if e == nil || e.Type != watchEventBookmark || e.Revision != 10 {
+		t.Fatalf("want bookmark at revision 10, got %+v", e)
+	}
+	if watcher.revision != 11 {
+		t.Errorf("should watch from revision 11, got %d", watcher.revision)
+	}
+
+	watcher.respChan <- &clientv3.WatchResponse{Events: []*clientv3.Event{
+		putEvent("demo2", "kind: HTTPPipeline\nname: demo2\n", 11, 11),
+		putEvent("server", "kind: HTTPServer\nname: server\n", 5, 12),
+		putEvent("demo2", "kind: HTTPPipeline\nname: demo2\n", 11, 13),
+		{
+			Type:   mvccpb.DELETE,
+			Kv:     &mvccpb.KeyValue{Key: []byte("/config/objects/demo"), ModRevision: 14},
+			PrevKv: &mvccpb.KeyValue{Value: []byte("kind: HTTPPipeline\nname: demo\n")},
+		},
+	}}
+
+	for _, want := range []watchEvent{
+		{Type: watchEventCreate, Name: "demo2", Revision: 11},
+		{Type: watchEventUpdate, Name: "demo2", Revision: 13},
+		{Type: watchEventDelete, Name: "demo", Revision: 14},
+	} {
+		e = next()
+		if e == nil || e.Type != want.Type || e.Name != want.Name || e.Revision != want.Revision {
+			t.Errorf("want %s event of %s at revision %d, got %+v", want.Type, want.Name, want.Revision, e)
+		}
+	}
+
+	watcher.respChan <- &clientv3.WatchResponse{Canceled: true, CompactRevision: 12}
+	e = next()
+	if e == nil || e.Type != watchEventError || !strings.Contains(e.Error, "compacted") {
+		t.Errorf("want error event of compaction, got %+v", e)
+	}
+	if e = next(); e != nil {
+		t.Errorf("stream should be ended after error, got %+v", e)
+	}
+}
+
+func TestWatchObjectsResumeSSE(t *testing.T) {
+	s, watcher := newMockWatchServer()
+	router := chi.NewMux()
+	for _, entry := range s.watchAPIEntries() {
+		router.Method(entry.Method, APIPrefix+entry.Path, entry.Handler)
+	}
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+APIPrefix+WatchObjectPrefix, nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Last-Event-ID", "20")
+
+	watcher.respChan <- &clientv3.WatchResponse{Events: []*clientv3.Event{
+		putEvent("demo", "kind: HTTPPipeline\nname: demo\n", 3, 21),
+	}}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("content type should be event stream, got %s", ct)
+	}
+
+	// No sync events when resuming.
+	reader := bufio.NewReader(resp.Body)
+	lines := []string{}
+	for i := 0; i < 3; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	if lines[0] != "id: 21" || lines[1] != "event: update" || !strings.HasPrefix(lines[2], "data: {") {
+		t.Errorf("unexpected event: %v", lines)
+	}
+	if watcher.revision != 21 {
+		t.Errorf("should watch from revision 21, got %d", watcher.revision)
+	}
+}
+
+func TestStatusWatchEvents(t *testing.T) {
+	c := clustertest.New(map[string]string{
+		"/status/objects/demo/member1": "state: running\n",
+		"/status/objects/demo/member2": "state: running\n",
+	})
+	s := &Server{cluster: c}
+
+	kinds := map[string]string{"demo": "HTTPPipeline"}
+	last := map[string]string{}
+
+	events := s.statusWatchEvents(kinds, last)
+	if len(events) != 1 || events[0].Name != "demo" || events[0].Kind != "HTTPPipeline" {
+		t.Fatalf("want status event of demo, got %+v", events)
+	}
+	want := `{"member1":{"state":"running"},"member2":{"state":"running"}}`
+	if string(events[0].Status) != want {
+		t.Errorf("want status %s, got %s", want, events[0].Status)
+	}
+
+	if events = s.statusWatchEvents(kinds, last); len(events) != 0 {
+		t.Errorf("unchanged status should not be sent, got %+v", events)
+	}
+
+	c.Put("/status/objects/demo/member2", "state: failed\n")
+	if events = s.statusWatchEvents(kinds, last); len(events) != 1 {
+		t.Errorf("changed status should be sent, got %+v", events)
+	}
+
+	delete(kinds, "demo")
+	if events = s.statusWatchEvents(kinds, last); len(events) != 0 || len(last) != 0 {
+		t.Errorf("status of deleted object should be dropped, got %+v", events)
+	}
+}
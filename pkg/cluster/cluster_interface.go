@@ -37,6 +37,9 @@ type (
 		GetPrefix(prefix string) (map[string]string, error)
 		GetRaw(key string) (*mvccpb.KeyValue, error)
 		GetRawPrefix(prefix string) (map[string]*mvccpb.KeyValue, error)
+		// GetRawPrefixWithRevision returns the revision of the store
+		// along with the key-values, it's used to watch the changes after.
+		GetRawPrefixWithRevision(prefix string) (map[string]*mvccpb.KeyValue, int64, error)
 
 		Put(key, value string) error
 		PutUnderLease(key, value string) error
@@ -70,6 +73,11 @@ type (
 		WatchPrefix(prefix string) (<-chan map[string]*string, error)
 		WatchRaw(key string) (<-chan *clientv3.Event, error)
 		WatchRawPrefix(prefix string) (<-chan map[string]*clientv3.Event, error)
+		// WatchRawPrefixFromRevision watches the changes since the revision,
+		// the events carry the previous key-values. The channel is closed
+		// after sending the canceled response, whose Err() tells the reason,
+		// such as the revision has been compacted.
+		WatchRawPrefixFromRevision(prefix string, revision int64) (<-chan *clientv3.WatchResponse, error)
 		Close()
 	}
 )
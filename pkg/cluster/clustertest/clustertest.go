@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package clustertest provides an in-memory cluster for testing.
+package clustertest
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/megaease/easegress/pkg/cluster"
+)
+
+type (
+	// MockedCluster is an in-memory cluster which supports the key-value
+	// operations and mutexes, the other methods of cluster.Cluster panic.
+	MockedCluster struct {
+		cluster.Cluster
+
+		mutex   sync.Mutex
+		kvs     map[string]string
+		mutexes map[string]*sync.Mutex
+	}
+
+	mockedMutex struct {
+		m *sync.Mutex
+	}
+)
+
+// New creates a MockedCluster with the initial key-values.
+func New(kvs map[string]string) *MockedCluster {
+	c := &MockedCluster{
+		kvs:     map[string]string{},
+		mutexes: map[string]*sync.Mutex{},
+	}
+	for k, v := range kvs {
+		c.kvs[k] = v
+	}
+	return c
+}
+
+// KVs returns a copy of all key-values.
+func (c *MockedCluster) KVs() map[string]string {
+	return c.getPrefix("")
+}
+
+// Layout returns an empty layout.
+func (c *MockedCluster) Layout() *cluster.Layout {
+	return &cluster.Layout{}
+}
+
+// Get gets the value of the key, it returns nil if the key doesn't exist.
+func (c *MockedCluster) Get(key string) (*string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if v, ok := c.kvs[key]; ok {
+		return &v, nil
+	}
+	return nil, nil
+}
+
+// GetPrefix gets the key-values with the prefix.
+func (c *MockedCluster) GetPrefix(prefix string) (map[string]string, error) {
+	return c.getPrefix(prefix), nil
+}
+
+func (c *MockedCluster) getPrefix(prefix string) map[string]string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	kvs := map[string]string{}
+	for k, v := range c.kvs {
+		if strings.HasPrefix(k, prefix) {
+			kvs[k] = v
+		}
+	}
+	return kvs
+}
+
+// Put puts the key-value.
+func (c *MockedCluster) Put(key, value string) error {
+	return c.PutAndDelete(map[string]*string{key: &value})
+}
+
+// PutUnderLease puts the key-value, there is no lease in MockedCluster.
+func (c *MockedCluster) PutUnderLease(key, value string) error {
+	return c.Put(key, value)
+}
+
+// PutAndDelete puts the key-values and deletes the keys with nil values.
+func (c *MockedCluster) PutAndDelete(kvs map[string]*string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for k, v := range kvs {
+		if v == nil {
+			delete(c.kvs, k)
+		} else {
+			c.kvs[k] = *v
+		}
+	}
+	return nil
+}
+
+// PutAndDeleteUnderLease is the same as PutAndDelete.
+func (c *MockedCluster) PutAndDeleteUnderLease(kvs map[string]*string) error {
+	return c.PutAndDelete(kvs)
+}
+
+// Delete deletes the key.
+func (c *MockedCluster) Delete(key string) error {
+	return c.PutAndDelete(map[string]*string{key: nil})
+}
+
+// DeletePrefix deletes the keys with the prefix.
+func (c *MockedCluster) DeletePrefix(prefix string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for k := range c.kvs {
+		if strings.HasPrefix(k, prefix) {
+			delete(c.kvs, k)
+		}
+	}
+	return nil
+}
+
+// Mutex returns the mutex of the name, which is shared by the callers
+// with the same name like the one of the real cluster.
+func (c *MockedCluster) Mutex(name string) (cluster.Mutex, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	m, ok := c.mutexes[name]
+	if !ok {
+		m = &sync.Mutex{}
+		c.mutexes[name] = m
+	}
+	return &mockedMutex{m: m}, nil
+}
+
+func (m *mockedMutex) Lock() error {
+	m.m.Lock()
+	return nil
+}
+
+func (m *mockedMutex) Unlock() error {
+	m.m.Unlock()
+	return nil
+}
@@ -23,17 +23,27 @@ import "fmt"
 // Status means dynamic, different in every member.
 // Config means static, same in every member.
 const (
-	leaseFormat              = "/leases/%s" //+memberName
-	statusMemberPrefix       = "/status/members/"
-	statusMemberFormat       = "/status/members/%s" // +memberName
-	statusObjectPrefix       = "/status/objects/"
-	statusObjectPrefixFormat = "/status/objects/%s/"   // +objectName
-	statusObjectFormat       = "/status/objects/%s/%s" // +objectName +memberName
-	configObjectPrefix       = "/config/objects/"
-	configObjectFormat       = "/config/objects/%s" // +objectName
-	configVersion            = "/config/version"
-	wasmCodeEvent            = "/wasm/code"
-	wasmDataPrefixFormat     = "/wasm/data/%s/%s/"
+	leaseFormat                = "/leases/%s" //+memberName
+	statusMemberPrefix         = "/status/members/"
+	statusMemberFormat         = "/status/members/%s" // +memberName
+	statusObjectPrefix         = "/status/objects/"
+	statusObjectPrefixFormat   = "/status/objects/%s/"   // +objectName
+	statusObjectFormat         = "/status/objects/%s/%s" // +objectName +memberName
+	configObjectPrefix         = "/config/objects/"
+	configObjectFormat         = "/config/objects/%s" // +objectName
+	configVersion              = "/config/version"
+	configHistoryPrefixFormat  = "/config/history/%s/"   // +objectName
+	configHistoryFormat        = "/config/history/%s/%d" // +objectName +revision
+	wasmCodeEvent              = "/wasm/code"
+	wasmDataPrefixFormat       = "/wasm/data/%s/%s/"
+	rateLimiterPrefixFormat    = "/ratelimiter/%s/%s/%s/"    // +pipelineName +filterName +urlRule
+	rateLimiterFormat          = "/ratelimiter/%s/%s/%s/%s"  // +pipelineName +filterName +urlRule +memberName
+	httpCachePurgePrefixFormat = "/httpcache/purge/%s/%s/"   // +pipelineName +filterName
+	httpCachePurgeFormat       = "/httpcache/purge/%s/%s/%d" // +pipelineName +filterName +unixNano
+	httpCacheEntryPrefixFormat = "/httpcache/entries/%s/%s/" // +pipelineName +filterName
+	loggingConfig              = "/config/logging"
+	memberToken                = "/config/member-token"
+	acmePrefixFormat           = "/acme/%s/" // +directoryHost
 
 	// the cluster name of this eg group will be registered under this path in etcd
 	// any new member(reader or writer ) will be rejected if it is configured a different cluster name
@@ -119,6 +129,16 @@ func (l *Layout) ConfigVersion() string {
 	return configVersion
 }
 
+// ConfigHistoryPrefix returns the prefix of the revision history of an object.
+func (l *Layout) ConfigHistoryPrefix(name string) string {
+	return fmt.Sprintf(configHistoryPrefixFormat, name)
+}
+
+// ConfigHistoryKey returns the key of a revision of an object.
+func (l *Layout) ConfigHistoryKey(name string, revision int64) string {
+	return fmt.Sprintf(configHistoryFormat, name, revision)
+}
+
 // WasmCodeEvent returns the key of wasm code event
 func (l *Layout) WasmCodeEvent() string {
 	return wasmCodeEvent
@@ -128,3 +148,46 @@ func (l *Layout) WasmCodeEvent() string {
 func (l *Layout) WasmDataPrefix(pipeline string, name string) string {
 	return fmt.Sprintf(wasmDataPrefixFormat, pipeline, name)
 }
+
+// RateLimiterPrefix returns the prefix of rate limiter counters of all members.
+func (l *Layout) RateLimiterPrefix(pipeline, filter, urlRule string) string {
+	return fmt.Sprintf(rateLimiterPrefixFormat, pipeline, filter, urlRule)
+}
+
+// RateLimiterKey returns the key of own rate limiter counters.
+func (l *Layout) RateLimiterKey(pipeline, filter, urlRule string) string {
+	return fmt.Sprintf(rateLimiterFormat, pipeline, filter, urlRule, l.memberName)
+}
+
+// HTTPCachePurgePrefix returns the prefix of purge events of a HTTPCache filter.
+func (l *Layout) HTTPCachePurgePrefix(pipeline, filter string) string {
+	return fmt.Sprintf(httpCachePurgePrefixFormat, pipeline, filter)
+}
+
+// HTTPCachePurgeKey returns the key of a purge event of a HTTPCache filter.
+func (l *Layout) HTTPCachePurgeKey(pipeline, filter string, unixNano int64) string {
+	return fmt.Sprintf(httpCachePurgeFormat, pipeline, filter, unixNano)
+}
+
+// HTTPCacheEntryPrefix returns the prefix of the cached responses of a HTTPCache
+// filter stored in the cluster, the cache keys follow the prefix.
+func (l *Layout) HTTPCacheEntryPrefix(pipeline, filter string) string {
+	return fmt.Sprintf(httpCacheEntryPrefixFormat, pipeline, filter)
+}
+
+// LoggingConfig returns the key of the runtime logging config.
+func (l *Layout) LoggingConfig() string {
+	return loggingConfig
+}
+
+// MemberToken returns the key of the token the members use to access
+// the admin API of each other.
+func (l *Layout) MemberToken() string {
+	return memberToken
+}
+
+// ACMEPrefix returns the prefix of the accounts, certificates and challenge
+// tokens of an ACME directory.
+func (l *Layout) ACMEPrefix(directoryHost string) string {
+	return fmt.Sprintf(acmePrefixFormat, directoryHost)
+}
@@ -18,6 +18,7 @@
 package cluster
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -67,4 +68,20 @@ func TestLayout(t *testing.T) {
 	if len(l.WasmDataPrefix("pipeline", "wasm")) == 0 {
 		t.Error("WasmDataPrefix empty")
 	}
+
+	if !strings.HasPrefix(l.RateLimiterKey("pipeline", "limiter", "url"), l.RateLimiterPrefix("pipeline", "limiter", "url")) {
+		t.Error("RateLimiterKey is not under RateLimiterPrefix")
+	}
+
+	if !strings.HasPrefix(l.HTTPCachePurgeKey("pipeline", "cache", 1), l.HTTPCachePurgePrefix("pipeline", "cache")) {
+		t.Error("HTTPCachePurgeKey is not under HTTPCachePurgePrefix")
+	}
+
+	if strings.HasPrefix(l.HTTPCacheEntryPrefix("pipeline", "cache"), l.HTTPCachePurgePrefix("pipeline", "cache")) {
+		t.Error("HTTPCacheEntryPrefix is under HTTPCachePurgePrefix")
+	}
+
+	if strings.HasPrefix(l.LoggingConfig(), l.ConfigObjectPrefix()) {
+		t.Error("LoggingConfig is under ConfigObjectPrefix")
+	}
 }
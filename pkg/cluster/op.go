@@ -156,23 +156,28 @@ func (c *cluster) GetPrefix(prefix string) (map[string]string, error) {
 }
 
 func (c *cluster) GetRawPrefix(prefix string) (map[string]*mvccpb.KeyValue, error) {
+	kvs, _, err := c.GetRawPrefixWithRevision(prefix)
+	return kvs, err
+}
+
+func (c *cluster) GetRawPrefixWithRevision(prefix string) (map[string]*mvccpb.KeyValue, int64, error) {
 	kvs := make(map[string]*mvccpb.KeyValue)
 
 	client, err := c.getClient()
 	if err != nil {
-		return kvs, err
+		return kvs, 0, err
 	}
 
 	resp, err := client.Get(c.requestContext(), prefix, clientv3.WithPrefix())
 	if err != nil {
-		return kvs, err
+		return kvs, 0, err
 	}
 
 	for _, kv := range resp.Kvs {
 		kvs[string(kv.Key)] = kv
 	}
 
-	return kvs, nil
+	return kvs, resp.Header.Revision, nil
 }
 
 func (c *cluster) STM(apply func(concurrency.STM) error) error {
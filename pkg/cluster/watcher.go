@@ -220,6 +220,47 @@ func (w *watcher) WatchRawPrefix(prefix string) (<-chan map[string]*clientv3.Eve
 	return prefixChan, nil
 }
 
+func (w *watcher) WatchRawPrefixFromRevision(prefix string, revision int64) (<-chan *clientv3.WatchResponse, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	watchResp := w.w.Watch(ctx, prefix, clientv3.WithPrefix(),
+		clientv3.WithRev(revision), clientv3.WithPrevKV())
+
+	respChan := make(chan *clientv3.WatchResponse, 10)
+
+	go func() {
+		defer cancel()
+		defer close(respChan)
+
+		for {
+			select {
+			case <-w.done:
+				return
+			case resp, ok := <-watchResp:
+				if !ok {
+					return
+				}
+				if resp.IsProgressNotify() {
+					continue
+				}
+
+				select {
+				case respChan <- &resp:
+				case <-w.done:
+					return
+				}
+
+				if resp.Canceled {
+					logger.Infof("watch raw prefix %s from revision %d canceled: %v",
+						prefix, revision, resp.Err())
+					return
+				}
+			}
+		}
+	}()
+
+	return respChan, nil
+}
+
 func (w *watcher) Close() {
 	close(w.done)
 
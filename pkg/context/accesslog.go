@@ -0,0 +1,336 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package context
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+const (
+	// AccessLogFormatJSON formats access logs in JSON.
+	AccessLogFormatJSON = "json"
+	// AccessLogFormatLogfmt formats access logs in logfmt.
+	AccessLogFormatLogfmt = "logfmt"
+	// AccessLogFormatTemplate formats access logs by the template.
+	AccessLogFormatTemplate = "template"
+
+	accessLogHeaderPrefix = "header."
+	accessLogCookiePrefix = "cookie."
+)
+
+type (
+	// AccessLogSpec describes the access logs of an HTTPServer.
+	AccessLogSpec struct {
+		Format string `yaml:"format" jsonschema:"required,enum=json,enum=logfmt,enum=template"`
+		// Template is like "$remoteAddr [$time] \"$method $uri $proto\" $status",
+		// ${field} could be used if the field is followed by a word character.
+		Template string `yaml:"template" jsonschema:"omitempty"`
+		// Fields are the fields of json and logfmt formats, in which
+		// header.<Name> and cookie.<name> refer to the ones of the request.
+		Fields []string `yaml:"fields" jsonschema:"omitempty,uniqueItems=true"`
+		// SampleRate is the ratio of the requests to be logged, 0 means 1.
+		SampleRate float64 `yaml:"sampleRate" jsonschema:"omitempty,minimum=0,maximum=1"`
+		// ExcludePaths are the paths not to be logged, the one ending
+		// with * matches the paths with the prefix.
+		ExcludePaths []string `yaml:"excludePaths" jsonschema:"omitempty,uniqueItems=true"`
+	}
+
+	// AccessLog formats the access logs of finished contexts.
+	AccessLog struct {
+		spec *AccessLogSpec
+
+		fields []string
+		// The template is split into texts and fields, the texts
+		// are at even indexes, and the fields are at odd indexes.
+		template []string
+
+		excludePaths        map[string]struct{}
+		excludePathPrefixes []string
+	}
+
+	accessLogValue func(ctx *httpContext) interface{}
+)
+
+// accessLogValues are the values of the fields except headers and cookies.
+var accessLogValues = map[string]accessLogValue{
+	"time": func(ctx *httpContext) interface{} {
+		return fasttime.Format(ctx.startTime, fasttime.RFC3339Milli)
+	},
+	"remoteAddr":   func(ctx *httpContext) interface{} { return ctx.r.std.RemoteAddr },
+	"realIP":       func(ctx *httpContext) interface{} { return ctx.r.RealIP() },
+	"method":       func(ctx *httpContext) interface{} { return ctx.r.std.Method },
+	"host":         func(ctx *httpContext) interface{} { return ctx.r.std.Host },
+	"uri":          func(ctx *httpContext) interface{} { return ctx.r.std.RequestURI },
+	"path":         func(ctx *httpContext) interface{} { return requestURIPath(ctx.r.std.RequestURI) },
+	"proto":        func(ctx *httpContext) interface{} { return ctx.r.std.Proto },
+	"status":       func(ctx *httpContext) interface{} { return ctx.w.code },
+	"reqSize":      func(ctx *httpContext) interface{} { return ctx.r.Size() },
+	"respSize":     func(ctx *httpContext) interface{} { return ctx.w.Size() },
+	"upstreamAddr": func(ctx *httpContext) interface{} { return ctx.upstreamAddr },
+	"traceID":      func(ctx *httpContext) interface{} { return ctx.span.TraceID() },
+	"tags":         func(ctx *httpContext) interface{} { return strings.Join(ctx.tags, " | ") },
+	// duration is in milliseconds.
+	"duration": func(ctx *httpContext) interface{} {
+		return float64(ctx.metric.Duration.Microseconds()) / 1000
+	},
+}
+
+// defaultAccessLogFields are the fields of json and logfmt formats
+// if no fields specified, which are the ones of the default access log.
+var defaultAccessLogFields = []string{
+	"time", "remoteAddr", "realIP", "method", "uri", "proto", "status",
+	"duration", "reqSize", "respSize", "upstreamAddr", "traceID", "tags",
+}
+
+func validAccessLogField(field string) bool {
+	for _, prefix := range []string{accessLogHeaderPrefix, accessLogCookiePrefix} {
+		if strings.HasPrefix(field, prefix) {
+			return len(field) > len(prefix)
+		}
+	}
+	_, exists := accessLogValues[field]
+	return exists
+}
+
+func isAccessLogFieldChar(c byte, extended bool) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_':
+		return true
+	case extended && c == '-':
+		return true
+	}
+	return false
+}
+
+// parseAccessLogTemplate splits the template into texts and fields.
+func parseAccessLogTemplate(template string) ([]string, error) {
+	result := []string{}
+	text := strings.Builder{}
+	for i := 0; i < len(template); i++ {
+		if template[i] != '$' {
+			text.WriteByte(template[i])
+			continue
+		}
+
+		if i+1 < len(template) && template[i+1] == '$' {
+			text.WriteByte('$')
+			i++
+			continue
+		}
+
+		var field string
+		if i+1 < len(template) && template[i+1] == '{' {
+			end := strings.IndexByte(template[i+2:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed ${ at %d", i)
+			}
+			field = template[i+2 : i+2+end]
+			i += 2 + end
+		} else {
+			j := i + 1
+			for j < len(template) && isAccessLogFieldChar(template[j], false) {
+				j++
+			}
+			// header.<Name> and cookie.<name> could contain '-'.
+			name := template[i+1 : j]
+			if (name == "header" || name == "cookie") && j < len(template) && template[j] == '.' {
+				j++
+				for j < len(template) && isAccessLogFieldChar(template[j], true) {
+					j++
+				}
+			}
+			field = template[i+1 : j]
+			i = j - 1
+		}
+
+		if !validAccessLogField(field) {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+
+		result = append(result, text.String(), field)
+		text.Reset()
+	}
+	result = append(result, text.String())
+
+	return result, nil
+}
+
+// Validate validates AccessLogSpec.
+func (spec *AccessLogSpec) Validate() error {
+	switch spec.Format {
+	case AccessLogFormatTemplate:
+		if spec.Template == "" {
+			return fmt.Errorf("template is required by the template format")
+		}
+		if len(spec.Fields) != 0 {
+			return fmt.Errorf("fields are not used by the template format")
+		}
+		_, err := parseAccessLogTemplate(spec.Template)
+		if err != nil {
+			return fmt.Errorf("invalid template: %v", err)
+		}
+	default:
+		if spec.Template != "" {
+			return fmt.Errorf("template is only used by the template format")
+		}
+		for _, field := range spec.Fields {
+			if !validAccessLogField(field) {
+				return fmt.Errorf("unknown field %q", field)
+			}
+		}
+	}
+
+	return nil
+}
+
+// NewAccessLog creates an AccessLog, it returns nil if the spec is nil,
+// and the spec must be validated.
+func NewAccessLog(spec *AccessLogSpec) *AccessLog {
+	if spec == nil {
+		return nil
+	}
+
+	al := &AccessLog{
+		spec:         spec,
+		fields:       spec.Fields,
+		excludePaths: map[string]struct{}{},
+	}
+
+	if spec.Format == AccessLogFormatTemplate {
+		al.template, _ = parseAccessLogTemplate(spec.Template)
+	} else if len(al.fields) == 0 {
+		al.fields = defaultAccessLogFields
+	}
+
+	for _, path := range spec.ExcludePaths {
+		if strings.HasSuffix(path, "*") {
+			al.excludePathPrefixes = append(al.excludePathPrefixes, strings.TrimSuffix(path, "*"))
+		} else {
+			al.excludePaths[path] = struct{}{}
+		}
+	}
+
+	return al
+}
+
+func requestURIPath(uri string) string {
+	if i := strings.IndexByte(uri, '?'); i >= 0 {
+		return uri[:i]
+	}
+	return uri
+}
+
+// skip returns true if the context should not be logged.
+func (al *AccessLog) skip(ctx *httpContext) bool {
+	path := requestURIPath(ctx.r.std.RequestURI)
+	if _, exists := al.excludePaths[path]; exists {
+		return true
+	}
+	for _, prefix := range al.excludePathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	rate := al.spec.SampleRate
+	return rate != 0 && rate < 1 && rand.Float64() >= rate
+}
+
+func (al *AccessLog) value(ctx *httpContext, field string) interface{} {
+	switch {
+	case strings.HasPrefix(field, accessLogHeaderPrefix):
+		return ctx.r.std.Header.Get(field[len(accessLogHeaderPrefix):])
+	case strings.HasPrefix(field, accessLogCookiePrefix):
+		cookie, err := ctx.r.std.Cookie(field[len(accessLogCookiePrefix):])
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	}
+
+	return accessLogValues[field](ctx)
+}
+
+func formatAccessLogValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (al *AccessLog) format(ctx *httpContext) string {
+	buff := strings.Builder{}
+
+	switch al.spec.Format {
+	case AccessLogFormatJSON:
+		buff.WriteByte('{')
+		for i, field := range al.fields {
+			if i != 0 {
+				buff.WriteByte(',')
+			}
+			key, _ := json.Marshal(field)
+			value, err := json.Marshal(al.value(ctx, field))
+			if err != nil {
+				value = []byte(`""`)
+			}
+			buff.Write(key)
+			buff.WriteByte(':')
+			buff.Write(value)
+		}
+		buff.WriteByte('}')
+
+	case AccessLogFormatLogfmt:
+		for i, field := range al.fields {
+			if i != 0 {
+				buff.WriteByte(' ')
+			}
+			value := formatAccessLogValue(al.value(ctx, field))
+			if value == "" || strings.ContainsAny(value, " =\"\\\t\r\n") {
+				value = strconv.Quote(value)
+			}
+			buff.WriteString(field)
+			buff.WriteByte('=')
+			buff.WriteString(value)
+		}
+
+	case AccessLogFormatTemplate:
+		for i, part := range al.template {
+			if i%2 == 0 {
+				buff.WriteString(part)
+				continue
+			}
+			value := formatAccessLogValue(al.value(ctx, part))
+			if value == "" {
+				value = "-"
+			}
+			buff.WriteString(value)
+		}
+	}
+
+	return buff.String()
+}
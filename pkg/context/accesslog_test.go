@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package context
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+func newAccessLogTestContext() *httpContext {
+	stdr := httptest.NewRequest(http.MethodGet, "/api/users?id=1", nil)
+	stdr.RemoteAddr = "192.168.1.1:5678"
+	stdr.Header.Set("User-Agent", "curl/7.64")
+	stdr.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+
+	ctx := New(httptest.NewRecorder(), stdr, tracing.NoopTracing, "test").(*httpContext)
+	ctx.startTime = time.Date(2021, 8, 10, 9, 30, 45, 123000000, time.UTC)
+	ctx.metric.Duration = 12345 * time.Microsecond
+	ctx.w.code = http.StatusOK
+	ctx.SetUpstreamAddr("http://127.0.0.1:9095")
+	ctx.AddTag("tag1")
+	ctx.AddTag("tag 2")
+	return ctx
+}
+
+func TestAccessLogValidate(t *testing.T) {
+	for _, spec := range []*AccessLogSpec{
+		{Format: AccessLogFormatTemplate},
+		{Format: AccessLogFormatTemplate, Template: "$unknown"},
+		{Format: AccessLogFormatTemplate, Template: "${status"},
+		{Format: AccessLogFormatTemplate, Template: "$status", Fields: []string{"status"}},
+		{Format: AccessLogFormatJSON, Fields: []string{"status", "header."}},
+		{Format: AccessLogFormatLogfmt, Template: "$status"},
+	} {
+		if err := spec.Validate(); err == nil {
+			t.Errorf("spec %+v should be invalid", spec)
+		}
+	}
+
+	for _, spec := range []*AccessLogSpec{
+		{Format: AccessLogFormatJSON},
+		{Format: AccessLogFormatLogfmt, Fields: []string{"status", "header.X-Request-Id", "cookie.session"}},
+		{Format: AccessLogFormatTemplate, Template: "$$ ${status}ok $header.User-Agent"},
+	} {
+		if err := spec.Validate(); err != nil {
+			t.Errorf("spec %+v should be valid: %v", spec, err)
+		}
+	}
+}
+
+func TestAccessLogFormat(t *testing.T) {
+	ctx := newAccessLogTestContext()
+
+	tests := []struct {
+		spec *AccessLogSpec
+		want string
+	}{
+		{
+			spec: &AccessLogSpec{
+				Format: AccessLogFormatJSON,
+				Fields: []string{"time", "method", "uri", "status", "duration", "header.User-Agent", "cookie.session", "upstreamAddr", "traceID"},
+			},
+			want: `{"time":"2021-08-10T09:30:45.123Z","method":"GET","uri":"/api/users?id=1","status":200,` +
+				`"duration":12.345,"header.User-Agent":"curl/7.64","cookie.session":"abc",` +
+				`"upstreamAddr":"http://127.0.0.1:9095","traceID":""}`,
+		},
+		{
+			spec: &AccessLogSpec{
+				Format: AccessLogFormatLogfmt,
+				Fields: []string{"remoteAddr", "path", "status", "header.X-Missing", "tags"},
+			},
+			want: `remoteAddr=192.168.1.1:5678 path=/api/users status=200 header.X-Missing="" tags="tag1 | tag 2"`,
+		},
+		{
+			spec: &AccessLogSpec{
+				Format:   AccessLogFormatTemplate,
+				Template: `$remoteAddr "$method $uri $proto" ${status}$$ $header.User-Agent $header.X-Missing`,
+			},
+			want: `192.168.1.1:5678 "GET /api/users?id=1 HTTP/1.1" 200$ curl/7.64 -`,
+		},
+	}
+
+	for _, test := range tests {
+		if err := test.spec.Validate(); err != nil {
+			t.Fatalf("spec %+v should be valid: %v", test.spec, err)
+		}
+		got := NewAccessLog(test.spec).format(ctx)
+		if got != test.want {
+			t.Errorf("want:\n%s\ngot:\n%s", test.want, got)
+		}
+	}
+
+	got := NewAccessLog(&AccessLogSpec{Format: AccessLogFormatLogfmt}).format(ctx)
+	if want := `time=2021-08-10T09:30:45.123Z remoteAddr=192.168.1.1:5678`; got[:len(want)] != want {
+		t.Errorf("default fields should be used, got %s", got)
+	}
+}
+
+func TestAccessLogSkip(t *testing.T) {
+	ctx := newAccessLogTestContext()
+
+	al := NewAccessLog(&AccessLogSpec{Format: AccessLogFormatJSON})
+	if al.skip(ctx) {
+		t.Errorf("should not skip without exclusion and sampling")
+	}
+
+	al = NewAccessLog(&AccessLogSpec{Format: AccessLogFormatJSON, ExcludePaths: []string{"/api/users"}})
+	if !al.skip(ctx) {
+		t.Errorf("should skip the excluded path")
+	}
+
+	al = NewAccessLog(&AccessLogSpec{Format: AccessLogFormatJSON, ExcludePaths: []string{"/api/*"}})
+	if !al.skip(ctx) {
+		t.Errorf("should skip the path with the excluded prefix")
+	}
+
+	al = NewAccessLog(&AccessLogSpec{Format: AccessLogFormatJSON, ExcludePaths: []string{"/api"}})
+	if al.skip(ctx) {
+		t.Errorf("should not skip the path not excluded")
+	}
+
+	al = NewAccessLog(&AccessLogSpec{Format: AccessLogFormatJSON, SampleRate: 0.5})
+	skipped := 0
+	for i := 0; i < 1000; i++ {
+		if al.skip(ctx) {
+			skipped++
+		}
+	}
+	if skipped < 350 || skipped > 650 {
+		t.Errorf("about half should be skipped, got %d", skipped)
+	}
+}
@@ -45,6 +45,8 @@ type MockedHTTPContext struct {
 	MockedClientDisconnected func() bool
 	MockedOnFinish           func(func())
 	MockedAddTag             func(tag string)
+	MockedSetUpstreamAddr    func(addr string)
+	MockedSetAccessLog       func(al *context.AccessLog)
 	MockedStatMetric         func() *httpstat.Metric
 	MockedFinish             func()
 	MockedTemplate           func() texttemplate.TemplateEngine
@@ -159,6 +161,20 @@ func (c *MockedHTTPContext) AddTag(tag string) {
 	}
 }
 
+// SetUpstreamAddr mocks the SetUpstreamAddr function of HTTPContext
+func (c *MockedHTTPContext) SetUpstreamAddr(addr string) {
+	if c.MockedSetUpstreamAddr != nil {
+		c.MockedSetUpstreamAddr(addr)
+	}
+}
+
+// SetAccessLog mocks the SetAccessLog function of HTTPContext
+func (c *MockedHTTPContext) SetAccessLog(al *context.AccessLog) {
+	if c.MockedSetAccessLog != nil {
+		c.MockedSetAccessLog(al)
+	}
+}
+
 // StatMetric mocks the StatMetric function of HTTPContext
 func (c *MockedHTTPContext) StatMetric() *httpstat.Metric {
 	if c.MockedStatMetric != nil {
@@ -31,6 +31,7 @@ type MockedHTTPResponse struct {
 	MockedSetStatusCode func(code int)
 	MockedHeader        func() *httpheader.HTTPHeader
 	MockedSetCookie     func(cookie *http.Cookie)
+	MockedTrailer       func() *httpheader.HTTPHeader
 	MockedSetBody       func(body io.Reader)
 	MockedBody          func() io.Reader
 	MockedOnFlushBody   func(func(body []byte, complete bool) (newBody []byte))
@@ -68,6 +69,14 @@ func (r *MockedHTTPResponse) SetCookie(cookie *http.Cookie) {
 	}
 }
 
+// Trailer returns the trailer
+func (r *MockedHTTPResponse) Trailer() *httpheader.HTTPHeader {
+	if r.MockedTrailer != nil {
+		return r.MockedTrailer()
+	}
+	return nil
+}
+
 // SetBody sets the response body
 func (r *MockedHTTPResponse) SetBody(body io.Reader) {
 	if r.MockedSetBody != nil {
@@ -27,6 +27,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/tomasen/realip"
+
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/tracing"
 	"github.com/megaease/easegress/pkg/util/fasttime"
@@ -60,6 +62,13 @@ type (
 		OnFinish(func())   // For setting final client statistics, etc.
 		AddTag(tag string) // For debug, log, etc.
 
+		// SetUpstreamAddr sets the address of the upstream
+		// writing the response, it's used by the access log.
+		SetUpstreamAddr(addr string)
+		// SetAccessLog sets the format of the access log,
+		// the default one is used if it's nil.
+		SetAccessLog(al *AccessLog)
+
 		StatMetric() *httpstat.Metric
 
 		Finish()
@@ -114,6 +123,10 @@ type (
 		Header() *httpheader.HTTPHeader
 		SetCookie(cookie *http.Cookie)
 
+		// Trailer is sent after the body has been flushed,
+		// it only works for HTTP/2 and chunked HTTP/1.1 responses.
+		Trailer() *httpheader.HTTPHeader
+
 		SetBody(body io.Reader)
 		Body() io.Reader
 		OnFlushBody(func(body []byte, complete bool) (newBody []byte))
@@ -135,6 +148,9 @@ type (
 		tags        []string
 		caller      HandlerCaller
 
+		upstreamAddr string
+		accessLog    *AccessLog
+
 		r *httpRequest
 		w *httpResponse
 
@@ -154,12 +170,19 @@ type (
 // Reference: https://github.com/gin-gonic/gin/issues/1731
 func New(stdw http.ResponseWriter, stdr *http.Request,
 	tracer *tracing.Tracing, spanName string) HTTPContext {
+	return NewWithRealIP(stdw, stdr, tracer, spanName, realip.FromRequest(stdr))
+}
+
+// NewWithRealIP creates an HTTPContext with the real IP resolved by the caller,
+// New trusts the forwarding headers sent by anyone, which could be spoofed.
+func NewWithRealIP(stdw http.ResponseWriter, stdr *http.Request,
+	tracer *tracing.Tracing, spanName string, realIP string) HTTPContext {
 	originalReqCtx := stdr.Context()
 	stdctx, cancelFunc := stdcontext.WithCancel(originalReqCtx)
 	stdr = stdr.WithContext(stdctx)
 
 	startTime := fasttime.Now()
-	span := tracing.NewSpanWithStart(tracer, spanName, startTime)
+	span := tracing.NewSpanFromHTTPHeader(tracer, spanName, startTime, stdr.Header)
 	span.SetTag("http.method", stdr.Method)
 	span.SetTag("http.path", stdr.URL.Path)
 	return &httpContext{
@@ -168,7 +191,7 @@ func New(stdw http.ResponseWriter, stdr *http.Request,
 		originalReqCtx: originalReqCtx,
 		stdctx:         stdctx,
 		cancelFunc:     cancelFunc,
-		r:              newHTTPRequest(stdr),
+		r:              newHTTPRequest(stdr, realIP),
 		w:              newHTTPResponse(stdw, stdr),
 	}
 }
@@ -197,6 +220,14 @@ func (ctx *httpContext) AddTag(tag string) {
 	ctx.tags = append(ctx.tags, tag)
 }
 
+func (ctx *httpContext) SetUpstreamAddr(addr string) {
+	ctx.upstreamAddr = addr
+}
+
+func (ctx *httpContext) SetAccessLog(al *AccessLog) {
+	ctx.accessLog = al
+}
+
 func (ctx *httpContext) Request() HTTPRequest {
 	return ctx.r
 }
@@ -273,6 +304,15 @@ func (ctx *httpContext) Finish() {
 		}()
 	}
 
+	if ctx.accessLog != nil {
+		if !ctx.accessLog.skip(ctx) {
+			logger.LazyHTTPAccess(func() string {
+				return ctx.accessLog.format(ctx)
+			})
+		}
+		return
+	}
+
 	logger.LazyHTTPAccess(func() string {
 		stdr := ctx.r.std
 
@@ -21,8 +21,6 @@ import (
 	"io"
 	"net/http"
 
-	"github.com/tomasen/realip"
-
 	"github.com/megaease/easegress/pkg/util/callbackreader"
 	"github.com/megaease/easegress/pkg/util/httpheader"
 )
@@ -40,7 +38,7 @@ type (
 	}
 )
 
-func newHTTPRequest(stdr *http.Request) *httpRequest {
+func newHTTPRequest(stdr *http.Request, realIP string) *httpRequest {
 	// Reference: https://golang.org/pkg/net/http/#Request
 	//
 	// For incoming requests, the Host header is promoted to the
@@ -55,7 +53,7 @@ func newHTTPRequest(stdr *http.Request) *httpRequest {
 		path:   stdr.URL.Path,
 		header: httpheader.New(stdr.Header),
 		body:   callbackreader.New(stdr.Body),
-		realIP: realip.FromRequest(stdr),
+		realIP: realIP,
 	}
 
 	// NOTE: Always count original body, even the body could be changed
@@ -25,6 +25,7 @@ import (
 	"strconv"
 
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/grpcstatus"
 	"github.com/megaease/easegress/pkg/util/httpheader"
 )
 
@@ -39,21 +40,29 @@ type (
 		stdr *http.Request
 		std  http.ResponseWriter
 
-		code   int
-		header *httpheader.HTTPHeader
+		code    int
+		header  *httpheader.HTTPHeader
+		trailer *httpheader.HTTPHeader
 
 		body           io.Reader
 		bodyWritten    uint64
 		bodyFlushFuncs []BodyFlushFunc
 	}
+
+	// flushWriter flushes data to the client after every writing.
+	flushWriter struct {
+		w       io.Writer
+		flusher http.Flusher
+	}
 )
 
 func newHTTPResponse(stdw http.ResponseWriter, stdr *http.Request) *httpResponse {
 	return &httpResponse{
-		stdr:   stdr,
-		std:    stdw,
-		code:   http.StatusOK,
-		header: httpheader.New(stdw.Header()),
+		stdr:    stdr,
+		std:     stdw,
+		code:    http.StatusOK,
+		header:  httpheader.New(stdw.Header()),
+		trailer: httpheader.New(http.Header{}),
 	}
 }
 
@@ -73,6 +82,10 @@ func (w *httpResponse) SetCookie(cookie *http.Cookie) {
 	http.SetCookie(w.std, cookie)
 }
 
+func (w *httpResponse) Trailer() *httpheader.HTTPHeader {
+	return w.trailer
+}
+
 func (w *httpResponse) Body() io.Reader {
 	return w.body
 }
@@ -102,8 +115,16 @@ func (w *httpResponse) flushBody() {
 		}
 	}()
 
+	var dst io.Writer = w.std
+	if grpcstatus.IsGRPC(w.header) {
+		// NOTE: gRPC streams must be flushed message by message.
+		if flusher, ok := w.std.(http.Flusher); ok {
+			dst = &flushWriter{w: w.std, flusher: flusher}
+		}
+	}
+
 	copyToClient := func(src io.Reader) (succeed bool) {
-		written, err := io.Copy(w.std, src)
+		written, err := io.Copy(dst, src)
 		if err != nil {
 			logger.Warnf("copy body failed: %v", err)
 			return false
@@ -162,6 +183,25 @@ func (w *httpResponse) finish() {
 	// NOTE: WriteHeader must be called at most one time.
 	w.std.WriteHeader(w.StatusCode())
 	w.flushBody()
+	w.flushTrailer()
+}
+
+// flushTrailer sends trailers which are not declared before writing header.
+// Reference: https://golang.org/pkg/net/http/#example_ResponseWriter_trailers
+func (w *httpResponse) flushTrailer() {
+	for key, values := range w.trailer.Std() {
+		for _, value := range values {
+			w.std.Header().Add(http.TrailerPrefix+key, value)
+		}
+	}
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if err == nil {
+		fw.flusher.Flush()
+	}
+	return n, err
 }
 
 func (w *httpResponse) Size() uint64 {
@@ -192,6 +192,7 @@ func (aa *APIAggregator) handle(ctx context.HTTPContext) (result string) {
 	wg.Add(len(aa.spec.Pipelines))
 
 	httpResps := make([]context.HTTPResponse, len(aa.spec.Pipelines))
+	realIP := ctx.Request().RealIP()
 	for i, p := range aa.spec.Pipelines {
 		req, err := aa.newHTTPReq(ctx, p, buff)
 		if err != nil {
@@ -208,7 +209,8 @@ func (aa *APIAggregator) handle(ctx context.HTTPContext) (result string) {
 				return
 			}
 			w := httptest.NewRecorder()
-			copyCtx := context.New(w, req, tracing.NoopTracing, "no trace")
+			// NOTE: Keep the real IP resolved by the HTTPServer.
+			copyCtx := context.NewWithRealIP(w, req, tracing.NoopTracing, "no trace", realIP)
 			handler.Handle(copyCtx)
 			rsp := copyCtx.Response()
 
@@ -0,0 +1,387 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bodytransformer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+const (
+	// Kind is the kind of BodyTransformer.
+	Kind = "BodyTransformer"
+
+	resultTransformError = "transformError"
+
+	formatJSON = "json"
+	formatXML  = "xml"
+	formatForm = "form"
+
+	opSet    = "set"
+	opDelete = "delete"
+	opMove   = "move"
+	opCopy   = "copy"
+
+	// pathThis is the path of the whole document.
+	pathThis = "@this"
+)
+
+var results = []string{resultTransformError}
+
+var contentTypes = map[string]string{
+	formatJSON: "application/json",
+	formatXML:  "application/xml",
+	formatForm: "application/x-www-form-urlencoded",
+}
+
+func init() {
+	httppipeline.Register(&BodyTransformer{})
+}
+
+type (
+	// BodyTransformer is filter BodyTransformer.
+	BodyTransformer struct {
+		filterSpec *httppipeline.FilterSpec
+		spec       *Spec
+	}
+
+	// Spec is BodyTransformer Spec.
+	Spec struct {
+		// Request is transformed before calling the next filters.
+		Request *TransformSpec `yaml:"request,omitempty" jsonschema:"omitempty"`
+		// Response is transformed after the next filters succeeded.
+		Response *TransformSpec `yaml:"response,omitempty" jsonschema:"omitempty"`
+	}
+
+	// TransformSpec describes how to transform the body. The body is
+	// converted from the original format to JSON, applied operations,
+	// and then converted to the target format.
+	TransformSpec struct {
+		From       string       `yaml:"from" jsonschema:"omitempty,enum=,enum=json,enum=xml,enum=form"`
+		To         string       `yaml:"to" jsonschema:"omitempty,enum=,enum=json,enum=xml,enum=form"`
+		XMLRoot    string       `yaml:"xmlRoot" jsonschema:"omitempty"`
+		Operations []*Operation `yaml:"operations" jsonschema:"omitempty"`
+	}
+
+	// Operation is an operation on the JSON document, the paths are
+	// in the syntax of gjson, and "@this" stands for the whole document.
+	Operation struct {
+		Op   string `yaml:"op" jsonschema:"required,enum=set,enum=delete,enum=move,enum=copy"`
+		Path string `yaml:"path" jsonschema:"required"`
+		From string `yaml:"from" jsonschema:"omitempty"`
+		// Value is the value to set, which could contain templates.
+		Value string `yaml:"value" jsonschema:"omitempty"`
+		// Raw means the value is raw JSON, such as an object, an array,
+		// a number or a boolean, instead of a string.
+		Raw bool `yaml:"raw" jsonschema:"omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	if spec.Request == nil && spec.Response == nil {
+		return fmt.Errorf("neither request nor response is specified")
+	}
+	return nil
+}
+
+// Validate validates TransformSpec.
+func (spec TransformSpec) Validate() error {
+	if spec.from() == spec.to() && len(spec.Operations) == 0 {
+		return fmt.Errorf("nothing to transform")
+	}
+	return nil
+}
+
+// Validate validates Operation.
+func (op Operation) Validate() error {
+	switch op.Op {
+	case opSet:
+		if op.From != "" {
+			return fmt.Errorf("from is not allowed by %s", op.Op)
+		}
+		// NOTE: The value with templates is checked after rendered.
+		if op.Raw && !gjson.Valid(op.Value) && !hasTemplates(op.Value) {
+			return fmt.Errorf("invalid raw json value: %s", op.Value)
+		}
+	case opDelete:
+		if op.Path == pathThis {
+			return fmt.Errorf("%s is not allowed to be deleted", pathThis)
+		}
+		if op.From != "" || op.Value != "" {
+			return fmt.Errorf("from and value are not allowed by %s", op.Op)
+		}
+	case opMove, opCopy:
+		if op.From == "" {
+			return fmt.Errorf("from is required by %s", op.Op)
+		}
+		if op.Value != "" {
+			return fmt.Errorf("value is not allowed by %s", op.Op)
+		}
+	}
+
+	return nil
+}
+
+// hasTemplates is a rough check for the templates of HTTPTemplate,
+// which are validated by the pipeline.
+func hasTemplates(s string) bool {
+	return bytes.Contains([]byte(s), []byte("[["))
+}
+
+func (spec *TransformSpec) from() string {
+	if spec.From == "" {
+		return formatJSON
+	}
+	return spec.From
+}
+
+func (spec *TransformSpec) to() string {
+	if spec.To == "" {
+		return spec.from()
+	}
+	return spec.To
+}
+
+// Kind returns the kind of BodyTransformer.
+func (bt *BodyTransformer) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns default spec of BodyTransformer.
+func (bt *BodyTransformer) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Description returns the description of BodyTransformer.
+func (bt *BodyTransformer) Description() string {
+	return "BodyTransformer transforms the body of request and response."
+}
+
+// Results returns the results of BodyTransformer.
+func (bt *BodyTransformer) Results() []string {
+	return results
+}
+
+// Init initializes BodyTransformer.
+func (bt *BodyTransformer) Init(filterSpec *httppipeline.FilterSpec) {
+	bt.filterSpec, bt.spec = filterSpec, filterSpec.FilterSpec().(*Spec)
+	bt.reload()
+}
+
+// Inherit inherits previous generation of BodyTransformer.
+func (bt *BodyTransformer) Inherit(filterSpec *httppipeline.FilterSpec, previousGeneration httppipeline.Filter) {
+	previousGeneration.Close()
+	bt.Init(filterSpec)
+}
+
+func (bt *BodyTransformer) reload() {
+	// Nothing to do.
+}
+
+// Handle transforms the body of request and response.
+func (bt *BodyTransformer) Handle(ctx context.HTTPContext) string {
+	if bt.spec.Request != nil {
+		r := ctx.Request()
+		body, err := bt.transform(ctx, bt.spec.Request, r.Body(), r.Header())
+		if err != nil {
+			ctx.AddTag(fmt.Sprintf("bodyTransformer: transform request failed: %v", err))
+			ctx.Response().SetStatusCode(http.StatusBadRequest)
+			return ctx.CallNextHandler(resultTransformError)
+		}
+		r.SetBody(bytes.NewReader(body))
+	}
+
+	result := ctx.CallNextHandler("")
+	if result != "" || bt.spec.Response == nil {
+		return result
+	}
+
+	// NOTE: These responses must not have a body.
+	w := ctx.Response()
+	if ctx.Request().Method() == http.MethodHead ||
+		w.StatusCode() == http.StatusNoContent || w.StatusCode() == http.StatusNotModified {
+		return result
+	}
+
+	// NOTE: The response is passed through if it can't be decoded,
+	// since it isn't the fault of the client.
+	if encoding := contentEncoding(w.Header()); !decodable(encoding) {
+		ctx.AddTag(fmt.Sprintf("bodyTransformer: skip response with content encoding %s", encoding))
+		return result
+	}
+
+	body, err := bt.transform(ctx, bt.spec.Response, w.Body(), w.Header())
+	if err != nil {
+		ctx.AddTag(fmt.Sprintf("bodyTransformer: transform response failed: %v", err))
+		w.SetStatusCode(http.StatusInternalServerError)
+		w.SetBody(nil)
+		w.Header().Del(httpheader.KeyContentLength)
+		return resultTransformError
+	}
+	w.SetBody(bytes.NewReader(body))
+
+	return result
+}
+
+// transform reads and transforms the body, the header is adapted to the new body.
+func (bt *BodyTransformer) transform(ctx context.HTTPContext, spec *TransformSpec,
+	reader io.Reader, header *httpheader.HTTPHeader) ([]byte, error) {
+	var body []byte
+	if reader != nil {
+		var err error
+		body, err = io.ReadAll(reader)
+		if closer, ok := reader.(io.Closer); ok {
+			closer.Close()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read body failed: %v", err)
+		}
+	}
+
+	// The transformed body is sent without encoding.
+	body, err := decode(body, contentEncoding(header))
+	if err != nil {
+		return nil, err
+	}
+	header.Del(httpheader.KeyContentEncoding)
+
+	doc, err := toJSON(body, spec.from())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range spec.Operations {
+		doc, err = applyOperation(ctx, doc, op)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	body, err = fromJSON(doc, spec.to(), spec.XMLRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	if spec.to() != spec.from() {
+		header.Set(httpheader.KeyContentType, contentTypes[spec.to()])
+	}
+	header.Set(httpheader.KeyContentLength, strconv.Itoa(len(body)))
+
+	return body, nil
+}
+
+func toJSON(body []byte, format string) ([]byte, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return []byte("{}"), nil
+	}
+
+	switch format {
+	case formatXML:
+		return xmlToJSON(body)
+	case formatForm:
+		return formToJSON(body)
+	default:
+		if !gjson.ValidBytes(body) {
+			return nil, fmt.Errorf("invalid json")
+		}
+		return body, nil
+	}
+}
+
+func fromJSON(doc []byte, format, xmlRoot string) ([]byte, error) {
+	switch format {
+	case formatXML:
+		return jsonToXML(doc, xmlRoot)
+	case formatForm:
+		return jsonToForm(doc)
+	default:
+		return doc, nil
+	}
+}
+
+func setRaw(doc []byte, path string, raw []byte) ([]byte, error) {
+	if path == pathThis {
+		return raw, nil
+	}
+	return sjson.SetRawBytes(doc, path, raw)
+}
+
+func applyOperation(ctx context.HTTPContext, doc []byte, op *Operation) ([]byte, error) {
+	var err error
+
+	switch op.Op {
+	case opSet:
+		value := op.Value
+		if hte := ctx.Template(); hte != nil && hte.HasTemplates(value) {
+			value, err = hte.Render(value)
+			if err != nil {
+				return nil, fmt.Errorf("render value %s failed: %v", op.Value, err)
+			}
+		}
+		if !op.Raw {
+			buff := bytes.NewBuffer(nil)
+			writeJSONString(buff, value)
+			value = buff.String()
+		} else if !gjson.Valid(value) {
+			return nil, fmt.Errorf("invalid raw json value of %s: %s", op.Path, value)
+		}
+		doc, err = setRaw(doc, op.Path, []byte(value))
+
+	case opDelete:
+		doc, err = sjson.DeleteBytes(doc, op.Path)
+
+	case opMove, opCopy:
+		value := gjson.GetBytes(doc, op.From)
+		if !value.Exists() {
+			// NOTE: Nothing to move or copy.
+			return doc, nil
+		}
+		raw := []byte(value.Raw)
+		if op.Op == opMove {
+			if op.From == pathThis {
+				doc = []byte("{}")
+			} else if doc, err = sjson.DeleteBytes(doc, op.From); err != nil {
+				break
+			}
+		}
+		doc, err = setRaw(doc, op.Path, raw)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %v", op.Op, op.Path, err)
+	}
+
+	return doc, nil
+}
+
+// Status returns status.
+func (bt *BodyTransformer) Status() interface{} { return nil }
+
+// Close closes BodyTransformer.
+func (bt *BodyTransformer) Close() {}
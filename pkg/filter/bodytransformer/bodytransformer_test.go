@@ -0,0 +1,319 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bodytransformer
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/texttemplate"
+	"github.com/megaease/easegress/pkg/util/yamltool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newBodyTransformer(t *testing.T, yamlSpec string) *BodyTransformer {
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, err := httppipeline.NewFilterSpec(rawSpec, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bt := &BodyTransformer{}
+	bt.Init(spec)
+	return bt
+}
+
+type mockedBody struct {
+	body   io.Reader
+	header http.Header
+}
+
+func newMockedContext(reqBody, respBody string) (*contexttest.MockedHTTPContext, *mockedBody, *mockedBody) {
+	req := &mockedBody{body: strings.NewReader(reqBody), header: http.Header{}}
+	resp := &mockedBody{body: strings.NewReader(respBody), header: http.Header{}}
+
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedMethod = func() string { return http.MethodPost }
+	ctx.MockedRequest.MockedBody = func() io.Reader { return req.body }
+	ctx.MockedRequest.MockedSetBody = func(body io.Reader) { req.body = body }
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader { return httpheader.New(req.header) }
+	ctx.MockedResponse.MockedStatusCode = func() int { return http.StatusOK }
+	ctx.MockedResponse.MockedBody = func() io.Reader { return resp.body }
+	ctx.MockedResponse.MockedSetBody = func(body io.Reader) { resp.body = body }
+	ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader { return httpheader.New(resp.header) }
+	ctx.MockedCallNextHandler = func(lastResult string) string { return lastResult }
+	ctx.MockedTemplate = func() texttemplate.TemplateEngine {
+		tt, _ := texttemplate.NewDefault([]string{"filter.{}.req.header.{}"})
+		tt.SetDict("filter.auth.req.header.X-User", "alice")
+		return tt
+	}
+
+	return ctx, req, resp
+}
+
+func readBody(t *testing.T, b *mockedBody) string {
+	data, err := io.ReadAll(b.body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestJSONOperations(t *testing.T) {
+	bt := newBodyTransformer(t, `
+kind: BodyTransformer
+name: bt
+request:
+  operations:
+  - op: move
+    path: userName
+    from: user.name
+  - op: delete
+    path: user.password
+  - op: copy
+    path: owner
+    from: userName
+  - op: set
+    path: meta.operator
+    value: "[[filter.auth.req.header.X-User]]"
+  - op: set
+    path: meta.tags
+    value: '["a","b"]'
+    raw: true
+  - op: copy
+    path: missing
+    from: notExist
+response:
+  operations:
+  - op: move
+    path: data
+    from: "@this"
+  - op: set
+    path: code
+    value: "0"
+    raw: true
+`)
+
+	ctx, req, resp := newMockedContext(
+		`{"user":{"name":"bob","password":"secret"}}`,
+		`[1,2]`,
+	)
+	if result := bt.Handle(ctx); result != "" {
+		t.Fatalf("unexpected result %s", result)
+	}
+
+	expected := `{"user":{},"userName":"bob","owner":"bob","meta":{"operator":"alice","tags":["a","b"]}}`
+	if got := readBody(t, req); got != expected {
+		t.Errorf("expected request body %s, got %s", expected, got)
+	}
+	if got := req.header.Get(httpheader.KeyContentLength); got != strconv.Itoa(len(expected)) {
+		t.Errorf("unexpected content length %s", got)
+	}
+
+	expected = `{"data":[1,2],"code":0}`
+	if got := readBody(t, resp); got != expected {
+		t.Errorf("expected response body %s, got %s", expected, got)
+	}
+}
+
+func TestTransformError(t *testing.T) {
+	bt := newBodyTransformer(t, `
+kind: BodyTransformer
+name: bt
+request:
+  operations:
+  - op: delete
+    path: password
+`)
+
+	statusCode := 0
+	ctx, _, _ := newMockedContext(`{"password":`, "")
+	ctx.MockedResponse.MockedSetStatusCode = func(code int) { statusCode = code }
+	if result := bt.Handle(ctx); result != resultTransformError {
+		t.Errorf("expected result %s, got %s", resultTransformError, result)
+	}
+	if statusCode != http.StatusBadRequest {
+		t.Errorf("expected status code 400, got %d", statusCode)
+	}
+}
+
+func TestContentEncoding(t *testing.T) {
+	bt := newBodyTransformer(t, `
+kind: BodyTransformer
+name: bt
+response:
+  operations:
+  - op: move
+    path: data
+    from: "@this"
+`)
+
+	buff := &bytes.Buffer{}
+	gw := gzip.NewWriter(buff)
+	gw.Write([]byte(`[1,2]`))
+	gw.Close()
+
+	ctx, _, resp := newMockedContext("", buff.String())
+	resp.header.Set(httpheader.KeyContentEncoding, "gzip")
+	if result := bt.Handle(ctx); result != "" {
+		t.Fatalf("unexpected result %s", result)
+	}
+	expected := `{"data":[1,2]}`
+	if got := readBody(t, resp); got != expected {
+		t.Errorf("expected response body %s, got %s", expected, got)
+	}
+	if got := resp.header.Get(httpheader.KeyContentEncoding); got != "" {
+		t.Errorf("content encoding should be removed, got %s", got)
+	}
+
+	// The response which can't be decoded is passed through.
+	ctx, _, resp = newMockedContext("", "compressed")
+	resp.header.Set(httpheader.KeyContentEncoding, "compress")
+	ctx.MockedResponse.MockedSetStatusCode = func(code int) {
+		t.Errorf("status code should not be changed, got %d", code)
+	}
+	if result := bt.Handle(ctx); result != "" {
+		t.Fatalf("unexpected result %s", result)
+	}
+	if got := readBody(t, resp); got != "compressed" {
+		t.Errorf("expected untouched response body, got %s", got)
+	}
+	if got := resp.header.Get(httpheader.KeyContentEncoding); got != "compress" {
+		t.Errorf("content encoding should be kept, got %s", got)
+	}
+}
+
+func TestFormatConversions(t *testing.T) {
+	bt := newBodyTransformer(t, `
+kind: BodyTransformer
+name: bt
+request:
+  from: form
+  to: json
+response:
+  from: xml
+  to: json
+  operations:
+  - op: move
+    path: "@this"
+    from: order
+`)
+
+	ctx, req, resp := newMockedContext(
+		"name=bob&tag=a&tag=b",
+		`<?xml version="1.0"?><order id="1"><item>a</item><item>b</item><note lang="en">hi</note></order>`,
+	)
+	bt.Handle(ctx)
+
+	expected := `{"name":"bob","tag":["a","b"]}`
+	if got := readBody(t, req); got != expected {
+		t.Errorf("expected request body %s, got %s", expected, got)
+	}
+	if got := req.header.Get(httpheader.KeyContentType); got != "application/json" {
+		t.Errorf("unexpected content type %s", got)
+	}
+
+	expected = `{"@id":"1","item":["a","b"],"note":{"@lang":"en","#text":"hi"}}`
+	if got := readBody(t, resp); got != expected {
+		t.Errorf("expected response body %s, got %s", expected, got)
+	}
+}
+
+func TestJSONToXMLAndForm(t *testing.T) {
+	doc := `{"order":{"@id":"1","item":["a","b"],"note":{"@lang":"en","#text":"x<y"},"empty":null}}`
+	got, err := jsonToXML([]byte(doc), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<order id="1"><item>a</item><item>b</item><note lang="en">x&lt;y</note><empty/></order>`
+	if string(got) != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	back, err := xmlToJSON(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `{"order":{"@id":"1","item":["a","b"],"note":{"@lang":"en","#text":"x<y"},"empty":""}}`
+	if string(back) != expected {
+		t.Errorf("expected %s, got %s", expected, back)
+	}
+
+	got, err = jsonToXML([]byte(`{"a":1,"b":true}`), "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected = `<data><a>1</a><b>true</b></data>`; string(got) != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	got, err = jsonToForm([]byte(`{"name":"bob","tag":["a","b"],"n":1,"obj":{"k":"v"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected = `n=1&name=bob&obj=%7B%22k%22%3A%22v%22%7D&tag=a&tag=b`; string(got) != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+	if _, err = jsonToForm([]byte(`[1]`)); err == nil {
+		t.Errorf("expected error of converting array to form")
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	cases := []struct {
+		op    Operation
+		valid bool
+	}{
+		{Operation{Op: opSet, Path: "a", Value: "1"}, true},
+		{Operation{Op: opSet, Path: "a", Value: "{", Raw: true}, false},
+		{Operation{Op: opSet, Path: "a", Value: "[[filter.a.rsp.body]]", Raw: true}, true},
+		{Operation{Op: opDelete, Path: pathThis}, false},
+		{Operation{Op: opMove, Path: "a"}, false},
+		{Operation{Op: opCopy, Path: "a", From: "b", Value: "c"}, false},
+	}
+	for i, c := range cases {
+		if err := c.op.Validate(); (err == nil) != c.valid {
+			t.Errorf("case %d: expected valid %v, got error %v", i, c.valid, err)
+		}
+	}
+
+	if (Spec{}).Validate() == nil {
+		t.Errorf("empty spec should be invalid")
+	}
+	if (TransformSpec{From: formatXML, To: formatXML}).Validate() == nil {
+		t.Errorf("nothing to transform should be invalid")
+	}
+}
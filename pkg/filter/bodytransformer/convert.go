@@ -0,0 +1,344 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bodytransformer
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// When converting between XML and JSON, the attributes are prefixed
+// with "@", and the text of an element with attributes or children is
+// the value of "#text", for example, <order id="1"><item>a</item>
+// <item>b</item><note>n</note></order> is converted to, and from
+// {"order":{"@id":"1","item":["a","b"],"note":"n"}}.
+const (
+	xmlAttrPrefix = "@"
+	xmlTextKey    = "#text"
+
+	defaultXMLRoot = "root"
+	xmlArrayItem   = "item"
+)
+
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr
+	children []*xmlNode
+	text     strings.Builder
+}
+
+// xmlToJSON converts the XML document to JSON.
+func xmlToJSON(body []byte) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+
+	var root *xmlNode
+	stack := []*xmlNode{}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decode xml failed: %v", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name.Local, attrs: t.Attr}
+			if len(stack) == 0 {
+				if root != nil {
+					return nil, fmt.Errorf("decode xml failed: multiple root elements")
+				}
+				root = node
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) != 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		}
+	}
+
+	if root == nil {
+		return []byte("{}"), nil
+	}
+
+	buff := bytes.NewBuffer(nil)
+	buff.WriteByte('{')
+	writeJSONString(buff, root.name)
+	buff.WriteByte(':')
+	root.writeJSON(buff)
+	buff.WriteByte('}')
+
+	return buff.Bytes(), nil
+}
+
+func writeJSONString(buff *bytes.Buffer, s string) {
+	// NOTE: The encoder escapes HTML by default, which is not expected here.
+	encoder := json.NewEncoder(buff)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	// Remove the newline appended by the encoder.
+	buff.Truncate(buff.Len() - 1)
+}
+
+func (n *xmlNode) writeJSON(buff *bytes.Buffer) {
+	text := strings.TrimSpace(n.text.String())
+	if len(n.attrs) == 0 && len(n.children) == 0 {
+		writeJSONString(buff, text)
+		return
+	}
+
+	// NOTE: The children of the same name are grouped into an array,
+	// in the order of their first appearance.
+	names := []string{}
+	groups := map[string][]*xmlNode{}
+	for _, child := range n.children {
+		if _, exists := groups[child.name]; !exists {
+			names = append(names, child.name)
+		}
+		groups[child.name] = append(groups[child.name], child)
+	}
+
+	first := true
+	writeKey := func(key string) {
+		if !first {
+			buff.WriteByte(',')
+		}
+		first = false
+		writeJSONString(buff, key)
+		buff.WriteByte(':')
+	}
+
+	buff.WriteByte('{')
+	for _, attr := range n.attrs {
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		writeKey(xmlAttrPrefix + attr.Name.Local)
+		writeJSONString(buff, attr.Value)
+	}
+	for _, name := range names {
+		writeKey(name)
+		group := groups[name]
+		if len(group) == 1 {
+			group[0].writeJSON(buff)
+			continue
+		}
+		buff.WriteByte('[')
+		for i, child := range group {
+			if i != 0 {
+				buff.WriteByte(',')
+			}
+			child.writeJSON(buff)
+		}
+		buff.WriteByte(']')
+	}
+	if text != "" {
+		writeKey(xmlTextKey)
+		writeJSONString(buff, text)
+	}
+	buff.WriteByte('}')
+}
+
+// jsonToXML converts the JSON document to XML. An object with only one key
+// is the root element, otherwise the document is wrapped in the root.
+func jsonToXML(body []byte, root string) ([]byte, error) {
+	if !gjson.ValidBytes(body) {
+		return nil, fmt.Errorf("invalid json")
+	}
+	if root == "" {
+		root = defaultXMLRoot
+	}
+
+	doc := gjson.ParseBytes(body)
+	buff := bytes.NewBuffer(nil)
+
+	if doc.IsObject() {
+		keys := 0
+		var key string
+		var value gjson.Result
+		doc.ForEach(func(k, v gjson.Result) bool {
+			keys++
+			key, value = k.String(), v
+			return true
+		})
+		if keys == 1 && !value.IsArray() && !strings.HasPrefix(key, xmlAttrPrefix) && key != xmlTextKey {
+			writeXMLElement(buff, key, value)
+			return buff.Bytes(), nil
+		}
+	}
+
+	if doc.IsArray() {
+		buff.WriteString("<" + root + ">")
+		doc.ForEach(func(_, v gjson.Result) bool {
+			writeXMLElement(buff, xmlArrayItem, v)
+			return true
+		})
+		buff.WriteString("</" + root + ">")
+		return buff.Bytes(), nil
+	}
+
+	writeXMLElement(buff, root, doc)
+	return buff.Bytes(), nil
+}
+
+func writeXMLText(buff *bytes.Buffer, s string) {
+	xml.EscapeText(buff, []byte(s))
+}
+
+func writeXMLElement(buff *bytes.Buffer, name string, value gjson.Result) {
+	if value.IsArray() {
+		value.ForEach(func(_, v gjson.Result) bool {
+			writeXMLElement(buff, name, v)
+			return true
+		})
+		return
+	}
+
+	buff.WriteString("<" + name)
+
+	if !value.IsObject() {
+		if value.Type == gjson.Null {
+			buff.WriteString("/>")
+			return
+		}
+		buff.WriteByte('>')
+		writeXMLText(buff, value.String())
+		buff.WriteString("</" + name + ">")
+		return
+	}
+
+	value.ForEach(func(k, v gjson.Result) bool {
+		if key := k.String(); strings.HasPrefix(key, xmlAttrPrefix) {
+			buff.WriteString(" " + key[len(xmlAttrPrefix):] + `="`)
+			writeXMLText(buff, v.String())
+			buff.WriteByte('"')
+		}
+		return true
+	})
+	buff.WriteByte('>')
+
+	value.ForEach(func(k, v gjson.Result) bool {
+		switch key := k.String(); {
+		case strings.HasPrefix(key, xmlAttrPrefix):
+		case key == xmlTextKey:
+			writeXMLText(buff, v.String())
+		default:
+			writeXMLElement(buff, key, v)
+		}
+		return true
+	})
+
+	buff.WriteString("</" + name + ">")
+}
+
+// formToJSON converts the form to a JSON object, whose values are strings,
+// or arrays of strings if there are multiple values of a key.
+func formToJSON(body []byte) ([]byte, error) {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("parse form failed: %v", err)
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buff := bytes.NewBuffer(nil)
+	buff.WriteByte('{')
+	for i, k := range keys {
+		if i != 0 {
+			buff.WriteByte(',')
+		}
+		writeJSONString(buff, k)
+		buff.WriteByte(':')
+
+		vs := values[k]
+		if len(vs) == 1 {
+			writeJSONString(buff, vs[0])
+			continue
+		}
+		buff.WriteByte('[')
+		for j, v := range vs {
+			if j != 0 {
+				buff.WriteByte(',')
+			}
+			writeJSONString(buff, v)
+		}
+		buff.WriteByte(']')
+	}
+	buff.WriteByte('}')
+
+	return buff.Bytes(), nil
+}
+
+// jsonToForm converts the JSON object to a form, the elements of arrays
+// are multiple values of the key, and the nested objects are kept in JSON.
+func jsonToForm(body []byte) ([]byte, error) {
+	if !gjson.ValidBytes(body) {
+		return nil, fmt.Errorf("invalid json")
+	}
+
+	doc := gjson.ParseBytes(body)
+	if !doc.IsObject() {
+		return nil, fmt.Errorf("only json object could be converted to form")
+	}
+
+	values := url.Values{}
+	doc.ForEach(func(k, v gjson.Result) bool {
+		key := k.String()
+		if v.IsArray() {
+			v.ForEach(func(_, item gjson.Result) bool {
+				values.Add(key, formValue(item))
+				return true
+			})
+			return true
+		}
+		values.Add(key, formValue(v))
+		return true
+	})
+
+	return []byte(values.Encode()), nil
+}
+
+func formValue(v gjson.Result) string {
+	switch v.Type {
+	case gjson.Null:
+		return ""
+	case gjson.JSON:
+		return v.Raw
+	default:
+		return v.String()
+	}
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bodytransformer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+// Content codings.
+// Reference: https://www.iana.org/assignments/http-parameters/http-parameters.xhtml#content-coding
+const (
+	encodingGzip     = "gzip"
+	encodingBrotli   = "br"
+	encodingZstd     = "zstd"
+	encodingDeflate  = "deflate"
+	encodingIdentity = "identity"
+)
+
+// contentEncoding returns the content coding of the body, it returns
+// an empty string if the body is not encoded.
+func contentEncoding(h *httpheader.HTTPHeader) string {
+	encoding := strings.ToLower(strings.TrimSpace(h.Get(httpheader.KeyContentEncoding)))
+	if encoding == encodingIdentity {
+		return ""
+	}
+	return encoding
+}
+
+// decodable returns whether the body in the encoding could be decoded,
+// multiple codings applied to the body are not supported.
+func decodable(encoding string) bool {
+	switch encoding {
+	case "", encodingGzip, encodingDeflate, encodingBrotli, encodingZstd:
+		return true
+	default:
+		return false
+	}
+}
+
+// decode decodes the body in the encoding.
+func decode(body []byte, encoding string) ([]byte, error) {
+	var r io.Reader
+	switch encoding {
+	case "":
+		return body, nil
+	case encodingGzip:
+		gr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("decode %s body failed: %v", encoding, err)
+		}
+		defer gr.Close()
+		r = gr
+	case encodingDeflate:
+		zr, err := zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("decode %s body failed: %v", encoding, err)
+		}
+		defer zr.Close()
+		r = zr
+	case encodingBrotli:
+		r = brotli.NewReader(bytes.NewReader(body))
+	case encodingZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(body), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("decode %s body failed: %v", encoding, err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %s", encoding)
+	}
+
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s body failed: %v", encoding, err)
+	}
+	return decoded, nil
+}
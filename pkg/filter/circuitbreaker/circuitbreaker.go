@@ -29,6 +29,8 @@ import (
 	"github.com/megaease/easegress/pkg/object/httppipeline"
 	libcb "github.com/megaease/easegress/pkg/util/circuitbreaker"
 	"github.com/megaease/easegress/pkg/util/fasttime"
+	"github.com/megaease/easegress/pkg/util/grpcstatus"
+	"github.com/megaease/easegress/pkg/util/prometheushelper"
 	"github.com/megaease/easegress/pkg/util/urlrule"
 )
 
@@ -40,6 +42,15 @@ const (
 
 var results = []string{resultShortCircuited}
 
+var (
+	stateGauge = prometheushelper.NewGauge("circuitbreaker", "state",
+		"The state of the circuit breaker, 0: disabled, 1: closed, 2: half open, 3: open, 4: force open.",
+		[]string{"pipeline", "filter", "url"})
+	shortCircuitedTotal = prometheushelper.NewCounter("circuitbreaker", "short_circuited_total",
+		"The total number of requests rejected by the circuit breaker.",
+		[]string{"pipeline", "filter", "url"})
+)
+
 func init() {
 	httppipeline.Register(&CircuitBreaker{})
 }
@@ -59,6 +70,7 @@ type (
 		MaxWaitDurationInHalfOpen        string `yaml:"maxWaitDurationInHalfOpenState" jsonschema:"omitempty,format=duration"`
 		WaitDurationInOpen               string `yaml:"waitDurationInOpenState" jsonschema:"omitempty,format=duration"`
 		FailureStatusCodes               []int  `yaml:"failureStatusCodes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
+		FailureGRPCStatusCodes           []int  `yaml:"failureGRPCStatusCodes" jsonschema:"omitempty,uniqueItems=true"`
 	}
 
 	// URLRule defines the circuit breaker rule for a URL pattern
@@ -105,6 +117,12 @@ URLLoop:
 		return fmt.Errorf("policy '%s' is not defined", name)
 	}
 
+	for _, p := range spec.Policies {
+		if err := grpcstatus.ValidateCodes(p.FailureGRPCStatusCodes); err != nil {
+			return fmt.Errorf("policy '%s': %v", p.Name, err)
+		}
+	}
+
 	return nil
 }
 
@@ -186,8 +204,23 @@ func (cb *CircuitBreaker) Results() []string {
 	return results
 }
 
+func (cb *CircuitBreaker) metricLabels(u *URLRule) []string {
+	return []string{cb.filterSpec.Pipeline(), cb.filterSpec.Name(), u.ID()}
+}
+
+func (cb *CircuitBreaker) exportState(u *URLRule, c *libcb.CircuitBreaker) {
+	// NOTE: Listeners are called in new goroutines, so the state
+	// of the event may be outdated, the current one is exported.
+	stateGauge.WithLabelValues(cb.metricLabels(u)...).Set(float64(c.State()))
+}
+
 func (cb *CircuitBreaker) setStateListenerForURL(u *URLRule) {
-	u.cb.SetStateListener(func(event *libcb.Event) {
+	// NOTE: u.cb is moved to the URL of the next generation when
+	// inherited, so the listener mustn't read it.
+	c := u.cb
+	cb.exportState(u, c)
+	c.SetStateListener(func(event *libcb.Event) {
+		cb.exportState(u, c)
 		logger.Infof("state of circuit breaker '%s' on URL(%s) transited from %s to %s at %d, reason: %s",
 			cb.filterSpec.Name(),
 			u.ID(),
@@ -273,6 +306,21 @@ OuterLoop:
 		}
 		cb.createCircuitBreakerForURL(url)
 	}
+
+	previousGeneration.deleteMetrics()
+	for _, u := range cb.spec.URLs {
+		cb.exportState(u, u.cb)
+	}
+}
+
+// deleteMetrics deletes metrics of URLs which are not inherited.
+func (cb *CircuitBreaker) deleteMetrics() {
+	for _, u := range cb.spec.URLs {
+		if u.cb != nil {
+			stateGauge.DeleteLabelValues(cb.metricLabels(u)...)
+			shortCircuitedTotal.DeleteLabelValues(cb.metricLabels(u)...)
+		}
+	}
 }
 
 // Init initializes CircuitBreaker.
@@ -290,6 +338,7 @@ func (cb *CircuitBreaker) Inherit(filterSpec *httppipeline.FilterSpec, previousG
 func (cb *CircuitBreaker) handle(ctx context.HTTPContext, u *URLRule) string {
 	permitted, stateID := u.cb.AcquirePermission()
 	if !permitted {
+		shortCircuitedTotal.WithLabelValues(cb.metricLabels(u)...).Inc()
 		ctx.AddTag("circuitBreaker: circuit is broken")
 		ctx.Response().SetStatusCode(http.StatusServiceUnavailable)
 		ctx.Response().Std().Header().Set("X-EG-Circuit-Breaker", "circurit-is-broken")
@@ -318,6 +367,9 @@ func (cb *CircuitBreaker) handle(ctx context.HTTPContext, u *URLRule) string {
 			}
 		}
 	}
+	if !hasErr {
+		hasErr = grpcstatus.InCodes(ctx.Response().Header(), u.policy.FailureGRPCStatusCodes)
+	}
 	u.cb.RecordResult(stateID, hasErr, d)
 
 	return result
@@ -340,4 +392,5 @@ func (cb *CircuitBreaker) Status() interface{} {
 
 // Close closes CircuitBreaker.
 func (cb *CircuitBreaker) Close() {
+	cb.deleteMetrics()
 }
@@ -24,6 +24,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
 	"github.com/megaease/easegress/pkg/context/contexttest"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
@@ -119,6 +121,15 @@ urls:
 	if result != resultShortCircuited {
 		t.Error("new circuit breaker should be short circuited")
 	}
+
+	// Metrics of the inherited URL are kept until it's closed.
+	if n := testutil.CollectAndCount(shortCircuitedTotal); n != 1 {
+		t.Errorf("expected 1 series, got %d", n)
+	}
+	newCb.Close()
+	if n := testutil.CollectAndCount(shortCircuitedTotal) + testutil.CollectAndCount(stateGauge); n != 0 {
+		t.Errorf("expected no series, got %d", n)
+	}
 }
 
 func TestBuildPolicy(t *testing.T) {
@@ -0,0 +1,172 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpcache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+// Cache-Control directives.
+// Reference: https://tools.ietf.org/html/rfc7234#section-5.2
+// and https://tools.ietf.org/html/rfc5861
+const (
+	directiveNoStore              = "no-store"
+	directiveNoCache              = "no-cache"
+	directivePrivate              = "private"
+	directivePublic               = "public"
+	directiveMaxAge               = "max-age"
+	directiveSMaxAge              = "s-maxage"
+	directiveMustRevalidate       = "must-revalidate"
+	directiveProxyRevalidate      = "proxy-revalidate"
+	directiveStaleWhileRevalidate = "stale-while-revalidate"
+	directiveStaleIfError         = "stale-if-error"
+)
+
+// cacheControl is the parsed Cache-Control header, the key is
+// the lower case directive and the value is its argument.
+type cacheControl map[string]string
+
+func parseCacheControl(h *httpheader.HTTPHeader) cacheControl {
+	cc := cacheControl{}
+
+	for _, value := range h.GetAll(httpheader.KeyCacheControl) {
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+
+			name, arg := directive, ""
+			if i := strings.IndexByte(directive, '='); i >= 0 {
+				name, arg = directive[:i], strings.Trim(directive[i+1:], `"`)
+			}
+			cc[strings.ToLower(strings.TrimSpace(name))] = arg
+		}
+	}
+
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+// seconds returns the duration of a delta-seconds directive.
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	v, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		// NOTE: An invalid value is treated as zero, which means stale.
+		return 0, true
+	}
+
+	return time.Duration(n) * time.Second, true
+}
+
+// requestNoCache returns whether the request asks for revalidation.
+func requestNoCache(h *httpheader.HTTPHeader, cc cacheControl) bool {
+	if cc.has(directiveNoCache) {
+		return true
+	}
+
+	// Pragma is used only if there is no Cache-Control.
+	// Reference: https://tools.ietf.org/html/rfc7234#section-5.4
+	if len(cc) == 0 && strings.Contains(strings.ToLower(h.Get("Pragma")), directiveNoCache) {
+		return true
+	}
+
+	return false
+}
+
+func parseHTTPDate(v string) (time.Time, bool) {
+	if v == "" {
+		return time.Time{}, false
+	}
+
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
+
+// freshnessLifetime calculates the freshness lifetime of a response,
+// it returns false if the lifetime is not explicitly specified.
+// Reference: https://tools.ietf.org/html/rfc7234#section-4.2.1
+func freshnessLifetime(h *httpheader.HTTPHeader, cc cacheControl) (time.Duration, bool) {
+	if d, ok := cc.seconds(directiveSMaxAge); ok {
+		return d, true
+	}
+
+	if d, ok := cc.seconds(directiveMaxAge); ok {
+		return d, true
+	}
+
+	expiresValue := h.Get("Expires")
+	if expiresValue == "" {
+		return 0, false
+	}
+
+	expires, ok := parseHTTPDate(expiresValue)
+	if !ok {
+		// NOTE: An invalid date represents a time in the past.
+		return 0, true
+	}
+
+	date, ok := parseHTTPDate(h.Get("Date"))
+	if !ok {
+		date = time.Now()
+	}
+
+	if d := expires.Sub(date); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+// initialAge calculates the corrected initial age of a response.
+// Reference: https://tools.ietf.org/html/rfc7234#section-4.2.3
+func initialAge(h *httpheader.HTTPHeader, responseTime time.Time) time.Duration {
+	var apparentAge, ageValue time.Duration
+
+	if date, ok := parseHTTPDate(h.Get("Date")); ok {
+		if d := responseTime.Sub(date); d > 0 {
+			apparentAge = d
+		}
+	}
+
+	if n, err := strconv.ParseInt(h.Get("Age"), 10, 64); err == nil && n > 0 {
+		ageValue = time.Duration(n) * time.Second
+	}
+
+	if apparentAge > ageValue {
+		return apparentAge
+	}
+	return ageValue
+}
@@ -0,0 +1,288 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpcache
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+const evictInterval = time.Minute
+
+type (
+	// clusterStore stores entries in the cluster, so all members share them.
+	// Every lookup reads the cluster, and the total size is bounded by the
+	// leader periodically, which removes the keys stored earliest.
+	clusterStore struct {
+		cls    cluster.Cluster
+		prefix string
+
+		maxBytes int64
+
+		// keys and size are counted in the last eviction.
+		keys int64
+		size int64
+
+		mutex     sync.Mutex
+		lastPurge time.Time
+	}
+
+	// storedEntry is the entry stored in the cluster.
+	storedEntry struct {
+		Vary       []string `json:"vary,omitempty"`
+		VaryValues []string `json:"varyValues,omitempty"`
+
+		StatusCode int         `json:"statusCode"`
+		Header     http.Header `json:"header"`
+		Body       []byte      `json:"body"`
+
+		ResponseTime time.Time     `json:"responseTime"`
+		InitialAge   time.Duration `json:"initialAge"`
+		Lifetime     time.Duration `json:"lifetime"`
+
+		StaleWhileRevalidate time.Duration `json:"staleWhileRevalidate"`
+		StaleIfError         time.Duration `json:"staleIfError"`
+	}
+)
+
+func newClusterStore(cls cluster.Cluster, prefix string, maxBytes int64) *clusterStore {
+	return &clusterStore{
+		cls:      cls,
+		prefix:   prefix,
+		maxBytes: maxBytes,
+		// NOTE: Purge events before the store was created are useless.
+		lastPurge: time.Now(),
+	}
+}
+
+func newStoredEntry(ent *entry) *storedEntry {
+	return &storedEntry{
+		Vary:                 ent.vary,
+		VaryValues:           ent.varyValues,
+		StatusCode:           ent.statusCode,
+		Header:               ent.header.Std(),
+		Body:                 ent.body,
+		ResponseTime:         ent.responseTime,
+		InitialAge:           ent.initialAge,
+		Lifetime:             ent.lifetime,
+		StaleWhileRevalidate: ent.staleWhileRevalidate,
+		StaleIfError:         ent.staleIfError,
+	}
+}
+
+func (se *storedEntry) entry(key string) *entry {
+	return &entry{
+		key:                  key,
+		vary:                 se.Vary,
+		varyValues:           se.VaryValues,
+		statusCode:           se.StatusCode,
+		header:               httpheader.New(se.Header),
+		body:                 se.Body,
+		responseTime:         se.ResponseTime,
+		initialAge:           se.InitialAge,
+		lifetime:             se.Lifetime,
+		staleWhileRevalidate: se.StaleWhileRevalidate,
+		staleIfError:         se.StaleIfError,
+	}
+}
+
+// variants returns the variants of the key stored in the cluster.
+func (s *clusterStore) variants(key string) []*entry {
+	value, err := s.cls.Get(s.prefix + key)
+	if err != nil {
+		logger.Errorf("get cached response %s failed: %v", key, err)
+		return nil
+	}
+	if value == nil {
+		return nil
+	}
+
+	return decodeVariants(key, *value)
+}
+
+func decodeVariants(key, value string) []*entry {
+	var stored []*storedEntry
+	if err := json.Unmarshal([]byte(value), &stored); err != nil {
+		logger.Errorf("unmarshal cached response %s failed: %v", key, err)
+		return nil
+	}
+
+	variants := make([]*entry, 0, len(stored))
+	for _, se := range stored {
+		variants = append(variants, se.entry(key))
+	}
+	return variants
+}
+
+func (s *clusterStore) get(key string, h *httpheader.HTTPHeader) *entry {
+	for _, variant := range s.variants(key) {
+		if variant.matchVary(h) {
+			return variant
+		}
+	}
+
+	return nil
+}
+
+// put stores the entry, concurrent puts of different variants of the same
+// key could overwrite each other, which only causes a cache miss.
+func (s *clusterStore) put(ent *entry) {
+	if ent.size() > atomic.LoadInt64(&s.maxBytes) {
+		return
+	}
+
+	stored := []*storedEntry{newStoredEntry(ent)}
+	for _, variant := range s.variants(ent.key) {
+		if !variant.sameVariant(ent) {
+			stored = append(stored, newStoredEntry(variant))
+		}
+	}
+
+	buff, err := json.Marshal(stored)
+	if err != nil {
+		logger.Errorf("BUG: marshal cached response %s failed: %v", ent.key, err)
+		return
+	}
+
+	if err := s.cls.Put(s.prefix+ent.key, string(buff)); err != nil {
+		logger.Errorf("put cached response %s failed: %v", ent.key, err)
+	}
+}
+
+func (s *clusterStore) setMaxBytes(maxBytes int64) {
+	atomic.StoreInt64(&s.maxBytes, maxBytes)
+}
+
+func (s *clusterStore) purge(key string) int {
+	value, err := s.cls.Get(s.prefix + key)
+	if err != nil || value == nil {
+		return 0
+	}
+
+	if err := s.cls.Delete(s.prefix + key); err != nil {
+		logger.Errorf("delete cached response %s failed: %v", key, err)
+		return 0
+	}
+	return 1
+}
+
+func (s *clusterStore) purgePrefix(prefix string) int {
+	kvs, err := s.cls.GetPrefix(s.prefix + prefix)
+	if err != nil || len(kvs) == 0 {
+		return 0
+	}
+
+	if err := s.cls.DeletePrefix(s.prefix + prefix); err != nil {
+		logger.Errorf("delete cached responses with prefix %s failed: %v", prefix, err)
+		return 0
+	}
+	return len(kvs)
+}
+
+// applyPurge applies the event on the cluster, all members apply the
+// same event, the later ones find nothing to purge.
+func (s *clusterStore) applyPurge(event *PurgeEvent) int {
+	s.mutex.Lock()
+	if !event.Time.After(s.lastPurge) {
+		s.mutex.Unlock()
+		return 0
+	}
+	s.lastPurge = event.Time
+	s.mutex.Unlock()
+
+	if event.Key != "" {
+		return s.purge(event.Key)
+	}
+	return s.purgePrefix(event.Prefix)
+}
+
+func (s *clusterStore) stat() (int, int64) {
+	return int(atomic.LoadInt64(&s.keys)), atomic.LoadInt64(&s.size)
+}
+
+// evict counts the stored keys, and removes the keys stored earliest
+// until the total size is within the limit if remove is true.
+func (s *clusterStore) evict(remove bool) {
+	kvs, err := s.cls.GetPrefix(s.prefix)
+	if err != nil {
+		logger.Errorf("get cached responses failed: %v", err)
+		return
+	}
+
+	type storedItem struct {
+		key          string
+		size         int64
+		responseTime time.Time
+	}
+
+	items := make([]*storedItem, 0, len(kvs))
+	total := int64(0)
+	for k, v := range kvs {
+		it := &storedItem{key: k[len(s.prefix):]}
+		for _, variant := range decodeVariants(it.key, v) {
+			it.size += variant.size()
+			if variant.responseTime.After(it.responseTime) {
+				it.responseTime = variant.responseTime
+			}
+		}
+		items = append(items, it)
+		total += it.size
+	}
+
+	if remove {
+		sort.Slice(items, func(i, j int) bool {
+			return items[i].responseTime.Before(items[j].responseTime)
+		})
+		maxBytes := atomic.LoadInt64(&s.maxBytes)
+		for total > maxBytes && len(items) > 0 {
+			it := items[0]
+			if err := s.cls.Delete(s.prefix + it.key); err != nil {
+				logger.Errorf("delete cached response %s failed: %v", it.key, err)
+				break
+			}
+			items, total = items[1:], total-it.size
+		}
+	}
+
+	atomic.StoreInt64(&s.keys, int64(len(items)))
+	atomic.StoreInt64(&s.size, total)
+}
+
+// run evicts keys periodically until done is closed, only the leader
+// removes keys to avoid members removing too many at the same time.
+func (s *clusterStore) run(done chan struct{}) {
+	ticker := time.NewTicker(evictInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.evict(s.cls.IsLeader())
+		case <-done:
+			return
+		}
+	}
+}
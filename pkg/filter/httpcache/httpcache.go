@@ -0,0 +1,683 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpcache
+
+import (
+	"bytes"
+	stdcontext "context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/protocol"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of HTTPCache.
+	Kind = "HTTPCache"
+
+	resultCached = "cached"
+
+	storageMemory  = "memory"
+	storageCluster = "cluster"
+
+	// NOTE: It's the kind of RawConfigTrafficController, whose package
+	// is not imported to avoid depending on the HTTP server.
+	rawConfigTrafficControllerKind = "RawConfigTrafficController"
+)
+
+var results = []string{resultCached}
+
+// headers which are not stored, hop-by-hop headers are meaningless to
+// other connections and Set-Cookie may leak sessions to other clients.
+var unstoredHeaders = []string{
+	"Age",
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Set-Cookie",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+	httpheader.KeyContentLength,
+}
+
+// headers which describe the representation, they are removed before
+// replacing the response with a stored one.
+var representationHeaders = []string{
+	"Age",
+	"Date",
+	"ETag",
+	"Expires",
+	"Last-Modified",
+	"Content-Range",
+	"Transfer-Encoding",
+	httpheader.KeyCacheControl,
+	httpheader.KeyContentEncoding,
+	httpheader.KeyContentLength,
+	httpheader.KeyContentType,
+	httpheader.KeyVary,
+}
+
+func init() {
+	httppipeline.Register(&HTTPCache{})
+}
+
+type (
+	// HTTPCache is a filter which caches responses according to HTTP caching.
+	// Reference: https://tools.ietf.org/html/rfc7234
+	HTTPCache struct {
+		filterSpec *httppipeline.FilterSpec
+		spec       *Spec
+
+		store                store
+		defaultTTL           time.Duration
+		staleWhileRevalidate time.Duration
+		staleIfError         time.Duration
+		done                 chan struct{}
+
+		// getPipeline returns the pipeline to revalidate in the background.
+		getPipeline func() followingHandler
+		// revalidating holds the variants being revalidated in the background.
+		revalidating sync.Map
+
+		hits          uint64
+		staleHits     uint64
+		misses        uint64
+		revalidations uint64
+	}
+
+	// followingHandler calls the filters after the given one,
+	// it is implemented by *httppipeline.HTTPPipeline.
+	followingHandler interface {
+		HandleAfter(ctx context.HTTPContext, filter httppipeline.Filter) (string, bool)
+	}
+
+	// pipelineGetter is implemented by RawConfigTrafficController.
+	pipelineGetter interface {
+		GetHTTPPipeline(name string) (protocol.HTTPHandler, bool)
+	}
+
+	// Spec describes the HTTPCache.
+	Spec struct {
+		// Storage is where the responses are stored, the memory of each
+		// member, or the cluster which is shared by all members.
+		Storage       string   `yaml:"storage" jsonschema:"omitempty,enum=,enum=memory,enum=cluster"`
+		MaxBytes      int64    `yaml:"maxBytes" jsonschema:"required,minimum=1"`
+		MaxEntryBytes int64    `yaml:"maxEntryBytes" jsonschema:"required,minimum=1"`
+		Methods       []string `yaml:"methods" jsonschema:"required,minItems=1,uniqueItems=true,format=httpmethod-array"`
+		Codes         []int    `yaml:"codes" jsonschema:"required,minItems=1,uniqueItems=true,format=httpcode-array"`
+		Key           *KeySpec `yaml:"key" jsonschema:"omitempty"`
+
+		// DefaultTTL is the freshness lifetime of responses without
+		// explicit expiration time, they are not cached if it is empty.
+		DefaultTTL string `yaml:"defaultTTL" jsonschema:"omitempty,format=duration"`
+
+		// StaleWhileRevalidate and StaleIfError are used if responses
+		// don't carry the directives of the same names.
+		StaleWhileRevalidate string `yaml:"staleWhileRevalidate" jsonschema:"omitempty,format=duration"`
+		StaleIfError         string `yaml:"staleIfError" jsonschema:"omitempty,format=duration"`
+	}
+
+	// Status is the status of HTTPCache.
+	Status struct {
+		Entries       int    `yaml:"entries"`
+		Bytes         int64  `yaml:"bytes"`
+		Hits          uint64 `yaml:"hits"`
+		StaleHits     uint64 `yaml:"staleHits"`
+		Misses        uint64 `yaml:"misses"`
+		Revalidations uint64 `yaml:"revalidations"`
+	}
+)
+
+// Kind returns the kind of HTTPCache.
+func (c *HTTPCache) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of HTTPCache.
+func (c *HTTPCache) DefaultSpec() interface{} {
+	return &Spec{
+		Storage:       storageMemory,
+		MaxBytes:      64 * 1024 * 1024,
+		MaxEntryBytes: 1024 * 1024,
+		Methods:       []string{http.MethodGet, http.MethodHead},
+		// Reference: https://tools.ietf.org/html/rfc7231#section-6.1 and https://tools.ietf.org/html/rfc7538
+		Codes: []int{200, 203, 204, 300, 301, 308, 404, 405, 410, 414, 501},
+	}
+}
+
+// Description returns the description of HTTPCache.
+func (c *HTTPCache) Description() string {
+	return "HTTPCache caches responses according to HTTP caching semantics."
+}
+
+// Results returns the results of HTTPCache.
+func (c *HTTPCache) Results() []string {
+	return results
+}
+
+// Init initializes HTTPCache.
+func (c *HTTPCache) Init(filterSpec *httppipeline.FilterSpec) {
+	c.filterSpec, c.spec = filterSpec, filterSpec.FilterSpec().(*Spec)
+	c.getPipeline = c.pipeline
+	c.reload(nil)
+	go c.watchPurge()
+}
+
+// Inherit inherits previous generation of HTTPCache.
+func (c *HTTPCache) Inherit(filterSpec *httppipeline.FilterSpec, previousGeneration httppipeline.Filter) {
+	c.filterSpec, c.spec = filterSpec, filterSpec.FilterSpec().(*Spec)
+	c.getPipeline = c.pipeline
+	c.reload(previousGeneration.(*HTTPCache))
+	previousGeneration.Close()
+	go c.watchPurge()
+}
+
+func parseDuration(d string) time.Duration {
+	if d == "" {
+		return 0
+	}
+
+	v, err := time.ParseDuration(d)
+	if err != nil {
+		logger.Errorf("BUG: parse duration %s failed: %v", d, err)
+		return 0
+	}
+
+	return v
+}
+
+func (c *HTTPCache) reload(previousGeneration *HTTPCache) {
+	if c.spec.Key == nil {
+		c.spec.Key = &KeySpec{}
+	}
+	if c.spec.Storage == "" {
+		c.spec.Storage = storageMemory
+	}
+
+	c.defaultTTL = parseDuration(c.spec.DefaultTTL)
+	c.staleWhileRevalidate = parseDuration(c.spec.StaleWhileRevalidate)
+	c.staleIfError = parseDuration(c.spec.StaleIfError)
+	c.done = make(chan struct{})
+
+	// NOTE: Keys may be different if the key spec changed,
+	// the cache is kept only if the key spec is the same.
+	if previousGeneration != nil && previousGeneration.spec.Storage == c.spec.Storage &&
+		reflect.DeepEqual(previousGeneration.spec.Key, c.spec.Key) {
+		c.store = previousGeneration.store
+		c.store.setMaxBytes(c.spec.MaxBytes)
+	} else if c.spec.Storage == storageCluster {
+		prefix := c.cluster().Layout().HTTPCacheEntryPrefix(c.filterSpec.Pipeline(), c.filterSpec.Name())
+		c.store = newClusterStore(c.cluster(), prefix, c.spec.MaxBytes)
+	} else {
+		c.store = newMemoryStore(c.spec.MaxBytes)
+	}
+
+	if s, ok := c.store.(*clusterStore); ok {
+		go s.run(c.done)
+	}
+}
+
+func (c *HTTPCache) cluster() cluster.Cluster {
+	return c.filterSpec.Super().Cluster()
+}
+
+// pipeline returns the pipeline of the filter, it returns nil if the
+// pipeline is not in the default namespace, such as pipelines of the mesh.
+func (c *HTTPCache) pipeline() followingHandler {
+	entity, exists := c.filterSpec.Super().GetSystemController(rawConfigTrafficControllerKind)
+	if !exists {
+		return nil
+	}
+	rctc, ok := entity.Instance().(pipelineGetter)
+	if !ok {
+		return nil
+	}
+
+	handler, exists := rctc.GetHTTPPipeline(c.filterSpec.Pipeline())
+	if !exists {
+		return nil
+	}
+	p, _ := handler.(followingHandler)
+	return p
+}
+
+// Handle handles HTTP request.
+func (c *HTTPCache) Handle(ctx context.HTTPContext) string {
+	r := ctx.Request()
+	if !stringtool.StrInSlice(r.Method(), c.spec.Methods) {
+		return ctx.CallNextHandler("")
+	}
+
+	now := time.Now()
+	reqCC := parseCacheControl(r.Header())
+	key := c.spec.Key.key(ctx)
+
+	ent := c.store.get(key, r.Header())
+	if ent != nil && c.usable(ent, r.Header(), reqCC, now) {
+		if ent.fresh(now) {
+			atomic.AddUint64(&c.hits, 1)
+			c.serve(ctx, ent, now)
+			return ctx.CallNextHandler(resultCached)
+		}
+
+		// Reference: https://tools.ietf.org/html/rfc5861#section-3
+		if ent.staleFor(now, ent.staleWhileRevalidate) && c.revalidateInBackground(ctx, ent, reqCC) {
+			atomic.AddUint64(&c.staleHits, 1)
+			c.serve(ctx, ent, now)
+			ctx.AddTag("httpCache: stale while revalidate")
+			return ctx.CallNextHandler(resultCached)
+		}
+	}
+
+	result, validated := c.fetch(ctx, ent, reqCC, func() string {
+		return ctx.CallNextHandler("")
+	})
+
+	w := ctx.Response()
+	now = time.Now()
+
+	if validated != nil {
+		c.replace(ctx, validated, now)
+		ctx.AddTag("httpCache: revalidated")
+		return result
+	}
+
+	if ent != nil && (result != "" || w.StatusCode() >= 500) && ent.staleFor(now, ent.staleIfError) {
+		atomic.AddUint64(&c.staleHits, 1)
+		c.replace(ctx, ent, now)
+		ctx.AddTag("httpCache: stale if error")
+		return ""
+	}
+
+	atomic.AddUint64(&c.misses, 1)
+	if result == "" {
+		c.cacheResponse(ctx, key, reqCC, now)
+	}
+
+	return result
+}
+
+// fetch gets the response by next, the request is made conditional to
+// validate the entry if it is not nil. It returns the validated entry if
+// the response is 304 to the conditional request.
+func (c *HTTPCache) fetch(ctx context.HTTPContext, ent *entry, reqCC cacheControl, next func() string) (string, *entry) {
+	r, w := ctx.Request(), ctx.Response()
+	conditional := ent != nil && addConditionalHeaders(r.Header(), ent)
+
+	result := next()
+	if conditional {
+		// NOTE: The client didn't send them, so it expects a full response.
+		r.Header().Del("If-None-Match")
+		r.Header().Del("If-Modified-Since")
+	}
+
+	if !conditional || result != "" || w.StatusCode() != http.StatusNotModified {
+		return result, nil
+	}
+
+	atomic.AddUint64(&c.revalidations, 1)
+	if refreshed := c.refresh(ent, r.Header(), reqCC, w.Header(), time.Now()); refreshed != nil {
+		return result, refreshed
+	}
+	return result, ent
+}
+
+// revalidateInBackground revalidates the entry with a copy of the request
+// by the following filters in the background, only one revalidation of the
+// same variant runs at the same time. It returns false if the pipeline
+// can't be found to do it.
+func (c *HTTPCache) revalidateInBackground(ctx context.HTTPContext, ent *entry, reqCC cacheControl) bool {
+	p := c.getPipeline()
+	if p == nil {
+		return false
+	}
+
+	id := ent.variantID()
+	if _, loaded := c.revalidating.LoadOrStore(id, struct{}{}); loaded {
+		return true
+	}
+
+	r := ctx.Request()
+	req := r.Std().Clone(stdcontext.Background())
+	req.Method, req.URL.Path, req.URL.RawPath = r.Method(), r.Path(), ""
+	req.Body = http.NoBody
+	// NOTE: The validators of the client are for its own copy.
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+	realIP := r.RealIP()
+
+	go func() {
+		defer c.revalidating.Delete(id)
+
+		bctx := context.NewWithRealIP(httptest.NewRecorder(), req, tracing.NoopTracing, "httpcache revalidation", realIP)
+		defer bctx.Finish()
+
+		handled := false
+		result, validated := c.fetch(bctx, ent, reqCC, func() string {
+			result, ok := p.HandleAfter(bctx, c)
+			handled = ok
+			return result
+		})
+		if !handled || validated != nil || result != "" {
+			return
+		}
+
+		// NOTE: Keep the stale entry to serve if it could be served on errors.
+		now := time.Now()
+		if bctx.Response().StatusCode() >= 500 && ent.staleFor(now, ent.staleIfError) {
+			return
+		}
+		c.cacheResponse(bctx, ent.key, reqCC, now)
+	}()
+
+	return true
+}
+
+// usable returns whether the stored entry could be used without
+// revalidation according to the request.
+func (c *HTTPCache) usable(ent *entry, h *httpheader.HTTPHeader, cc cacheControl, now time.Time) bool {
+	if requestNoCache(h, cc) {
+		return false
+	}
+
+	if maxAge, ok := cc.seconds(directiveMaxAge); ok && ent.age(now) > maxAge {
+		return false
+	}
+
+	return true
+}
+
+// addConditionalHeaders makes the request a conditional one to validate
+// the entry, it does nothing if the client sent conditional headers.
+func addConditionalHeaders(h *httpheader.HTTPHeader, ent *entry) bool {
+	if h.Get("If-None-Match") != "" || h.Get("If-Modified-Since") != "" {
+		return false
+	}
+
+	added := false
+	if etag := ent.etag(); etag != "" {
+		h.Set("If-None-Match", etag)
+		added = true
+	}
+	if lastModified := ent.lastModified(); lastModified != "" {
+		h.Set("If-Modified-Since", lastModified)
+		added = true
+	}
+
+	return added
+}
+
+// notModified evaluates conditional headers of the request against the entry.
+// Reference: https://tools.ietf.org/html/rfc7232#section-6
+func notModified(h *httpheader.HTTPHeader, ent *entry) bool {
+	if inm := h.Get("If-None-Match"); inm != "" {
+		etag := strings.TrimPrefix(ent.etag(), "W/")
+		if etag == "" {
+			return false
+		}
+		for _, v := range strings.Split(inm, ",") {
+			v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+			if v == "*" || v == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims, ok := parseHTTPDate(h.Get("If-Modified-Since"))
+	if !ok {
+		return false
+	}
+	lastModified, ok := parseHTTPDate(ent.lastModified())
+	if !ok {
+		return false
+	}
+
+	return !lastModified.After(ims)
+}
+
+// newEntry creates an entry without body for the response,
+// it returns nil if the response can't be stored.
+func (c *HTTPCache) newEntry(key string, reqHeader *httpheader.HTTPHeader, reqCC cacheControl,
+	statusCode int, header *httpheader.HTTPHeader, now time.Time) *entry {
+	if !c.cacheableCode(statusCode) {
+		return nil
+	}
+
+	cc := parseCacheControl(header)
+	if reqCC.has(directiveNoStore) || cc.has(directiveNoStore) || cc.has(directivePrivate) {
+		return nil
+	}
+
+	// Reference: https://tools.ietf.org/html/rfc7234#section-3.2
+	if reqHeader.Get("Authorization") != "" &&
+		!cc.has(directivePublic) && !cc.has(directiveSMaxAge) && !cc.has(directiveMustRevalidate) {
+		return nil
+	}
+
+	ent := &entry{
+		key:          key,
+		statusCode:   statusCode,
+		header:       header.Copy(),
+		responseTime: now,
+		initialAge:   initialAge(header, now),
+	}
+
+	for _, name := range unstoredHeaders {
+		ent.header.Del(name)
+	}
+
+	for _, value := range header.GetAll(httpheader.KeyVary) {
+		for _, name := range strings.Split(value, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "*" {
+				return nil
+			}
+			if name != "" {
+				ent.vary = append(ent.vary, name)
+				ent.varyValues = append(ent.varyValues, varyValue(reqHeader, name))
+			}
+		}
+	}
+
+	lifetime, explicit := freshnessLifetime(header, cc)
+	if !explicit {
+		lifetime = c.defaultTTL
+	}
+	if cc.has(directiveNoCache) {
+		lifetime = 0
+	}
+	ent.lifetime = lifetime
+
+	if lifetime == 0 && ent.etag() == "" && ent.lastModified() == "" {
+		// It can be neither served nor revalidated.
+		return nil
+	}
+
+	if cc.has(directiveMustRevalidate) || cc.has(directiveProxyRevalidate) ||
+		cc.has(directiveSMaxAge) || cc.has(directiveNoCache) {
+		return ent
+	}
+
+	if d, ok := cc.seconds(directiveStaleWhileRevalidate); ok {
+		ent.staleWhileRevalidate = d
+	} else {
+		ent.staleWhileRevalidate = c.staleWhileRevalidate
+	}
+
+	if d, ok := cc.seconds(directiveStaleIfError); ok {
+		ent.staleIfError = d
+	} else {
+		ent.staleIfError = c.staleIfError
+	}
+
+	return ent
+}
+
+func (c *HTTPCache) cacheableCode(code int) bool {
+	for _, v := range c.spec.Codes {
+		if v == code {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheResponse stores the response when its body is flushed to the client.
+func (c *HTTPCache) cacheResponse(ctx context.HTTPContext, key string, reqCC cacheControl, now time.Time) {
+	r, w := ctx.Request(), ctx.Response()
+
+	ent := c.newEntry(key, r.Header(), reqCC, w.StatusCode(), w.Header(), now)
+	if ent == nil {
+		return
+	}
+
+	// NOTE: Body flushing functions are not called for an empty body.
+	if w.Body() == nil {
+		ent.body = []byte{}
+		c.store.put(ent)
+		return
+	}
+
+	body, tooLarge := []byte{}, false
+	w.OnFlushBody(func(chunk []byte, complete bool) []byte {
+		if tooLarge {
+			return chunk
+		}
+
+		if int64(len(body)+len(chunk)) > c.spec.MaxEntryBytes {
+			tooLarge, body = true, nil
+			return chunk
+		}
+
+		body = append(body, chunk...)
+		if complete {
+			ent.body = body
+			c.store.put(ent)
+		}
+
+		return chunk
+	})
+}
+
+// refresh updates the entry with the header of a 304 response.
+// Reference: https://tools.ietf.org/html/rfc7234#section-4.3.4
+func (c *HTTPCache) refresh(ent *entry, reqHeader *httpheader.HTTPHeader, reqCC cacheControl,
+	header *httpheader.HTTPHeader, now time.Time) *entry {
+	merged := ent.header.Copy()
+	copyHeader(merged, header)
+
+	refreshed := c.newEntry(ent.key, reqHeader, reqCC, ent.statusCode, merged, now)
+	if refreshed == nil {
+		c.store.purge(ent.key)
+		return nil
+	}
+
+	refreshed.body = ent.body
+	c.store.put(refreshed)
+
+	return refreshed
+}
+
+// copyHeader replaces the values of dst with the values of src.
+func copyHeader(dst, src *httpheader.HTTPHeader) {
+	for key := range src.Std() {
+		dst.Del(key)
+	}
+	for _, name := range unstoredHeaders {
+		src.Del(name)
+	}
+	dst.AddFrom(src)
+}
+
+func ageValue(ent *entry, now time.Time) string {
+	return strconv.FormatInt(int64(ent.age(now)/time.Second), 10)
+}
+
+// serve writes the entry to the response.
+func (c *HTTPCache) serve(ctx context.HTTPContext, ent *entry, now time.Time) {
+	r, w := ctx.Request(), ctx.Response()
+
+	copyHeader(w.Header(), ent.header.Copy())
+	w.Header().Set("Age", ageValue(ent, now))
+
+	if notModified(r.Header(), ent) {
+		w.Header().Del(httpheader.KeyContentLength)
+		w.SetStatusCode(http.StatusNotModified)
+		ctx.AddTag("httpCache: not modified")
+		return
+	}
+
+	w.SetStatusCode(ent.statusCode)
+	if r.Method() != http.MethodHead {
+		w.SetBody(bytes.NewReader(ent.body))
+	}
+	ctx.AddTag("httpCache: hit")
+}
+
+// replace replaces the response generated by following filters with the entry.
+func (c *HTTPCache) replace(ctx context.HTTPContext, ent *entry, now time.Time) {
+	w := ctx.Response()
+
+	if body := w.Body(); body != nil {
+		io.Copy(io.Discard, body)
+		if closer, ok := body.(io.Closer); ok {
+			closer.Close()
+		}
+		w.SetBody(nil)
+	}
+
+	for _, name := range representationHeaders {
+		w.Header().Del(name)
+	}
+
+	c.serve(ctx, ent, now)
+}
+
+// Status returns Status generated by Runtime.
+func (c *HTTPCache) Status() interface{} {
+	entries, size := c.store.stat()
+	return &Status{
+		Entries:       entries,
+		Bytes:         size,
+		Hits:          atomic.LoadUint64(&c.hits),
+		StaleHits:     atomic.LoadUint64(&c.staleHits),
+		Misses:        atomic.LoadUint64(&c.misses),
+		Revalidations: atomic.LoadUint64(&c.revalidations),
+	}
+}
+
+// Close closes HTTPCache.
+func (c *HTTPCache) Close() {
+	close(c.done)
+}
@@ -0,0 +1,445 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpcache
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+type upstream func(reqHeader *httpheader.HTTPHeader) (int, http.Header, string)
+
+type response struct {
+	code       int
+	header     *httpheader.HTTPHeader
+	body       io.Reader
+	flushFuncs []func([]byte, bool) []byte
+}
+
+// do runs the filter with a mocked context, the upstream is called
+// if the filter calls the next handler with an empty result.
+func do(c *HTTPCache, method, url string, reqHeader http.Header, up upstream) (string, int, http.Header, string) {
+	req, _ := http.NewRequest(method, url, nil)
+	if reqHeader == nil {
+		reqHeader = http.Header{}
+	}
+	rh := httpheader.New(reqHeader)
+	w := &response{header: httpheader.New(http.Header{})}
+
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedStd = func() *http.Request { return req }
+	ctx.MockedRequest.MockedMethod = func() string { return method }
+	ctx.MockedRequest.MockedHost = func() string { return req.Host }
+	ctx.MockedRequest.MockedPath = func() string { return req.URL.Path }
+	ctx.MockedRequest.MockedRealIP = func() string { return "127.0.0.1" }
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader { return rh }
+	ctx.MockedResponse.MockedStatusCode = func() int { return w.code }
+	ctx.MockedResponse.MockedSetStatusCode = func(code int) { w.code = code }
+	ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader { return w.header }
+	ctx.MockedResponse.MockedBody = func() io.Reader { return w.body }
+	ctx.MockedResponse.MockedSetBody = func(body io.Reader) { w.body = body }
+	ctx.MockedResponse.MockedOnFlushBody = func(fn func([]byte, bool) []byte) {
+		w.flushFuncs = append(w.flushFuncs, fn)
+	}
+	ctx.MockedCallNextHandler = func(lastResult string) string {
+		if lastResult != "" {
+			return lastResult
+		}
+		code, header, body := up(rh)
+		w.code = code
+		w.header.AddFromStd(header)
+		if body != "" {
+			w.body = strings.NewReader(body)
+		}
+		return ""
+	}
+
+	result := c.Handle(ctx)
+
+	var body []byte
+	if w.body != nil {
+		body, _ = io.ReadAll(w.body)
+		for _, fn := range w.flushFuncs {
+			body = fn(body, true)
+		}
+	}
+
+	return result, w.code, w.header.Std(), string(body)
+}
+
+// fakePipeline calls the upstream as the following filters.
+type fakePipeline struct {
+	up upstream
+}
+
+func (p *fakePipeline) HandleAfter(ctx context.HTTPContext, filter httppipeline.Filter) (string, bool) {
+	code, header, body := p.up(ctx.Request().Header())
+	w := ctx.Response()
+	w.SetStatusCode(code)
+	w.Header().AddFromStd(header)
+	if body != "" {
+		w.SetBody(strings.NewReader(body))
+	}
+	return "", true
+}
+
+func newHTTPCache(spec *Spec) *HTTPCache {
+	c := &HTTPCache{spec: spec}
+	c.getPipeline = func() followingHandler { return nil }
+	c.reload(nil)
+	return c
+}
+
+func defaultSpec() *Spec {
+	return (&HTTPCache{}).DefaultSpec().(*Spec)
+}
+
+func TestFreshAndConditional(t *testing.T) {
+	c := newHTTPCache(defaultSpec())
+
+	calls := 0
+	up := func(h *httpheader.HTTPHeader) (int, http.Header, string) {
+		calls++
+		return http.StatusOK, http.Header{
+			"Cache-Control": {"max-age=60"},
+			"Etag":          {`"v1"`},
+			"Set-Cookie":    {"a=b"},
+		}, "hello"
+	}
+
+	_, code, _, body := do(c, http.MethodGet, "http://example.com/a?y=2&x=1", nil, up)
+	if code != http.StatusOK || body != "hello" || calls != 1 {
+		t.Fatalf("unexpected first response: %d %q %d", code, body, calls)
+	}
+
+	result, code, header, body := do(c, http.MethodGet, "http://example.com/a?x=1&y=2", nil, up)
+	if result != resultCached || code != http.StatusOK || body != "hello" || calls != 1 {
+		t.Fatalf("expected cached response, got: %s %d %q %d", result, code, body, calls)
+	}
+	if header.Get("Set-Cookie") != "" {
+		t.Errorf("set-cookie should not be cached")
+	}
+	if header.Get("Age") == "" {
+		t.Errorf("age should be set")
+	}
+
+	_, code, _, _ = do(c, http.MethodGet, "http://example.com/a?x=1&y=2", http.Header{"If-None-Match": {`"v1"`}}, up)
+	if code != http.StatusNotModified || calls != 1 {
+		t.Errorf("expected 304 from cache, got: %d %d", code, calls)
+	}
+
+	do(c, http.MethodGet, "http://example.com/a?x=1&y=2", http.Header{"Cache-Control": {"no-cache"}}, up)
+	if calls != 2 {
+		t.Errorf("no-cache request should go upstream")
+	}
+
+	do(c, http.MethodPost, "http://example.com/a?x=1&y=2", nil, up)
+	if calls != 3 {
+		t.Errorf("post request should not be cached")
+	}
+}
+
+func TestNotCacheable(t *testing.T) {
+	c := newHTTPCache(defaultSpec())
+
+	cases := []struct {
+		code      int
+		reqHeader http.Header
+		header    http.Header
+	}{
+		{http.StatusOK, nil, http.Header{"Cache-Control": {"no-store"}}},
+		{http.StatusOK, nil, http.Header{"Cache-Control": {"private, max-age=60"}}},
+		{http.StatusOK, nil, http.Header{"Vary": {"*"}, "Cache-Control": {"max-age=60"}}},
+		{http.StatusOK, nil, http.Header{}},
+		{http.StatusInternalServerError, nil, http.Header{"Cache-Control": {"max-age=60"}}},
+		{http.StatusOK, http.Header{"Authorization": {"Basic xxx"}}, http.Header{"Cache-Control": {"max-age=60"}}},
+		{http.StatusOK, http.Header{"Cache-Control": {"no-store"}}, http.Header{"Cache-Control": {"max-age=60"}}},
+	}
+
+	for i, cs := range cases {
+		up := func(h *httpheader.HTTPHeader) (int, http.Header, string) {
+			return cs.code, cs.header, "body"
+		}
+		do(c, http.MethodGet, "http://example.com/b", cs.reqHeader, up)
+		if n, _ := c.store.stat(); n != 0 {
+			t.Errorf("case %d: response should not be cached", i)
+		}
+	}
+}
+
+func TestVary(t *testing.T) {
+	c := newHTTPCache(defaultSpec())
+
+	calls := 0
+	up := func(h *httpheader.HTTPHeader) (int, http.Header, string) {
+		calls++
+		return http.StatusOK, http.Header{
+			"Cache-Control": {"max-age=60"},
+			"Vary":          {"Accept-Language"},
+		}, h.Get("Accept-Language")
+	}
+
+	en := http.Header{"Accept-Language": {"en"}}
+	zh := http.Header{"Accept-Language": {"zh"}}
+	do(c, http.MethodGet, "http://example.com/c", en, up)
+	do(c, http.MethodGet, "http://example.com/c", zh, up)
+
+	_, _, _, body := do(c, http.MethodGet, "http://example.com/c", en, up)
+	if body != "en" || calls != 2 {
+		t.Errorf("expected cached en variant, got %q %d", body, calls)
+	}
+	_, _, _, body = do(c, http.MethodGet, "http://example.com/c", zh, up)
+	if body != "zh" || calls != 2 {
+		t.Errorf("expected cached zh variant, got %q %d", body, calls)
+	}
+}
+
+func TestRevalidateAndStale(t *testing.T) {
+	spec := defaultSpec()
+	spec.StaleIfError = "1h"
+	c := newHTTPCache(spec)
+
+	status := http.StatusOK
+	var condition string
+	up := func(h *httpheader.HTTPHeader) (int, http.Header, string) {
+		condition = h.Get("If-None-Match")
+		if status == http.StatusOK && condition == `"v1"` {
+			return http.StatusNotModified, http.Header{"Cache-Control": {"max-age=0"}, "X-New": {"1"}}, ""
+		}
+		return status, http.Header{"Cache-Control": {"max-age=0"}, "Etag": {`"v1"`}}, "content"
+	}
+
+	do(c, http.MethodGet, "http://example.com/d", nil, up)
+
+	_, code, header, body := do(c, http.MethodGet, "http://example.com/d", nil, up)
+	if condition != `"v1"` {
+		t.Errorf("expected conditional request, got %q", condition)
+	}
+	if code != http.StatusOK || body != "content" || header.Get("X-New") != "1" {
+		t.Errorf("expected refreshed response, got %d %q %v", code, body, header)
+	}
+
+	status = http.StatusBadGateway
+	result, code, _, body := do(c, http.MethodGet, "http://example.com/d", nil, up)
+	if result != "" || code != http.StatusOK || body != "content" {
+		t.Errorf("expected stale response on error, got %s %d %q", result, code, body)
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	c := newHTTPCache(defaultSpec())
+
+	c.store.put(&entry{
+		key:                  "example.com/e GET",
+		statusCode:           http.StatusOK,
+		header:               httpheader.New(http.Header{"Etag": {`"v1"`}}),
+		body:                 []byte("stale"),
+		responseTime:         time.Now().Add(-time.Minute),
+		staleWhileRevalidate: time.Hour,
+	})
+
+	calls, release := 0, make(chan struct{})
+	var condition string
+	up := func(h *httpheader.HTTPHeader) (int, http.Header, string) {
+		<-release
+		calls++
+		condition = h.Get("If-None-Match")
+		return http.StatusOK, http.Header{"Cache-Control": {"max-age=60"}}, "fresh"
+	}
+	c.getPipeline = func() followingHandler { return &fakePipeline{up: up} }
+
+	// Both requests are served with the stale response, and only
+	// one revalidation runs in the background.
+	for i := 0; i < 2; i++ {
+		result, _, _, body := do(c, http.MethodGet, "http://example.com/e", http.Header{"If-None-Match": {`"v0"`}}, up)
+		if result != resultCached || body != "stale" {
+			t.Fatalf("expected stale response, got %s %q", result, body)
+		}
+	}
+	close(release)
+
+	for i := 0; i < 100; i++ {
+		if ent := c.store.get("example.com/e GET", httpheader.New(http.Header{})); string(ent.body) == "fresh" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if calls != 1 || condition != `"v1"` {
+		t.Errorf("expected one conditional revalidation, got %d %q", calls, condition)
+	}
+
+	result, _, _, body := do(c, http.MethodGet, "http://example.com/e", nil, up)
+	if result != resultCached || body != "fresh" || calls != 1 {
+		t.Errorf("expected revalidated response, got %s %q %d", result, body, calls)
+	}
+
+	// It is revalidated in the request without the pipeline.
+	c.getPipeline = func() followingHandler { return nil }
+	c.store.put(&entry{
+		key:                  "example.com/f GET",
+		statusCode:           http.StatusOK,
+		header:               httpheader.New(http.Header{}),
+		body:                 []byte("stale"),
+		responseTime:         time.Now().Add(-time.Minute),
+		staleWhileRevalidate: time.Hour,
+	})
+	_, _, _, body = do(c, http.MethodGet, "http://example.com/f", nil, up)
+	if body != "fresh" || calls != 2 {
+		t.Errorf("expected revalidated response, got %q %d", body, calls)
+	}
+}
+
+func TestStore(t *testing.T) {
+	s := newMemoryStore(20)
+
+	newEntry := func(key string, size int) *entry {
+		return &entry{
+			key:    key,
+			header: httpheader.New(http.Header{}),
+			body:   bytes.Repeat([]byte{'x'}, size),
+		}
+	}
+
+	h := httpheader.New(http.Header{})
+	s.put(newEntry("a/1", 8))
+	s.put(newEntry("a/2", 8))
+	s.get("a/1", h)
+	s.put(newEntry("b/1", 8))
+
+	if s.get("a/2", h) != nil {
+		t.Errorf("least recently used key should be evicted")
+	}
+	if s.get("a/1", h) == nil || s.get("b/1", h) == nil {
+		t.Errorf("recently used keys should be kept")
+	}
+
+	s.put(newEntry("c", 30))
+	if n, size := s.stat(); n != 2 || size != 16 {
+		t.Errorf("too large entry should not be stored, got %d %d", n, size)
+	}
+
+	if n := s.purgePrefix("a/"); n != 1 {
+		t.Errorf("expected 1 key purged, got %d", n)
+	}
+
+	event := &PurgeEvent{Key: "b/1", Time: time.Now().Add(-time.Hour)}
+	if n := s.applyPurge(event); n != 0 {
+		t.Errorf("purge events before the store was created should be ignored")
+	}
+	event.Time = time.Now()
+	if n := s.applyPurge(event); n != 1 {
+		t.Errorf("expected 1 key purged, got %d", n)
+	}
+}
+
+func TestFreshnessLifetime(t *testing.T) {
+	now := time.Now().UTC()
+	date := now.Format(http.TimeFormat)
+
+	cases := []struct {
+		header   http.Header
+		lifetime time.Duration
+		explicit bool
+	}{
+		{http.Header{"Cache-Control": {"max-age=10, s-maxage=20"}}, 20 * time.Second, true},
+		{http.Header{"Cache-Control": {"max-age=10"}, "Expires": {now.Add(time.Hour).Format(http.TimeFormat)}}, 10 * time.Second, true},
+		{http.Header{"Date": {date}, "Expires": {now.Add(time.Minute).Format(http.TimeFormat)}}, time.Minute, true},
+		{http.Header{"Expires": {"0"}}, 0, true},
+		{http.Header{"Cache-Control": {"max-age=abc"}}, 0, true},
+		{http.Header{}, 0, false},
+	}
+
+	for i, cs := range cases {
+		h := httpheader.New(cs.header)
+		lifetime, explicit := freshnessLifetime(h, parseCacheControl(h))
+		if lifetime != cs.lifetime || explicit != cs.explicit {
+			t.Errorf("case %d: expected %v %v, got %v %v", i, cs.lifetime, cs.explicit, lifetime, explicit)
+		}
+	}
+}
+
+func TestClusterStore(t *testing.T) {
+	cls := clustertest.New(nil)
+	prefix := cls.Layout().HTTPCacheEntryPrefix("pipeline", "cache")
+	s := newClusterStore(cls, prefix, 20)
+	other := newClusterStore(cls, prefix, 20)
+
+	newEntry := func(key, lang string, size int, responseTime time.Time) *entry {
+		return &entry{
+			key:          key,
+			vary:         []string{"Accept-Language"},
+			varyValues:   []string{lang},
+			statusCode:   http.StatusOK,
+			header:       httpheader.New(http.Header{}),
+			body:         bytes.Repeat([]byte{'x'}, size),
+			responseTime: responseTime,
+			lifetime:     time.Minute,
+		}
+	}
+
+	now := time.Now()
+	s.put(newEntry("a/1", "en", 4, now.Add(-time.Minute)))
+	s.put(newEntry("a/1", "zh", 4, now))
+	s.put(newEntry("a/2", "en", 8, now.Add(-2*time.Minute)))
+
+	zh := httpheader.New(http.Header{"Accept-Language": {"zh"}})
+	ent := other.get("a/1", zh)
+	if ent == nil || len(ent.body) != 4 || !ent.fresh(now) {
+		t.Fatalf("entries should be shared by stores of the same prefix, got %+v", ent)
+	}
+
+	other.evict(false)
+	if n, size := other.stat(); n != 2 || size != 16 {
+		t.Errorf("expected 2 keys of 16 bytes, got %d %d", n, size)
+	}
+
+	s.put(newEntry("b/1", "en", 8, now.Add(time.Second)))
+	s.evict(true)
+	if s.get("a/2", httpheader.New(http.Header{"Accept-Language": {"en"}})) != nil {
+		t.Errorf("key stored earliest should be evicted")
+	}
+	if n, size := s.stat(); n != 2 || size != 16 {
+		t.Errorf("expected 2 keys of 16 bytes, got %d %d", n, size)
+	}
+
+	event := &PurgeEvent{Prefix: "a/", Time: time.Now()}
+	if n := s.applyPurge(event); n != 1 {
+		t.Errorf("expected 1 key purged, got %d", n)
+	}
+	if n := other.applyPurge(event); n != 0 {
+		t.Errorf("the purged key should not be purged again, got %d", n)
+	}
+	if _, ok := cls.KVs()[prefix+"b/1"]; !ok {
+		t.Errorf("b/1 should be kept")
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpcache
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/context"
+)
+
+type (
+	// KeySpec describes how to build the cache key of a request.
+	//
+	// The key is [host]path[?query] method, followed by the values of the
+	// configured headers and cookies, so keys of the same host and path
+	// share the same prefix, which is convenient to purge by prefix.
+	KeySpec struct {
+		IgnoreHost  bool     `yaml:"ignoreHost" jsonschema:"omitempty"`
+		IgnoreQuery bool     `yaml:"ignoreQuery" jsonschema:"omitempty"`
+		QueryParams []string `yaml:"queryParams" jsonschema:"omitempty,uniqueItems=true"`
+		Headers     []string `yaml:"headers" jsonschema:"omitempty,uniqueItems=true"`
+		Cookies     []string `yaml:"cookies" jsonschema:"omitempty,uniqueItems=true"`
+	}
+)
+
+func (ks *KeySpec) query(rawQuery string) string {
+	if ks.IgnoreQuery || rawQuery == "" {
+		return ""
+	}
+
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return rawQuery
+	}
+
+	if len(ks.QueryParams) > 0 {
+		picked := url.Values{}
+		for _, name := range ks.QueryParams {
+			if v, ok := values[name]; ok {
+				picked[name] = v
+			}
+		}
+		values = picked
+	}
+
+	// NOTE: Encode sorts parameters by name, so the order doesn't matter.
+	return values.Encode()
+}
+
+func (ks *KeySpec) key(ctx context.HTTPContext) string {
+	r := ctx.Request()
+
+	var b strings.Builder
+	if !ks.IgnoreHost {
+		b.WriteString(r.Host())
+	}
+	b.WriteString(r.Path())
+
+	if q := ks.query(r.Std().URL.RawQuery); q != "" {
+		b.WriteByte('?')
+		b.WriteString(q)
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(r.Method())
+
+	for _, name := range ks.Headers {
+		b.WriteString(" " + name + "=" + r.Header().Get(name))
+	}
+
+	for _, name := range ks.Cookies {
+		value := ""
+		if cookie, err := r.Cookie(name); err == nil && cookie != nil {
+			value = cookie.Value
+		}
+		b.WriteString(" " + name + "=" + value)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpcache
+
+import (
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+type (
+	// PurgeEvent is posted to the cluster by the admin API to purge
+	// cached responses of a HTTPCache filter in all members. It purges
+	// the key if Key is not empty, or keys with the prefix otherwise.
+	PurgeEvent struct {
+		Key    string    `yaml:"key,omitempty"`
+		Prefix string    `yaml:"prefix,omitempty"`
+		Time   time.Time `yaml:"time"`
+	}
+)
+
+func (s *memoryStore) applyPurge(event *PurgeEvent) int {
+	s.mutex.Lock()
+	if !event.Time.After(s.lastPurge) {
+		s.mutex.Unlock()
+		return 0
+	}
+	s.lastPurge = event.Time
+	s.mutex.Unlock()
+
+	if event.Key != "" {
+		return s.purge(event.Key)
+	}
+	return s.purgePrefix(event.Prefix)
+}
+
+func (c *HTTPCache) applyPurgeEvents(events map[string]string) {
+	list := make([]*PurgeEvent, 0, len(events))
+	for k, v := range events {
+		event := &PurgeEvent{}
+		if err := yaml.Unmarshal([]byte(v), event); err != nil {
+			logger.Errorf("unmarshal purge event %s failed: %v", k, err)
+			continue
+		}
+		list = append(list, event)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Time.Before(list[j].Time)
+	})
+
+	for _, event := range list {
+		if n := c.store.applyPurge(event); n > 0 {
+			logger.Infof("httpcache %s/%s purged %d keys", c.filterSpec.Pipeline(), c.filterSpec.Name(), n)
+		}
+	}
+}
+
+func (c *HTTPCache) watchPurge() {
+	var (
+		ch     <-chan map[string]string
+		syncer *cluster.Syncer
+		err    error
+	)
+
+	prefix := c.cluster().Layout().HTTPCachePurgePrefix(c.filterSpec.Pipeline(), c.filterSpec.Name())
+	for {
+		syncer, err = c.cluster().Syncer(time.Minute)
+		if err == nil {
+			ch, err = syncer.SyncPrefix(prefix)
+			if err == nil {
+				break
+			}
+			syncer.Close()
+		}
+		logger.Errorf("failed to watch httpcache purge events: %v", err)
+		select {
+		case <-time.After(10 * time.Second):
+		case <-c.done:
+			return
+		}
+	}
+	defer syncer.Close()
+
+	for {
+		select {
+		case events := <-ch:
+			c.applyPurgeEvents(events)
+		case <-c.done:
+			return
+		}
+	}
+}
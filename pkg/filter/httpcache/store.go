@@ -0,0 +1,271 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpcache
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+type (
+	// store is the storage of entries, entries must not be modified
+	// after being stored.
+	store interface {
+		// get returns the entry of the key which matches the request header.
+		get(key string, h *httpheader.HTTPHeader) *entry
+		// put stores the entry, it replaces the same variant of the key.
+		put(ent *entry)
+		// purge removes the key, it returns the number of removed keys.
+		purge(key string) int
+		// purgePrefix removes keys with the prefix, it returns the number of removed keys.
+		purgePrefix(prefix string) int
+		// applyPurge applies the event if it has not been applied,
+		// it returns the number of purged keys.
+		applyPurge(event *PurgeEvent) int
+		setMaxBytes(maxBytes int64)
+		// stat returns the number of keys and the total size of entries.
+		stat() (int, int64)
+	}
+
+	// entry is a stored response.
+	entry struct {
+		key string
+
+		// vary is the header names in the Vary header of the response,
+		// varyValues is the values of these headers in the request.
+		vary       []string
+		varyValues []string
+
+		statusCode int
+		header     *httpheader.HTTPHeader
+		body       []byte
+
+		responseTime time.Time
+		initialAge   time.Duration
+		lifetime     time.Duration
+
+		staleWhileRevalidate time.Duration
+		staleIfError         time.Duration
+	}
+
+	// item holds the variants of a cache key.
+	item struct {
+		key      string
+		variants []*entry
+		size     int64
+	}
+
+	// memoryStore is a LRU store in memory bounded by the total size of entries.
+	memoryStore struct {
+		maxBytes int64
+
+		mutex     sync.Mutex
+		size      int64
+		lru       *list.List
+		items     map[string]*list.Element
+		lastPurge time.Time
+	}
+)
+
+func (e *entry) size() int64 {
+	size := int64(len(e.body))
+	for k, values := range e.header.Std() {
+		for _, v := range values {
+			size += int64(len(k) + len(v))
+		}
+	}
+	return size
+}
+
+func (e *entry) age(now time.Time) time.Duration {
+	return e.initialAge + now.Sub(e.responseTime)
+}
+
+func (e *entry) fresh(now time.Time) bool {
+	return e.age(now) < e.lifetime
+}
+
+// staleFor returns whether the entry is stale less than d.
+func (e *entry) staleFor(now time.Time, d time.Duration) bool {
+	return e.age(now) < e.lifetime+d
+}
+
+// variantID identifies the variant of the key.
+func (e *entry) variantID() string {
+	return e.key + "\n" + strings.Join(e.vary, ",") + "\n" + strings.Join(e.varyValues, "\n")
+}
+
+func (e *entry) etag() string {
+	return e.header.Get("ETag")
+}
+
+func (e *entry) lastModified() string {
+	return e.header.Get("Last-Modified")
+}
+
+func varyValue(h *httpheader.HTTPHeader, name string) string {
+	return strings.Join(h.GetAll(name), ",")
+}
+
+func (e *entry) matchVary(h *httpheader.HTTPHeader) bool {
+	for i, name := range e.vary {
+		if varyValue(h, name) != e.varyValues[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *entry) sameVariant(other *entry) bool {
+	if len(e.vary) != len(other.vary) {
+		return false
+	}
+
+	for i := range e.vary {
+		if e.vary[i] != other.vary[i] || e.varyValues[i] != other.varyValues[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func newMemoryStore(maxBytes int64) *memoryStore {
+	now := time.Now()
+	return &memoryStore{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		items:    map[string]*list.Element{},
+		// NOTE: Purge events before the store was created are useless.
+		lastPurge: now,
+	}
+}
+
+func (s *memoryStore) get(key string, h *httpheader.HTTPHeader) *entry {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e, ok := s.items[key]
+	if !ok {
+		return nil
+	}
+	s.lru.MoveToFront(e)
+
+	for _, variant := range e.Value.(*item).variants {
+		if variant.matchVary(h) {
+			return variant
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryStore) put(ent *entry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if ent.size() > s.maxBytes {
+		return
+	}
+
+	var it *item
+	if e, ok := s.items[ent.key]; ok {
+		it = e.Value.(*item)
+		s.lru.MoveToFront(e)
+	} else {
+		it = &item{key: ent.key}
+		s.items[ent.key] = s.lru.PushFront(it)
+	}
+
+	variants := []*entry{ent}
+	for _, variant := range it.variants {
+		if !variant.sameVariant(ent) {
+			variants = append(variants, variant)
+		}
+	}
+
+	s.size -= it.size
+	it.variants, it.size = variants, 0
+	for _, variant := range variants {
+		it.size += variant.size()
+	}
+	s.size += it.size
+
+	s.evict()
+}
+
+// evict removes the least recently used keys until the size is
+// within the limit, the caller must hold the lock.
+func (s *memoryStore) evict() {
+	for s.size > s.maxBytes {
+		s.remove(s.lru.Back())
+	}
+}
+
+func (s *memoryStore) setMaxBytes(maxBytes int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.maxBytes = maxBytes
+	s.evict()
+}
+
+// remove removes an element, the caller must hold the lock.
+func (s *memoryStore) remove(e *list.Element) {
+	it := e.Value.(*item)
+	s.lru.Remove(e)
+	delete(s.items, it.key)
+	s.size -= it.size
+}
+
+func (s *memoryStore) purge(key string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e, ok := s.items[key]
+	if !ok {
+		return 0
+	}
+
+	s.remove(e)
+	return 1
+}
+
+func (s *memoryStore) purgePrefix(prefix string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := 0
+	for key, e := range s.items {
+		if strings.HasPrefix(key, prefix) {
+			s.remove(e)
+			count++
+		}
+	}
+
+	return count
+}
+
+func (s *memoryStore) stat() (int, int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.items), s.size
+}
@@ -19,30 +19,57 @@ package proxy
 
 import (
 	"bytes"
+	"fmt"
 	"io"
+	"mime"
 	"os"
 	"strconv"
 	"strings"
 
+	"github.com/andybalholm/brotli"
 	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/grpcstatus"
 	"github.com/megaease/easegress/pkg/util/httpheader"
 )
 
-// TODO: Expose more options: compression level, mime types.
+// Content codings.
+// Reference: https://www.iana.org/assignments/http-parameters/http-parameters.xhtml#content-coding
+const (
+	encodingGzip     = "gzip"
+	encodingBrotli   = "br"
+	encodingZstd     = "zstd"
+	encodingDeflate  = "deflate"
+	encodingIdentity = "identity"
+)
 
 var bodyFlushSize = 8 * int64(os.Getpagesize())
 
 type (
-	gzipBody struct {
+	compressBody struct {
 		body     io.Reader
 		buff     *bytes.Buffer
-		gw       *gzip.Writer
+		w        io.WriteCloser
 		complete bool
 	}
 
+	decompressBody struct {
+		io.Reader
+		body  io.Reader
+		close func()
+	}
+
+	// recordReader records the data read from r until stopped, so
+	// that the data could be put back if a decoder fails on it.
+	recordReader struct {
+		r    io.Reader
+		buff *bytes.Buffer
+	}
+
 	// compression is filter compression.
 	compression struct {
 		spec *CompressionSpec
@@ -51,69 +78,322 @@ type (
 	// CompressionSpec describes the compression.
 	CompressionSpec struct {
 		MinLength uint32 `yaml:"minLength"`
+
+		// Encodings are the content codings to compress responses with,
+		// in the order of preference of the server, default is gzip only.
+		Encodings []string `yaml:"encodings" jsonschema:"omitempty,uniqueItems=true"`
+
+		// Levels of the encodings, zero means the default level.
+		GzipLevel   int `yaml:"gzipLevel" jsonschema:"omitempty,minimum=-2,maximum=9"`
+		BrotliLevel int `yaml:"brotliLevel" jsonschema:"omitempty,minimum=0,maximum=11"`
+		ZstdLevel   int `yaml:"zstdLevel" jsonschema:"omitempty,minimum=0,maximum=22"`
+
+		// MIMETypes are the media types to compress, type/* is supported,
+		// empty means all types. ExcludeMIMETypes takes precedence over it.
+		MIMETypes        []string `yaml:"mimeTypes" jsonschema:"omitempty,uniqueItems=true"`
+		ExcludeMIMETypes []string `yaml:"excludeMimeTypes" jsonschema:"omitempty,uniqueItems=true"`
+
+		// Decompress decompresses encoded responses of upstreams
+		// for clients which don't accept their encodings.
+		Decompress bool `yaml:"decompress" jsonschema:"omitempty"`
 	}
 )
 
+// Validate validates CompressionSpec.
+func (s CompressionSpec) Validate() error {
+	for _, e := range s.Encodings {
+		switch e {
+		case encodingGzip, encodingBrotli, encodingZstd:
+		default:
+			return fmt.Errorf("unsupported encoding %s", e)
+		}
+	}
+
+	for _, t := range append(s.MIMETypes, s.ExcludeMIMETypes...) {
+		if !strings.Contains(t, "/") {
+			return fmt.Errorf("invalid mime type %s", t)
+		}
+	}
+
+	return nil
+}
+
 func newCompression(spec *CompressionSpec) *compression {
+	if len(spec.Encodings) == 0 {
+		spec.Encodings = []string{encodingGzip}
+	}
+
 	return &compression{
 		spec: spec,
 	}
 }
 
 func (c *compression) compress(ctx context.HTTPContext) {
-	if !c.acceptGzip(ctx) {
+	// NOTE: gRPC has its own compression mechanism per message.
+	if grpcstatus.IsGRPC(ctx.Response().Header()) {
+		return
+	}
+
+	w := ctx.Response()
+	if w.Body() == nil {
 		return
 	}
 
-	if c.alreadyGziped(ctx) {
+	accepted := parseAcceptEncoding(ctx.Request().Header())
+
+	encoding := c.contentEncoding(ctx)
+	if encoding != "" {
+		if !c.spec.Decompress || acceptable(accepted, encoding) || !c.decompress(ctx, encoding) {
+			return
+		}
+	}
+
+	// Reference: https://tools.ietf.org/html/rfc7234#section-5.2.2.4
+	if strings.Contains(w.Header().Get(httpheader.KeyCacheControl), "no-transform") {
 		return
 	}
 
+	if !c.matchMIMEType(w.Header().Get(httpheader.KeyContentType)) {
+		return
+	}
+
+	// NOTE: The length of a decompressed body is unknown.
 	cl := c.parseContentLength(ctx)
 	if cl != -1 && cl < int(c.spec.MinLength) {
 		return
 	}
-	w := ctx.Response()
-	if w.Body() == nil {
+
+	encoding = c.negotiate(accepted)
+	if encoding == "" {
+		return
+	}
+
+	cw, buff, err := c.newWriter(encoding)
+	if err != nil {
+		logger.Errorf("BUG: create %s writer failed: %v", encoding, err)
 		return
 	}
 
-	ctx.Response().Header().Del(httpheader.KeyContentLength)
+	w.Header().Del(httpheader.KeyContentLength)
+	w.Header().Set(httpheader.KeyContentEncoding, encoding)
+	c.addVary(ctx)
+
+	ctx.AddTag(encoding)
+
+	w.SetBody(&compressBody{body: w.Body(), buff: buff, w: cw})
+}
+
+// decompress decodes the response body, it returns false if the
+// encoding is not supported.
+func (c *compression) decompress(ctx context.HTTPContext, encoding string) bool {
+	w := ctx.Response()
+	body := w.Body()
+
+	// NOTE: The gzip and zlib readers read the header on creation.
+	rr := &recordReader{r: body, buff: &bytes.Buffer{}}
+
+	var (
+		r     io.Reader
+		close func()
+		err   error
+	)
+	switch encoding {
+	case encodingGzip:
+		var gr *gzip.Reader
+		gr, err = gzip.NewReader(rr)
+		r, close = gr, func() { gr.Close() }
+	case encodingDeflate:
+		var zr io.ReadCloser
+		zr, err = zlib.NewReader(rr)
+		r, close = zr, func() { zr.Close() }
+	case encodingBrotli:
+		r, close = brotli.NewReader(body), func() {}
+	case encodingZstd:
+		var zr *zstd.Decoder
+		zr, err = zstd.NewReader(body, zstd.WithDecoderConcurrency(1))
+		r, close = zr, func() { zr.Close() }
+	default:
+		return false
+	}
+
+	if err != nil {
+		// NOTE: The body is passed through as it is, so the data
+		// read by the decoder must be put back.
+		logger.Warnf("decompress %s body failed: %v", encoding, err)
+		w.SetBody(&decompressBody{
+			Reader: io.MultiReader(rr.buff, body),
+			body:   body,
+			close:  func() {},
+		})
+		return false
+	}
+	rr.buff = nil
+
+	w.Header().Del(httpheader.KeyContentLength)
+	w.Header().Del(httpheader.KeyContentEncoding)
+	c.addVary(ctx)
 
-	w.Header().Set(httpheader.KeyContentEncoding, "gzip")
-	w.Header().Add(httpheader.KeyVary, httpheader.KeyContentEncoding)
+	ctx.AddTag("decompress " + encoding)
 
-	ctx.AddTag("gzip")
+	w.SetBody(&decompressBody{Reader: r, body: body, close: close})
 
-	w.SetBody(newGzipBody(w.Body()))
+	return true
+}
+
+func (c *compression) addVary(ctx context.HTTPContext) {
+	h := ctx.Response().Header()
+	for _, v := range h.GetAll(httpheader.KeyVary) {
+		for _, name := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(name), httpheader.KeyAcceptEncoding) {
+				return
+			}
+		}
+	}
+	h.Add(httpheader.KeyVary, httpheader.KeyAcceptEncoding)
 }
 
-func (c *compression) alreadyGziped(ctx context.HTTPContext) bool {
-	for _, ce := range ctx.Response().Header().GetAll(httpheader.KeyContentEncoding) {
-		if strings.Contains(ce, "gzip") {
-			return true
+// contentEncoding returns the encoding of the response, empty means
+// the body is not encoded.
+func (c *compression) contentEncoding(ctx context.HTTPContext) string {
+	encodings := ctx.Response().Header().GetAll(httpheader.KeyContentEncoding)
+	for i := len(encodings) - 1; i >= 0; i-- {
+		parts := strings.Split(encodings[i], ",")
+		for j := len(parts) - 1; j >= 0; j-- {
+			e := strings.ToLower(strings.TrimSpace(parts[j]))
+			if e != "" && e != encodingIdentity {
+				// NOTE: Only the outermost one matters.
+				return e
+			}
 		}
 	}
 
-	return false
+	return ""
 }
 
-func (c *compression) acceptGzip(ctx context.HTTPContext) bool {
-	acceptEncodings := ctx.Request().Header().GetAll(httpheader.KeyAcceptEncoding)
+func (c *compression) matchMIMEType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = ""
+	}
 
-	// NOTE: Easegress does not support parsing qvalue for performance.
-	// Reference: https://tools.ietf.org/html/rfc2616#section-14.3
-	if len(acceptEncodings) > 0 {
-		for _, ae := range acceptEncodings {
-			if strings.Contains(ae, "*/*") ||
-				strings.Contains(ae, "gzip") {
+	match := func(patterns []string) bool {
+		for _, p := range patterns {
+			p = strings.ToLower(p)
+			if p == mediaType || p == "*/*" ||
+				(strings.HasSuffix(p, "/*") && strings.HasPrefix(mediaType, p[:len(p)-1])) {
 				return true
 			}
 		}
 		return false
 	}
 
-	return true
+	if mediaType != "" && match(c.spec.ExcludeMIMETypes) {
+		return false
+	}
+
+	if len(c.spec.MIMETypes) == 0 {
+		return true
+	}
+
+	return mediaType != "" && match(c.spec.MIMETypes)
+}
+
+// parseAcceptEncoding parses Accept-Encoding to a map from the coding to
+// its qvalue, it returns nil if the header is absent.
+// Reference: https://tools.ietf.org/html/rfc7231#section-5.3.4
+func parseAcceptEncoding(h *httpheader.HTTPHeader) map[string]float64 {
+	values := h.GetAll(httpheader.KeyAcceptEncoding)
+	if len(values) == 0 {
+		return nil
+	}
+
+	accepted := map[string]float64{}
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			params := strings.Split(item, ";")
+			coding := strings.ToLower(strings.TrimSpace(params[0]))
+			if coding == "" {
+				continue
+			}
+			// NOTE: Some clients send */* by mistake.
+			if coding == "*/*" {
+				coding = "*"
+			}
+
+			q := 1.0
+			for _, p := range params[1:] {
+				p = strings.TrimSpace(p)
+				if strings.HasPrefix(p, "q=") {
+					if f, err := strconv.ParseFloat(p[2:], 64); err == nil {
+						q = f
+					}
+				}
+			}
+			accepted[coding] = q
+		}
+	}
+
+	return accepted
+}
+
+func qvalue(accepted map[string]float64, encoding string) float64 {
+	if accepted == nil {
+		// NOTE: No Accept-Encoding means any coding is acceptable.
+		return 1
+	}
+
+	if q, ok := accepted[encoding]; ok {
+		return q
+	}
+	if q, ok := accepted["*"]; ok {
+		return q
+	}
+	return 0
+}
+
+func acceptable(accepted map[string]float64, encoding string) bool {
+	return qvalue(accepted, encoding) > 0
+}
+
+// negotiate returns the acceptable encoding with the highest qvalue,
+// the preference of the server is used if qvalues are the same.
+func (c *compression) negotiate(accepted map[string]float64) string {
+	best, bestQ := "", 0.0
+	for _, e := range c.spec.Encodings {
+		if q := qvalue(accepted, e); q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+	return best
+}
+
+func (c *compression) newWriter(encoding string) (io.WriteCloser, *bytes.Buffer, error) {
+	buff := bytes.NewBuffer(nil)
+
+	switch encoding {
+	case encodingGzip:
+		level := c.spec.GzipLevel
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		w, err := gzip.NewWriterLevel(buff, level)
+		return w, buff, err
+	case encodingBrotli:
+		level := c.spec.BrotliLevel
+		if level == 0 {
+			level = brotli.DefaultCompression
+		}
+		return brotli.NewWriterLevel(buff, level), buff, nil
+	case encodingZstd:
+		level := zstd.SpeedDefault
+		if c.spec.ZstdLevel != 0 {
+			level = zstd.EncoderLevelFromZstd(c.spec.ZstdLevel)
+		}
+		w, err := zstd.NewWriter(buff, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(1))
+		return w, buff, err
+	}
+
+	return nil, nil, fmt.Errorf("unsupported encoding %s", encoding)
 }
 
 func (c *compression) parseContentLength(ctx context.HTTPContext) int {
@@ -130,46 +410,62 @@ func (c *compression) parseContentLength(ctx context.HTTPContext) int {
 	return int(cl)
 }
 
-func newGzipBody(body io.Reader) *gzipBody {
-	buff := bytes.NewBuffer(nil)
-	return &gzipBody{
-		body: body,
-		buff: buff,
-		gw:   gzip.NewWriter(buff),
-	}
-}
-
-// body -> gw -> p
-func (gb *gzipBody) Read(p []byte) (int, error) {
-	if gb.complete {
+// body -> w -> p
+func (cb *compressBody) Read(p []byte) (int, error) {
+	if cb.complete && cb.buff.Len() == 0 {
 		return 0, io.EOF
 	}
 
-	if len(gb.buff.Bytes()) < len(p) {
-		gb.pull()
+	if !cb.complete && cb.buff.Len() < len(p) {
+		cb.pull()
 	}
 
-	n, err := gb.buff.Read(p)
-	if err == io.EOF && !gb.complete {
+	n, err := cb.buff.Read(p)
+	if err == io.EOF && !cb.complete {
 		err = nil
 	}
 
 	return n, err
 }
 
-func (gb *gzipBody) pull() {
-	_, err := io.CopyN(gb.gw, gb.body, bodyFlushSize)
+func (cb *compressBody) pull() {
+	_, err := io.CopyN(cb.w, cb.body, bodyFlushSize)
 	switch err {
 	case nil:
 		// Nothing to do.
 	case io.EOF:
-		err := gb.gw.Close()
+		err := cb.w.Close()
 		if err != nil {
-			logger.Errorf("BUG: close gzip failed: %v", err)
+			logger.Errorf("BUG: close compression writer failed: %v", err)
 		}
-		gb.complete = true
+		cb.complete = true
 	default:
-		gb.complete = true
-		logger.Errorf("BUG: copy body to gzip failed: %v", err)
+		cb.complete = true
+		logger.Errorf("BUG: copy body to compression writer failed: %v", err)
+	}
+}
+
+// Close closes the original body.
+func (cb *compressBody) Close() error {
+	if closer, ok := cb.body.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (rr *recordReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	if rr.buff != nil {
+		rr.buff.Write(p[:n])
+	}
+	return n, err
+}
+
+// Close closes the decoder and the original body.
+func (db *decompressBody) Close() error {
+	db.close()
+	if closer, ok := db.body.(io.Closer); ok {
+		return closer.Close()
 	}
+	return nil
 }
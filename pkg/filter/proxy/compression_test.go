@@ -18,12 +18,17 @@
 package proxy
 
 import (
+	"bytes"
 	"io"
 	"net/http"
 	"os"
 	"strings"
 	"testing"
 
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+
 	"github.com/megaease/easegress/pkg/context/contexttest"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/util/httpheader"
@@ -35,37 +40,36 @@ func TestMain(m *testing.M) {
 	os.Exit(code)
 }
 
-func TestAcceptGzip(t *testing.T) {
-	c := newCompression(&CompressionSpec{MinLength: 100})
-
-	header := http.Header{}
-	ctx := &contexttest.MockedHTTPContext{}
-	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
-		return httpheader.New(header)
-	}
-
-	if !c.acceptGzip(ctx) {
-		t.Error("accept gzip should be true")
-	}
-
-	header.Add(httpheader.KeyAcceptEncoding, "text/text")
-	if c.acceptGzip(ctx) {
-		t.Error("accept gzip should be false")
-	}
+func TestNegotiate(t *testing.T) {
+	c := newCompression(&CompressionSpec{MinLength: 100, Encodings: []string{"br", "zstd", "gzip"}})
 
-	header.Add(httpheader.KeyAcceptEncoding, "*/*")
-	if !c.acceptGzip(ctx) {
-		t.Error("accept gzip should be true")
+	cases := []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{"", "br"},
+		{"text/text", ""},
+		{"*/*", "br"},
+		{"gzip", "gzip"},
+		{"gzip, zstd", "zstd"},
+		{"gzip;q=1.0, br;q=0.5", "gzip"},
+		{"*;q=0.1, br;q=0", "zstd"},
+		{"identity", ""},
 	}
 
-	header.Del(httpheader.KeyAcceptEncoding)
-	header.Add(httpheader.KeyAcceptEncoding, "gzip")
-	if !c.acceptGzip(ctx) {
-		t.Error("accept gzip should be true")
+	for _, cs := range cases {
+		header := http.Header{}
+		if cs.acceptEncoding != "" {
+			header.Set(httpheader.KeyAcceptEncoding, cs.acceptEncoding)
+		}
+		got := c.negotiate(parseAcceptEncoding(httpheader.New(header)))
+		if got != cs.expected {
+			t.Errorf("accept encoding %q: expected %q, got %q", cs.acceptEncoding, cs.expected, got)
+		}
 	}
 }
 
-func TestAlreadyGziped(t *testing.T) {
+func TestContentEncoding(t *testing.T) {
 	c := newCompression(&CompressionSpec{MinLength: 100})
 
 	header := http.Header{}
@@ -74,18 +78,43 @@ func TestAlreadyGziped(t *testing.T) {
 		return httpheader.New(header)
 	}
 
-	if c.alreadyGziped(ctx) {
-		t.Error("already gziped should be false")
+	if c.contentEncoding(ctx) != "" {
+		t.Error("content encoding should be empty")
 	}
 
-	header.Add(httpheader.KeyContentEncoding, "text")
-	if c.alreadyGziped(ctx) {
-		t.Error("already gziped should be false")
+	header.Add(httpheader.KeyContentEncoding, "identity")
+	if c.contentEncoding(ctx) != "" {
+		t.Error("content encoding should be empty")
 	}
 
 	header.Add(httpheader.KeyContentEncoding, "gzip")
-	if !c.alreadyGziped(ctx) {
-		t.Error("already gziped should be true")
+	if c.contentEncoding(ctx) != "gzip" {
+		t.Error("content encoding should be gzip")
+	}
+}
+
+func TestMatchMIMEType(t *testing.T) {
+	c := newCompression(&CompressionSpec{
+		MIMETypes:        []string{"text/*", "application/json"},
+		ExcludeMIMETypes: []string{"text/event-stream"},
+	})
+
+	cases := map[string]bool{
+		"text/html; charset=utf-8": true,
+		"application/json":         true,
+		"text/event-stream":        false,
+		"image/png":                false,
+		"":                         false,
+	}
+	for contentType, expected := range cases {
+		if c.matchMIMEType(contentType) != expected {
+			t.Errorf("content type %q: expected %v", contentType, expected)
+		}
+	}
+
+	c = newCompression(&CompressionSpec{ExcludeMIMETypes: []string{"image/*"}})
+	if !c.matchMIMEType("") || c.matchMIMEType("image/png") {
+		t.Error("only image types should be excluded")
 	}
 }
 
@@ -146,5 +175,163 @@ func TestCompress(t *testing.T) {
 	if header.Get(httpheader.KeyContentEncoding) != "gzip" {
 		t.Error("body should be gziped")
 	}
+	if header.Get(httpheader.KeyVary) != httpheader.KeyAcceptEncoding {
+		t.Error("vary should be Accept-Encoding")
+	}
+}
+
+// compressAndDecode runs the compression with a response body and returns
+// the response header and the body decoded by its Content-Encoding.
+func compressAndDecode(t *testing.T, c *compression, reqHeader, header http.Header, body []byte) (http.Header, string) {
+	var rb io.Reader = bytes.NewReader(body)
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(reqHeader)
+	}
+	ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(header)
+	}
+	ctx.MockedResponse.MockedBody = func() io.Reader {
+		return rb
+	}
+	ctx.MockedResponse.MockedSetBody = func(body io.Reader) {
+		rb = body
+	}
+
+	c.compress(ctx)
+
+	var r io.Reader = rb
+	switch header.Get(httpheader.KeyContentEncoding) {
+	case "gzip":
+		gr, err := gzip.NewReader(rb)
+		if err != nil {
+			t.Fatalf("create gzip reader failed: %v", err)
+		}
+		r = gr
+	case "br":
+		r = brotli.NewReader(rb)
+	case "zstd":
+		zr, err := zstd.NewReader(rb)
+		if err != nil {
+			t.Fatalf("create zstd reader failed: %v", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
 
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read body failed: %v", err)
+	}
+	if closer, ok := rb.(io.Closer); ok {
+		closer.Close()
+	}
+
+	return header, string(data)
+}
+
+func TestCompressEncodings(t *testing.T) {
+	rawBody := strings.Repeat("this is the raw body. ", 1000)
+
+	for _, encoding := range []string{"gzip", "br", "zstd"} {
+		c := newCompression(&CompressionSpec{
+			Encodings:   []string{encoding},
+			GzipLevel:   9,
+			BrotliLevel: 4,
+			ZstdLevel:   19,
+		})
+
+		reqHeader := http.Header{httpheader.KeyAcceptEncoding: {"gzip, deflate, br, zstd"}}
+		header, body := compressAndDecode(t, c, reqHeader, http.Header{}, []byte(rawBody))
+		if header.Get(httpheader.KeyContentEncoding) != encoding {
+			t.Errorf("body should be encoded by %s", encoding)
+		}
+		if body != rawBody {
+			t.Errorf("%s: decoded body mismatch", encoding)
+		}
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	rawBody := strings.Repeat("this is the raw body. ", 1000)
+
+	buff := bytes.NewBuffer(nil)
+	gw := gzip.NewWriter(buff)
+	gw.Write([]byte(rawBody))
+	gw.Close()
+
+	c := newCompression(&CompressionSpec{Encodings: []string{"br"}, Decompress: true})
+
+	// The client accepts gzip, so the body is kept as it is.
+	reqHeader := http.Header{httpheader.KeyAcceptEncoding: {"gzip"}}
+	header := http.Header{httpheader.KeyContentEncoding: {"gzip"}}
+	header, body := compressAndDecode(t, c, reqHeader, header, buff.Bytes())
+	if header.Get(httpheader.KeyContentEncoding) != "gzip" || body != rawBody {
+		t.Error("body should be kept as gzip")
+	}
+
+	// The client accepts br only, so the body is transcoded.
+	reqHeader = http.Header{httpheader.KeyAcceptEncoding: {"br"}}
+	header = http.Header{httpheader.KeyContentEncoding: {"gzip"}}
+	header, body = compressAndDecode(t, c, reqHeader, header, buff.Bytes())
+	if header.Get(httpheader.KeyContentEncoding) != "br" || body != rawBody {
+		t.Error("body should be transcoded to br")
+	}
+
+	// The client accepts nothing, so the body is decompressed.
+	reqHeader = http.Header{httpheader.KeyAcceptEncoding: {"identity"}}
+	header = http.Header{httpheader.KeyContentEncoding: {"gzip"}}
+	header, body = compressAndDecode(t, c, reqHeader, header, buff.Bytes())
+	if header.Get(httpheader.KeyContentEncoding) != "" || body != rawBody {
+		t.Error("body should be decompressed")
+	}
+}
+
+func TestDecompressBogusBody(t *testing.T) {
+	// A body with a bogus gzip header, which is longer than the
+	// buffer of the gzip reader, so that it's read partially.
+	rawBody := "\x1f\x8b" + strings.Repeat("not gzip at all", 1000)
+	var rb io.Reader = strings.NewReader(rawBody)
+	header := http.Header{httpheader.KeyContentEncoding: {"gzip"}}
+
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(http.Header{httpheader.KeyAcceptEncoding: {"identity"}})
+	}
+	ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(header)
+	}
+	ctx.MockedResponse.MockedBody = func() io.Reader {
+		return rb
+	}
+	ctx.MockedResponse.MockedSetBody = func(body io.Reader) {
+		rb = body
+	}
+
+	c := newCompression(&CompressionSpec{Decompress: true})
+	c.compress(ctx)
+
+	// The body is passed through as it is.
+	if header.Get(httpheader.KeyContentEncoding) != "gzip" {
+		t.Errorf("content encoding should be kept, got %q", header.Get(httpheader.KeyContentEncoding))
+	}
+	data, err := io.ReadAll(rb)
+	if err != nil {
+		t.Fatalf("read body failed: %v", err)
+	}
+	if string(data) != rawBody {
+		t.Errorf("body should be kept, got %d bytes, want %d bytes", len(data), len(rawBody))
+	}
+}
+
+func TestCompressionSpecValidate(t *testing.T) {
+	if (CompressionSpec{Encodings: []string{"gzip", "br", "zstd"}}).Validate() != nil {
+		t.Error("spec should be valid")
+	}
+	if (CompressionSpec{Encodings: []string{"lzma"}}).Validate() == nil {
+		t.Error("unsupported encoding should be invalid")
+	}
+	if (CompressionSpec{MIMETypes: []string{"text"}}).Validate() == nil {
+		t.Error("invalid mime type should be invalid")
+	}
 }
@@ -0,0 +1,306 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/proxyprotocol"
+)
+
+const (
+	// HealthCheckProtocolHTTP probes servers by HTTP GET.
+	HealthCheckProtocolHTTP = "http"
+	// HealthCheckProtocolTCP probes servers by TCP connecting.
+	HealthCheckProtocolTCP = "tcp"
+
+	defaultHealthCheckInterval       = 10 * time.Second
+	defaultHealthCheckTimeout        = 3 * time.Second
+	defaultHealthyThreshold          = 2
+	defaultUnhealthyThreshold        = 3
+	defaultOutlierConsecutiveErrors  = 5
+	defaultOutlierEjectionTime       = 30 * time.Second
+	defaultOutlierMaxEjectionPercent = 50
+)
+
+type (
+	// HealthCheckSpec is the spec of active health checking.
+	HealthCheckSpec struct {
+		Protocol           string `yaml:"protocol" jsonschema:"omitempty,enum=http,enum=tcp"`
+		Path               string `yaml:"path" jsonschema:"omitempty,pattern=^/"`
+		Interval           string `yaml:"interval" jsonschema:"omitempty,format=duration"`
+		Timeout            string `yaml:"timeout" jsonschema:"omitempty,format=duration"`
+		HealthyThreshold   uint32 `yaml:"healthyThreshold" jsonschema:"omitempty,minimum=1"`
+		UnhealthyThreshold uint32 `yaml:"unhealthyThreshold" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// OutlierDetectionSpec is the spec of passive outlier ejection,
+	// a server is ejected for a while after consecutive errors,
+	// the errors are 5xx responses and failures of connecting.
+	OutlierDetectionSpec struct {
+		ConsecutiveErrors  uint32 `yaml:"consecutiveErrors" jsonschema:"omitempty,minimum=1"`
+		EjectionTime       string `yaml:"ejectionTime" jsonschema:"omitempty,format=duration"`
+		MaxEjectionPercent uint32 `yaml:"maxEjectionPercent" jsonschema:"omitempty,minimum=1,maximum=100"`
+	}
+
+	// ServerStatus is the health status of a server.
+	ServerStatus struct {
+		URL     string `yaml:"url"`
+		Healthy bool   `yaml:"healthy"`
+		Ejected bool   `yaml:"ejected"`
+
+		// ConsecutiveFailures is the number of consecutive failed probes.
+		ConsecutiveFailures uint32 `yaml:"consecutiveFailures"`
+		// ConsecutiveErrors is the number of consecutive failed requests.
+		ConsecutiveErrors uint32 `yaml:"consecutiveErrors"`
+
+		LastError string `yaml:"lastError,omitempty"`
+	}
+
+	serverHealth struct {
+		healthy      bool
+		successes    uint32
+		failures     uint32
+		errors       uint32
+		ejectedUntil time.Time
+		lastError    string
+	}
+
+	healthChecker struct {
+		spec   *HealthCheckSpec
+		client *http.Client
+	}
+)
+
+func parseDurationOrDefault(d string, defaultValue time.Duration) time.Duration {
+	if d == "" {
+		return defaultValue
+	}
+
+	v, err := time.ParseDuration(d)
+	if err != nil {
+		logger.Errorf("BUG: parse duration %s failed: %v", d, err)
+		return defaultValue
+	}
+
+	return v
+}
+
+func (spec *HealthCheckSpec) interval() time.Duration {
+	return parseDurationOrDefault(spec.Interval, defaultHealthCheckInterval)
+}
+
+func (spec *HealthCheckSpec) timeout() time.Duration {
+	return parseDurationOrDefault(spec.Timeout, defaultHealthCheckTimeout)
+}
+
+func (spec *HealthCheckSpec) healthyThreshold() uint32 {
+	if spec.HealthyThreshold == 0 {
+		return defaultHealthyThreshold
+	}
+	return spec.HealthyThreshold
+}
+
+func (spec *HealthCheckSpec) unhealthyThreshold() uint32 {
+	if spec.UnhealthyThreshold == 0 {
+		return defaultUnhealthyThreshold
+	}
+	return spec.UnhealthyThreshold
+}
+
+func (spec *OutlierDetectionSpec) consecutiveErrors() uint32 {
+	if spec.ConsecutiveErrors == 0 {
+		return defaultOutlierConsecutiveErrors
+	}
+	return spec.ConsecutiveErrors
+}
+
+func (spec *OutlierDetectionSpec) ejectionTime() time.Duration {
+	return parseDurationOrDefault(spec.EjectionTime, defaultOutlierEjectionTime)
+}
+
+func (spec *OutlierDetectionSpec) maxEjectionPercent() uint32 {
+	if spec.MaxEjectionPercent == 0 {
+		return defaultOutlierMaxEjectionPercent
+	}
+	return spec.MaxEjectionPercent
+}
+
+func newServerHealth() *serverHealth {
+	return &serverHealth{healthy: true}
+}
+
+func (h *serverHealth) ejected(now time.Time) bool {
+	return now.Before(h.ejectedUntil)
+}
+
+func (h *serverHealth) available(now time.Time) bool {
+	return h.healthy && !h.ejected(now)
+}
+
+// recordProbe records the result of a probe,
+// it returns true if the health of the server changed.
+func (h *serverHealth) recordProbe(spec *HealthCheckSpec, err error) bool {
+	if err == nil {
+		h.failures = 0
+		h.successes++
+		if !h.healthy && h.successes >= spec.healthyThreshold() {
+			h.healthy = true
+			return true
+		}
+		return false
+	}
+
+	h.lastError = err.Error()
+	h.successes = 0
+	h.failures++
+	if h.healthy && h.failures >= spec.unhealthyThreshold() {
+		h.healthy = false
+		return true
+	}
+	return false
+}
+
+func (h *serverHealth) status(url string, now time.Time) *ServerStatus {
+	return &ServerStatus{
+		URL:                 url,
+		Healthy:             h.healthy,
+		Ejected:             h.ejected(now),
+		ConsecutiveFailures: h.failures,
+		ConsecutiveErrors:   h.errors,
+		LastError:           h.lastError,
+	}
+}
+
+func newHealthChecker(spec *HealthCheckSpec, tlsConfig *tls.Config, proxyProtocol string) *healthChecker {
+	transport := &http.Transport{
+		TLSClientConfig:   tlsConfig,
+		DisableKeepAlives: true,
+	}
+
+	// NOTE: The probes send PROXY protocol headers without addresses,
+	// which are meant for health checks by the protocol.
+	if proxyProtocol != "" {
+		dialer := &net.Dialer{}
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			if err := proxyprotocol.WriteHeader(conn, proxyProtocol, nil, nil); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return conn, nil
+		}
+	}
+
+	return &healthChecker{
+		spec: spec,
+		client: &http.Client{
+			Timeout:   spec.timeout(),
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// probeAll probes servers concurrently, the key of result is the server URL.
+func (hc *healthChecker) probeAll(servers []*Server) map[string]error {
+	result := make(map[string]error, len(servers))
+	mutex := sync.Mutex{}
+	wg := &sync.WaitGroup{}
+
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *Server) {
+			defer wg.Done()
+			err := hc.probe(server)
+			mutex.Lock()
+			result[server.URL] = err
+			mutex.Unlock()
+		}(server)
+	}
+	wg.Wait()
+
+	return result
+}
+
+func (hc *healthChecker) probe(server *Server) error {
+	if hc.spec.Protocol == HealthCheckProtocolTCP {
+		return hc.probeTCP(server)
+	}
+	return hc.probeHTTP(server)
+}
+
+func (hc *healthChecker) probeHTTP(server *Server) error {
+	path := hc.spec.Path
+	if path == "" {
+		path = "/"
+	}
+
+	resp, err := hc.client.Get(server.URL + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (hc *healthChecker) probeTCP(server *Server) error {
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		return err
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, hc.spec.timeout())
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func (hc *healthChecker) close() {
+	hc.client.CloseIdleConnections()
+}
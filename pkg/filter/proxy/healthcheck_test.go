@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthCheck(t *testing.T) {
+	var healthy int32 = 1
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&healthy) == 1 {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer backend.Close()
+
+	spec := &PoolSpec{
+		Servers: []*Server{
+			{URL: backend.URL},
+			{URL: "http://127.0.0.1:1"},
+		},
+		LoadBalance: &LoadBalance{Policy: PolicyRoundRobin},
+		HealthCheck: &HealthCheckSpec{
+			Path:               "/healthz",
+			Timeout:            "500ms",
+			HealthyThreshold:   1,
+			UnhealthyThreshold: 1,
+		},
+	}
+
+	s := &servers{poolSpec: spec}
+	s.useStaticServers()
+	s.healthChecker = newHealthChecker(spec.HealthCheck, nil, "")
+
+	s.probe()
+	if s.len() != 1 || s.snapshot().servers[0].URL != backend.URL {
+		t.Fatalf("the dead server should be removed: %+v", s.snapshot().servers)
+	}
+
+	status := s.status()
+	if !status[0].Healthy || status[1].Healthy || status[1].LastError == "" {
+		t.Errorf("unexpected status: %+v %+v", status[0], status[1])
+	}
+
+	// None of servers is healthy, use all of them.
+	atomic.StoreInt32(&healthy, 0)
+	s.probe()
+	if s.len() != 2 {
+		t.Errorf("all servers should be used when none is healthy")
+	}
+
+	// The server recovers.
+	atomic.StoreInt32(&healthy, 1)
+	s.probe()
+	if s.len() != 1 || s.snapshot().servers[0].URL != backend.URL {
+		t.Errorf("the recovered server should be restored: %+v", s.snapshot().servers)
+	}
+}
+
+func TestOutlierDetection(t *testing.T) {
+	spec := &PoolSpec{
+		Servers: []*Server{
+			{URL: "http://127.0.0.1:9091"},
+			{URL: "http://127.0.0.1:9092"},
+			{URL: "http://127.0.0.1:9093"},
+			{URL: "http://127.0.0.1:9094"},
+		},
+		LoadBalance: &LoadBalance{Policy: PolicyRoundRobin},
+		OutlierDetection: &OutlierDetectionSpec{
+			ConsecutiveErrors:  2,
+			EjectionTime:       "100ms",
+			MaxEjectionPercent: 25,
+		},
+	}
+
+	s := &servers{poolSpec: spec}
+	s.useStaticServers()
+
+	err := fmt.Errorf("status code 503")
+	s.recordResult(spec.Servers[0], err)
+	if s.len() != 4 {
+		t.Errorf("server should not be ejected before reaching the threshold")
+	}
+
+	s.recordResult(spec.Servers[0], err)
+	if s.len() != 3 {
+		t.Errorf("server should be ejected after consecutive errors")
+	}
+	if status := s.status(); !status[0].Ejected {
+		t.Errorf("server should be reported as ejected: %+v", status[0])
+	}
+
+	// Success resets the consecutive errors.
+	s.recordResult(spec.Servers[1], err)
+	s.recordResult(spec.Servers[1], nil)
+	s.recordResult(spec.Servers[1], err)
+	if s.len() != 3 {
+		t.Errorf("server should not be ejected if errors are not consecutive")
+	}
+
+	// Max ejection percent stops ejecting more servers.
+	s.recordResult(spec.Servers[2], err)
+	s.recordResult(spec.Servers[2], err)
+	if s.len() != 3 {
+		t.Errorf("max ejection percent is exceeded")
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if s.len() != 4 {
+		t.Errorf("ejected server should be restored after ejection time")
+	}
+}
@@ -0,0 +1,358 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/hashtool"
+)
+
+const (
+	// HashAlgorithmRing is the ring hash (ketama) algorithm.
+	HashAlgorithmRing = "ring"
+	// HashAlgorithmMaglev is the Maglev hash algorithm.
+	HashAlgorithmMaglev = "maglev"
+
+	// HashKeySourceHeader uses a header value as the hash key.
+	HashKeySourceHeader = "header"
+	// HashKeySourceCookie uses a cookie value as the hash key.
+	HashKeySourceCookie = "cookie"
+	// HashKeySourceQuery uses a query parameter as the hash key.
+	HashKeySourceQuery = "query"
+	// HashKeySourceIP uses the client IP as the hash key.
+	HashKeySourceIP = "ip"
+
+	defaultStickyCookieName = "EG_SESSION"
+
+	// ringReplicas is the number of virtual nodes of every server in the ring.
+	ringReplicas = 100
+	// maglevTableSize must be a prime number larger than 100 times of servers.
+	maglevTableSize = 65537
+
+	// ewmaDecay is the time constant of peak EWMA, a latency sample
+	// decays to 1/e of its weight after the duration.
+	ewmaDecay = 10 * time.Second
+)
+
+type (
+	// HashKey describes where to get the key of consistent hash.
+	HashKey struct {
+		Source string `yaml:"source" jsonschema:"required,enum=header,enum=cookie,enum=query,enum=ip"`
+		Name   string `yaml:"name" jsonschema:"omitempty"`
+	}
+
+	// StickySession describes the sticky session by a generated cookie.
+	StickySession struct {
+		CookieName string `yaml:"cookieName" jsonschema:"omitempty"`
+		CookieTTL  string `yaml:"cookieTTL" jsonschema:"omitempty,format=duration"`
+	}
+
+	// consistentHash picks a server by a hash value.
+	consistentHash interface {
+		get(hash uint32) *Server
+	}
+
+	hashRing struct {
+		hashes  []uint32
+		servers []*Server
+	}
+
+	maglevTable struct {
+		table []*Server
+	}
+)
+
+// Validate validates HashKey.
+func (hk HashKey) Validate() error {
+	if hk.Source != HashKeySourceIP && hk.Name == "" {
+		return fmt.Errorf("hash key from %s needs name", hk.Source)
+	}
+
+	return nil
+}
+
+func (hk *HashKey) value(ctx context.HTTPContext) string {
+	r := ctx.Request()
+
+	switch hk.Source {
+	case HashKeySourceHeader:
+		return r.Header().Get(hk.Name)
+	case HashKeySourceCookie:
+		cookie, err := r.Cookie(hk.Name)
+		if err != nil || cookie == nil {
+			return ""
+		}
+		return cookie.Value
+	case HashKeySourceQuery:
+		return r.Std().URL.Query().Get(hk.Name)
+	default:
+		return r.RealIP()
+	}
+}
+
+func (ss *StickySession) cookieName() string {
+	if ss.CookieName == "" {
+		return defaultStickyCookieName
+	}
+	return ss.CookieName
+}
+
+// setCookie sets the sticky cookie if the request doesn't carry the right one.
+func (ss *StickySession) setCookie(ctx context.HTTPContext, server *Server) {
+	name, value := ss.cookieName(), server.stickyValue()
+
+	cookie, err := ctx.Request().Cookie(name)
+	if err == nil && cookie != nil && cookie.Value == value {
+		return
+	}
+
+	cookie = &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+	}
+	if ss.CookieTTL != "" {
+		ttl := parseDurationOrDefault(ss.CookieTTL, 0)
+		cookie.MaxAge = int(ttl.Seconds())
+	}
+
+	ctx.Response().SetCookie(cookie)
+}
+
+func hash64(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// stickyValue returns the cookie value of sticky session,
+// it doesn't expose the server URL to clients.
+func (s *Server) stickyValue() string {
+	return strconv.FormatUint(hash64(s.URL), 16)
+}
+
+// beginRequest must be followed by endRequest.
+func (s *Server) beginRequest() {
+	atomic.AddInt64(&s.activeRequests, 1)
+}
+
+func (s *Server) endRequest() {
+	atomic.AddInt64(&s.activeRequests, -1)
+}
+
+func (s *Server) active() int64 {
+	return atomic.LoadInt64(&s.activeRequests)
+}
+
+// observeLatency updates the peak EWMA of latency, the peak is taken
+// immediately, otherwise the average decays with the elapsed time.
+// NOTE: Concurrent updates may lose samples, it's acceptable for load balancing.
+func (s *Server) observeLatency(latency time.Duration) {
+	now := time.Now().UnixNano()
+	rtt := float64(latency)
+
+	last := atomic.SwapInt64(&s.ewmaStamp, now)
+	ewma := math.Float64frombits(atomic.LoadUint64(&s.ewma))
+
+	if last == 0 || rtt > ewma {
+		ewma = rtt
+	} else {
+		w := math.Exp(-float64(now-last) / float64(ewmaDecay))
+		ewma = ewma*w + rtt*(1-w)
+	}
+
+	atomic.StoreUint64(&s.ewma, math.Float64bits(ewma))
+}
+
+// cost is the peak EWMA weighted by the number of active requests.
+func (s *Server) cost() float64 {
+	ewma := math.Float64frombits(atomic.LoadUint64(&s.ewma))
+	return ewma * float64(s.active()+1)
+}
+
+func newHashRing(servers []*Server) *hashRing {
+	type node struct {
+		hash   uint32
+		server *Server
+	}
+
+	nodes := make([]node, 0, len(servers)*ringReplicas)
+	for _, server := range servers {
+		for i := 0; i < ringReplicas; i++ {
+			nodes = append(nodes, node{
+				hash:   uint32(hash64(server.URL + "#" + strconv.Itoa(i))),
+				server: server,
+			})
+		}
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].hash < nodes[j].hash
+	})
+
+	ring := &hashRing{
+		hashes:  make([]uint32, len(nodes)),
+		servers: make([]*Server, len(nodes)),
+	}
+	for i, n := range nodes {
+		ring.hashes[i], ring.servers[i] = n.hash, n.server
+	}
+
+	return ring
+}
+
+func (ring *hashRing) get(hash uint32) *Server {
+	i := sort.Search(len(ring.hashes), func(i int) bool {
+		return ring.hashes[i] >= hash
+	})
+	if i == len(ring.hashes) {
+		i = 0
+	}
+
+	return ring.servers[i]
+}
+
+// newMaglevTable builds the lookup table.
+// Reference: https://research.google/pubs/pub44824/
+func newMaglevTable(servers []*Server) *maglevTable {
+	m := uint64(maglevTableSize)
+	n := len(servers)
+
+	offsets := make([]uint64, n)
+	skips := make([]uint64, n)
+	for i, server := range servers {
+		h := hash64(server.URL)
+		offsets[i] = (h >> 32) % m
+		skips[i] = (h&0xffffffff)%(m-1) + 1
+	}
+
+	table := make([]*Server, m)
+	next := make([]uint64, n)
+	filled := uint64(0)
+	for {
+		for i := 0; i < n; i++ {
+			c := (offsets[i] + next[i]*skips[i]) % m
+			for table[c] != nil {
+				next[i]++
+				c = (offsets[i] + next[i]*skips[i]) % m
+			}
+			table[c] = servers[i]
+			next[i]++
+			filled++
+			if filled == m {
+				return &maglevTable{table: table}
+			}
+		}
+	}
+}
+
+func (mt *maglevTable) get(hash uint32) *Server {
+	return mt.table[uint64(hash)%uint64(len(mt.table))]
+}
+
+func (ss *staticServers) prepareConsistentHash() {
+	if ss.lb.Policy != PolicyConsistentHash || len(ss.servers) == 0 {
+		return
+	}
+
+	if ss.lb.HashAlgorithm == HashAlgorithmMaglev {
+		ss.hash = newMaglevTable(ss.servers)
+	} else {
+		ss.hash = newHashRing(ss.servers)
+	}
+}
+
+func (ss *staticServers) consistentHash(ctx context.HTTPContext) *Server {
+	if ss.hash == nil || ss.lb.HashKey == nil {
+		return ss.roundRobin(ctx)
+	}
+
+	key := ss.lb.HashKey.value(ctx)
+	if key == "" {
+		return ss.roundRobin(ctx)
+	}
+
+	return ss.hash.get(hashtool.Hash32(key))
+}
+
+func (ss *staticServers) leastConnections(ctx context.HTTPContext) *Server {
+	// NOTE: Start from a rotating position to spread servers with the same count.
+	start := int(atomic.AddUint64(&ss.count, 1) % uint64(len(ss.servers)))
+
+	var picked *Server
+	for i := 0; i < len(ss.servers); i++ {
+		server := ss.servers[(start+i)%len(ss.servers)]
+		if picked == nil || server.active() < picked.active() {
+			picked = server
+		}
+	}
+
+	return picked
+}
+
+// peakEWMA picks the server with lower cost from two random servers,
+// it's the power of two choices.
+func (ss *staticServers) peakEWMA(ctx context.HTTPContext) *Server {
+	n := len(ss.servers)
+	if n == 1 {
+		return ss.servers[0]
+	}
+
+	i := rand.Intn(n)
+	j := rand.Intn(n - 1)
+	if j >= i {
+		j++
+	}
+
+	a, b := ss.servers[i], ss.servers[j]
+	if b.cost() < a.cost() {
+		return b
+	}
+	return a
+}
+
+func (ss *staticServers) prepareStickySession() {
+	if ss.lb.StickySession == nil {
+		return
+	}
+
+	ss.stickyServers = make(map[string]*Server, len(ss.servers))
+	for _, server := range ss.servers {
+		ss.stickyServers[server.stickyValue()] = server
+	}
+}
+
+func (ss *staticServers) stickyServer(ctx context.HTTPContext) *Server {
+	cookie, err := ctx.Request().Cookie(ss.lb.StickySession.cookieName())
+	if err != nil || cookie == nil {
+		return nil
+	}
+
+	return ss.stickyServers[cookie.Value]
+}
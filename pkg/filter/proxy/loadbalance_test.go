@@ -0,0 +1,178 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+func newTestServers(n int) []*Server {
+	servers := make([]*Server, n)
+	for i := 0; i < n; i++ {
+		servers[i] = &Server{URL: fmt.Sprintf("http://192.168.0.%d:8080", i+1)}
+	}
+	return servers
+}
+
+func TestLeastConnections(t *testing.T) {
+	servers := newTestServers(3)
+	ss := newStaticServers(servers, nil, &LoadBalance{Policy: PolicyLeastConnections})
+	ctx := &contexttest.MockedHTTPContext{}
+
+	servers[0].beginRequest()
+	servers[0].beginRequest()
+	servers[1].beginRequest()
+
+	for i := 0; i < 10; i++ {
+		if s := ss.next(ctx); s != servers[2] {
+			t.Fatalf("want %s, got %s", servers[2].URL, s.URL)
+		}
+	}
+
+	servers[0].endRequest()
+	servers[0].endRequest()
+	if s := ss.next(ctx); s == servers[1] {
+		t.Errorf("server with more connections should not be picked")
+	}
+}
+
+func TestPeakEWMA(t *testing.T) {
+	servers := newTestServers(2)
+	ss := newStaticServers(servers, nil, &LoadBalance{Policy: PolicyPeakEWMA})
+	ctx := &contexttest.MockedHTTPContext{}
+
+	servers[0].observeLatency(100 * time.Millisecond)
+	servers[1].observeLatency(10 * time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		if s := ss.next(ctx); s != servers[1] {
+			t.Fatalf("want %s, got %s", servers[1].URL, s.URL)
+		}
+	}
+
+	// The peak is taken immediately.
+	servers[1].observeLatency(time.Second)
+	if s := ss.next(ctx); s != servers[0] {
+		t.Errorf("want %s, got %s", servers[0].URL, s.URL)
+	}
+}
+
+func testConsistentHash(t *testing.T, algorithm string) {
+	servers := newTestServers(5)
+	lb := &LoadBalance{
+		Policy:        PolicyConsistentHash,
+		HashAlgorithm: algorithm,
+		HashKey:       &HashKey{Source: HashKeySourceHeader, Name: "X-User"},
+	}
+	if err := lb.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	header := http.Header{}
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(header)
+	}
+
+	ss := newStaticServers(servers, nil, lb)
+	picked := map[string]*Server{}
+	for i := 0; i < 1000; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		header.Set("X-User", user)
+		picked[user] = ss.next(ctx)
+		if ss.next(ctx) != picked[user] {
+			t.Fatalf("the same key picks different servers")
+		}
+	}
+
+	// Ring hash only remaps keys of the removed server,
+	// Maglev hash has minimal disruption.
+	removed := servers[2]
+	ss = newStaticServers(append(servers[:2:2], servers[3:]...), nil, lb)
+	remapped := 0
+	for user, server := range picked {
+		header.Set("X-User", user)
+		if server != removed && ss.next(ctx) != server {
+			remapped++
+		}
+	}
+	if algorithm == HashAlgorithmRing && remapped != 0 {
+		t.Errorf("%d keys of other servers are remapped", remapped)
+	}
+	if remapped > len(picked)/20 {
+		t.Errorf("too many keys of other servers are remapped: %d", remapped)
+	}
+}
+
+func TestConsistentHash(t *testing.T) {
+	testConsistentHash(t, HashAlgorithmRing)
+	testConsistentHash(t, HashAlgorithmMaglev)
+
+	lb := &LoadBalance{Policy: PolicyConsistentHash}
+	if lb.Validate() == nil {
+		t.Errorf("consistentHash without hashKey should be invalid")
+	}
+	if (HashKey{Source: HashKeySourceCookie}).Validate() == nil {
+		t.Errorf("hash key from cookie without name should be invalid")
+	}
+}
+
+func TestStickySession(t *testing.T) {
+	servers := newTestServers(3)
+	lb := &LoadBalance{
+		Policy:        PolicyRoundRobin,
+		StickySession: &StickySession{CookieTTL: "1h"},
+	}
+	ss := newStaticServers(servers, nil, lb)
+
+	var setCookie *http.Cookie
+	var reqCookie *http.Cookie
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedCookie = func(name string) (*http.Cookie, error) {
+		if reqCookie == nil {
+			return nil, http.ErrNoCookie
+		}
+		return reqCookie, nil
+	}
+	ctx.MockedResponse.MockedSetCookie = func(cookie *http.Cookie) {
+		setCookie = cookie
+	}
+
+	server := ss.next(ctx)
+	lb.StickySession.setCookie(ctx, server)
+	if setCookie == nil || setCookie.Name != defaultStickyCookieName || setCookie.MaxAge != 3600 {
+		t.Fatalf("unexpected cookie: %+v", setCookie)
+	}
+
+	reqCookie, setCookie = setCookie, nil
+	for i := 0; i < 10; i++ {
+		if ss.next(ctx) != server {
+			t.Fatalf("sticky session picks a different server")
+		}
+	}
+	lb.StickySession.setCookie(ctx, server)
+	if setCookie != nil {
+		t.Errorf("cookie should not be set again")
+	}
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"strconv"
+
+	"github.com/megaease/easegress/pkg/util/httpstat"
+	"github.com/megaease/easegress/pkg/util/prometheushelper"
+)
+
+const metricsSubsystem = "proxy"
+
+var (
+	poolLabels = []string{"pipeline", "filter", "pool", "backend"}
+
+	requestsTotal = prometheushelper.NewCounter(metricsSubsystem, "requests_total",
+		"The total number of requests sent to backends.",
+		append(poolLabels, "code"))
+	requestErrorsTotal = prometheushelper.NewCounter(metricsSubsystem, "request_errors_total",
+		"The total number of requests failed to get responses from backends.",
+		poolLabels)
+	requestDuration = prometheushelper.NewHistogram(metricsSubsystem, "request_duration_seconds",
+		"The latency of requests sent to backends.",
+		poolLabels, prometheushelper.DurationBuckets)
+)
+
+// poolMetrics exports metrics of a pool.
+type poolMetrics struct {
+	pipeline string
+	filter   string
+	pool     string
+
+	// series is shared by all pools of the Proxy.
+	series *prometheushelper.Series
+}
+
+// poolLabelIndex is the index of the pool in the label values.
+const poolLabelIndex = 2
+
+func (pm *poolMetrics) stat(backend string, m *httpstat.Metric) {
+	code := strconv.Itoa(m.StatusCode)
+	requestsTotal.WithLabelValues(pm.pipeline, pm.filter, pm.pool, backend, code).Inc()
+	pm.series.Add(requestsTotal.MetricVec, pm.pipeline, pm.filter, pm.pool, backend, code)
+	requestDuration.WithLabelValues(pm.pipeline, pm.filter, pm.pool, backend).Observe(m.Duration.Seconds())
+	pm.series.Add(requestDuration.MetricVec, pm.pipeline, pm.filter, pm.pool, backend)
+}
+
+func (pm *poolMetrics) statError(backend string) {
+	requestErrorsTotal.WithLabelValues(pm.pipeline, pm.filter, pm.pool, backend).Inc()
+	pm.series.Add(requestErrorsTotal.MetricVec, pm.pipeline, pm.filter, pm.pool, backend)
+}
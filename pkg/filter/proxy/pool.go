@@ -18,6 +18,7 @@
 package proxy
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net/http"
@@ -30,6 +31,7 @@ import (
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/tracing"
 	"github.com/megaease/easegress/pkg/util/callbackreader"
+	"github.com/megaease/easegress/pkg/util/fasttime"
 	"github.com/megaease/easegress/pkg/util/httpfilter"
 	"github.com/megaease/easegress/pkg/util/httpheader"
 	"github.com/megaease/easegress/pkg/util/httpstat"
@@ -48,7 +50,12 @@ type (
 
 		servers     *servers
 		httpStat    *httpstat.HTTPStat
+		metrics     *poolMetrics
 		memoryCache *memorycache.MemoryCache
+
+		// client is the pool's own client sending PROXY protocol headers,
+		// it's nil if the pool uses the shared client of the proxy.
+		client *http.Client
 	}
 
 	// PoolSpec describes a pool of servers.
@@ -61,11 +68,19 @@ type (
 		ServiceName     string            `yaml:"serviceName" jsonschema:"omitempty"`
 		LoadBalance     *LoadBalance      `yaml:"loadBalance" jsonschema:"required"`
 		MemoryCache     *memorycache.Spec `yaml:"memoryCache,omitempty" jsonschema:"omitempty"`
+
+		HealthCheck      *HealthCheckSpec      `yaml:"healthCheck,omitempty" jsonschema:"omitempty"`
+		OutlierDetection *OutlierDetectionSpec `yaml:"outlierDetection,omitempty" jsonschema:"omitempty"`
+
+		// ProxyProtocol is the version of PROXY protocol headers sent to
+		// servers, empty means not to send them.
+		ProxyProtocol string `yaml:"proxyProtocol" jsonschema:"omitempty,enum=,enum=v1,enum=v2"`
 	}
 
 	// PoolStatus is the status of Pool.
 	PoolStatus struct {
-		Stat *httpstat.Status `yaml:"stat"`
+		Stat    *httpstat.Status `yaml:"stat"`
+		Servers []*ServerStatus  `yaml:"servers,omitempty"`
 	}
 )
 
@@ -97,7 +112,7 @@ func (s PoolSpec) Validate() error {
 }
 
 func newPool(super *supervisor.Supervisor, spec *PoolSpec, tagPrefix string,
-	writeResponse bool, failureCodes []int) *pool {
+	writeResponse bool, failureCodes []int, tlsConfig *tls.Config, metrics *poolMetrics) *pool {
 
 	var filter *httpfilter.HTTPFilter
 	if spec.Filter != nil {
@@ -109,6 +124,11 @@ func newPool(super *supervisor.Supervisor, spec *PoolSpec, tagPrefix string,
 		memoryCache = memorycache.New(spec.MemoryCache)
 	}
 
+	var client *http.Client
+	if spec.ProxyProtocol != "" {
+		client = newProxyProtocolClient(spec.ProxyProtocol, tlsConfig)
+	}
+
 	return &pool{
 		spec: spec,
 
@@ -116,18 +136,27 @@ func newPool(super *supervisor.Supervisor, spec *PoolSpec, tagPrefix string,
 		writeResponse: writeResponse,
 
 		filter:      filter,
-		servers:     newServers(super, spec),
+		servers:     newServers(super, spec, tlsConfig),
 		httpStat:    httpstat.New(),
+		metrics:     metrics,
 		memoryCache: memoryCache,
+		client:      client,
 	}
 }
 
 func (p *pool) status() *PoolStatus {
-	s := &PoolStatus{Stat: p.httpStat.Status()}
+	s := &PoolStatus{
+		Stat:    p.httpStat.Status(),
+		Servers: p.servers.status(),
+	}
 	return s
 }
 
 func (p *pool) handle(ctx context.HTTPContext, reqBody io.Reader, client *http.Client) string {
+	if p.client != nil {
+		client = p.client
+	}
+
 	addTag := func(subPrefix, msg string) {
 		tag := stringtool.Cat(p.tagPrefix, "#", subPrefix, ": ", msg)
 		ctx.Lock()
@@ -149,6 +178,15 @@ func (p *pool) handle(ctx context.HTTPContext, reqBody io.Reader, client *http.C
 	}
 	addTag("addr", server.URL)
 
+	if p.writeResponse {
+		ctx.Lock()
+		ctx.SetUpstreamAddr(server.URL)
+		if p.spec.LoadBalance.StickySession != nil {
+			p.spec.LoadBalance.StickySession.setCookie(ctx, server)
+		}
+		ctx.Unlock()
+	}
+
 	req, err := p.prepareRequest(ctx, server, reqBody)
 	if err != nil {
 		msg := stringtool.Cat("prepare request failed: ", err.Error())
@@ -158,8 +196,12 @@ func (p *pool) handle(ctx context.HTTPContext, reqBody io.Reader, client *http.C
 		return resultInternalError
 	}
 
+	server.beginRequest()
 	resp, span, err := p.doRequest(ctx, req, client)
+	server.observeLatency(fasttime.Since(req.startTime()))
 	if err != nil {
+		server.endRequest()
+
 		// NOTE: May add option to cancel the tracing if failed here.
 		// ctx.Span().Cancel()
 
@@ -171,11 +213,20 @@ func (p *pool) handle(ctx context.HTTPContext, reqBody io.Reader, client *http.C
 			return resultClientError
 		}
 
+		p.servers.recordResult(server, err)
+		p.metrics.statError(server.URL)
 		setStatusCode(http.StatusServiceUnavailable)
 		return resultServerError
 	}
 
 	addTag("code", strconv.Itoa(resp.StatusCode))
+	ctx.OnFinish(server.endRequest)
+
+	if resp.StatusCode >= 500 {
+		p.servers.recordResult(server, fmt.Errorf("status code %d", resp.StatusCode))
+	} else {
+		p.servers.recordResult(server, nil)
+	}
 
 	ctx.Lock()
 	defer ctx.Unlock()
@@ -231,14 +282,19 @@ func (p *pool) statRequestResponse(ctx context.HTTPContext,
 	var count int
 
 	callbackBody := callbackreader.New(resp.Body)
-	callbackBody.OnAfter(func(num int, p []byte, n int, err error) ([]byte, int, error) {
+	callbackBody.OnAfter(func(num int, buff []byte, n int, err error) ([]byte, int, error) {
 		count += n
 		if err == io.EOF {
 			req.finish()
 			span.Finish()
+
+			// NOTE: Trailers are only available after reading body to EOF.
+			if p.writeResponse {
+				ctx.Response().Trailer().AddFromStd(resp.Trailer)
+			}
 		}
 
-		return p, n, err
+		return buff, n, err
 	})
 
 	ctx.OnFinish(func() {
@@ -259,6 +315,7 @@ func (p *pool) statRequestResponse(ctx context.HTTPContext,
 			metric.RespSize = 0
 		}
 		p.httpStat.Stat(metric)
+		p.metrics.stat(req.server.URL, metric)
 	})
 
 	return callbackBody
@@ -31,6 +31,8 @@ import (
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
 	"github.com/megaease/easegress/pkg/util/fallback"
+	"github.com/megaease/easegress/pkg/util/grpcstatus"
+	"github.com/megaease/easegress/pkg/util/prometheushelper"
 )
 
 const (
@@ -73,6 +75,9 @@ type (
 		client *http.Client
 
 		compression *compression
+
+		// series is shared by all generations of the Proxy.
+		series *prometheushelper.Series
 	}
 
 	// Spec describes the Proxy.
@@ -82,6 +87,8 @@ type (
 		CandidatePools      []*PoolSpec      `yaml:"candidatePools,omitempty" jsonschema:"omitempty"`
 		MirrorPool          *PoolSpec        `yaml:"mirrorPool,omitempty" jsonschema:"omitempty"`
 		FailureCodes        []int            `yaml:"failureCodes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
+		FailureGRPCCodes    []int            `yaml:"failureGRPCCodes" jsonschema:"omitempty,uniqueItems=true"`
+		H2C                 bool             `yaml:"h2c" jsonschema:"omitempty"`
 		Compression         *CompressionSpec `yaml:"compression,omitempty" jsonschema:"omitempty"`
 		MTLS                *MTLS            `yaml:"mtls,omitempty" jsonschema:"omitempty"`
 		MaxIdleConns        int              `yaml:"maxIdleConns" jsonschema:"omitempty"`
@@ -137,9 +144,13 @@ func (s Spec) Validate() error {
 		}
 	}
 
-	if len(s.FailureCodes) == 0 {
+	if err := grpcstatus.ValidateCodes(s.FailureGRPCCodes); err != nil {
+		return err
+	}
+
+	if len(s.FailureCodes) == 0 && len(s.FailureGRPCCodes) == 0 {
 		if s.Fallback != nil {
-			return fmt.Errorf("fallback needs failureCodes")
+			return fmt.Errorf("fallback needs failureCodes or failureGRPCCodes")
 		}
 	}
 
@@ -172,13 +183,27 @@ func (b *Proxy) Results() []string {
 // Init initializes Proxy.
 func (b *Proxy) Init(filterSpec *httppipeline.FilterSpec) {
 	b.filterSpec, b.spec = filterSpec, filterSpec.FilterSpec().(*Spec)
+	b.series = prometheushelper.NewSeries()
 	b.reload()
 }
 
 // Inherit inherits previous generation of Proxy.
 func (b *Proxy) Inherit(filterSpec *httppipeline.FilterSpec, previousGeneration httppipeline.Filter) {
-	previousGeneration.Close()
-	b.Init(filterSpec)
+	prev := previousGeneration.(*Proxy)
+	prev.closePools()
+
+	b.filterSpec, b.spec = filterSpec, filterSpec.FilterSpec().(*Spec)
+	b.series = prev.series
+	b.reload()
+
+	// NOTE: Metrics of the pools which still exist are kept.
+	pools := map[string]bool{}
+	for _, p := range b.pools() {
+		pools[p.metrics.pool] = true
+	}
+	b.series.Delete(func(lvs []string) bool {
+		return !pools[lvs[poolLabelIndex]]
+	})
 }
 
 func (b *Proxy) needmTLS() bool {
@@ -212,11 +237,30 @@ func (b *Proxy) tlsConfig() *tls.Config {
 	}
 }
 
+func (b *Proxy) newPoolMetrics(pool string) *poolMetrics {
+	return &poolMetrics{
+		pipeline: b.filterSpec.Pipeline(),
+		filter:   b.filterSpec.Name(),
+		pool:     pool,
+		series:   b.series,
+	}
+}
+
+// pools returns all pools of the Proxy.
+func (b *Proxy) pools() []*pool {
+	pools := append([]*pool{b.mainPool}, b.candidatePools...)
+	if b.mirrorPool != nil {
+		pools = append(pools, b.mirrorPool)
+	}
+	return pools
+}
+
 func (b *Proxy) reload() {
 	super := b.filterSpec.Super()
+	tlsConfig := b.tlsConfig()
 
 	b.mainPool = newPool(super, b.spec.MainPool, "proxy#main",
-		true /*writeResponse*/, b.spec.FailureCodes)
+		true /*writeResponse*/, b.spec.FailureCodes, tlsConfig, b.newPoolMetrics("main"))
 
 	if b.spec.Fallback != nil {
 		b.fallback = fallback.New(&b.spec.Fallback.Spec)
@@ -227,39 +271,41 @@ func (b *Proxy) reload() {
 		for k := range b.spec.CandidatePools {
 			candidatePools = append(candidatePools,
 				newPool(super, b.spec.CandidatePools[k], fmt.Sprintf("proxy#candidate#%d", k),
-					true, b.spec.FailureCodes))
+					true, b.spec.FailureCodes, tlsConfig, b.newPoolMetrics(fmt.Sprintf("candidate#%d", k))))
 		}
 		b.candidatePools = candidatePools
 	}
 	if b.spec.MirrorPool != nil {
 		b.mirrorPool = newPool(super, b.spec.MirrorPool, "proxy#mirror",
-			false /*writeResponse*/, b.spec.FailureCodes)
+			false /*writeResponse*/, b.spec.FailureCodes, tlsConfig, b.newPoolMetrics("mirror"))
 	}
 
 	if b.spec.Compression != nil {
 		b.compression = newCompression(b.spec.Compression)
 	}
 
+	h1 := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 60 * time.Second,
+			DualStack: true,
+		}).DialContext,
+		TLSClientConfig:    tlsConfig,
+		DisableCompression: false,
+		// NOTE: The large number of Idle Connections can
+		// reduce overhead of building connections.
+		MaxIdleConns:          b.spec.MaxIdleConns,
+		MaxIdleConnsPerHost:   b.spec.MaxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
 	b.client = &http.Client{
 		// NOTE: Timeout could be no limit, real client or server could cancel it.
-		Timeout: 0,
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 60 * time.Second,
-				DualStack: true,
-			}).DialContext,
-			TLSClientConfig:    b.tlsConfig(),
-			DisableCompression: false,
-			// NOTE: The large number of Idle Connections can
-			// reduce overhead of building connections.
-			MaxIdleConns:          b.spec.MaxIdleConns,
-			MaxIdleConnsPerHost:   b.spec.MaxIdleConnsPerHost,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-		},
+		Timeout:   0,
+		Transport: newTransport(h1, tlsConfig, b.spec.H2C),
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
 		},
@@ -284,16 +330,13 @@ func (b *Proxy) Status() interface{} {
 
 // Close closes Proxy.
 func (b *Proxy) Close() {
-	b.mainPool.close()
-
-	if b.candidatePools != nil {
-		for _, v := range b.candidatePools {
-			v.close()
-		}
-	}
+	b.closePools()
+	b.series.Delete(nil)
+}
 
-	if b.mirrorPool != nil {
-		b.mirrorPool.close()
+func (b *Proxy) closePools() {
+	for _, p := range b.pools() {
+		p.close()
 	}
 }
 
@@ -305,6 +348,13 @@ func (b *Proxy) fallbackForCodes(ctx context.HTTPContext) bool {
 				return true
 			}
 		}
+
+		// NOTE: Only the status of Trailers-Only responses is visible here,
+		// the status in trailers arrives after the body is flushed.
+		if grpcstatus.InCodes(ctx.Response().Header(), b.spec.FailureGRPCCodes) {
+			b.fallback.Fallback(ctx)
+			return true
+		}
 	}
 	return false
 }
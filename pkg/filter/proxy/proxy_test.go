@@ -25,10 +25,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
 	"github.com/megaease/easegress/pkg/context/contexttest"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
 	"github.com/megaease/easegress/pkg/util/httpfilter"
 	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/httpstat"
 	"github.com/megaease/easegress/pkg/util/memorycache"
 	"github.com/megaease/easegress/pkg/util/yamltool"
 )
@@ -148,6 +151,62 @@ failureCodes: [503, 504]
 	time.Sleep(10 * time.Millisecond)
 }
 
+func TestProxyMetrics(t *testing.T) {
+	newSpec := func(yamlSpec string) *httppipeline.FilterSpec {
+		rawSpec := make(map[string]interface{})
+		yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+		spec, err := httppipeline.NewFilterSpec(rawSpec, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return spec
+	}
+
+	const mainPool = `
+name: metrics-proxy
+kind: Proxy
+mainPool:
+  servers:
+  - url: http://127.0.0.1:9095
+  loadBalance:
+    policy: roundRobin
+`
+	proxy := &Proxy{}
+	proxy.Init(newSpec(mainPool + `
+candidatePools:
+- filter:
+    headers:
+      "X-Test":
+        exact: testheader
+  servers:
+  - url: http://127.0.0.2:9095
+  loadBalance:
+    policy: roundRobin
+`))
+
+	proxy.mainPool.metrics.stat("http://127.0.0.1:9095", &httpstat.Metric{StatusCode: 200})
+	proxy.candidatePools[0].metrics.stat("http://127.0.0.2:9095", &httpstat.Metric{StatusCode: 200})
+	proxy.candidatePools[0].metrics.statError("http://127.0.0.2:9095")
+	if n := testutil.CollectAndCount(requestsTotal); n != 2 {
+		t.Errorf("expected 2 series, got %d", n)
+	}
+
+	// Metrics of the candidate pool are deleted, the main pool's are kept.
+	next := &Proxy{}
+	next.Inherit(newSpec(mainPool), proxy)
+	if n := testutil.CollectAndCount(requestsTotal); n != 1 {
+		t.Errorf("expected 1 series, got %d", n)
+	}
+	if n := testutil.CollectAndCount(requestErrorsTotal); n != 0 {
+		t.Errorf("expected no series, got %d", n)
+	}
+
+	next.Close()
+	if n := testutil.CollectAndCount(requestsTotal) + testutil.CollectAndCount(requestDuration); n != 0 {
+		t.Errorf("expected no series, got %d", n)
+	}
+}
+
 func TestSpecValidate(t *testing.T) {
 	spec := Spec{}
 
@@ -19,6 +19,7 @@ package proxy
 
 import (
 	"bytes"
+	stdcontext "context"
 	"fmt"
 	"io"
 	"net/http"
@@ -60,7 +61,12 @@ func (p *pool) newRequest(ctx context.HTTPContext, server *Server, reqBody io.Re
 		url += "?" + r.Query()
 	}
 
-	newCtx := httpstat.WithHTTPStat(ctx, req.statResult)
+	var newCtx stdcontext.Context = ctx
+	if p.client != nil {
+		// NOTE: The pool's own client sends PROXY protocol headers.
+		newCtx = withClientAddrs(newCtx, r.Std())
+	}
+	newCtx = httpstat.WithHTTPStat(newCtx, req.statResult)
 	stdr, err := http.NewRequestWithContext(newCtx, r.Method(), url, reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("BUG: new request failed: %v", err)
@@ -68,6 +74,9 @@ func (p *pool) newRequest(ctx context.HTTPContext, server *Server, reqBody io.Re
 
 	stdr.Header = r.Header().Std()
 	stdr.Host = r.Host()
+	// NOTE: Trailers of the original request are filled after reading
+	// its body to EOF, sharing it makes them forwarded as well.
+	stdr.Trailer = r.Std().Trailer
 
 	req.std = stdr
 
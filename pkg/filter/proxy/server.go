@@ -18,6 +18,7 @@
 package proxy
 
 import (
+	"crypto/tls"
 	"fmt"
 	"math/rand"
 	"sync"
@@ -43,6 +44,12 @@ const (
 	PolicyIPHash = "ipHash"
 	// PolicyHeaderHash is the policy of header hash.
 	PolicyHeaderHash = "headerHash"
+	// PolicyLeastConnections is the policy of least connections.
+	PolicyLeastConnections = "leastConnections"
+	// PolicyPeakEWMA is the policy of peak EWMA of latency.
+	PolicyPeakEWMA = "peakEWMA"
+	// PolicyConsistentHash is the policy of consistent hash.
+	PolicyConsistentHash = "consistentHash"
 
 	retryTimeout = 3 * time.Second
 )
@@ -55,19 +62,31 @@ type (
 		mutex           sync.Mutex
 		serviceRegistry *serviceregistry.ServiceRegistry
 		serviceWatcher  serviceregistry.ServiceWatcher
-		static          *staticServers
-		done            chan struct{}
+		// static contains available servers picked from all,
+		// it excludes unhealthy and ejected servers.
+		static        *staticServers
+		all           *staticServers
+		healths       map[string]*serverHealth
+		healthChecker *healthChecker
+		done          chan struct{}
 	}
 
 	staticServers struct {
-		count      uint64
-		weightsSum int
-		servers    []*Server
-		lb         LoadBalance
+		count         uint64
+		weightsSum    int
+		servers       []*Server
+		lb            LoadBalance
+		hash          consistentHash
+		stickyServers map[string]*Server
 	}
 
 	// Server is proxy server.
 	Server struct {
+		// NOTE: 64-bit atomic fields must be at the beginning for alignment.
+		activeRequests int64
+		ewma           uint64 // float64 bits of nanoseconds
+		ewmaStamp      int64  // unix nano
+
 		URL    string   `yaml:"url" jsonschema:"required,format=url"`
 		Tags   []string `yaml:"tags" jsonschema:"omitempty,uniqueItems=true"`
 		Weight int      `yaml:"weight" jsonschema:"omitempty,minimum=0,maximum=100"`
@@ -75,8 +94,11 @@ type (
 
 	// LoadBalance is load balance for multiple servers.
 	LoadBalance struct {
-		Policy        string `yaml:"policy" jsonschema:"required,enum=roundRobin,enum=random,enum=weightedRandom,enum=ipHash,enum=headerHash"`
-		HeaderHashKey string `yaml:"headerHashKey" jsonschema:"omitempty"`
+		Policy        string         `yaml:"policy" jsonschema:"required,enum=roundRobin,enum=random,enum=weightedRandom,enum=ipHash,enum=headerHash,enum=leastConnections,enum=peakEWMA,enum=consistentHash"`
+		HeaderHashKey string         `yaml:"headerHashKey" jsonschema:"omitempty"`
+		HashKey       *HashKey       `yaml:"hashKey,omitempty" jsonschema:"omitempty"`
+		HashAlgorithm string         `yaml:"hashAlgorithm" jsonschema:"omitempty,enum=,enum=ring,enum=maglev"`
+		StickySession *StickySession `yaml:"stickySession,omitempty" jsonschema:"omitempty"`
 	}
 )
 
@@ -90,18 +112,28 @@ func (lb LoadBalance) Validate() error {
 		return fmt.Errorf("headerHash needs to specify headerHashKey")
 	}
 
+	if lb.Policy == PolicyConsistentHash && lb.HashKey == nil {
+		return fmt.Errorf("consistentHash needs to specify hashKey")
+	}
+
 	return nil
 }
 
-func newServers(super *supervisor.Supervisor, poolSpec *PoolSpec) *servers {
+func newServers(super *supervisor.Supervisor, poolSpec *PoolSpec, tlsConfig *tls.Config) *servers {
 	s := &servers{
 		poolSpec: poolSpec,
 		super:    super,
+		healths:  make(map[string]*serverHealth),
 		done:     make(chan struct{}),
 	}
 
 	s.useStaticServers()
 
+	if poolSpec.HealthCheck != nil {
+		s.healthChecker = newHealthChecker(poolSpec.HealthCheck, tlsConfig, poolSpec.ProxyProtocol)
+		go s.checkHealth()
+	}
+
 	if poolSpec.ServiceRegistry == "" || poolSpec.ServiceName == "" {
 		return s
 	}
@@ -170,15 +202,165 @@ func (s *servers) useService(serviceInstanceSpecs map[string]*serviceregistry.Se
 
 	logger.Infof("use dynamic service: %s/%s", s.poolSpec.ServiceRegistry, s.poolSpec.ServiceName)
 
+	s.setServers(dynamicServers)
+}
+
+func (s *servers) useStaticServers() {
+	s.setServers(newStaticServers(s.poolSpec.Servers, s.poolSpec.ServersTags, s.poolSpec.LoadBalance))
+}
+
+func (s *servers) setServers(all *staticServers) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	s.static = dynamicServers
+
+	// NOTE: Keep the health of existing servers, new servers are healthy by default.
+	healths := make(map[string]*serverHealth, all.len())
+	for _, server := range all.servers {
+		h := s.healths[server.URL]
+		if h == nil {
+			h = newServerHealth()
+		}
+		healths[server.URL] = h
+	}
+
+	s.all = all
+	s.healths = healths
+	s.rebuild()
 }
 
-func (s *servers) useStaticServers() {
+// rebuild rebuilds available servers, the caller must hold the lock.
+func (s *servers) rebuild() {
+	now := time.Now()
+
+	available := make([]*Server, 0, s.all.len())
+	for _, server := range s.all.servers {
+		if s.healths[server.URL].available(now) {
+			available = append(available, server)
+		}
+	}
+
+	switch len(available) {
+	case s.all.len():
+		s.static = s.all
+	case 0:
+		// NOTE: It's better to try all servers than reject all requests.
+		logger.Warnf("none of servers is available, use all servers: %v", s.all.servers)
+		s.static = s.all
+	default:
+		s.static = newStaticServers(available, nil, &s.all.lb)
+	}
+}
+
+func (s *servers) checkHealth() {
+	ticker := time.NewTicker(s.poolSpec.HealthCheck.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.probe()
+		}
+	}
+}
+
+func (s *servers) probe() {
+	s.mutex.Lock()
+	all := s.all
+	s.mutex.Unlock()
+
+	result := s.healthChecker.probeAll(all.servers)
+
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	s.static = newStaticServers(s.poolSpec.Servers, s.poolSpec.ServersTags, s.poolSpec.LoadBalance)
+
+	changed := false
+	for url, err := range result {
+		h := s.healths[url]
+		if h == nil {
+			// The server has been removed during probing.
+			continue
+		}
+
+		if h.recordProbe(s.poolSpec.HealthCheck, err) {
+			changed = true
+			if h.healthy {
+				logger.Infof("server %s becomes healthy", url)
+			} else {
+				logger.Warnf("server %s becomes unhealthy: %s", url, h.lastError)
+			}
+		}
+	}
+
+	if changed {
+		s.rebuild()
+	}
+}
+
+// recordResult records the result of a request to the server,
+// it ejects the server after consecutive errors.
+func (s *servers) recordResult(server *Server, err error) {
+	spec := s.poolSpec.OutlierDetection
+	if spec == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	h := s.healths[server.URL]
+	if h == nil {
+		return
+	}
+
+	if err == nil {
+		h.errors = 0
+		return
+	}
+
+	h.errors++
+	h.lastError = err.Error()
+
+	now := time.Now()
+	if h.errors < spec.consecutiveErrors() || h.ejected(now) {
+		return
+	}
+
+	ejected := 0
+	for _, h := range s.healths {
+		if h.ejected(now) {
+			ejected++
+		}
+	}
+	if uint32((ejected+1)*100) > spec.maxEjectionPercent()*uint32(len(s.healths)) {
+		return
+	}
+
+	ejectionTime := spec.ejectionTime()
+	h.errors = 0
+	h.ejectedUntil = now.Add(ejectionTime)
+	logger.Warnf("server %s is ejected for %v: %s", server.URL, ejectionTime, h.lastError)
+	s.rebuild()
+
+	time.AfterFunc(ejectionTime, func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.rebuild()
+	})
+}
+
+func (s *servers) status() []*ServerStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	status := make([]*ServerStatus, 0, s.all.len())
+	for _, server := range s.all.servers {
+		status = append(status, s.healths[server.URL].status(server.URL, now))
+	}
+
+	return status
 }
 
 func (s *servers) snapshot() *staticServers {
@@ -210,6 +392,10 @@ func (s *servers) close() {
 	if s.serviceWatcher != nil {
 		s.serviceWatcher.Stop()
 	}
+
+	if s.healthChecker != nil {
+		s.healthChecker.close()
+	}
 }
 
 func newStaticServers(servers []*Server, tags []string, lb *LoadBalance) *staticServers {
@@ -249,6 +435,9 @@ func (ss *staticServers) prepare() {
 	for _, server := range ss.servers {
 		ss.weightsSum += server.Weight
 	}
+
+	ss.prepareConsistentHash()
+	ss.prepareStickySession()
 }
 
 func (ss *staticServers) len() int {
@@ -256,6 +445,12 @@ func (ss *staticServers) len() int {
 }
 
 func (ss *staticServers) next(ctx context.HTTPContext) *Server {
+	if ss.lb.StickySession != nil {
+		if server := ss.stickyServer(ctx); server != nil {
+			return server
+		}
+	}
+
 	switch ss.lb.Policy {
 	case PolicyRoundRobin:
 		return ss.roundRobin(ctx)
@@ -267,6 +462,12 @@ func (ss *staticServers) next(ctx context.HTTPContext) *Server {
 		return ss.ipHash(ctx)
 	case PolicyHeaderHash:
 		return ss.headerHash(ctx)
+	case PolicyLeastConnections:
+		return ss.leastConnections(ctx)
+	case PolicyPeakEWMA:
+		return ss.peakEWMA(ctx)
+	case PolicyConsistentHash:
+		return ss.consistentHash(ctx)
 	}
 
 	logger.Errorf("BUG: unknown load balance policy: %s", ss.lb.Policy)
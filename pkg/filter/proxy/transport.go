@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/megaease/easegress/pkg/util/grpcstatus"
+	"github.com/megaease/easegress/pkg/util/proxyprotocol"
+)
+
+type (
+	// transport dispatches requests to HTTP/1.1 or HTTP/2 transports.
+	// gRPC requests always go through HTTP/2, which is h2c for http
+	// servers and h2 for https servers.
+	transport struct {
+		h1  *http.Transport
+		h2  *http2.Transport
+		h2c *http2.Transport
+
+		// forceH2C makes all requests to http servers use h2c.
+		forceH2C bool
+	}
+
+	clientAddrsKey struct{}
+
+	// clientAddrs are the addresses of the client connection,
+	// which are sent to servers in PROXY protocol headers.
+	clientAddrs struct {
+		src net.Addr
+		dst net.Addr
+	}
+)
+
+func newTransport(h1 *http.Transport, tlsConfig *tls.Config, forceH2C bool) *transport {
+	h2TLSConfig := tlsConfig.Clone()
+	h2TLSConfig.NextProtos = []string{http2.NextProtoTLS}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 60 * time.Second,
+	}
+
+	return &transport{
+		h1: h1,
+		h2: &http2.Transport{
+			TLSClientConfig: h2TLSConfig,
+		},
+		h2c: &http2.Transport{
+			// NOTE: AllowHTTP with a plain dialer is the way to do h2c.
+			// Reference: https://github.com/golang/go/issues/14141
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return dialer.Dial(network, addr)
+			},
+		},
+		forceH2C: forceH2C,
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	isGRPC := grpcstatus.IsGRPCStd(req.Header)
+
+	switch req.URL.Scheme {
+	case "http":
+		if isGRPC || t.forceH2C {
+			return t.h2c.RoundTrip(req)
+		}
+	case "https":
+		if isGRPC {
+			return t.h2.RoundTrip(req)
+		}
+	}
+
+	return t.h1.RoundTrip(req)
+}
+
+// CloseIdleConnections implements the optional interface
+// which is used by http.Client.CloseIdleConnections.
+func (t *transport) CloseIdleConnections() {
+	t.h1.CloseIdleConnections()
+	t.h2.CloseIdleConnections()
+	t.h2c.CloseIdleConnections()
+}
+
+// withClientAddrs returns the context carrying the addresses of the client
+// connection of the request, the remote address reflects the PROXY protocol
+// header of the client connection if any.
+func withClientAddrs(ctx context.Context, req *http.Request) context.Context {
+	addrs := &clientAddrs{}
+	if addr, err := net.ResolveTCPAddr("tcp", req.RemoteAddr); err == nil {
+		addrs.src = addr
+	}
+	if addr, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		addrs.dst = addr
+	}
+	return context.WithValue(ctx, clientAddrsKey{}, addrs)
+}
+
+// newProxyProtocolClient creates the client sending PROXY protocol headers
+// once connected to servers. Since a header describes a single client
+// connection, the connections to servers are never reused, and all
+// requests go through HTTP/1.1.
+func newProxyProtocolClient(version string, tlsConfig *tls.Config) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 60 * time.Second,
+	}
+
+	dialContext := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		var src, dst net.Addr
+		if addrs, ok := ctx.Value(clientAddrsKey{}).(*clientAddrs); ok {
+			src, dst = addrs.src, addrs.dst
+		}
+		if err := proxyprotocol.WriteHeader(conn, version, src, dst); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return conn, nil
+	}
+
+	return &http.Client{
+		Timeout: 0,
+		Transport: &http.Transport{
+			DialContext:           dialContext,
+			TLSClientConfig:       tlsConfig,
+			DisableKeepAlives:     true,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/megaease/easegress/pkg/util/grpcstatus"
+	"github.com/megaease/easegress/pkg/util/proxyprotocol"
+)
+
+func newH2CTestServer() *httptest.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		w.Header().Set("X-Proto", r.Proto)
+		w.WriteHeader(http.StatusOK)
+		io.Copy(w, r.Body)
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	})
+
+	return httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+}
+
+func TestTransport(t *testing.T) {
+	server := newH2CTestServer()
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: newTransport(&http.Transport{}, &tls.Config{}, false),
+	}
+
+	// gRPC request goes through h2c.
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/pkg.Service/Method", strings.NewReader("grpc"))
+	req.Header.Set("Content-Type", grpcstatus.ContentType)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("do request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.Header.Get("X-Proto") != "HTTP/2.0" {
+		t.Errorf("grpc request should use HTTP/2, got %s", resp.Header.Get("X-Proto"))
+	}
+	if string(body) != "grpc" {
+		t.Errorf("want body grpc, got %s", body)
+	}
+	if resp.Trailer.Get("Grpc-Status") != "0" {
+		t.Errorf("trailer grpc-status is not received: %v", resp.Trailer)
+	}
+
+	// Normal request goes through HTTP/1.1.
+	resp, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("do request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("X-Proto") != "HTTP/1.1" {
+		t.Errorf("normal request should use HTTP/1.1, got %s", resp.Header.Get("X-Proto"))
+	}
+
+	// All requests go through h2c if it's forced.
+	client.Transport = newTransport(&http.Transport{}, &tls.Config{}, true)
+	resp, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("do request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("X-Proto") != "HTTP/2.0" {
+		t.Errorf("request should use HTTP/2 when h2c is forced, got %s", resp.Header.Get("X-Proto"))
+	}
+}
+
+func TestProxyProtocolClient(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	l = proxyprotocol.NewListener(l, &proxyprotocol.Spec{TrustedCIDRs: []string{"127.0.0.1"}})
+	server := &httptest.Server{
+		Listener: l,
+		Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, r.RemoteAddr)
+		})},
+	}
+	server.Start()
+	defer server.Close()
+
+	client := newProxyProtocolClient(proxyprotocol.Version2, &tls.Config{})
+
+	for _, remoteAddr := range []string{"203.0.113.7:5000", "203.0.113.8:6000"} {
+		clientReq := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		clientReq.RemoteAddr = remoteAddr
+		ctx := stdcontext.WithValue(clientReq.Context(), http.LocalAddrContextKey,
+			&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 80})
+		clientReq = clientReq.WithContext(ctx)
+
+		req, _ := http.NewRequestWithContext(withClientAddrs(stdcontext.Background(), clientReq),
+			http.MethodGet, server.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("do request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if string(body) != remoteAddr {
+			t.Errorf("want remote address %s, got %s", remoteAddr, body)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimiter
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	librl "github.com/megaease/easegress/pkg/util/ratelimiter"
+)
+
+// for unit testing cases to mock 'time.Now' only
+var nowFunc = time.Now
+
+type (
+	// clusterLimiter limits requests across all members of the cluster.
+	//
+	// Time is divided into fixed windows of the refresh period, every member
+	// counts requests of the current window locally, publishes its counters
+	// to the cluster and pulls counters of other members periodically. A
+	// request is permitted if the sum of counters is less than the limit.
+	//
+	// Before the first sync of a window, a member knows nothing about the
+	// others, so it only permits its share of the limit, which is the limit
+	// divided by the number of members found in the last sync.
+	//
+	// To bound the size of the counters in the cluster, a member publishes
+	// at most maxKeys keys with the largest counters, the others are counted
+	// as the largest counter among them, which is never less than the real
+	// one, so the limit still holds for them, but may be a bit too strict.
+	//
+	// It is an approximate algorithm: counters of other members are at most
+	// one sync interval late, so the cluster may permit a bit more requests
+	// than the limit. The clocks of members are supposed to be synchronized.
+	clusterLimiter struct {
+		cls          cluster.Cluster
+		prefix       string
+		key          string
+		limit        int
+		maxKeys      int
+		period       time.Duration
+		syncInterval time.Duration
+
+		mutex  sync.Mutex
+		window int64
+		local  map[string]int
+		dirty  bool
+		synced bool
+
+		// The counter of a key of other members is remoteOthers plus
+		// remote[key], see remoteCount.
+		remote       map[string]int
+		remoteOthers int
+
+		// members is the number of members found in the last sync,
+		// index is the position of this member among them.
+		members int
+		index   int
+
+		done chan struct{}
+	}
+
+	// clusterCounters is the counters of a member stored in the cluster.
+	clusterCounters struct {
+		Window   int64          `json:"window"`
+		Counters map[string]int `json:"counters"`
+		// Others is the largest counter of the keys not in Counters.
+		Others int `json:"others,omitempty"`
+	}
+)
+
+// clusterID returns the identity of the URL rule in the cluster.
+func clusterID(u *URLRule) string {
+	return url.PathEscape(strings.Join(u.Methods, ",") + ":" + u.ID())
+}
+
+func newClusterLimiter(cls cluster.Cluster, prefix, key string, limit, maxKeys int,
+	period, syncInterval time.Duration) *clusterLimiter {
+	cl := &clusterLimiter{
+		cls:          cls,
+		prefix:       prefix,
+		key:          key,
+		limit:        limit,
+		maxKeys:      maxKeys,
+		period:       period,
+		syncInterval: syncInterval,
+		local:        map[string]int{},
+		remote:       map[string]int{},
+		members:      1,
+		done:         make(chan struct{}),
+	}
+
+	// NOTE: Publish the counters at once, so that the other members
+	// count this one in when sharing the limit.
+	cl.window, cl.dirty = cl.currentWindow(nowFunc()), true
+	cl.sync()
+	go cl.run()
+
+	return cl
+}
+
+func (cl *clusterLimiter) currentWindow(now time.Time) int64 {
+	return now.UnixNano() / int64(cl.period)
+}
+
+// rotate resets counters if the window has passed, the caller must hold the lock.
+func (cl *clusterLimiter) rotate(window int64) {
+	if cl.window == window {
+		return
+	}
+
+	cl.window = window
+	cl.local = map[string]int{}
+	cl.remote = map[string]int{}
+	cl.remoteOthers = 0
+	cl.dirty = false
+	cl.synced = false
+}
+
+// share returns the share of the limit of this member, the remainder is
+// given to the members in the front, so that the shares sum up to the limit.
+func (cl *clusterLimiter) share() int {
+	share := cl.limit / cl.members
+	if cl.index < cl.limit%cl.members {
+		share++
+	}
+	return share
+}
+
+// acquirePermission returns whether the request with the key is permitted,
+// and the quota of the key in current window.
+func (cl *clusterLimiter) acquirePermission(key string) (bool, librl.Quota) {
+	now := nowFunc()
+	window := cl.currentWindow(now)
+
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	cl.rotate(window)
+
+	quota := librl.Quota{
+		Limit: cl.limit,
+		Reset: time.Unix(0, (window+1)*int64(cl.period)).Sub(now),
+	}
+
+	used := cl.local[key] + cl.remoteCount(key)
+	if used >= cl.limit {
+		return false, quota
+	}
+	if !cl.synced && cl.local[key] >= cl.share() {
+		return false, quota
+	}
+
+	cl.local[key]++
+	cl.dirty = true
+	quota.Remaining = cl.limit - used - 1
+
+	return true, quota
+}
+
+// remoteCount returns the counter of the key of other members,
+// the caller must hold the lock.
+func (cl *clusterLimiter) remoteCount(key string) int {
+	return cl.remoteOthers + cl.remote[key]
+}
+
+// localCounters returns the counters to publish, the caller must hold the lock.
+func (cl *clusterLimiter) localCounters(window int64) *clusterCounters {
+	if len(cl.local) <= cl.maxKeys {
+		return &clusterCounters{Window: window, Counters: cl.local}
+	}
+
+	keys := make([]string, 0, len(cl.local))
+	for key := range cl.local {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return cl.local[keys[i]] > cl.local[keys[j]]
+	})
+
+	counters := make(map[string]int, cl.maxKeys)
+	for _, key := range keys[:cl.maxKeys] {
+		counters[key] = cl.local[key]
+	}
+
+	return &clusterCounters{
+		Window:   window,
+		Counters: counters,
+		Others:   cl.local[keys[cl.maxKeys]],
+	}
+}
+
+func (cl *clusterLimiter) run() {
+	ticker := time.NewTicker(cl.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cl.done:
+			return
+		case <-ticker.C:
+			cl.sync()
+		}
+	}
+}
+
+func (cl *clusterLimiter) sync() {
+	window := cl.currentWindow(nowFunc())
+
+	cl.mutex.Lock()
+	cl.rotate(window)
+	var data []byte
+	if cl.dirty {
+		data, _ = json.Marshal(cl.localCounters(window))
+		cl.dirty = false
+	}
+	cl.mutex.Unlock()
+
+	if data != nil {
+		err := cl.cls.PutUnderLease(cl.key, string(data))
+		if err != nil {
+			logger.Errorf("put rate limiter counters to %s failed: %v", cl.key, err)
+		}
+	}
+
+	kvs, err := cl.cls.GetPrefix(cl.prefix)
+	if err != nil {
+		logger.Errorf("get rate limiter counters from %s failed: %v", cl.prefix, err)
+		return
+	}
+
+	members, index := 1, 0
+	remote, remoteOthers := map[string]int{}, 0
+	for k, v := range kvs {
+		if k == cl.key {
+			continue
+		}
+
+		members++
+		if k < cl.key {
+			index++
+		}
+
+		counters := &clusterCounters{}
+		if err := json.Unmarshal([]byte(v), counters); err != nil {
+			logger.Errorf("unmarshal rate limiter counters of %s failed: %v", k, err)
+			continue
+		}
+		if counters.Window != window {
+			continue
+		}
+
+		// NOTE: The published counters are never less than the others.
+		remoteOthers += counters.Others
+		for key, count := range counters.Counters {
+			remote[key] += count - counters.Others
+		}
+	}
+
+	cl.mutex.Lock()
+	cl.members, cl.index = members, index
+	if cl.window == window {
+		cl.remote, cl.remoteOthers = remote, remoteOthers
+		cl.synced = true
+	}
+	cl.mutex.Unlock()
+}
+
+func (cl *clusterLimiter) close() {
+	close(cl.done)
+
+	err := cl.cls.Delete(cl.key)
+	if err != nil {
+		logger.Errorf("delete rate limiter counters %s failed: %v", cl.key, err)
+	}
+}
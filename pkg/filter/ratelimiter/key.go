@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimiter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filter/validator"
+)
+
+const (
+	// KeySourceIP uses the real IP of the client as the key.
+	KeySourceIP = "ip"
+	// KeySourceHeader uses a header value as the key.
+	KeySourceHeader = "header"
+	// KeySourceJWTClaim uses a claim of the JWT bearer token as the key.
+	KeySourceJWTClaim = "jwtClaim"
+	// KeySourceConsumer uses the authenticated consumer as the key.
+	KeySourceConsumer = "consumer"
+	// KeySourceAPIKey uses the API key in a header or query parameter as the key.
+	KeySourceAPIKey = "apiKey"
+
+	// consumerHeader is set by the Validator filter after authentication.
+	consumerHeader = "X-Authenticated-Userid"
+	// defaultAPIKeyName is the default header name of API key.
+	defaultAPIKeyName = "X-Api-Key"
+)
+
+type (
+	// KeySpec describes where to get the key which requests are limited by,
+	// requests with different keys are limited separately.
+	KeySpec struct {
+		Source string `yaml:"source" jsonschema:"required,enum=ip,enum=header,enum=jwtClaim,enum=consumer,enum=apiKey"`
+		Name   string `yaml:"name" jsonschema:"omitempty"`
+
+		// JWT verifies the token before getting the claim if it is configured.
+		JWT *validator.JWTValidatorSpec `yaml:"jwt" jsonschema:"omitempty"`
+
+		jwtValidator *validator.JWTValidator
+	}
+)
+
+// Validate validates KeySpec.
+func (ks KeySpec) Validate() error {
+	switch ks.Source {
+	case KeySourceHeader, KeySourceJWTClaim:
+		if ks.Name == "" {
+			return fmt.Errorf("key from %s needs name", ks.Source)
+		}
+	}
+
+	if ks.JWT != nil && ks.Source != KeySourceJWTClaim {
+		return fmt.Errorf("jwt is only supported by key from %s", KeySourceJWTClaim)
+	}
+
+	return nil
+}
+
+func (ks *KeySpec) init() {
+	if ks.JWT != nil {
+		ks.jwtValidator = validator.NewJWTValidator(ks.JWT)
+	}
+}
+
+// value returns the key of the request, requests without
+// the key share the bucket of the empty key.
+func (ks *KeySpec) value(ctx context.HTTPContext) string {
+	r := ctx.Request()
+
+	switch ks.Source {
+	case KeySourceHeader:
+		return r.Header().Get(ks.Name)
+	case KeySourceJWTClaim:
+		if ks.jwtValidator == nil {
+			return jwtClaim(r.Header().Get("Authorization"), ks.Name)
+		}
+		claims, err := ks.jwtValidator.Claims(r)
+		if err != nil {
+			return ""
+		}
+		return claimValue(claims, ks.Name)
+	case KeySourceConsumer:
+		return r.Header().Get(consumerHeader)
+	case KeySourceAPIKey:
+		name := ks.Name
+		if name == "" {
+			name = defaultAPIKeyName
+		}
+		if v := r.Header().Get(name); v != "" {
+			return v
+		}
+		return r.Std().URL.Query().Get(name)
+	default:
+		return r.RealIP()
+	}
+}
+
+// jwtClaim gets the claim from the bearer token without verifying it,
+// the token should have been verified by the Validator filter in front
+// if the key doesn't verify it.
+func jwtClaim(authHdr, claim string) string {
+	const prefix = "Bearer "
+	if !strings.HasPrefix(authHdr, prefix) {
+		return ""
+	}
+
+	claims := jwt.MapClaims{}
+	_, _, err := (&jwt.Parser{}).ParseUnverified(authHdr[len(prefix):], claims)
+	if err != nil {
+		return ""
+	}
+
+	return claimValue(claims, claim)
+}
+
+func claimValue(claims jwt.MapClaims, claim string) string {
+	v, ok := claims[claim]
+	if !ok || v == nil {
+		return ""
+	}
+
+	return fmt.Sprint(v)
+}
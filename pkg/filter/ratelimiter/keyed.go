@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimiter
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	librl "github.com/megaease/easegress/pkg/util/ratelimiter"
+)
+
+type (
+	// keyedLimiter holds a rate limiter for every key in a LRU list,
+	// the least recently used limiter is evicted when there are too
+	// many keys, and limiters idle for a while are evicted too.
+	keyedLimiter struct {
+		policy      *librl.Policy
+		maxKeys     int
+		idleTimeout time.Duration
+
+		mutex    sync.Mutex
+		lru      *list.List
+		limiters map[string]*list.Element
+	}
+
+	keyedEntry struct {
+		key        string
+		rl         *librl.RateLimiter
+		lastAccess time.Time
+	}
+)
+
+func newKeyedLimiter(policy *librl.Policy, maxKeys int, idleTimeout time.Duration) *keyedLimiter {
+	return &keyedLimiter{
+		policy:      policy,
+		maxKeys:     maxKeys,
+		idleTimeout: idleTimeout,
+		lru:         list.New(),
+		limiters:    map[string]*list.Element{},
+	}
+}
+
+// get returns the rate limiter of the key, it creates one if not exists.
+func (kl *keyedLimiter) get(key string) *librl.RateLimiter {
+	now := nowFunc()
+
+	kl.mutex.Lock()
+	defer kl.mutex.Unlock()
+
+	kl.evictIdle(now)
+
+	if e, ok := kl.limiters[key]; ok {
+		entry := e.Value.(*keyedEntry)
+		entry.lastAccess = now
+		kl.lru.MoveToFront(e)
+		return entry.rl
+	}
+
+	entry := &keyedEntry{
+		key:        key,
+		rl:         librl.New(kl.policy),
+		lastAccess: now,
+	}
+	kl.limiters[key] = kl.lru.PushFront(entry)
+
+	if kl.lru.Len() > kl.maxKeys {
+		kl.remove(kl.lru.Back())
+	}
+
+	return entry.rl
+}
+
+// evictIdle evicts idle limiters from the back of the list,
+// the caller must hold the lock.
+func (kl *keyedLimiter) evictIdle(now time.Time) {
+	for e := kl.lru.Back(); e != nil; e = kl.lru.Back() {
+		if now.Sub(e.Value.(*keyedEntry).lastAccess) < kl.idleTimeout {
+			return
+		}
+		kl.remove(e)
+	}
+}
+
+func (kl *keyedLimiter) remove(e *list.Element) {
+	kl.lru.Remove(e)
+	delete(kl.limiters, e.Value.(*keyedEntry).key)
+}
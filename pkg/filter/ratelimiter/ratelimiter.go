@@ -19,13 +19,17 @@ package ratelimiter
 
 import (
 	"fmt"
+	"math"
 	"net/http"
 	"reflect"
+	"strconv"
 	"time"
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/prometheushelper"
 	librl "github.com/megaease/easegress/pkg/util/ratelimiter"
 	"github.com/megaease/easegress/pkg/util/urlrule"
 )
@@ -34,10 +38,30 @@ const (
 	// Kind is the kind of RateLimiter.
 	Kind              = "RateLimiter"
 	resultRateLimited = "rateLimited"
+
+	// ScopeLocal limits requests in every member separately.
+	ScopeLocal = "local"
+	// ScopeCluster limits requests across all members of the cluster.
+	ScopeCluster = "cluster"
+
+	defaultLimitForPeriod            = 50
+	defaultTimeoutDuration           = 100 * time.Millisecond
+	defaultLimitRefreshPeriod        = 10 * time.Millisecond
+	defaultClusterLimitRefreshPeriod = time.Second
+	defaultClusterSyncInterval       = 500 * time.Millisecond
+	defaultMaxKeys                   = 10000
+	defaultKeyIdleTimeout            = 10 * time.Minute
 )
 
 var results = []string{resultRateLimited}
 
+var rateLimitedTotal = prometheushelper.NewCounter("ratelimiter", "rate_limited_total",
+	"The total number of requests rejected by the rate limiter.",
+	[]string{"pipeline", "filter", "policy"})
+
+// policyLabelIndex is the index of the policy label of the metrics.
+const policyLabelIndex = 2
+
 func init() {
 	httppipeline.Register(&RateLimiter{})
 }
@@ -49,6 +73,18 @@ type (
 		TimeoutDuration    string `yaml:"timeoutDuration" jsonschema:"omitempty,format=duration"`
 		LimitRefreshPeriod string `yaml:"limitRefreshPeriod" jsonschema:"omitempty,format=duration"`
 		LimitForPeriod     int    `yaml:"limitForPeriod" jsonschema:"omitempty,minimum=1"`
+
+		// Scope is local or cluster, in cluster scope, the limit holds
+		// across all members and requests are rejected immediately
+		// instead of waiting for the timeout duration.
+		Scope        string   `yaml:"scope,omitempty" jsonschema:"omitempty,enum=local,enum=cluster"`
+		SyncInterval string   `yaml:"syncInterval,omitempty" jsonschema:"omitempty,format=duration"`
+		Key          *KeySpec `yaml:"key" jsonschema:"omitempty"`
+
+		// MaxKeys and KeyIdleTimeout bound the limiters of keys in local scope,
+		// MaxKeys also bounds the counters published to the cluster in cluster scope.
+		MaxKeys        int    `yaml:"maxKeys,omitempty" jsonschema:"omitempty,minimum=1"`
+		KeyIdleTimeout string `yaml:"keyIdleTimeout,omitempty" jsonschema:"omitempty,format=duration"`
 	}
 
 	// URLRule defines the rate limiter rule for a URL pattern
@@ -56,6 +92,8 @@ type (
 		urlrule.URLRule `yaml:",inline"`
 		policy          *Policy
 		rl              *librl.RateLimiter
+		krl             *keyedLimiter
+		crl             *clusterLimiter
 	}
 
 	// Spec is the configuration of a rate limiter
@@ -69,9 +107,78 @@ type (
 	RateLimiter struct {
 		filterSpec *httppipeline.FilterSpec
 		spec       *Spec
+
+		// series is shared by all generations of the RateLimiter.
+		series *prometheushelper.Series
 	}
 )
 
+// Validate implements custom validation for Policy
+func (p Policy) Validate() error {
+	if p.Key == nil && (p.MaxKeys != 0 || p.KeyIdleTimeout != "") {
+		return fmt.Errorf("policy '%s': maxKeys and keyIdleTimeout need key", p.Name)
+	}
+
+	if p.Scope != ScopeCluster {
+		if p.SyncInterval != "" {
+			return fmt.Errorf("policy '%s': syncInterval is only supported in cluster scope", p.Name)
+		}
+		return nil
+	}
+
+	if p.limitRefreshPeriod() < p.syncInterval() {
+		return fmt.Errorf("policy '%s': limitRefreshPeriod must not be less than syncInterval", p.Name)
+	}
+
+	return nil
+}
+
+func parseDurationOrDefault(d string, defaultValue time.Duration) time.Duration {
+	if d == "" {
+		return defaultValue
+	}
+
+	v, err := time.ParseDuration(d)
+	if err != nil {
+		return defaultValue
+	}
+
+	return v
+}
+
+func (p *Policy) limitForPeriod() int {
+	if p.LimitForPeriod == 0 {
+		return defaultLimitForPeriod
+	}
+	return p.LimitForPeriod
+}
+
+func (p *Policy) timeoutDuration() time.Duration {
+	return parseDurationOrDefault(p.TimeoutDuration, defaultTimeoutDuration)
+}
+
+func (p *Policy) limitRefreshPeriod() time.Duration {
+	if p.Scope == ScopeCluster {
+		return parseDurationOrDefault(p.LimitRefreshPeriod, defaultClusterLimitRefreshPeriod)
+	}
+	return parseDurationOrDefault(p.LimitRefreshPeriod, defaultLimitRefreshPeriod)
+}
+
+func (p *Policy) syncInterval() time.Duration {
+	return parseDurationOrDefault(p.SyncInterval, defaultClusterSyncInterval)
+}
+
+func (p *Policy) maxKeys() int {
+	if p.MaxKeys == 0 {
+		return defaultMaxKeys
+	}
+	return p.MaxKeys
+}
+
+func (p *Policy) keyIdleTimeout() time.Duration {
+	return parseDurationOrDefault(p.KeyIdleTimeout, defaultKeyIdleTimeout)
+}
+
 // Validate implements custom validation for Spec
 func (spec Spec) Validate() error {
 URLLoop:
@@ -95,23 +202,14 @@ URLLoop:
 
 func (url *URLRule) createRateLimiter() {
 	policy := librl.Policy{
-		LimitForPeriod: url.policy.LimitForPeriod,
-	}
-
-	if policy.LimitForPeriod == 0 {
-		policy.LimitForPeriod = 50
-	}
-
-	if d := url.policy.TimeoutDuration; d != "" {
-		policy.TimeoutDuration, _ = time.ParseDuration(d)
-	} else {
-		policy.TimeoutDuration = 100 * time.Millisecond
+		LimitForPeriod:     url.policy.limitForPeriod(),
+		TimeoutDuration:    url.policy.timeoutDuration(),
+		LimitRefreshPeriod: url.policy.limitRefreshPeriod(),
 	}
 
-	if d := url.policy.LimitRefreshPeriod; d != "" {
-		policy.LimitRefreshPeriod, _ = time.ParseDuration(d)
-	} else {
-		policy.LimitRefreshPeriod = 10 * time.Millisecond
+	if url.policy.Key != nil {
+		url.krl = newKeyedLimiter(&policy, url.policy.maxKeys(), url.policy.keyIdleTimeout())
+		return
 	}
 
 	url.rl = librl.New(&policy)
@@ -162,11 +260,31 @@ func (rl *RateLimiter) bindPolicyToURL(u *URLRule) {
 	}
 }
 
+func (rl *RateLimiter) createClusterLimiterForURL(u *URLRule) {
+	cls := rl.filterSpec.Super().Cluster()
+	pipeline, name, id := rl.filterSpec.Pipeline(), rl.filterSpec.Name(), clusterID(u)
+
+	u.crl = newClusterLimiter(cls,
+		cls.Layout().RateLimiterPrefix(pipeline, name, id),
+		cls.Layout().RateLimiterKey(pipeline, name, id),
+		u.policy.limitForPeriod(),
+		u.policy.maxKeys(),
+		u.policy.limitRefreshPeriod(),
+		u.policy.syncInterval(),
+	)
+}
+
 func (rl *RateLimiter) createRateLimiterForURL(u *URLRule) {
 	u.Init()
 	rl.bindPolicyToURL(u)
+	if u.policy.Scope == ScopeCluster {
+		rl.createClusterLimiterForURL(u)
+		return
+	}
 	u.createRateLimiter()
-	rl.setStateListenerForURL(u)
+	if u.rl != nil {
+		rl.setStateListenerForURL(u)
+	}
 }
 
 func isSamePolicy(spec1, spec2 *Spec, policyName string) bool {
@@ -196,6 +314,12 @@ func isSamePolicy(spec1, spec2 *Spec, policyName string) bool {
 }
 
 func (rl *RateLimiter) reload(previousGeneration *RateLimiter) {
+	for _, p := range rl.spec.Policies {
+		if p.Key != nil {
+			p.Key.init()
+		}
+	}
+
 	if previousGeneration == nil {
 		for _, u := range rl.spec.URLs {
 			rl.createRateLimiterForURL(u)
@@ -215,9 +339,11 @@ OuterLoop:
 
 			url.Init()
 			rl.bindPolicyToURL(url)
-			url.rl = prev.rl
-			prev.rl = nil
-			rl.setStateListenerForURL(url)
+			url.rl, url.krl, url.crl = prev.rl, prev.krl, prev.crl
+			prev.rl, prev.krl, prev.crl = nil, nil, nil
+			if url.rl != nil {
+				rl.setStateListenerForURL(url)
+			}
 			continue OuterLoop
 		}
 		rl.createRateLimiterForURL(url)
@@ -227,13 +353,27 @@ OuterLoop:
 // Init initializes RateLimiter.
 func (rl *RateLimiter) Init(filterSpec *httppipeline.FilterSpec) {
 	rl.filterSpec, rl.spec = filterSpec, filterSpec.FilterSpec().(*Spec)
+	rl.series = prometheushelper.NewSeries()
 	rl.reload(nil)
 }
 
 // Inherit inherits previous generation of RateLimiter.
 func (rl *RateLimiter) Inherit(filterSpec *httppipeline.FilterSpec, previousGeneration httppipeline.Filter) {
+	prev := previousGeneration.(*RateLimiter)
+
 	rl.filterSpec, rl.spec = filterSpec, filterSpec.FilterSpec().(*Spec)
-	rl.reload(previousGeneration.(*RateLimiter))
+	rl.series = prev.series
+	rl.reload(prev)
+	prev.closeLimiters()
+
+	// NOTE: Metrics of the policies which are still in use are kept.
+	policies := map[string]bool{}
+	for _, u := range rl.spec.URLs {
+		policies[u.policy.Name] = true
+	}
+	rl.series.Delete(func(lvs []string) bool {
+		return !policies[lvs[policyLabelIndex]]
+	})
 }
 
 // Handle handles HTTP request
@@ -248,13 +388,26 @@ func (rl *RateLimiter) handle(ctx context.HTTPContext) string {
 			continue
 		}
 
-		permitted, d := u.rl.AcquirePermission()
+		key := ""
+		if u.policy.Key != nil {
+			key = u.policy.Key.value(ctx)
+		}
+
+		if u.crl != nil {
+			return rl.handleCluster(ctx, u, key)
+		}
+
+		limiter := u.rl
+		if u.krl != nil {
+			limiter = u.krl.get(key)
+		}
+
+		permitted, d := limiter.AcquirePermission()
+		quota := limiter.Quota()
 		if !permitted {
-			ctx.AddTag("rateLimiter: too many requests")
-			ctx.Response().SetStatusCode(http.StatusTooManyRequests)
-			ctx.Response().Std().Header().Set("X-EG-Rate-Limiter", "too-many-requests")
-			return resultRateLimited
+			return rl.rateLimited(ctx, u, quota)
 		}
+		setQuotaHeaders(ctx, quota)
 
 		if d <= 0 {
 			break
@@ -273,6 +426,41 @@ func (rl *RateLimiter) handle(ctx context.HTTPContext) string {
 	return ""
 }
 
+func (rl *RateLimiter) handleCluster(ctx context.HTTPContext, u *URLRule, key string) string {
+	permitted, quota := u.crl.acquirePermission(key)
+	if !permitted {
+		return rl.rateLimited(ctx, u, quota)
+	}
+
+	setQuotaHeaders(ctx, quota)
+	return ""
+}
+
+// ceilSeconds converts the duration to seconds which is rounded up,
+// so that clients never retry too early.
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+func setQuotaHeaders(ctx context.HTTPContext, quota librl.Quota) {
+	h := ctx.Response().Header()
+	h.Set(httpheader.KeyXRateLimitLimit, strconv.Itoa(quota.Limit))
+	h.Set(httpheader.KeyXRateLimitRemaining, strconv.Itoa(quota.Remaining))
+	h.Set(httpheader.KeyXRateLimitReset, ceilSeconds(quota.Reset))
+}
+
+func (rl *RateLimiter) rateLimited(ctx context.HTTPContext, u *URLRule, quota librl.Quota) string {
+	lvs := []string{rl.filterSpec.Pipeline(), rl.filterSpec.Name(), u.policy.Name}
+	rateLimitedTotal.WithLabelValues(lvs...).Inc()
+	rl.series.Add(rateLimitedTotal.MetricVec, lvs...)
+	ctx.AddTag("rateLimiter: too many requests")
+	ctx.Response().SetStatusCode(http.StatusTooManyRequests)
+	ctx.Response().Std().Header().Set("X-EG-Rate-Limiter", "too-many-requests")
+	setQuotaHeaders(ctx, quota)
+	ctx.Response().Header().Set(httpheader.KeyRetryAfter, ceilSeconds(quota.Reset))
+	return resultRateLimited
+}
+
 // Status returns Status generated by Runtime.
 func (rl *RateLimiter) Status() interface{} {
 	return nil
@@ -280,4 +468,15 @@ func (rl *RateLimiter) Status() interface{} {
 
 // Close closes RateLimiter.
 func (rl *RateLimiter) Close() {
+	rl.closeLimiters()
+	rl.series.Delete(nil)
+}
+
+func (rl *RateLimiter) closeLimiters() {
+	for _, u := range rl.spec.URLs {
+		if u.crl != nil {
+			u.crl.close()
+			u.crl = nil
+		}
+	}
 }
@@ -0,0 +1,410 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimiter
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/filter/validator"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	librl "github.com/megaease/easegress/pkg/util/ratelimiter"
+	"github.com/megaease/easegress/pkg/util/yamltool"
+	"github.com/megaease/easegress/pkg/v"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func TestPolicyValidate(t *testing.T) {
+	p := Policy{Name: "p", MaxKeys: 10}
+	if p.Validate() == nil {
+		t.Errorf("maxKeys without key should be invalid")
+	}
+
+	p = Policy{Name: "p", Key: &KeySpec{Source: KeySourceIP}}
+	if err := p.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	p = Policy{Name: "p", Scope: ScopeCluster, LimitRefreshPeriod: "100ms", SyncInterval: "1s"}
+	if p.Validate() == nil {
+		t.Errorf("refresh period less than sync interval should be invalid")
+	}
+
+	p = Policy{Name: "p", Scope: ScopeCluster, Key: &KeySpec{Source: KeySourceIP}}
+	if err := p.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if p.limitRefreshPeriod() != defaultClusterLimitRefreshPeriod {
+		t.Errorf("unexpected default refresh period of cluster scope: %v", p.limitRefreshPeriod())
+	}
+
+	if (KeySpec{Source: KeySourceHeader}).Validate() == nil {
+		t.Errorf("header key without name should be invalid")
+	}
+	if (KeySpec{Source: KeySourceIP, JWT: &validator.JWTValidatorSpec{}}).Validate() == nil {
+		t.Errorf("jwt of ip key should be invalid")
+	}
+}
+
+func TestLegacySpecValidate(t *testing.T) {
+	const yamlSpec = `
+policies:
+- name: default
+  timeoutDuration: 100ms
+  limitRefreshPeriod: 10ms
+  limitForPeriod: 50
+defaultPolicyRef: default
+urls:
+- methods: [GET]
+  url:
+    prefix: /
+`
+	spec := &Spec{}
+	yamltool.Unmarshal([]byte(yamlSpec), spec)
+
+	if vr := v.Validate(spec); !vr.Valid() {
+		t.Errorf("spec without new fields should be valid: %s", vr)
+	}
+}
+
+func TestKeyValue(t *testing.T) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "alice", "tenant": 42})
+	tokenStr, err := token.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatalf("sign token failed: %v", err)
+	}
+
+	header := httpheader.New(http.Header{})
+	header.Set("Authorization", "Bearer "+tokenStr)
+	header.Set("X-Api-Key", "key-1")
+	header.Set(consumerHeader, "consumer-1")
+
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader { return header }
+	ctx.MockedRequest.MockedRealIP = func() string { return "192.168.1.1" }
+	ctx.MockedRequest.MockedStd = func() *http.Request {
+		req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/?api_key=key-2", nil)
+		return req
+	}
+
+	verified := &KeySpec{Source: KeySourceJWTClaim, Name: "sub", JWT: &validator.JWTValidatorSpec{
+		Algorithm: "HS256",
+		Secret:    hex.EncodeToString([]byte("secret")),
+	}}
+	verified.init()
+	wrongSecret := &KeySpec{Source: KeySourceJWTClaim, Name: "sub", JWT: &validator.JWTValidatorSpec{
+		Algorithm: "HS256",
+		Secret:    hex.EncodeToString([]byte("wrong")),
+	}}
+	wrongSecret.init()
+
+	cases := []struct {
+		key  KeySpec
+		want string
+	}{
+		{KeySpec{Source: KeySourceIP}, "192.168.1.1"},
+		{KeySpec{Source: KeySourceHeader, Name: "X-Api-Key"}, "key-1"},
+		{KeySpec{Source: KeySourceJWTClaim, Name: "tenant"}, "42"},
+		{KeySpec{Source: KeySourceJWTClaim, Name: "role"}, ""},
+		{KeySpec{Source: KeySourceConsumer}, "consumer-1"},
+		{KeySpec{Source: KeySourceAPIKey}, "key-1"},
+		{KeySpec{Source: KeySourceAPIKey, Name: "api_key"}, "key-2"},
+		{*verified, "alice"},
+		{*wrongSecret, ""},
+	}
+
+	for _, c := range cases {
+		if got := c.key.value(ctx); got != c.want {
+			t.Errorf("key from %s(%s): want %q, got %q", c.key.Source, c.key.Name, c.want, got)
+		}
+	}
+}
+
+func TestClusterLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	cls := clustertest.New(nil)
+	prefix := "/ratelimiter/pipeline/limiter/url/"
+	newLimiter := func(member string) *clusterLimiter {
+		// A long sync interval prevents the background syncing.
+		return newClusterLimiter(cls, prefix, prefix+member, 10, defaultMaxKeys, time.Minute, time.Hour)
+	}
+
+	cl1, cl2 := newLimiter("member-1"), newLimiter("member-2")
+	defer cl1.close()
+	defer cl2.close()
+
+	for i := 0; i < 6; i++ {
+		if permitted, _ := cl1.acquirePermission("client-1"); !permitted {
+			t.Fatalf("request %d of member-1 should be permitted", i)
+		}
+	}
+	cl1.sync()
+	cl2.sync()
+
+	for i := 0; i < 4; i++ {
+		if permitted, _ := cl2.acquirePermission("client-1"); !permitted {
+			t.Fatalf("request %d of member-2 should be permitted", i)
+		}
+	}
+	permitted, quota := cl2.acquirePermission("client-1")
+	if permitted {
+		t.Errorf("the limit should hold across members")
+	}
+	if quota.Limit != 10 || quota.Remaining != 0 || quota.Reset != 20*time.Second {
+		t.Errorf("unexpected quota: %+v", quota)
+	}
+
+	if permitted, _ := cl2.acquirePermission("client-2"); !permitted {
+		t.Errorf("another key should be limited separately")
+	}
+
+	// Counters of the previous window are ignored.
+	now = now.Add(time.Minute)
+	cl2.sync()
+	if permitted, _ := cl2.acquirePermission("client-1"); !permitted {
+		t.Errorf("request in the next window should be permitted")
+	}
+}
+
+func TestClusterLimiterMaxKeys(t *testing.T) {
+	now := time.Unix(1000, 0)
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	cls := clustertest.New(nil)
+	prefix := "/ratelimiter/pipeline/limiter/url/"
+	cl1 := newClusterLimiter(cls, prefix, prefix+"member-1", 10, 2, time.Minute, time.Hour)
+	defer cl1.close()
+	cl2 := newClusterLimiter(cls, prefix, prefix+"member-2", 10, 2, time.Minute, time.Hour)
+	defer cl2.close()
+
+	for key, n := range map[string]int{"client-1": 5, "client-2": 3, "client-3": 2, "client-4": 1} {
+		for i := 0; i < n; i++ {
+			cl1.acquirePermission(key)
+		}
+	}
+	cl1.sync()
+	cl2.sync()
+
+	value, err := cls.Get(prefix + "member-1")
+	if err != nil || value == nil {
+		t.Fatalf("counters of member-1 not found: %v", err)
+	}
+	counters := &clusterCounters{}
+	json.Unmarshal([]byte(*value), counters)
+	if len(counters.Counters) != 2 || counters.Counters["client-1"] != 5 || counters.Others != 2 {
+		t.Errorf("unexpected counters: %+v", counters)
+	}
+
+	admit := func(key string) int {
+		admitted := 0
+		for i := 0; i < 20; i++ {
+			if permitted, _ := cl2.acquirePermission(key); permitted {
+				admitted++
+			}
+		}
+		return admitted
+	}
+
+	// The keys not published are counted as the largest of them.
+	for key, want := range map[string]int{"client-1": 5, "client-3": 8, "client-4": 8, "client-5": 8} {
+		if got := admit(key); got != want {
+			t.Errorf("want %d requests of %s admitted, got %d", want, key, got)
+		}
+	}
+}
+
+func TestClusterLimiterCombined(t *testing.T) {
+	now := time.Unix(1000, 0)
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	cls := clustertest.New(nil)
+	prefix := "/ratelimiter/pipeline/limiter/url/"
+	cl1 := newClusterLimiter(cls, prefix, prefix+"member-1", 11, defaultMaxKeys, time.Second, time.Hour)
+	defer cl1.close()
+	cl2 := newClusterLimiter(cls, prefix, prefix+"member-2", 11, defaultMaxKeys, time.Second, time.Hour)
+	defer cl2.close()
+	// The background syncing of member-1 finds member-2.
+	cl1.sync()
+
+	admit := func(cl *clusterLimiter) int {
+		admitted := 0
+		for i := 0; i < 20; i++ {
+			if permitted, _ := cl.acquirePermission("client-1"); permitted {
+				admitted++
+			}
+		}
+		return admitted
+	}
+
+	// Both members are busy before syncing in the new window.
+	now = now.Add(time.Second)
+	admitted1, admitted2 := admit(cl1), admit(cl2)
+	if admitted1 != 6 || admitted2 != 5 {
+		t.Errorf("members should share the limit before syncing, got %d and %d", admitted1, admitted2)
+	}
+
+	// member-1 gets the counters of member-2 in its second sync.
+	cl1.sync()
+	cl2.sync()
+	cl1.sync()
+	if total := admitted1 + admitted2 + admit(cl1) + admit(cl2); total != 11 {
+		t.Errorf("want 11 requests admitted by the cluster, got %d", total)
+	}
+}
+
+func TestKeyedLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	kl := newKeyedLimiter(librl.NewDefaultPolicy(), 2, time.Minute)
+
+	rl1 := kl.get("key-1")
+	kl.get("key-2")
+	if kl.get("key-1") != rl1 {
+		t.Errorf("limiter of the same key should be reused")
+	}
+
+	// key-2 is the least recently used one.
+	kl.get("key-3")
+	if _, ok := kl.limiters["key-2"]; ok {
+		t.Errorf("key-2 should be evicted")
+	}
+	if kl.lru.Len() != 2 {
+		t.Errorf("want 2 limiters, got %d", kl.lru.Len())
+	}
+
+	now = now.Add(time.Minute)
+	kl.get("key-4")
+	if kl.lru.Len() != 1 {
+		t.Errorf("idle limiters should be evicted, got %d limiters", kl.lru.Len())
+	}
+}
+
+func TestHandle(t *testing.T) {
+	const yamlSpec = `
+kind: RateLimiter
+name: rate-limiter
+policies:
+- name: per-ip
+  timeoutDuration: 0s
+  limitRefreshPeriod: 1h
+  limitForPeriod: 2
+  key:
+    source: ip
+defaultPolicyRef: per-ip
+urls:
+- url:
+    prefix: /
+`
+	newSpec := func(yamlSpec string) *httppipeline.FilterSpec {
+		rawSpec := map[string]interface{}{}
+		yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+		spec, err := httppipeline.NewFilterSpec(rawSpec, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return spec
+	}
+
+	rl := &RateLimiter{}
+	rl.Init(newSpec(yamlSpec))
+
+	newContext := func(ip string) (*contexttest.MockedHTTPContext, *httpheader.HTTPHeader) {
+		ctx := &contexttest.MockedHTTPContext{}
+		ctx.MockedRequest.MockedRealIP = func() string { return ip }
+		ctx.MockedRequest.MockedPath = func() string { return "/orders" }
+		ctx.MockedRequest.MockedMethod = func() string { return http.MethodGet }
+		header := httpheader.New(http.Header{})
+		ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader { return header }
+		return ctx, header
+	}
+
+	for i := 0; i < 2; i++ {
+		ctx, header := newContext("192.168.1.1")
+		if result := rl.Handle(ctx); result != "" {
+			t.Fatalf("request %d should be permitted, got %s", i, result)
+		}
+		if v := header.Get(httpheader.KeyXRateLimitRemaining); v != strconv.Itoa(1-i) {
+			t.Errorf("want remaining %d, got %s", 1-i, v)
+		}
+	}
+
+	ctx, header := newContext("192.168.1.1")
+	if result := rl.Handle(ctx); result != resultRateLimited {
+		t.Errorf("request should be rate limited, got %q", result)
+	}
+	if header.Get(httpheader.KeyXRateLimitLimit) != "2" || header.Get(httpheader.KeyRetryAfter) != "3600" {
+		t.Errorf("unexpected headers: %+v", header.Std())
+	}
+
+	ctx, _ = newContext("192.168.1.2")
+	if result := rl.Handle(ctx); result != "" {
+		t.Errorf("request of another client should be permitted, got %s", result)
+	}
+
+	if n := testutil.CollectAndCount(rateLimitedTotal); n != 1 {
+		t.Errorf("expected 1 series, got %d", n)
+	}
+
+	// Metrics of the policy which is still in use are kept.
+	next := &RateLimiter{}
+	next.Inherit(newSpec(yamlSpec), rl)
+	if n := testutil.CollectAndCount(rateLimitedTotal); n != 1 {
+		t.Errorf("expected 1 series, got %d", n)
+	}
+
+	// Metrics of the renamed policy are deleted.
+	renamed := &RateLimiter{}
+	renamed.Inherit(newSpec(strings.ReplaceAll(yamlSpec, "per-ip", "per-client")), next)
+	if n := testutil.CollectAndCount(rateLimitedTotal); n != 0 {
+		t.Errorf("expected no series, got %d", n)
+	}
+
+	for i := 0; i < 3; i++ {
+		ctx, _ := newContext("192.168.1.3")
+		renamed.Handle(ctx)
+	}
+	if n := testutil.CollectAndCount(rateLimitedTotal); n != 1 {
+		t.Errorf("expected 1 series, got %d", n)
+	}
+	renamed.Close()
+	if n := testutil.CollectAndCount(rateLimitedTotal); n != 0 {
+		t.Errorf("expected no series, got %d", n)
+	}
+}
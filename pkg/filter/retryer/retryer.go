@@ -28,6 +28,8 @@ import (
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/grpcstatus"
+	"github.com/megaease/easegress/pkg/util/httpheader"
 	"github.com/megaease/easegress/pkg/util/urlrule"
 )
 
@@ -47,15 +49,16 @@ type (
 
 	// Policy is the policy of the retryer
 	Policy struct {
-		Name                 string `yaml:"name" jsonschema:"required"`
-		MaxAttempts          int    `yaml:"maxAttempts" jsonschema:"omitempty,minimum=1"`
-		WaitDuration         string `yaml:"waitDuration" jsonschema:"omitempty,format=duration"`
-		waitDuration         time.Duration
-		BackOffPolicy        string  `yaml:"backOffPolicy" jsonschema:"omitempty,enum=random,enum=exponential"`
-		RandomizationFactor  float64 `yaml:"randomizationFactor" jsonschema:"omitempty,minimum=0,maximum=1"`
-		backOffPolicy        backOffPolicy
-		CountingNetworkError bool  `yaml:"countingNetworkError" jsonschema:"omitempty"`
-		FailureStatusCodes   []int `yaml:"failureStatusCodes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
+		Name                   string `yaml:"name" jsonschema:"required"`
+		MaxAttempts            int    `yaml:"maxAttempts" jsonschema:"omitempty,minimum=1"`
+		WaitDuration           string `yaml:"waitDuration" jsonschema:"omitempty,format=duration"`
+		waitDuration           time.Duration
+		BackOffPolicy          string  `yaml:"backOffPolicy" jsonschema:"omitempty,enum=random,enum=exponential"`
+		RandomizationFactor    float64 `yaml:"randomizationFactor" jsonschema:"omitempty,minimum=0,maximum=1"`
+		backOffPolicy          backOffPolicy
+		CountingNetworkError   bool  `yaml:"countingNetworkError" jsonschema:"omitempty"`
+		FailureStatusCodes     []int `yaml:"failureStatusCodes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
+		FailureGRPCStatusCodes []int `yaml:"failureGRPCStatusCodes" jsonschema:"omitempty,uniqueItems=true"`
 	}
 
 	// URLRule is the URL rule
@@ -101,6 +104,12 @@ URLLoop:
 		return fmt.Errorf("policy '%s' is not defined", name)
 	}
 
+	for _, p := range spec.Policies {
+		if err := grpcstatus.ValidateCodes(p.FailureGRPCStatusCodes); err != nil {
+			return fmt.Errorf("policy '%s': %v", p.Name, err)
+		}
+	}
+
 	return nil
 }
 
@@ -180,6 +189,11 @@ func (r *Retryer) handle(ctx context.HTTPContext, u *URLRule) string {
 	for {
 		attempt++
 		ctx.Request().SetBody(bytes.NewReader(data))
+		if len(u.policy.FailureGRPCStatusCodes) > 0 {
+			// NOTE: Remove the status of the last attempt.
+			ctx.Response().Header().Del(httpheader.KeyGRPCStatus)
+			ctx.Response().Header().Del(httpheader.KeyGRPCMessage)
+		}
 
 		result := ctx.CallNextHandler("")
 
@@ -193,6 +207,9 @@ func (r *Retryer) handle(ctx context.HTTPContext, u *URLRule) string {
 				}
 			}
 		}
+		if !hasErr {
+			hasErr = grpcstatus.InCodes(ctx.Response().Header(), u.policy.FailureGRPCStatusCodes)
+		}
 
 		if !hasErr {
 			ctx.AddTag(fmt.Sprintf("retryer: succeeded after %d attempts", attempt))
@@ -55,10 +55,16 @@ type JWTValidator struct {
 
 // Validate validates the JWT token of a http request
 func (v *JWTValidator) Validate(req context.HTTPRequest) error {
+	_, e := v.Claims(req)
+	return e
+}
+
+// Claims validates the JWT token of a http request and returns its claims
+func (v *JWTValidator) Claims(req context.HTTPRequest) (jwt.MapClaims, error) {
 	var token string
 
 	if v.spec.CookieName != "" {
-		if cookie, e := req.Cookie(v.spec.CookieName); e == nil {
+		if cookie, e := req.Cookie(v.spec.CookieName); e == nil && cookie != nil {
 			token = cookie.Value
 		}
 	}
@@ -67,18 +73,21 @@ func (v *JWTValidator) Validate(req context.HTTPRequest) error {
 		const prefix = "Bearer "
 		authHdr := req.Header().Get("Authorization")
 		if !strings.HasPrefix(authHdr, prefix) {
-			return fmt.Errorf("unexpected authorization header: %s", authHdr)
+			return nil, fmt.Errorf("unexpected authorization header: %s", authHdr)
 		}
 		token = authHdr[len(prefix):]
 	}
 
 	// jwt.Parse does everything including parsing and verification
-	_, e := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+	t, e := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
 		if alg := token.Method.Alg(); alg != v.spec.Algorithm {
 			return nil, fmt.Errorf("unexpected signing method: %v", alg)
 		}
 		return v.secretBytes, nil
 	})
+	if e != nil {
+		return nil, e
+	}
 
-	return e
+	return t.Claims.(jwt.MapClaims), nil
 }
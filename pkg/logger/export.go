@@ -66,6 +66,7 @@ func Sync() {
 	httpFilterAccessLogger.Sync()
 	httpFilterDumpLogger.Sync()
 	restAPILogger.Sync()
+	restAPIAuditLogger.Sync()
 }
 
 // APIAccess logs admin api log.
@@ -82,11 +83,23 @@ func APIAccess(
 		fasttime.Format(requestTime, fasttime.RFC3339), processTime)
 }
 
+// APIAudit logs the denied request of admin API.
+func APIAudit(method, remoteAddr, path, user, reason string) {
+	restAPIAuditLogger.Infof("%s %s %s user:%s denied:%s time:%v",
+		method, remoteAddr, path, user, reason,
+		fasttime.Format(fasttime.Now(), fasttime.RFC3339))
+}
+
 // HTTPAccess logs http access log.
 func HTTPAccess(template string, args ...interface{}) {
 	httpFilterAccessLogger.Debugf(template, args...)
 }
 
+// HTTPDump logs the dump of http requests and responses.
+func HTTPDump(template string, args ...interface{}) {
+	httpFilterDumpLogger.Debugf(template, args...)
+}
+
 // LazyHTTPAccess logs http access log in lazy mode, if http access log is disabled
 // by configuration, it skips the the built of log message to improve performance
 func LazyHTTPAccess(fn func() string) {
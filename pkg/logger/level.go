@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+type (
+	// DebugTarget is the object or filter being debugged, whose debug
+	// entries are logged regardless of the level until it expires.
+	DebugTarget struct {
+		Object string `yaml:"object"`
+		// Filter is the filter in the object, empty means the whole object.
+		Filter string `yaml:"filter,omitempty"`
+		// Dump dumps the requests and responses to filter_http_dump.log.
+		Dump     bool      `yaml:"dump"`
+		ExpireAt time.Time `yaml:"expireAt"`
+	}
+)
+
+var (
+	// defaultLevel is the level at startup.
+	defaultLevel = zap.InfoLevel
+	systemLevel  = zap.NewAtomicLevelAt(zap.InfoLevel)
+
+	// debugTargets's type is []*DebugTarget.
+	debugTargets atomic.Value
+)
+
+func init() {
+	debugTargets.Store([]*DebugTarget{})
+}
+
+// ParseLevel parses the level of DEBUG, INFO, WARN or ERROR.
+func ParseLevel(s string) (zapcore.Level, error) {
+	var level zapcore.Level
+	switch s {
+	case "DEBUG", "INFO", "WARN", "ERROR":
+		level.UnmarshalText([]byte(s))
+		return level, nil
+	default:
+		return level, fmt.Errorf("invalid level %s, available levels are DEBUG, INFO, WARN, ERROR", s)
+	}
+}
+
+// DefaultLevel returns the level of the system log at startup.
+func DefaultLevel() zapcore.Level {
+	return defaultLevel
+}
+
+// Level returns the current level of the system log.
+func Level() zapcore.Level {
+	return systemLevel.Level()
+}
+
+// SetLevel changes the level of the system log at runtime.
+func SetLevel(level zapcore.Level) {
+	systemLevel.SetLevel(level)
+}
+
+// SetDebugTargets replaces the objects and filters being debugged.
+func SetDebugTargets(targets []*DebugTarget) {
+	debugTargets.Store(targets)
+}
+
+// DebugTargets returns the objects and filters being debugged.
+func DebugTargets() []*DebugTarget {
+	return debugTargets.Load().([]*DebugTarget)
+}
+
+// ObjectDebugEnabled returns whether the filter of the object is being
+// debugged, and whether to dump its requests and responses. The empty
+// filter stands for the object itself, which is only matched by the
+// targets of the whole object.
+func ObjectDebugEnabled(object, filter string) (enabled, dump bool) {
+	targets := debugTargets.Load().([]*DebugTarget)
+	if len(targets) == 0 {
+		return false, false
+	}
+
+	now := fasttime.Now()
+	for _, t := range targets {
+		if t.Object != object || now.After(t.ExpireAt) {
+			continue
+		}
+		if t.Filter == "" || t.Filter == filter {
+			enabled = true
+			dump = dump || t.Dump
+		}
+	}
+
+	return enabled, dump
+}
+
+// LazyObjectDebug logs debug log of the filter of the object in lazy mode,
+// it's logged regardless of the level if the filter is being debugged.
+func LazyObjectDebug(object, filter string, fn func() string) {
+	if enabled, _ := ObjectDebugEnabled(object, filter); enabled {
+		objectDebugLogger.Debug(lazyLogBuilder{fn})
+		return
+	}
+	defaultLogger.Debug(lazyLogBuilder{fn})
+}
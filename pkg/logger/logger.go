@@ -43,10 +43,12 @@ func InitNop() {
 	httpFilterAccessLogger = nop.Sugar()
 	httpFilterDumpLogger = nop.Sugar()
 	restAPILogger = nop.Sugar()
+	restAPIAuditLogger = nop.Sugar()
 
 	defaultLogger = nop.Sugar()
 	gressLogger = defaultLogger
 	stderrLogger = defaultLogger
+	objectDebugLogger = defaultLogger
 }
 
 const (
@@ -54,6 +56,7 @@ const (
 	filterHTTPAccessFilename = "filter_http_access.log"
 	filterHTTPDumpFilename   = "filter_http_dump.log"
 	adminAPIFilename         = "admin_api.log"
+	adminAPIAuditFilename    = "admin_api_audit.log"
 
 	// EtcdClientFilename is the filename of etcd client log.
 	EtcdClientFilename = "etcd_client.log"
@@ -73,6 +76,8 @@ var (
 	httpFilterAccessLogger *zap.SugaredLogger
 	httpFilterDumpLogger   *zap.SugaredLogger
 	restAPILogger          *zap.SugaredLogger
+	restAPIAuditLogger     *zap.SugaredLogger
+	objectDebugLogger      *zap.SugaredLogger
 )
 
 // EtcdClientLoggerConfig generates the config of etcd client logger.
@@ -116,10 +121,13 @@ func defaultEncoderConfig() zapcore.EncoderConfig {
 func initDefault(opt *option.Options) {
 	encoderConfig := defaultEncoderConfig()
 
-	lowestLevel := zap.InfoLevel
+	defaultLevel = zap.InfoLevel
 	if opt.Debug {
-		lowestLevel = zap.DebugLevel
+		defaultLevel = zap.DebugLevel
 	}
+	// NOTE: The level could be changed at runtime.
+	lowestLevel := zap.NewAtomicLevelAt(defaultLevel)
+	systemLevel = lowestLevel
 
 	lf, err := newLogFile(filepath.Join(opt.AbsLogDir, stdoutFilename), systemLogMaxCacheCount)
 	if err != nil {
@@ -134,26 +142,43 @@ func initDefault(opt *option.Options) {
 
 	gatewaySyncer := zapcore.AddSync(lf)
 	gatewayCore := zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConfig), gatewaySyncer, lowestLevel)
-	gressLogger = zap.New(gatewayCore, opts...).Sugar()
+	systemSinkCore := newSinkCore(LogSystem)
+	gressLogger = zap.New(zapcore.NewTee(gatewayCore, systemSinkCore), opts...).Sugar()
 
-	defaultCore := zapcore.NewTee(gatewayCore, stderrCore)
+	defaultCore := zapcore.NewTee(gatewayCore, stderrCore, systemSinkCore)
 	defaultLogger = zap.New(defaultCore, opts...).Sugar()
+
+	// objectDebugLogger logs the debug entries of objects being debugged
+	// regardless of the level.
+	objectDebugCore := zapcore.NewTee(
+		zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConfig), gatewaySyncer, zap.DebugLevel),
+		zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConfig), stderrSyncer, zap.DebugLevel),
+		systemSinkCore,
+	)
+	objectDebugLogger = zap.New(objectDebugCore, opts...).Sugar()
 }
 
 func initHTTPFilter(opt *option.Options) {
-	httpFilterAccessLogger = newPlainLogger(opt, filterHTTPAccessFilename, trafficLogMaxCacheCount)
-	httpFilterDumpLogger = newPlainLogger(opt, filterHTTPDumpFilename, trafficLogMaxCacheCount)
+	httpFilterAccessLogger = newPlainLogger(opt, filterHTTPAccessFilename, LogAccess, trafficLogMaxCacheCount)
+	httpFilterDumpLogger = newPlainLogger(opt, filterHTTPDumpFilename, LogDump, trafficLogMaxCacheCount)
 }
 
 func initRestAPI(opt *option.Options) {
-	restAPILogger = newPlainLogger(opt, adminAPIFilename, systemLogMaxCacheCount)
+	restAPILogger = newPlainLogger(opt, adminAPIFilename, LogAdminAPI, systemLogMaxCacheCount)
+	// NOTE: The audit log is for security, so it can't be disabled.
+	restAPIAuditLogger = newPlainFileLogger(opt, adminAPIAuditFilename, LogAudit, systemLogMaxCacheCount)
 }
 
-func newPlainLogger(opt *option.Options, filename string, maxCacheCount uint32) *zap.SugaredLogger {
+// newPlainLogger only sends the entries to sinks if access log is disabled.
+func newPlainLogger(opt *option.Options, filename, log string, maxCacheCount uint32) *zap.SugaredLogger {
 	if opt.DisableAccessLog {
-		return zap.NewNop().Sugar()
+		return zap.New(newSinkCore(log)).Sugar()
 	}
 
+	return newPlainFileLogger(opt, filename, log, maxCacheCount)
+}
+
+func newPlainFileLogger(opt *option.Options, filename, log string, maxCacheCount uint32) *zap.SugaredLogger {
 	encoderConfig := zapcore.EncoderConfig{
 		TimeKey:       "",
 		LevelKey:      "",
@@ -172,5 +197,5 @@ func newPlainLogger(opt *option.Options, filename string, maxCacheCount uint32)
 	syncer := zapcore.AddSync(fr)
 	core := zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConfig), syncer, zap.DebugLevel)
 
-	return zap.New(core).Sugar()
+	return zap.New(zapcore.NewTee(core, newSinkCore(log))).Sugar()
 }
@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// The names of logs which could be sent to sinks.
+const (
+	// LogSystem is the log written to stdout.log.
+	LogSystem = "system"
+	// LogAccess is the log written to filter_http_access.log.
+	LogAccess = "access"
+	// LogDump is the log written to filter_http_dump.log.
+	LogDump = "dump"
+	// LogAdminAPI is the log written to admin_api.log.
+	LogAdminAPI = "adminAPI"
+	// LogAudit is the log written to admin_api_audit.log.
+	LogAudit = "audit"
+)
+
+// Logs are all names of logs.
+var Logs = []string{LogSystem, LogAccess, LogDump, LogAdminAPI, LogAudit}
+
+type (
+	// Entry is the log entry sent to sinks.
+	Entry struct {
+		Log     string
+		Level   zapcore.Level
+		Time    time.Time
+		Message string
+	}
+
+	// Sink receives the log entries. Write is called synchronously
+	// while logging, so it must not block, and must not log either.
+	Sink interface {
+		// Enabled returns true if the sink accepts the entries
+		// of the log at the level.
+		Enabled(log string, level zapcore.Level) bool
+		Write(entry *Entry)
+	}
+
+	// sinkCore is the zap core sending entries to the sinks of the log.
+	sinkCore struct {
+		log string
+	}
+)
+
+var (
+	sinksMutex sync.Mutex
+	// sinksByOwner is guarded by sinksMutex.
+	sinksByOwner = map[string][]Sink{}
+	// sinks is the flattened sinksByOwner, whose type is []Sink.
+	sinks atomic.Value
+)
+
+func init() {
+	sinks.Store([]Sink{})
+}
+
+// SetSinks sets the sinks of the owner, which replaces the previous ones.
+func SetSinks(owner string, ss []Sink) {
+	sinksMutex.Lock()
+	defer sinksMutex.Unlock()
+
+	if len(ss) == 0 {
+		delete(sinksByOwner, owner)
+	} else {
+		sinksByOwner[owner] = ss
+	}
+
+	all := []Sink{}
+	for _, ss := range sinksByOwner {
+		all = append(all, ss...)
+	}
+	sinks.Store(all)
+}
+
+// RemoveSinks removes the sinks of the owner.
+func RemoveSinks(owner string) {
+	SetSinks(owner, nil)
+}
+
+func newSinkCore(log string) zapcore.Core {
+	return &sinkCore{log: log}
+}
+
+func (c *sinkCore) Enabled(level zapcore.Level) bool {
+	for _, s := range sinks.Load().([]Sink) {
+		if s.Enabled(c.log, level) {
+			return true
+		}
+	}
+	return false
+}
+
+// With ignores the fields, since only sugared loggers without
+// fields are used in this package.
+func (c *sinkCore) With(fields []zapcore.Field) zapcore.Core {
+	return c
+}
+
+func (c *sinkCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+	return ce
+}
+
+func (c *sinkCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	e := &Entry{
+		Log:     c.log,
+		Level:   entry.Level,
+		Time:    entry.Time,
+		Message: entry.Message,
+	}
+	for _, s := range sinks.Load().([]Sink) {
+		if s.Enabled(c.log, entry.Level) {
+			s.Write(e)
+		}
+	}
+	return nil
+}
+
+func (c *sinkCore) Sync() error {
+	return nil
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificatestore
+
+import (
+	"time"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Category is the category of CertificateStore.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of CertificateStore.
+	Kind = "CertificateStore"
+)
+
+func init() {
+	supervisor.Register(&CertificateStore{})
+}
+
+type (
+	// CertificateStore holds named certificates shared by servers, which
+	// refer to it by name and pick certificates from it by SNI.
+	CertificateStore struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		store *store
+	}
+
+	// Status is the status of CertificateStore.
+	Status struct {
+		Certificates map[string]*CertificateStatus `yaml:"certificates"`
+	}
+)
+
+// Category returns the category of CertificateStore.
+func (cs *CertificateStore) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of CertificateStore.
+func (cs *CertificateStore) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of CertificateStore.
+func (cs *CertificateStore) DefaultSpec() interface{} {
+	return &Spec{
+		ExpiryWarning: "720h",
+	}
+}
+
+// Init initializes CertificateStore.
+func (cs *CertificateStore) Init(superSpec *supervisor.Spec) {
+	cs.superSpec, cs.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	cs.reload(nil)
+}
+
+// Inherit inherits previous generation of CertificateStore.
+func (cs *CertificateStore) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	cs.superSpec, cs.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+
+	// NOTE: The new store replaces the previous one in the registry
+	// before the previous one stops, so handshakes never miss it.
+	previous := previousGeneration.(*CertificateStore).store
+	cs.reload(previous)
+	previous.stop()
+}
+
+func (cs *CertificateStore) reload(previous *store) {
+	cs.store = newStore(cs.superSpec.Name(), cs.spec, previous)
+	cs.store.register()
+	go cs.store.run()
+}
+
+// Status returns the status of CertificateStore.
+func (cs *CertificateStore) Status() *supervisor.Status {
+	return &supervisor.Status{
+		ObjectStatus: &Status{
+			Certificates: cs.store.status(time.Now()),
+		},
+	}
+}
+
+// Close closes CertificateStore.
+func (cs *CertificateStore) Close() {
+	cs.store.unregister()
+	cs.store.stop()
+}
@@ -0,0 +1,326 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificatestore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+type testCA struct {
+	cert   *x509.Certificate
+	key    crypto.Signer
+	serial int64
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, serial: 1}
+}
+
+// issue issues a certificate and returns its spec, the cert contains
+// the chain of the leaf and the CA.
+func (ca *testCA) issue(t *testing.T, name string, notAfter time.Time, ocspServer string, domains ...string) *CertificateSpec {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: domains[0]},
+		DNSNames:     domains,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	if ocspServer != "" {
+		tmpl.OCSPServer = []string{ocspServer}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	certPem = append(certPem, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})...)
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return &CertificateSpec{
+		Name:       name,
+		CertBase64: base64.StdEncoding.EncodeToString(certPem),
+		KeyBase64:  base64.StdEncoding.EncodeToString(keyPem),
+	}
+}
+
+func newSuperSpec(t *testing.T, name string, certs ...*CertificateSpec) *supervisor.Spec {
+	yamlConfig := fmt.Sprintf("kind: CertificateStore\nname: %s\ncertificates:\n", name)
+	for _, c := range certs {
+		yamlConfig += fmt.Sprintf("- name: %s\n  certBase64: %s\n  keyBase64: %s\n", c.Name, c.CertBase64, c.KeyBase64)
+	}
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return superSpec
+}
+
+func TestSpecValidate(t *testing.T) {
+	ca := newTestCA(t)
+	notAfter := time.Now().Add(90 * 24 * time.Hour)
+	cert1 := ca.issue(t, "cert1", notAfter, "", "a.example.com")
+	cert2 := ca.issue(t, "cert1", notAfter, "", "b.example.com")
+	invalid := &CertificateSpec{Name: "invalid", CertBase64: cert1.CertBase64, KeyBase64: cert2.KeyBase64}
+
+	cases := []struct {
+		spec  Spec
+		valid bool
+	}{
+		{Spec{Certificates: []*CertificateSpec{cert1}}, true},
+		{Spec{Certificates: []*CertificateSpec{cert1}, ExpiryWarning: "1 month"}, false},
+		{Spec{Certificates: []*CertificateSpec{cert1, cert2}}, false},
+		{Spec{Certificates: []*CertificateSpec{invalid}}, false},
+	}
+
+	for i, c := range cases {
+		err := c.spec.Validate()
+		if c.valid && err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("case %d: expected an error", i)
+		}
+	}
+}
+
+func TestGetCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	notAfter := time.Now().Add(90 * 24 * time.Hour)
+	wildcard := ca.issue(t, "wildcard", notAfter, "", "*.example.com", "example.com")
+	exact := ca.issue(t, "exact", notAfter, "", "api.example.com")
+
+	cs := &CertificateStore{}
+	cs.Init(newSuperSpec(t, "test-get-certificate", wildcard, exact))
+
+	getCert := GetCertificateFunc("test-get-certificate", false)
+	getCertFallback := GetCertificateFunc("test-get-certificate", true)
+
+	commonName := func(cert *tls.Certificate) string {
+		if cert == nil {
+			return ""
+		}
+		return cert.Leaf.Subject.CommonName
+	}
+
+	cases := []struct {
+		serverName string
+		fallback   bool
+		expected   string
+	}{
+		{"api.example.com", false, "api.example.com"},
+		{"API.example.com.", false, "api.example.com"},
+		{"www.example.com", false, "*.example.com"},
+		{"example.com", false, "*.example.com"},
+		{"a.b.example.com", false, ""},
+		{"a.b.example.com", true, "*.example.com"},
+		{"", true, "*.example.com"},
+	}
+	for _, c := range cases {
+		f := getCert
+		if c.fallback {
+			f = getCertFallback
+		}
+		cert, err := f(&tls.ClientHelloInfo{ServerName: c.serverName})
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.serverName, err)
+		}
+		if got := commonName(cert); got != c.expected {
+			t.Errorf("%s: expected certificate %q, got %q", c.serverName, c.expected, got)
+		}
+	}
+
+	// Rotate the certificate without changing the function.
+	rotated := ca.issue(t, "exact", notAfter, "", "api.example.com")
+	next := &CertificateStore{}
+	next.Inherit(newSuperSpec(t, "test-get-certificate", wildcard, rotated), cs)
+
+	cert, _ := getCert(&tls.ClientHelloInfo{ServerName: "api.example.com"})
+	expected, _ := rotated.keyPair()
+	if cert == nil || string(cert.Certificate[0]) != string(expected.Certificate[0]) {
+		t.Error("the certificate is not rotated")
+	}
+
+	next.Close()
+	cert, err := getCert(&tls.ClientHelloInfo{ServerName: "api.example.com"})
+	if cert != nil || err != nil {
+		t.Errorf("expected no certificate and no error after closed, got %v, %v", cert, err)
+	}
+	if _, err := getCertFallback(&tls.ClientHelloInfo{ServerName: "api.example.com"}); err == nil {
+		t.Error("expected an error for the closed store")
+	}
+}
+
+func TestStatus(t *testing.T) {
+	ca := newTestCA(t)
+	now := time.Now()
+	spec := &Spec{
+		ExpiryWarning: "720h",
+		Certificates: []*CertificateSpec{
+			ca.issue(t, "fresh", now.Add(90*24*time.Hour), "", "fresh.example.com"),
+			ca.issue(t, "expiring", now.Add(10*24*time.Hour), "", "expiring.example.com"),
+		},
+	}
+
+	s := newStore("test-status", spec, nil)
+	status := s.status(now)
+
+	if status["fresh"].Expiring || status["fresh"].Warning != "" {
+		t.Errorf("fresh certificate is expiring: %+v", status["fresh"])
+	}
+	if !status["expiring"].Expiring || status["expiring"].Warning == "" {
+		t.Errorf("expiring certificate is not expiring: %+v", status["expiring"])
+	}
+	if status["expiring"].Domains[0] != "expiring.example.com" {
+		t.Errorf("unexpected domains: %v", status["expiring"].Domains)
+	}
+}
+
+func TestOCSPStapling(t *testing.T) {
+	ca := newTestCA(t)
+
+	var revoked int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		tmpl := ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Hour),
+			NextUpdate:   time.Now().Add(47 * time.Hour),
+		}
+		if atomic.LoadInt32(&revoked) == 1 {
+			tmpl.Status = ocsp.Revoked
+			tmpl.RevokedAt = time.Now().Add(-time.Minute)
+		}
+		resp, err := ocsp.CreateResponse(ca.cert, ca.cert, tmpl, ca.key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(resp)
+	}))
+	defer server.Close()
+
+	spec := &Spec{
+		OCSPStapling: true,
+		Certificates: []*CertificateSpec{
+			ca.issue(t, "stapled", time.Now().Add(90*24*time.Hour), server.URL, "stapled.example.com"),
+			ca.issue(t, "no-ocsp", time.Now().Add(90*24*time.Hour), "", "no-ocsp.example.com"),
+		},
+	}
+
+	s := newStore("test-ocsp", spec, nil)
+	now := time.Now()
+	s.check(now)
+
+	stapled, noOCSP := s.certs[0], s.certs[1]
+	if stapled.getTLSCert().OCSPStaple == nil {
+		t.Fatal("OCSP response is not stapled")
+	}
+	status := s.status(now)["stapled"].OCSP
+	if status == nil || status.Status != "good" || !status.Stapled {
+		t.Errorf("unexpected OCSP status: %+v", status)
+	}
+	if !stapled.nextOCSPRefresh.After(now.Add(time.Hour)) {
+		t.Errorf("unexpected next OCSP refresh: %v", stapled.nextOCSPRefresh)
+	}
+
+	if noOCSP.getTLSCert().OCSPStaple != nil {
+		t.Error("certificate without OCSP server is stapled")
+	}
+	if status := s.status(now)["no-ocsp"].OCSP; status == nil || status.Error == "" {
+		t.Errorf("expected OCSP error, got %+v", status)
+	}
+
+	// The staple is kept for the unchanged certificate in the next generation.
+	next := newStore("test-ocsp", spec, s)
+	if next.certs[0].getTLSCert().OCSPStaple == nil {
+		t.Error("OCSP staple is not inherited")
+	}
+
+	atomic.StoreInt32(&revoked, 1)
+	next.certs[0].refreshOCSP(next.ocspClient, now)
+	if next.certs[0].getTLSCert().OCSPStaple != nil {
+		t.Error("revoked certificate is still stapled")
+	}
+	if status := next.status(now)["stapled"].OCSP; status.Status != "revoked" || status.Stapled {
+		t.Errorf("unexpected OCSP status: %+v", status)
+	}
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificatestore
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	ocspTimeout        = 10 * time.Second
+	ocspRetryInterval  = 5 * time.Minute
+	ocspRefreshDefault = time.Hour
+	maxOCSPRespSize    = 1024 * 1024
+)
+
+type (
+	// OCSPStatus is the status of OCSP stapling of a certificate.
+	OCSPStatus struct {
+		Status     string     `yaml:"status,omitempty"`
+		ThisUpdate *time.Time `yaml:"thisUpdate,omitempty"`
+		NextUpdate *time.Time `yaml:"nextUpdate,omitempty"`
+		Stapled    bool       `yaml:"stapled"`
+		Error      string     `yaml:"error,omitempty"`
+	}
+)
+
+// refreshOCSP fetches the OCSP response of the certificate, and staples it
+// if the certificate is good.
+func (c *certificate) refreshOCSP(client *http.Client, now time.Time) {
+	resp, raw, err := c.fetchOCSP(client)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err != nil {
+		if len(c.leaf.OCSPServer) == 0 || c.issuer == nil {
+			// NOTE: It's a permanent error, no need to retry.
+			c.nextOCSPRefresh = c.leaf.NotAfter
+		} else {
+			c.nextOCSPRefresh = now.Add(ocspRetryInterval)
+			logger.Warnf("fetch OCSP response of certificate %s failed: %v", c.spec.Name, err)
+		}
+		// NOTE: Keep the previous staple until it's out of date.
+		if c.ocspStatus == nil {
+			c.ocspStatus = &OCSPStatus{}
+		}
+		c.ocspStatus.Error = err.Error()
+		if c.ocspStatus.NextUpdate != nil && c.ocspStatus.NextUpdate.Before(now) {
+			c.staple(nil)
+			c.ocspStatus.Stapled = false
+		}
+		return
+	}
+
+	status := &OCSPStatus{
+		ThisUpdate: &resp.ThisUpdate,
+	}
+	if !resp.NextUpdate.IsZero() {
+		status.NextUpdate = &resp.NextUpdate
+	}
+
+	switch resp.Status {
+	case ocsp.Good:
+		status.Status = "good"
+		status.Stapled = true
+		c.staple(raw)
+	case ocsp.Revoked:
+		status.Status = "revoked"
+		c.staple(nil)
+		logger.Errorf("certificate %s has been revoked at %s",
+			c.spec.Name, resp.RevokedAt.Format(time.RFC3339))
+	default:
+		status.Status = "unknown"
+		c.staple(nil)
+	}
+	c.ocspStatus = status
+
+	// Refresh at the half of the validity period of the response.
+	next := now.Add(ocspRefreshDefault)
+	if !resp.NextUpdate.IsZero() {
+		next = resp.ThisUpdate.Add(resp.NextUpdate.Sub(resp.ThisUpdate) / 2)
+		if next.Before(now.Add(ocspRetryInterval)) {
+			next = now.Add(ocspRetryInterval)
+		}
+	}
+	c.nextOCSPRefresh = next
+}
+
+func (c *certificate) fetchOCSP(client *http.Client) (*ocsp.Response, []byte, error) {
+	if len(c.leaf.OCSPServer) == 0 {
+		return nil, nil, fmt.Errorf("no OCSP server in the certificate")
+	}
+	if c.issuer == nil {
+		return nil, nil, fmt.Errorf("no issuer certificate after the leaf one")
+	}
+
+	req, err := ocsp.CreateRequest(c.leaf, c.issuer, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create OCSP request failed: %v", err)
+	}
+
+	httpResp, err := client.Post(c.leaf.OCSPServer[0], "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("OCSP server %s responds status code %d",
+			c.leaf.OCSPServer[0], httpResp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, maxOCSPRespSize))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := ocsp.ParseResponseForCert(body, c.leaf, c.issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse OCSP response failed: %v", err)
+	}
+
+	return resp, body, nil
+}
+
+// staple replaces the TLS certificate with a copy carrying the OCSP response,
+// the caller must hold the lock.
+func (c *certificate) staple(raw []byte) {
+	tlsCert := *c.getTLSCert()
+	if tlsCert.OCSPStaple == nil && raw == nil {
+		return
+	}
+	tlsCert.OCSPStaple = raw
+	c.tlsCert.Store(&tlsCert)
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificatestore
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+type (
+	// Spec describes the CertificateStore.
+	Spec struct {
+		Certificates  []*CertificateSpec `yaml:"certificates" jsonschema:"required,minItems=1"`
+		ExpiryWarning string             `yaml:"expiryWarning" jsonschema:"omitempty,format=duration"`
+		OCSPStapling  bool               `yaml:"ocspStapling" jsonschema:"omitempty"`
+	}
+
+	// CertificateSpec describes a named certificate, the certificate may
+	// contain the intermediate certificates after the leaf one, and the
+	// issuer of the leaf is required by OCSP stapling.
+	CertificateSpec struct {
+		Name       string `yaml:"name" jsonschema:"required"`
+		CertBase64 string `yaml:"certBase64" jsonschema:"required,format=base64"`
+		KeyBase64  string `yaml:"keyBase64" jsonschema:"required,format=base64"`
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	if spec.ExpiryWarning != "" {
+		if _, err := time.ParseDuration(spec.ExpiryWarning); err != nil {
+			return fmt.Errorf("invalid expiryWarning %s: %v", spec.ExpiryWarning, err)
+		}
+	}
+
+	names := map[string]struct{}{}
+	for _, c := range spec.Certificates {
+		if _, exists := names[c.Name]; exists {
+			return fmt.Errorf("certificate %s is duplicated", c.Name)
+		}
+		names[c.Name] = struct{}{}
+
+		if _, err := c.keyPair(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (spec *Spec) expiryWarning() time.Duration {
+	d, err := time.ParseDuration(spec.ExpiryWarning)
+	if err != nil {
+		return defaultExpiryWarning
+	}
+	return d
+}
+
+func (c *CertificateSpec) keyPair() (*tls.Certificate, error) {
+	certPem, err := base64.StdEncoding.DecodeString(c.CertBase64)
+	if err != nil {
+		return nil, fmt.Errorf("decode certBase64 of %s failed: %v", c.Name, err)
+	}
+	keyPem, err := base64.StdEncoding.DecodeString(c.KeyBase64)
+	if err != nil {
+		return nil, fmt.Errorf("decode keyBase64 of %s failed: %v", c.Name, err)
+	}
+
+	cert, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		return nil, fmt.Errorf("generate x509 key pair for %s failed: %v", c.Name, err)
+	}
+
+	return &cert, nil
+}
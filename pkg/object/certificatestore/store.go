@@ -0,0 +1,306 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificatestore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	defaultExpiryWarning = 30 * 24 * time.Hour
+
+	checkInterval         = time.Minute
+	expiryWarningInterval = 24 * time.Hour
+)
+
+var (
+	storesMutex sync.RWMutex
+	stores      = map[string]*store{}
+)
+
+type (
+	store struct {
+		name  string
+		spec  *Spec
+		certs []*certificate
+		// names is keyed by the lower case DNS names of the certificates,
+		// including the wildcard ones like *.example.com.
+		names map[string]*certificate
+
+		ocspClient *http.Client
+		done       chan struct{}
+	}
+
+	certificate struct {
+		spec   *CertificateSpec
+		leaf   *x509.Certificate
+		issuer *x509.Certificate
+
+		// tlsCert is replaced as a whole when the OCSP staple changes,
+		// since it's read by handshakes concurrently.
+		tlsCert atomic.Value // *tls.Certificate
+
+		mutex           sync.Mutex
+		ocspStatus      *OCSPStatus
+		nextOCSPRefresh time.Time
+		lastWarned      time.Time
+	}
+
+	// CertificateStatus is the status of a certificate.
+	CertificateStatus struct {
+		Domains   []string    `yaml:"domains"`
+		NotBefore time.Time   `yaml:"notBefore"`
+		NotAfter  time.Time   `yaml:"notAfter"`
+		Expiring  bool        `yaml:"expiring"`
+		Warning   string      `yaml:"warning,omitempty"`
+		OCSP      *OCSPStatus `yaml:"ocsp,omitempty"`
+	}
+)
+
+// GetCertificateFunc returns the function for tls.Config.GetCertificate, which
+// picks certificates by SNI from the store at the time of every handshake, so
+// the updates of the store take effect without restarting listeners.
+// If no certificate matches, the first certificate of the store is returned
+// when fallback is true, otherwise nil is returned so that the certificates
+// in tls.Config.Certificates are used.
+func GetCertificateFunc(storeName string, fallback bool) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		storesMutex.RLock()
+		s := stores[storeName]
+		storesMutex.RUnlock()
+
+		if s == nil {
+			if fallback {
+				return nil, fmt.Errorf("certificate store %s not found", storeName)
+			}
+			return nil, nil
+		}
+
+		if c := s.match(hello.ServerName); c != nil {
+			return c.getTLSCert(), nil
+		}
+		if fallback && len(s.certs) > 0 {
+			return s.certs[0].getTLSCert(), nil
+		}
+		return nil, nil
+	}
+}
+
+func newStore(name string, spec *Spec, previous *store) *store {
+	s := &store{
+		name:       name,
+		spec:       spec,
+		names:      map[string]*certificate{},
+		ocspClient: &http.Client{Timeout: ocspTimeout},
+		done:       make(chan struct{}),
+	}
+
+	previousCerts := map[string]*certificate{}
+	if previous != nil {
+		for _, c := range previous.certs {
+			previousCerts[c.spec.Name] = c
+		}
+	}
+
+	for _, certSpec := range spec.Certificates {
+		c, err := newCertificate(certSpec)
+		if err != nil {
+			logger.Errorf("BUG: %s: %v", name, err)
+			continue
+		}
+
+		// NOTE: Keep the OCSP staple of the unchanged certificate.
+		if prev := previousCerts[certSpec.Name]; prev != nil && *prev.spec == *certSpec {
+			prev.mutex.Lock()
+			c.tlsCert.Store(prev.getTLSCert())
+			c.ocspStatus = prev.ocspStatus
+			c.nextOCSPRefresh = prev.nextOCSPRefresh
+			c.lastWarned = prev.lastWarned
+			prev.mutex.Unlock()
+		}
+
+		s.certs = append(s.certs, c)
+		for _, domain := range c.domains() {
+			domain = strings.ToLower(domain)
+			if _, exists := s.names[domain]; !exists {
+				s.names[domain] = c
+			}
+		}
+	}
+
+	return s
+}
+
+func newCertificate(spec *CertificateSpec) (*certificate, error) {
+	tlsCert, err := spec.keyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(tlsCert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate %s failed: %v", spec.Name, err)
+	}
+	tlsCert.Leaf = leaf
+
+	c := &certificate{
+		spec: spec,
+		leaf: leaf,
+	}
+	if len(tlsCert.Certificate) > 1 {
+		issuer, err := x509.ParseCertificate(tlsCert.Certificate[1])
+		if err != nil {
+			return nil, fmt.Errorf("parse issuer certificate of %s failed: %v", spec.Name, err)
+		}
+		c.issuer = issuer
+	}
+	c.tlsCert.Store(tlsCert)
+
+	return c, nil
+}
+
+func (c *certificate) domains() []string {
+	if len(c.leaf.DNSNames) > 0 {
+		return c.leaf.DNSNames
+	}
+	if c.leaf.Subject.CommonName != "" {
+		return []string{c.leaf.Subject.CommonName}
+	}
+	return nil
+}
+
+func (c *certificate) getTLSCert() *tls.Certificate {
+	return c.tlsCert.Load().(*tls.Certificate)
+}
+
+// match returns the certificate of the server name, the exact names
+// take precedence over the wildcard ones.
+func (s *store) match(serverName string) *certificate {
+	name := strings.TrimSuffix(strings.ToLower(serverName), ".")
+	if name == "" {
+		return nil
+	}
+
+	if c := s.names[name]; c != nil {
+		return c
+	}
+
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		return s.names["*"+name[i:]]
+	}
+
+	return nil
+}
+
+func (s *store) register() {
+	storesMutex.Lock()
+	stores[s.name] = s
+	storesMutex.Unlock()
+}
+
+// unregister removes the store from the registry, unless it has been
+// replaced by a newer generation.
+func (s *store) unregister() {
+	storesMutex.Lock()
+	if stores[s.name] == s {
+		delete(stores, s.name)
+	}
+	storesMutex.Unlock()
+}
+
+func (s *store) run() {
+	s.check(time.Now())
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			s.check(now)
+		}
+	}
+}
+
+func (s *store) stop() {
+	close(s.done)
+}
+
+func (s *store) check(now time.Time) {
+	expiryWarning := s.spec.expiryWarning()
+
+	for _, c := range s.certs {
+		c.mutex.Lock()
+		if c.leaf.NotAfter.Before(now.Add(expiryWarning)) && now.Sub(c.lastWarned) >= expiryWarningInterval {
+			c.lastWarned = now
+			logger.Warnf("%s: certificate %s %s", s.name, c.spec.Name, expiryMessage(c.leaf.NotAfter, now))
+		}
+		refresh := s.spec.OCSPStapling && !now.Before(c.nextOCSPRefresh)
+		c.mutex.Unlock()
+
+		if refresh {
+			c.refreshOCSP(s.ocspClient, now)
+		}
+	}
+}
+
+func expiryMessage(notAfter, now time.Time) string {
+	if !notAfter.After(now) {
+		return fmt.Sprintf("expired at %s", notAfter.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("expires in %v at %s", notAfter.Sub(now).Truncate(time.Second), notAfter.Format(time.RFC3339))
+}
+
+func (s *store) status(now time.Time) map[string]*CertificateStatus {
+	expiryWarning := s.spec.expiryWarning()
+
+	result := make(map[string]*CertificateStatus, len(s.certs))
+	for _, c := range s.certs {
+		status := &CertificateStatus{
+			Domains:   c.domains(),
+			NotBefore: c.leaf.NotBefore,
+			NotAfter:  c.leaf.NotAfter,
+			Expiring:  c.leaf.NotAfter.Before(now.Add(expiryWarning)),
+		}
+		if status.Expiring {
+			status.Warning = expiryMessage(c.leaf.NotAfter, now)
+		}
+
+		c.mutex.Lock()
+		if c.ocspStatus != nil {
+			ocspStatus := *c.ocspStatus
+			status.OCSP = &ocspStatus
+		}
+		c.mutex.Unlock()
+
+		result[c.spec.Name] = status
+	}
+
+	return result
+}
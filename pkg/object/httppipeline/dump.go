@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+// maxDumpBodySize is the max size of the body in a dump,
+// the rest of the body is truncated.
+const maxDumpBodySize = 4 * 1024
+
+// dumpTitle returns the first line of the dump.
+func dumpTitle(ctx context.HTTPContext, pipeline, filter, what string) string {
+	title := fmt.Sprintf("%s %s pipeline %s", fasttime.Format(fasttime.Now(), fasttime.RFC3339Milli),
+		ctx.Request().RealIP(), pipeline)
+	if filter != "" {
+		title += " filter " + filter
+	}
+	return title + " " + what
+}
+
+// dumpRequest dumps the request, the body is only dumped at the entry
+// of the pipeline, where it's peeked and put back for filters.
+func dumpRequest(ctx context.HTTPContext, pipeline, filter string, withBody bool) {
+	r := ctx.Request()
+
+	uri := r.Path()
+	if r.Query() != "" {
+		uri += "?" + r.Query()
+	}
+
+	buff := bytes.NewBuffer(nil)
+	fmt.Fprintf(buff, "%s\n%s %s %s\n", dumpTitle(ctx, pipeline, filter, "request:"), r.Method(), uri, r.Proto())
+	fmt.Fprintf(buff, "Host: %s\n", r.Host())
+	r.Header().Std().Write(buff)
+
+	if withBody && r.Body() != nil {
+		body := r.Body()
+		head := make([]byte, maxDumpBodySize)
+		n, err := io.ReadFull(body, head)
+		head = head[:n]
+		r.SetBody(io.MultiReader(bytes.NewReader(head), body))
+
+		buff.WriteString("\n")
+		buff.Write(head)
+		if err == nil {
+			buff.WriteString("...(truncated)")
+		}
+	}
+
+	logger.HTTPDump("%s\n", buff.String())
+}
+
+// dumpResponse dumps the response, the body is not dumped
+// since it may not be ready before flushing.
+func dumpResponse(ctx context.HTTPContext, pipeline, filter string) {
+	w := ctx.Response()
+
+	buff := bytes.NewBuffer(nil)
+	fmt.Fprintf(buff, "%s\n%s %d %s\n", dumpTitle(ctx, pipeline, filter, "response:"),
+		ctx.Request().Proto(), w.StatusCode(), http.StatusText(w.StatusCode()))
+	w.Header().Std().Write(buff)
+
+	logger.HTTPDump("%s\n", buff.String())
+}
+
+// dumpResponseOnFinish dumps the response sent to the client,
+// including the body captured while flushing.
+func dumpResponseOnFinish(ctx context.HTTPContext, pipeline string) {
+	body := bytes.NewBuffer(nil)
+	truncated := false
+	ctx.Response().OnFlushBody(func(p []byte, complete bool) []byte {
+		if n := maxDumpBodySize - body.Len(); n < len(p) {
+			body.Write(p[:n])
+			truncated = true
+		} else {
+			body.Write(p)
+		}
+		return p
+	})
+
+	ctx.OnFinish(func() {
+		w := ctx.Response()
+
+		buff := bytes.NewBuffer(nil)
+		fmt.Fprintf(buff, "%s\n%s %d %s\n", dumpTitle(ctx, pipeline, "", "response:"),
+			ctx.Request().Proto(), w.StatusCode(), http.StatusText(w.StatusCode()))
+		w.Header().Std().Write(buff)
+		if body.Len() != 0 {
+			buff.WriteString("\n")
+			buff.Write(body.Bytes())
+			if truncated {
+				buff.WriteString("...(truncated)")
+			}
+		}
+
+		logger.HTTPDump("%s\n", buff.String())
+	})
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+func TestDumpRequestKeepsBody(t *testing.T) {
+	logger.InitNop()
+	for _, size := range []int{0, 10, maxDumpBodySize, maxDumpBodySize + 10} {
+		body := strings.Repeat("a", size)
+
+		ctx := &contexttest.MockedHTTPContext{}
+		var reader io.Reader = strings.NewReader(body)
+		ctx.MockedRequest.MockedBody = func() io.Reader { return reader }
+		ctx.MockedRequest.MockedSetBody = func(r io.Reader) { reader = r }
+		ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+			return httpheader.New(http.Header{})
+		}
+
+		dumpRequest(ctx, "pipeline", "", true)
+
+		got, _ := io.ReadAll(ctx.Request().Body())
+		if string(got) != body {
+			t.Errorf("body of size %d changed to size %d after dumped", size, len(got))
+		}
+	}
+}
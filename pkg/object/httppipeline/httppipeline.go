@@ -438,9 +438,35 @@ func (hp *HTTPPipeline) getNextFilterIndex(index int, result string) int {
 
 // Handle is the handler to deal with HTTP
 func (hp *HTTPPipeline) Handle(ctx context.HTTPContext) {
+	hp.handle(ctx, -1)
+}
+
+// HandleAfter handles the context with the filters after the given one,
+// it's used by filters which need to call the following filters out of
+// the request, such as the background revalidation of HTTPCache.
+// It returns the result of the following filters, and false if the filter
+// is not running in the pipeline.
+func (hp *HTTPPipeline) HandleAfter(ctx context.HTTPContext, filter Filter) (string, bool) {
+	for index, f := range hp.runningFilters {
+		if f.filter == filter {
+			return hp.handle(ctx, index), true
+		}
+	}
+
+	return "", false
+}
+
+func (hp *HTTPPipeline) handle(ctx context.HTTPContext, startIndex int) string {
 	ctx.SetTemplate(hp.ht)
 
-	filterIndex := -1
+	pipeline := hp.superSpec.Name()
+	_, pipelineDump := logger.ObjectDebugEnabled(pipeline, "")
+	if pipelineDump {
+		dumpRequest(ctx, pipeline, "", true)
+		dumpResponseOnFinish(ctx, pipeline)
+	}
+
+	filterIndex := startIndex
 	filterStat := newFilterStat()
 
 	handle := func(lastResult string) string {
@@ -453,8 +479,8 @@ func (hp *HTTPPipeline) Handle(ctx context.HTTPContext) {
 				format := "save http rsp failed, dict is %#v err is %v"
 				logger.Errorf(format, ctx.Template().GetDict(), err)
 			}
-			logger.LazyDebug(func() string {
-				return fmt.Sprintf("filter %s, saved response dict %v", name, ctx.Template().GetDict())
+			logger.LazyObjectDebug(pipeline, name, func() string {
+				return fmt.Sprintf("pipeline %s filter %s, saved response dict %v", pipeline, name, ctx.Template().GetDict())
 			})
 		}
 
@@ -482,27 +508,43 @@ func (hp *HTTPPipeline) Handle(ctx context.HTTPContext) {
 			logger.Errorf(format, ctx.Template().GetDict(), err)
 		}
 
-		logger.LazyDebug(func() string {
-			return fmt.Sprintf("filter %s saved request dict %v", name, ctx.Template().GetDict())
+		logger.LazyObjectDebug(pipeline, name, func() string {
+			return fmt.Sprintf("pipeline %s filter %s saved request dict %v", pipeline, name, ctx.Template().GetDict())
 		})
 		filterStat = newFilterStat()
 		filterStat.Name = name
 		filterStat.Kind = filter.spec.Kind()
 
+		// NOTE: The whole pipeline being dumped needs no dumps of filters.
+		_, filterDump := logger.ObjectDebugEnabled(pipeline, name)
+		filterDump = filterDump && !pipelineDump
+		if filterDump {
+			dumpRequest(ctx, pipeline, name, false)
+		}
+
 		startTime := fasttime.Now()
 		result := filter.filter.Handle(ctx)
 
 		filterStat.Duration = fasttime.Since(startTime)
 		filterStat.Result = result
 
+		if filterDump {
+			dumpResponse(ctx, pipeline, name)
+		}
+		logger.LazyObjectDebug(pipeline, name, func() string {
+			return fmt.Sprintf("pipeline %s filter %s(%s) returned result %q in %v",
+				pipeline, name, filterStat.Kind, result, filterStat.Duration)
+		})
+
 		lastStat.Next = append(lastStat.Next, filterStat)
 		return result
 	}
 
 	ctx.SetHandlerCaller(handle)
-	handle("")
+	result := handle("")
 
 	ctx.AddTag(filterStat.marshalAndRelease())
+	return result
 }
 
 func (hp *HTTPPipeline) getRunningFilter(name string) *runningFilter {
@@ -291,6 +291,14 @@ filters:
 
 	ctx := &contexttest.MockedHTTPContext{}
 	httpPipeline.Handle(ctx)
+
+	if _, ok := httpPipeline.HandleAfter(ctx, CreateObjectMock("Validator")); ok {
+		t.Errorf("filter not in the pipeline should not be handled")
+	}
+	if _, ok := httpPipeline.HandleAfter(ctx, httpPipeline.runningFilters[0].filter); !ok {
+		t.Errorf("filter in the pipeline should be handled")
+	}
+
 	status := httpPipeline.Status()
 	if reflect.TypeOf(status).Kind() == reflect.Struct {
 		t.Errorf("should be type of Status")
@@ -54,7 +54,12 @@ func NewFilterSpec(originalRawSpec map[string]interface{}, super *supervisor.Sup
 	defer func() {
 		if r := recover(); r != nil {
 			s = nil
-			err = fmt.Errorf("%v", r)
+			// NOTE: Keep the validation result for the structured errors.
+			if vr, ok := r.(*v.ValidateRecorder); ok {
+				err = vr
+			} else {
+				err = fmt.Errorf("%v", r)
+			}
 		} else {
 			err = nil
 		}
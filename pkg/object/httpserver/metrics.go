@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"strconv"
+
+	"github.com/megaease/easegress/pkg/util/httpstat"
+	"github.com/megaease/easegress/pkg/util/prometheushelper"
+)
+
+const metricsSubsystem = "httpserver"
+
+var (
+	requestsTotal = prometheushelper.NewCounter(metricsSubsystem, "requests_total",
+		"The total number of requests handled by the HTTPServer.",
+		[]string{"http_server", "code"})
+	requestDuration = prometheushelper.NewHistogram(metricsSubsystem, "request_duration_seconds",
+		"The latency of requests handled by the HTTPServer.",
+		[]string{"http_server"}, prometheushelper.DurationBuckets)
+	requestSizeTotal = prometheushelper.NewCounter(metricsSubsystem, "request_size_bytes_total",
+		"The total size of requests handled by the HTTPServer.",
+		[]string{"http_server"})
+	responseSizeTotal = prometheushelper.NewCounter(metricsSubsystem, "response_size_bytes_total",
+		"The total size of responses sent by the HTTPServer.",
+		[]string{"http_server"})
+)
+
+// exportMetrics exports the metrics of a request, the series are added
+// to be deleted after the HTTPServer is closed.
+func exportMetrics(series *prometheushelper.Series, httpServer string, m *httpstat.Metric) {
+	code := strconv.Itoa(m.StatusCode)
+	requestsTotal.WithLabelValues(httpServer, code).Inc()
+	series.Add(requestsTotal.MetricVec, httpServer, code)
+	requestDuration.WithLabelValues(httpServer).Observe(m.Duration.Seconds())
+	series.Add(requestDuration.MetricVec, httpServer)
+	requestSizeTotal.WithLabelValues(httpServer).Add(float64(m.ReqSize))
+	series.Add(requestSizeTotal.MetricVec, httpServer)
+	responseSizeTotal.WithLabelValues(httpServer).Add(float64(m.RespSize))
+	series.Add(responseSizeTotal.MetricVec, httpServer)
+}
@@ -30,9 +30,12 @@ import (
 	"github.com/megaease/easegress/pkg/protocol"
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/clientip"
 	"github.com/megaease/easegress/pkg/util/httpheader"
 	"github.com/megaease/easegress/pkg/util/httpstat"
 	"github.com/megaease/easegress/pkg/util/ipfilter"
+	"github.com/megaease/easegress/pkg/util/prometheushelper"
+	"github.com/megaease/easegress/pkg/util/routeaction"
 	"github.com/megaease/easegress/pkg/util/stringtool"
 	"github.com/megaease/easegress/pkg/util/topn"
 )
@@ -41,6 +44,7 @@ type (
 	mux struct {
 		httpStat *httpstat.HTTPStat
 		topN     *topn.TopN
+		series   *prometheushelper.Series
 
 		rules atomic.Value // *muxRules
 	}
@@ -54,8 +58,10 @@ type (
 		cache *cache
 
 		tracer       *tracing.Tracing
+		accessLog    *context.AccessLog
 		ipFilter     *ipfilter.IPFilter
 		ipFilterChan *ipfilter.IPFilters
+		clientIP     *clientip.Resolver
 
 		rules []*muxRule
 	}
@@ -81,7 +87,13 @@ type (
 		methods       []string
 		rewriteTarget string
 		backend       string
+		redirect      *routeaction.Redirect
+		response      *routeaction.Response
 		headers       []*Header
+
+		// hostRE is the host regexp of the rule the path belongs to,
+		// its captures are used by redirect.
+		hostRE *regexp.Regexp
 	}
 )
 
@@ -156,6 +168,10 @@ func newMuxRule(parentIPFilters *ipfilter.IPFilters, rule *Rule, paths []*muxPat
 		}
 	}
 
+	for _, path := range paths {
+		path.hostRE = hostRE
+	}
+
 	return &muxRule{
 		ipFilter:      newIPFilter(rule.IPFilter),
 		ipFilterChain: newIPFilterChain(parentIPFilters, rule.IPFilter),
@@ -211,17 +227,24 @@ func newMuxPath(parentIPFilters *ipfilter.IPFilters, path *Path) *muxPath {
 		p.initHeaderRoute()
 	}
 
+	p, pathPrefix := path.Path, path.PathPrefix
+	if path.GRPCService != "" {
+		p, pathPrefix = path.grpcPath()
+	}
+
 	return &muxPath{
 		ipFilter:      newIPFilter(path.IPFilter),
 		ipFilterChain: newIPFilterChain(parentIPFilters, path.IPFilter),
 
-		path:          path.Path,
-		pathPrefix:    path.PathPrefix,
+		path:          p,
+		pathPrefix:    pathPrefix,
 		pathRegexp:    path.PathRegexp,
 		pathRE:        pathRE,
 		rewriteTarget: path.RewriteTarget,
 		methods:       path.Methods,
 		backend:       path.Backend,
+		redirect:      path.Redirect,
+		response:      path.Response,
 		headers:       path.Headers,
 	}
 }
@@ -285,6 +308,7 @@ func newMux(httpStat *httpstat.HTTPStat, topN *topn.TopN, mapper protocol.MuxMap
 	m := &mux{
 		httpStat: httpStat,
 		topN:     topN,
+		series:   prometheushelper.NewSeries(),
 	}
 
 	m.rules.Store(&muxRules{
@@ -326,12 +350,17 @@ func (m *mux) reloadRules(superSpec *supervisor.Spec, muxMapper protocol.MuxMapp
 		ipFilterChan: newIPFilterChain(nil, spec.IPFilter),
 		rules:        make([]*muxRule, len(spec.Rules)),
 		tracer:       tracer,
+		accessLog:    context.NewAccessLog(spec.AccessLog),
 	}
 
 	if spec.CacheSize > 0 {
 		rules.cache = newCache(spec.CacheSize)
 	}
 
+	if spec.ClientIP != nil {
+		rules.clientIP = clientip.New(spec.ClientIP)
+	}
+
 	for i := 0; i < len(rules.rules); i++ {
 		specRule := spec.Rules[i]
 
@@ -352,11 +381,20 @@ func (m *mux) reloadRules(superSpec *supervisor.Spec, muxMapper protocol.MuxMapp
 func (m *mux) ServeHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 	rules := m.rules.Load().(*muxRules)
 
-	ctx := context.New(stdw, stdr, rules.tracer, rules.superSpec.Name())
+	var ctx context.HTTPContext
+	if rules.clientIP != nil {
+		realIP := rules.clientIP.Resolve(stdr)
+		ctx = context.NewWithRealIP(stdw, stdr, rules.tracer, rules.superSpec.Name(), realIP)
+	} else {
+		ctx = context.New(stdw, stdr, rules.tracer, rules.superSpec.Name())
+	}
+	ctx.SetAccessLog(rules.accessLog)
 	defer ctx.Finish()
 	ctx.OnFinish(func() {
 		ctx.Span().Finish()
-		m.httpStat.Stat(ctx.StatMetric())
+		metric := ctx.StatMetric()
+		m.httpStat.Stat(metric)
+		exportMetrics(m.series, rules.superSpec.Name(), metric)
 		m.topN.Stat(ctx)
 	})
 
@@ -437,6 +475,10 @@ func (m *mux) handleRequestWithCache(rules *muxRules, ctx context.HTTPContext, c
 		ctx.Response().SetStatusCode(http.StatusNotFound)
 	case ci.methodNotAllowed:
 		ctx.Response().SetStatusCode(http.StatusMethodNotAllowed)
+	case ci.path != nil && ci.path.redirect != nil:
+		ci.path.redirect.Handle(ctx, ci.path.hostRE, ci.path.pathRE)
+	case ci.path != nil && ci.path.response != nil:
+		ci.path.response.Handle(ctx)
 	case ci.path != nil:
 		handler, exists := rules.muxMapper.GetHandler(ci.path.backend)
 		if !exists {
@@ -446,7 +488,7 @@ func (m *mux) handleRequestWithCache(rules *muxRules, ctx context.HTTPContext, c
 		}
 
 		if rules.spec.XForwardedFor {
-			m.appendXForwardedFor(ctx)
+			m.appendXForwardedFor(rules, ctx)
 		}
 
 		if ci.path.pathRE != nil && ci.path.rewriteTarget != "" {
@@ -458,8 +500,21 @@ func (m *mux) handleRequestWithCache(rules *muxRules, ctx context.HTTPContext, c
 	}
 }
 
-func (m *mux) appendXForwardedFor(ctx context.HTTPContext) {
+func (m *mux) appendXForwardedFor(rules *muxRules, ctx context.HTTPContext) {
 	v := ctx.Request().Header().Get(httpheader.KeyXForwardedFor)
+
+	// NOTE: With the client IP resolution configured, append the peer
+	// like the other proxies do, so that the hops stay verifiable for
+	// the upstreams trusting Easegress.
+	if rules.clientIP != nil {
+		ip := clientip.PeerIP(ctx.Request().Std())
+		if v != "" {
+			ip = stringtool.Cat(v, ", ", ip)
+		}
+		ctx.Request().Header().Set(httpheader.KeyXForwardedFor, ip)
+		return
+	}
+
 	ip := ctx.Request().RealIP()
 
 	if v == "" {
@@ -480,4 +535,5 @@ func (m *mux) close() {
 		logger.Errorf("%s close tracer failed: %v",
 			rules.superSpec.Name(), err)
 	}
+	m.series.Delete(nil)
 }
@@ -25,13 +25,17 @@ import (
 	"time"
 
 	"github.com/lucas-clemente/quic-go/http3"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 
 	"github.com/megaease/easegress/pkg/graceupdate"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/protocol"
 	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/acme"
 	"github.com/megaease/easegress/pkg/util/httpstat"
 	"github.com/megaease/easegress/pkg/util/limitlistener"
+	"github.com/megaease/easegress/pkg/util/proxyprotocol"
 	"github.com/megaease/easegress/pkg/util/topn"
 )
 
@@ -83,6 +87,8 @@ type (
 		httpStat      *httpstat.HTTPStat
 		topN          *topn.TopN
 		limitListener *limitlistener.LimitListener
+		proxyListener *proxyprotocol.Listener
+		acmeManager   *acme.Manager
 	}
 
 	// Status contains all status generated by runtime, for displaying to users.
@@ -167,6 +173,9 @@ func (r *runtime) reload(nextSuperSpec *supervisor.Spec, muxMapper protocol.MuxM
 	if nextSpec != nil && r.limitListener != nil {
 		r.limitListener.SetMaxConnection(nextSpec.MaxConnections)
 	}
+	if nextSpec != nil && r.proxyListener != nil {
+		r.proxyListener.SetSpec(nextSpec.ProxyProtocol)
+	}
 
 	// NOTE: Due to the mechanism of supervisor,
 	// nextSpec must not be nil, just defensive programming here.
@@ -181,6 +190,7 @@ func (r *runtime) reload(nextSuperSpec *supervisor.Spec, muxMapper protocol.MuxM
 		logger.Errorf("BUG: nextSpec is nil")
 		r.spec = nil
 		r.closeServer()
+		r.closeACMEManager()
 	case r.spec != nil && nextSpec != nil:
 		if r.needRestartServer(nextSpec) {
 			r.spec = nextSpec
@@ -227,6 +237,9 @@ func (r *runtime) needRestartServer(nextSpec *Spec) bool {
 	x.XForwardedFor, y.XForwardedFor = false, false
 	x.Tracing, y.Tracing = nil, nil
 	x.IPFilter, y.IPFilter = nil, nil
+	x.ClientIP, y.ClientIP = nil, nil
+	x.AccessLog, y.AccessLog = nil, nil
+	x.ProxyProtocol, y.ProxyProtocol = nil, nil
 	x.Rules, y.Rules = nil, nil
 
 	// The update of rules need not to shutdown server.
@@ -245,15 +258,50 @@ func (r *runtime) startServer() {
 		}
 	}
 
+	var handler http.Handler = r.mux
+	if r.spec.H2C {
+		// NOTE: h2c handler serves HTTP/1.1 as well,
+		// it upgrades connections with HTTP/2 prior knowledge.
+		handler = h2c.NewHandler(r.mux, &http2.Server{
+			IdleTimeout: keepAliveTimeout,
+		})
+	}
+
+	var acmeManager *acme.Manager
+	if r.spec.ACME != nil {
+		m, err := acme.GetManager(r.spec.ACME, r.superSpec.Super().Cluster())
+		if err != nil {
+			r.setState(stateFailed)
+			r.setError(err)
+			return
+		}
+		acmeManager = m
+	}
+	// NOTE: The new manager is got before closing the old one,
+	// so the same manager keeps running if the ACME spec is unchanged.
+	r.closeACMEManager()
+	r.acmeManager = acmeManager
+
+	if acmeManager != nil {
+		// NOTE: The plain HTTP server answers HTTP-01 challenges,
+		// while the HTTPS one answers TLS-ALPN-01 challenges.
+		if !r.spec.HTTPS {
+			handler = acmeManager.HTTPHandler(handler)
+		}
+	}
+
 	srv := &http.Server{
 		Addr:        fmt.Sprintf(":%d", r.spec.Port),
-		Handler:     r.mux,
+		Handler:     handler,
 		IdleTimeout: keepAliveTimeout,
 	}
 	srv.SetKeepAlivesEnabled(r.spec.KeepAlive)
 
 	if r.spec.HTTPS {
 		tlsConfig, _ := r.spec.tlsConfig()
+		if acmeManager != nil {
+			acmeManager.TLSConfig(tlsConfig)
+		}
 		srv.TLSConfig = tlsConfig
 	}
 
@@ -276,7 +324,13 @@ func (r *runtime) startServer() {
 			return
 		}
 
-		limitListener := limitlistener.NewLimitListener(listener, r.spec.MaxConnections)
+		// NOTE: PROXY protocol headers precede TLS handshakes,
+		// so they are parsed before the TLS listener of ServeTLS.
+		// The listener is always created, so that PROXY protocol
+		// could be enabled or disabled without restarting the server.
+		r.proxyListener = proxyprotocol.NewListener(listener, r.spec.ProxyProtocol)
+
+		limitListener := limitlistener.NewLimitListener(r.proxyListener, r.spec.MaxConnections)
 		r.limitListener = limitListener
 		go r.runHTTP1And2Server(limitListener, r.spec.HTTPS, r.startNum)
 	}
@@ -330,6 +384,13 @@ func (r *runtime) closeServer() {
 	}
 }
 
+func (r *runtime) closeACMEManager() {
+	if r.acmeManager != nil {
+		r.acmeManager.Close()
+		r.acmeManager = nil
+	}
+}
+
 func (r *runtime) checkFailed() {
 	ticker := time.NewTicker(checkFailedTimeout)
 	for range ticker.C {
@@ -363,6 +424,7 @@ func (r *runtime) handleEventReload(e *eventReload) {
 
 func (r *runtime) handleEventClose(e *eventClose) {
 	r.closeServer()
+	r.closeACMEManager()
 	r.mux.close()
 	close(e.done)
 }
@@ -23,15 +23,23 @@ import (
 	"encoding/base64"
 	"fmt"
 	"regexp"
+	"strings"
 
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/certificatestore"
 	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/acme"
+	"github.com/megaease/easegress/pkg/util/clientip"
 	"github.com/megaease/easegress/pkg/util/ipfilter"
+	"github.com/megaease/easegress/pkg/util/proxyprotocol"
+	"github.com/megaease/easegress/pkg/util/routeaction"
 )
 
 type (
 	// Spec describes the HTTPServer.
 	Spec struct {
 		HTTP3            bool          `yaml:"http3" jsonschema:"omitempty"`
+		H2C              bool          `yaml:"h2c" jsonschema:"omitempty"`
 		Port             uint16        `yaml:"port" jsonschema:"required,minimum=1"`
 		KeepAlive        bool          `yaml:"keepAlive" jsonschema:"required"`
 		KeepAliveTimeout string        `yaml:"keepAliveTimeout" jsonschema:"omitempty,format=duration"`
@@ -52,8 +60,23 @@ type (
 		// Keys saved as map, key is domain name, value is secret
 		Keys map[string]string `yaml:"keys" jsonschema:"omitempty"`
 
-		IPFilter *ipfilter.Spec `yaml:"ipFilter,omitempty" jsonschema:"omitempty"`
-		Rules    []*Rule        `yaml:"rules" jsonschema:"omitempty"`
+		// CertificateStore is the name of the CertificateStore to pick
+		// certificates from by SNI, its certs take precedence over the static ones.
+		CertificateStore string `yaml:"certificateStore" jsonschema:"omitempty"`
+
+		// ACME obtains certificates of its domains automatically, the static
+		// certs above are still used for the other domains.
+		ACME *acme.Spec `yaml:"acme,omitempty" jsonschema:"omitempty"`
+
+		// ClientIP resolves the real IP of clients from the headers set by
+		// trusted proxies, it is used by IP filters, canary, load balancing
+		// etc. All forwarding headers are trusted if it is absent.
+		ClientIP *clientip.Spec `yaml:"clientIP,omitempty" jsonschema:"omitempty"`
+
+		IPFilter      *ipfilter.Spec         `yaml:"ipFilter,omitempty" jsonschema:"omitempty"`
+		ProxyProtocol *proxyprotocol.Spec    `yaml:"proxyProtocol,omitempty" jsonschema:"omitempty"`
+		AccessLog     *context.AccessLogSpec `yaml:"accessLog,omitempty" jsonschema:"omitempty"`
+		Rules         []*Rule                `yaml:"rules" jsonschema:"omitempty"`
 	}
 
 	// Rule is first level entry of router.
@@ -77,10 +100,17 @@ type (
 		Path          string         `yaml:"path,omitempty" jsonschema:"omitempty,pattern=^/"`
 		PathPrefix    string         `yaml:"pathPrefix,omitempty" jsonschema:"omitempty,pattern=^/"`
 		PathRegexp    string         `yaml:"pathRegexp,omitempty" jsonschema:"omitempty,format=regexp"`
+		GRPCService   string         `yaml:"grpcService,omitempty" jsonschema:"omitempty"`
+		GRPCMethod    string         `yaml:"grpcMethod,omitempty" jsonschema:"omitempty"`
 		RewriteTarget string         `yaml:"rewriteTarget" jsonschema:"omitempty"`
 		Methods       []string       `yaml:"methods,omitempty" jsonschema:"omitempty,uniqueItems=true,format=httpmethod-array"`
-		Backend       string         `yaml:"backend" jsonschema:"required"`
+		Backend       string         `yaml:"backend" jsonschema:"omitempty"`
 		Headers       []*Header      `yaml:"headers" jsonschema:"omitempty"`
+
+		// Redirect and Response handle the requests in the router
+		// instead of Backend, there must be exactly one of them.
+		Redirect *routeaction.Redirect `yaml:"redirect,omitempty" jsonschema:"omitempty"`
+		Response *routeaction.Response `yaml:"response,omitempty" jsonschema:"omitempty"`
 	}
 
 	// Header is the third level entry of router. A header entry is always under a specific path entry, that is to mean
@@ -101,9 +131,18 @@ func (spec *Spec) Validate() error {
 		return fmt.Errorf("https is disabled when http3 enabled")
 	}
 
+	if spec.H2C && spec.HTTPS {
+		return fmt.Errorf("h2c is for cleartext, it can't work with https")
+	}
+
+	if spec.HTTP3 && spec.ProxyProtocol != nil {
+		return fmt.Errorf("proxyProtocol is for tcp, it can't work with http3")
+	}
+
 	if spec.HTTPS {
-		if spec.CertBase64 == "" && spec.KeyBase64 == "" && len(spec.Certs) == 0 && len(spec.Keys) == 0 {
-			return fmt.Errorf("certBase64/keyBase64, certs/keys are both empty when https enabled")
+		if spec.CertBase64 == "" && spec.KeyBase64 == "" && len(spec.Certs) == 0 && len(spec.Keys) == 0 &&
+			spec.CertificateStore == "" && spec.ACME == nil {
+			return fmt.Errorf("certBase64/keyBase64, certs/keys, certificateStore and acme are all empty when https enabled")
 		}
 		_, err := spec.tlsConfig()
 		if err != nil {
@@ -139,13 +178,16 @@ func (spec *Spec) tlsConfig() (*tls.Config, error) {
 		}
 	}
 
-	if len(certificates) == 0 {
+	if len(certificates) == 0 && spec.CertificateStore == "" && spec.ACME == nil {
 		return nil, fmt.Errorf("none valid certs and secret")
 	}
 
 	tlsConf := &tls.Config{
 		Certificates: certificates,
 	}
+	if spec.CertificateStore != "" {
+		tlsConf.GetCertificate = certificatestore.GetCertificateFunc(spec.CertificateStore, len(certificates) == 0)
+	}
 
 	// if caCertBase64 configuration is provided, should enable tls.ClientAuth and
 	// add the root cert
@@ -161,6 +203,44 @@ func (spec *Spec) tlsConfig() (*tls.Config, error) {
 	return tlsConf, nil
 }
 
+// Validate validates Path.
+func (p *Path) Validate() error {
+	if err := routeaction.Validate(p.Backend, p.Redirect, p.Response); err != nil {
+		return err
+	}
+
+	if p.GRPCService == "" {
+		if p.GRPCMethod != "" {
+			return fmt.Errorf("grpcMethod %s needs grpcService", p.GRPCMethod)
+		}
+		return nil
+	}
+
+	if p.Path != "" || p.PathPrefix != "" || p.PathRegexp != "" {
+		return fmt.Errorf("grpcService can't be used with path, pathPrefix or pathRegexp")
+	}
+
+	if strings.Contains(p.GRPCService, "/") || strings.Contains(p.GRPCMethod, "/") {
+		return fmt.Errorf("grpcService and grpcMethod can't contain '/'")
+	}
+
+	return nil
+}
+
+// grpcPath returns the path and path prefix of gRPC routing,
+// gRPC requests are always in the form of /package.Service/Method.
+func (p *Path) grpcPath() (path, pathPrefix string) {
+	if p.GRPCService == "" {
+		return "", ""
+	}
+
+	if p.GRPCMethod == "" {
+		return "", "/" + p.GRPCService + "/"
+	}
+
+	return "/" + p.GRPCService + "/" + p.GRPCMethod, ""
+}
+
 func (h *Header) initHeaderRoute() {
 	h.headerRE = regexp.MustCompile(h.Regexp)
 }
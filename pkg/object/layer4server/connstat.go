@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package layer4server
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+// maxReportedConnections limits the connections reported in status,
+// the status is synchronized to the cluster periodically so it must be small.
+const maxReportedConnections = 128
+
+type (
+	// connStat records the statistics of all connections.
+	connStat struct {
+		total    uint64
+		rejected uint64
+		failed   uint64
+		bytesIn  uint64
+		bytesOut uint64
+
+		mutex sync.Mutex
+		conns map[*connection]struct{}
+	}
+
+	// connection is the statistics of one proxied connection(or UDP session).
+	connection struct {
+		stat *connStat
+
+		clientAddr   string
+		upstreamAddr string
+		startTime    time.Time
+		bytesIn      uint64
+		bytesOut     uint64
+	}
+
+	// ConnectionStatus is the status of one active connection.
+	ConnectionStatus struct {
+		ClientAddr   string `yaml:"clientAddr"`
+		UpstreamAddr string `yaml:"upstreamAddr"`
+		StartTime    string `yaml:"startTime"`
+		BytesIn      uint64 `yaml:"bytesIn"`
+		BytesOut     uint64 `yaml:"bytesOut"`
+	}
+
+	// ConnStatus is the statistics status of connections.
+	ConnStatus struct {
+		ActiveConnections   int                 `yaml:"activeConnections"`
+		TotalConnections    uint64              `yaml:"totalConnections"`
+		RejectedConnections uint64              `yaml:"rejectedConnections"`
+		FailedConnections   uint64              `yaml:"failedConnections"`
+		BytesIn             uint64              `yaml:"bytesIn"`
+		BytesOut            uint64              `yaml:"bytesOut"`
+		Connections         []*ConnectionStatus `yaml:"connections,omitempty"`
+	}
+)
+
+func newConnStat() *connStat {
+	return &connStat{
+		conns: make(map[*connection]struct{}),
+	}
+}
+
+// reject records a connection rejected by ip filter or connection limit.
+func (cs *connStat) reject() {
+	atomic.AddUint64(&cs.rejected, 1)
+}
+
+// fail records a connection failed to reach the upstream.
+func (cs *connStat) fail() {
+	atomic.AddUint64(&cs.failed, 1)
+}
+
+func (cs *connStat) open(clientAddr, upstreamAddr string) *connection {
+	c := &connection{
+		stat:         cs,
+		clientAddr:   clientAddr,
+		upstreamAddr: upstreamAddr,
+		startTime:    fasttime.Now(),
+	}
+
+	atomic.AddUint64(&cs.total, 1)
+
+	cs.mutex.Lock()
+	cs.conns[c] = struct{}{}
+	cs.mutex.Unlock()
+
+	return c
+}
+
+func (cs *connStat) status() *ConnStatus {
+	s := &ConnStatus{
+		TotalConnections:    atomic.LoadUint64(&cs.total),
+		RejectedConnections: atomic.LoadUint64(&cs.rejected),
+		FailedConnections:   atomic.LoadUint64(&cs.failed),
+		BytesIn:             atomic.LoadUint64(&cs.bytesIn),
+		BytesOut:            atomic.LoadUint64(&cs.bytesOut),
+	}
+
+	cs.mutex.Lock()
+	conns := make([]*connection, 0, len(cs.conns))
+	for c := range cs.conns {
+		conns = append(conns, c)
+	}
+	cs.mutex.Unlock()
+
+	s.ActiveConnections = len(conns)
+
+	// Report the latest connections.
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].startTime.After(conns[j].startTime)
+	})
+	if len(conns) > maxReportedConnections {
+		conns = conns[:maxReportedConnections]
+	}
+
+	for _, c := range conns {
+		s.Connections = append(s.Connections, &ConnectionStatus{
+			ClientAddr:   c.clientAddr,
+			UpstreamAddr: c.upstreamAddr,
+			StartTime:    fasttime.Format(c.startTime, fasttime.RFC3339Milli),
+			BytesIn:      atomic.LoadUint64(&c.bytesIn),
+			BytesOut:     atomic.LoadUint64(&c.bytesOut),
+		})
+	}
+
+	return s
+}
+
+// addBytesIn records bytes from client to upstream.
+func (c *connection) addBytesIn(n int) {
+	atomic.AddUint64(&c.bytesIn, uint64(n))
+	atomic.AddUint64(&c.stat.bytesIn, uint64(n))
+}
+
+// addBytesOut records bytes from upstream to client.
+func (c *connection) addBytesOut(n int) {
+	atomic.AddUint64(&c.bytesOut, uint64(n))
+	atomic.AddUint64(&c.stat.bytesOut, uint64(n))
+}
+
+func (c *connection) close() {
+	c.stat.mutex.Lock()
+	delete(c.stat.conns, c)
+	c.stat.mutex.Unlock()
+}
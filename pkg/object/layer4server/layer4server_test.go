@@ -0,0 +1,392 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package layer4server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/ipfilter"
+	"github.com/megaease/easegress/pkg/util/limitlistener"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newTestConfig(addr string, filter *ipfilter.Spec) *handlerConfig {
+	config := &handlerConfig{
+		pool: &pool{
+			spec:   &PoolSpec{},
+			static: newStaticServers([]*Server{{Addr: addr}}, nil, nil),
+			done:   make(chan struct{}),
+		},
+		connectTimeout: time.Second,
+		idleTimeout:    time.Second,
+	}
+	if filter != nil {
+		config.ipFilter = ipfilter.New(filter)
+	}
+	return config
+}
+
+func startTCPEchoServer(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return l
+}
+
+func TestSpecValidate(t *testing.T) {
+	spec := &Spec{Protocol: ProtocolTCP, Port: 10080}
+	if spec.Validate() == nil {
+		t.Errorf("spec without pool should be invalid")
+	}
+
+	pool := PoolSpec{Servers: []*Server{{Addr: "127.0.0.1"}}}
+	if pool.Validate() == nil {
+		t.Errorf("server address without port should be invalid")
+	}
+
+	pool = PoolSpec{Servers: []*Server{{Addr: "127.0.0.1:80", Weight: 1}, {Addr: "127.0.0.1:81"}}}
+	if pool.Validate() == nil {
+		t.Errorf("partial weights should be invalid")
+	}
+
+	pool = PoolSpec{Servers: []*Server{{Addr: "127.0.0.1:80", Tags: []string{"v1"}}}, ServersTags: []string{"v2"}}
+	if pool.Validate() == nil {
+		t.Errorf("serversTags picking none of servers should be invalid")
+	}
+
+	pool = PoolSpec{Servers: []*Server{{Addr: "127.0.0.1:80"}}}
+	if err := pool.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if d := (&Spec{Protocol: ProtocolUDP}).idleTimeout(); d != defaultUDPIdleTimeout {
+		t.Errorf("udp idle timeout want %v, got %v", defaultUDPIdleTimeout, d)
+	}
+	if d := (&Spec{Protocol: ProtocolTCP}).idleTimeout(); d != 0 {
+		t.Errorf("tcp idle timeout want 0, got %v", d)
+	}
+}
+
+func TestStaticServers(t *testing.T) {
+	servers := []*Server{
+		{Addr: "127.0.0.1:9090", Weight: 1},
+		{Addr: "127.0.0.1:9091", Weight: 2},
+		{Addr: "127.0.0.1:9092", Weight: 3},
+	}
+
+	ss := newStaticServers(servers, nil, nil)
+	for i := 0; i < len(servers); i++ {
+		if ss.next("") != servers[i] {
+			t.Errorf("round robin returns unexpected server")
+		}
+	}
+
+	ss.lb.Policy = PolicyIPHash
+	s := ss.next("192.168.1.1")
+	for i := 0; i < 10; i++ {
+		if ss.next("192.168.1.1") != s {
+			t.Errorf("ip hash returns different servers for the same ip")
+		}
+	}
+
+	ss.lb.Policy = PolicyWeightedRandom
+	for i := 0; i < 10; i++ {
+		if ss.next("") == nil {
+			t.Errorf("weighted random returns nil")
+		}
+	}
+}
+
+func TestTCPProxy(t *testing.T) {
+	echo := startTCPEchoServer(t)
+	defer echo.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer l.Close()
+
+	stat := newConnStat()
+	config := newTestConfig(echo.Addr().String(), nil)
+	go serveTCP(l, func() *handlerConfig { return config }, stat)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+
+	data := []byte("hello layer4")
+	conn.Write(data)
+	buff := make([]byte, len(data))
+	if _, err := io.ReadFull(conn, buff); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !bytes.Equal(buff, data) {
+		t.Errorf("want %s, got %s", data, buff)
+	}
+
+	status := stat.status()
+	if status.ActiveConnections != 1 || status.TotalConnections != 1 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+	if len(status.Connections) != 1 || status.Connections[0].UpstreamAddr != echo.Addr().String() {
+		t.Errorf("unexpected connections: %+v", status.Connections)
+	}
+
+	conn.Close()
+	for i := 0; i < 100 && stat.status().ActiveConnections != 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	status = stat.status()
+	if status.ActiveConnections != 0 {
+		t.Errorf("connection should be released")
+	}
+	if status.BytesIn != uint64(len(data)) || status.BytesOut != uint64(len(data)) {
+		t.Errorf("unexpected bytes: in %d out %d", status.BytesIn, status.BytesOut)
+	}
+}
+
+func TestTCPProxyProtocol(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer upstream.Close()
+
+	headerChan := make(chan string, 1)
+	go func() {
+		conn, err := upstream.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		headerChan <- line
+	}()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer l.Close()
+
+	config := newTestConfig(upstream.Addr().String(), nil)
+	config.pool.spec.ProxyProtocol = "v1"
+	go serveTCP(l, func() *handlerConfig { return config }, newConnStat())
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("hello"))
+
+	client := conn.LocalAddr().(*net.TCPAddr)
+	server := l.Addr().(*net.TCPAddr)
+	want := fmt.Sprintf("PROXY TCP4 127.0.0.1 127.0.0.1 %d %d\r\n", client.Port, server.Port)
+	select {
+	case header := <-headerChan:
+		if header != want {
+			t.Errorf("want header %q, got %q", want, header)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	spec := &Spec{Protocol: ProtocolUDP, Port: 10080, Pool: &PoolSpec{ProxyProtocol: "v2"}}
+	if spec.Validate() == nil {
+		t.Errorf("proxy protocol of udp should be invalid")
+	}
+}
+
+func TestTCPHalfClose(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer upstream.Close()
+
+	// The upstream sends its response and closes its writing side
+	// before the client finishes sending the request.
+	received := make(chan string, 1)
+	go func() {
+		conn, err := upstream.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("response"))
+		conn.(*net.TCPConn).CloseWrite()
+		data, _ := io.ReadAll(conn)
+		received <- string(data)
+	}()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	// Connections accepted by the server are wrapped by the limit listener.
+	l := limitlistener.NewLimitListener(listener, 10)
+	defer l.Close()
+
+	config := newTestConfig(upstream.Addr().String(), nil)
+	go serveTCP(l, func() *handlerConfig { return config }, newConnStat())
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	data, err := io.ReadAll(conn)
+	if err != nil || string(data) != "response" {
+		t.Fatalf("want response, got %q, %v", data, err)
+	}
+
+	conn.Write([]byte("request"))
+	conn.(*net.TCPConn).CloseWrite()
+	select {
+	case data := <-received:
+		if data != "request" {
+			t.Errorf("want request, got %q", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestTCPProxyIPFilter(t *testing.T) {
+	echo := startTCPEchoServer(t)
+	defer echo.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer l.Close()
+
+	stat := newConnStat()
+	config := newTestConfig(echo.Addr().String(), &ipfilter.Spec{
+		BlockIPs: []string{"127.0.0.1"},
+	})
+	go serveTCP(l, func() *handlerConfig { return config }, stat)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("blocked connection should be closed, got %v", err)
+	}
+	if stat.status().RejectedConnections != 1 {
+		t.Errorf("rejected connection is not recorded")
+	}
+}
+
+func TestUDPProxy(t *testing.T) {
+	upstream, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer upstream.Close()
+	go func() {
+		buff := make([]byte, 1024)
+		for {
+			n, addr, err := upstream.ReadFrom(buff)
+			if err != nil {
+				return
+			}
+			upstream.WriteTo(buff[:n], addr)
+		}
+	}()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+
+	stat := newConnStat()
+	config := newTestConfig(upstream.LocalAddr().String(), nil)
+	server := newUDPServer(pc, 1, func() *handlerConfig { return config }, stat)
+	go server.serve()
+	defer server.close()
+
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	data := []byte("hello udp")
+	conn.Write(data)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buff := make([]byte, 1024)
+	n, err := conn.Read(buff)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !bytes.Equal(buff[:n], data) {
+		t.Errorf("want %s, got %s", data, buff[:n])
+	}
+
+	// The second client exceeds the session limit.
+	conn2, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn2.Close()
+	conn2.Write(data)
+	for i := 0; i < 100 && stat.status().RejectedConnections == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	status := stat.status()
+	if status.ActiveConnections != 1 || status.RejectedConnections != 1 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
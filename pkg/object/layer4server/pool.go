@@ -0,0 +1,285 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package layer4server
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/serviceregistry"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/hashtool"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// PolicyRoundRobin is the policy of round-robin.
+	PolicyRoundRobin = "roundRobin"
+	// PolicyRandom is the policy of random.
+	PolicyRandom = "random"
+	// PolicyWeightedRandom is the policy of weighted random.
+	PolicyWeightedRandom = "weightedRandom"
+	// PolicyIPHash is the policy of ip hash.
+	PolicyIPHash = "ipHash"
+)
+
+type (
+	pool struct {
+		spec  *PoolSpec
+		super *supervisor.Supervisor
+
+		mutex           sync.Mutex
+		serviceRegistry *serviceregistry.ServiceRegistry
+		serviceWatcher  serviceregistry.ServiceWatcher
+		static          *staticServers
+		done            chan struct{}
+	}
+
+	staticServers struct {
+		count      uint64
+		weightsSum int
+		servers    []*Server
+		lb         LoadBalance
+	}
+
+	// Server is the upstream server.
+	Server struct {
+		Addr   string   `yaml:"addr" jsonschema:"required"`
+		Tags   []string `yaml:"tags" jsonschema:"omitempty,uniqueItems=true"`
+		Weight int      `yaml:"weight" jsonschema:"omitempty,minimum=0,maximum=100"`
+	}
+
+	// LoadBalance is load balance for multiple servers.
+	LoadBalance struct {
+		Policy string `yaml:"policy" jsonschema:"required,enum=roundRobin,enum=random,enum=weightedRandom,enum=ipHash"`
+	}
+)
+
+func (s *Server) String() string {
+	return fmt.Sprintf("%s,%v,%d", s.Addr, s.Tags, s.Weight)
+}
+
+func newPool(super *supervisor.Supervisor, spec *PoolSpec) *pool {
+	p := &pool{
+		spec:  spec,
+		super: super,
+		done:  make(chan struct{}),
+	}
+
+	p.useStaticServers()
+
+	if spec.ServiceRegistry == "" || spec.ServiceName == "" {
+		return p
+	}
+
+	p.serviceRegistry = p.super.MustGetSystemController(serviceregistry.Kind).
+		Instance().(*serviceregistry.ServiceRegistry)
+
+	p.tryUseService()
+	p.serviceWatcher = p.serviceRegistry.NewServiceWatcher(p.spec.ServiceRegistry, p.spec.ServiceName)
+
+	go p.watchService()
+
+	return p
+}
+
+func (p *pool) watchService() {
+	for {
+		select {
+		case <-p.done:
+			return
+		case event := <-p.serviceWatcher.Watch():
+			p.useService(event.Instances)
+		}
+	}
+}
+
+func (p *pool) tryUseService() {
+	serviceInstanceSpecs, err := p.serviceRegistry.ListServiceInstances(p.spec.ServiceRegistry, p.spec.ServiceName)
+	if err != nil {
+		logger.Warnf("first try to use service %s/%s failed(will try again): %v",
+			p.spec.ServiceRegistry, p.spec.ServiceName, err)
+		p.useStaticServers()
+		return
+	}
+
+	p.useService(serviceInstanceSpecs)
+}
+
+func (p *pool) useService(serviceInstanceSpecs map[string]*serviceregistry.ServiceInstanceSpec) {
+	var servers []*Server
+	for _, instance := range serviceInstanceSpecs {
+		servers = append(servers, &Server{
+			Addr:   net.JoinHostPort(instance.Address, strconv.Itoa(int(instance.Port))),
+			Tags:   instance.Tags,
+			Weight: instance.Weight,
+		})
+	}
+	if len(servers) == 0 {
+		logger.Warnf("%s/%s: empty service instance",
+			p.spec.ServiceRegistry, p.spec.ServiceName)
+		p.useStaticServers()
+		return
+	}
+
+	dynamicServers := newStaticServers(servers, p.spec.ServersTags, p.spec.LoadBalance)
+	if dynamicServers.len() == 0 {
+		logger.Warnf("%s/%s: no service instance satisfy tags: %v",
+			p.spec.ServiceRegistry, p.spec.ServiceName, p.spec.ServersTags)
+		p.useStaticServers()
+		return
+	}
+
+	logger.Infof("use dynamic service: %s/%s", p.spec.ServiceRegistry, p.spec.ServiceName)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.static = dynamicServers
+}
+
+func (p *pool) useStaticServers() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.static = newStaticServers(p.spec.Servers, p.spec.ServersTags, p.spec.LoadBalance)
+}
+
+func (p *pool) snapshot() *staticServers {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.static
+}
+
+// next picks an upstream server for the client ip.
+func (p *pool) next(clientIP string) (*Server, error) {
+	static := p.snapshot()
+
+	if static.len() == 0 {
+		return nil, fmt.Errorf("no server available")
+	}
+
+	return static.next(clientIP), nil
+}
+
+func (p *pool) close() {
+	close(p.done)
+
+	if p.serviceWatcher != nil {
+		p.serviceWatcher.Stop()
+	}
+}
+
+func newStaticServers(servers []*Server, tags []string, lb *LoadBalance) *staticServers {
+	if servers == nil {
+		servers = make([]*Server, 0)
+	}
+
+	ss := &staticServers{}
+	if lb == nil {
+		ss.lb.Policy = PolicyRoundRobin
+	} else {
+		ss.lb = *lb
+	}
+
+	defer ss.prepare()
+
+	if len(tags) == 0 {
+		ss.servers = servers
+		return ss
+	}
+
+	chosenServers := make([]*Server, 0)
+	for _, server := range servers {
+		for _, tag := range tags {
+			if stringtool.StrInSlice(tag, server.Tags) {
+				chosenServers = append(chosenServers, server)
+				break
+			}
+		}
+	}
+	ss.servers = chosenServers
+
+	return ss
+}
+
+func (ss *staticServers) prepare() {
+	for _, server := range ss.servers {
+		ss.weightsSum += server.Weight
+	}
+}
+
+func (ss *staticServers) len() int {
+	return len(ss.servers)
+}
+
+func (ss *staticServers) next(clientIP string) *Server {
+	switch ss.lb.Policy {
+	case PolicyRoundRobin:
+		return ss.roundRobin()
+	case PolicyRandom:
+		return ss.random()
+	case PolicyWeightedRandom:
+		return ss.weightedRandom()
+	case PolicyIPHash:
+		return ss.ipHash(clientIP)
+	}
+
+	logger.Errorf("BUG: unknown load balance policy: %s", ss.lb.Policy)
+
+	return ss.roundRobin()
+}
+
+func (ss *staticServers) roundRobin() *Server {
+	count := atomic.AddUint64(&ss.count, 1)
+	// NOTE: start from 0.
+	count--
+	return ss.servers[int(count)%len(ss.servers)]
+}
+
+func (ss *staticServers) random() *Server {
+	return ss.servers[rand.Intn(len(ss.servers))]
+}
+
+func (ss *staticServers) weightedRandom() *Server {
+	if ss.weightsSum <= 0 {
+		return ss.random()
+	}
+
+	randomWeight := rand.Intn(ss.weightsSum)
+	for _, server := range ss.servers {
+		randomWeight -= server.Weight
+		if randomWeight < 0 {
+			return server
+		}
+	}
+
+	logger.Errorf("BUG: weighted random can't pick a server: sum(%d) servers(%+v)",
+		ss.weightsSum, ss.servers)
+
+	return ss.random()
+}
+
+func (ss *staticServers) ipHash(clientIP string) *Server {
+	sum32 := int(hashtool.Hash32(clientIP))
+	return ss.servers[sum32%len(ss.servers)]
+}
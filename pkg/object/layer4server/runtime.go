@@ -0,0 +1,354 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package layer4server
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/graceupdate"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/ipfilter"
+	"github.com/megaease/easegress/pkg/util/limitlistener"
+)
+
+const (
+	checkFailedTimeout = 10 * time.Second
+
+	stateNil     stateType = "nil"
+	stateFailed  stateType = "failed"
+	stateRunning stateType = "running"
+	stateClosed  stateType = "closed"
+)
+
+var (
+	errNil = fmt.Errorf("")
+	gnet   = graceupdate.Global
+)
+
+type (
+	stateType string
+
+	eventCheckFailed struct{}
+	eventServeFailed struct {
+		startNum uint64
+		err      error
+	}
+	eventReload struct {
+		nextSuperSpec *supervisor.Spec
+	}
+	eventClose struct{ done chan struct{} }
+
+	// handlerConfig is the config used by connection handlers,
+	// it could be changed without restarting the listener.
+	handlerConfig struct {
+		pool           *pool
+		ipFilter       *ipfilter.IPFilter
+		connectTimeout time.Duration
+		idleTimeout    time.Duration
+	}
+
+	runtime struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+		startNum  uint64
+		eventChan chan interface{}
+
+		handlerConfig atomic.Value // *handlerConfig
+
+		tcpListener *limitlistener.LimitListener
+		udpServer   *udpServer
+
+		// status
+		state atomic.Value // stateType
+		err   atomic.Value // error
+
+		connStat *connStat
+	}
+
+	// Status contains all status generated by runtime, for displaying to users.
+	Status struct {
+		Health string `yaml:"health"`
+
+		State stateType `yaml:"state"`
+		Error string    `yaml:"error,omitempty"`
+
+		*ConnStatus
+	}
+)
+
+func newRuntime() *runtime {
+	r := &runtime{
+		eventChan: make(chan interface{}, 10),
+		connStat:  newConnStat(),
+	}
+
+	r.setState(stateNil)
+	r.setError(errNil)
+
+	go r.fsm()
+	go r.checkFailed()
+
+	return r
+}
+
+// Close closes runtime.
+func (r *runtime) Close() {
+	done := make(chan struct{})
+	r.eventChan <- &eventClose{done: done}
+	<-done
+}
+
+// Status returns Layer4Server Status.
+func (r *runtime) Status() *Status {
+	health := r.getError().Error()
+
+	return &Status{
+		Health:     health,
+		State:      r.getState(),
+		Error:      r.getError().Error(),
+		ConnStatus: r.connStat.status(),
+	}
+}
+
+// FSM is the finite-state-machine for the runtime.
+func (r *runtime) fsm() {
+	for e := range r.eventChan {
+		switch e := e.(type) {
+		case *eventCheckFailed:
+			r.handleEventCheckFailed(e)
+		case *eventServeFailed:
+			r.handleEventServeFailed(e)
+		case *eventReload:
+			r.handleEventReload(e)
+		case *eventClose:
+			r.handleEventClose(e)
+			// NOTE: We don't close r.eventChan,
+			// in case of panic of any other goroutines
+			// to send event to it later.
+			return
+		default:
+			logger.Errorf("BUG: unknown event: %T\n", e)
+		}
+	}
+}
+
+func (r *runtime) reload(nextSuperSpec *supervisor.Spec) {
+	r.superSpec = nextSuperSpec
+	nextSpec := nextSuperSpec.ObjectSpec().(*Spec)
+
+	r.reloadHandlerConfig(nextSuperSpec.Super(), nextSpec)
+
+	if r.tcpListener != nil {
+		r.tcpListener.SetMaxConnection(nextSpec.MaxConnections)
+	}
+	if r.udpServer != nil {
+		r.udpServer.setMaxSessions(nextSpec.MaxConnections)
+	}
+
+	switch {
+	case r.spec == nil:
+		r.spec = nextSpec
+		r.startServer()
+	case r.needRestartServer(nextSpec):
+		r.spec = nextSpec
+		r.closeServer()
+		r.startServer()
+	default:
+		r.spec = nextSpec
+	}
+}
+
+func (r *runtime) reloadHandlerConfig(super *supervisor.Supervisor, spec *Spec) {
+	var ipFilter *ipfilter.IPFilter
+	if spec.IPFilter != nil {
+		ipFilter = ipfilter.New(spec.IPFilter)
+	}
+
+	config := &handlerConfig{
+		pool:           newPool(super, spec.Pool),
+		ipFilter:       ipFilter,
+		connectTimeout: spec.connectTimeout(),
+		idleTimeout:    spec.idleTimeout(),
+	}
+
+	oldConfig := r.handlerConfig.Load()
+	r.handlerConfig.Store(config)
+
+	// NOTE: Connections established already keep working with
+	// the upstream they picked, closing the pool only stops
+	// watching the service registry.
+	if oldConfig != nil {
+		oldConfig.(*handlerConfig).pool.close()
+	}
+}
+
+func (r *runtime) getHandlerConfig() *handlerConfig {
+	return r.handlerConfig.Load().(*handlerConfig)
+}
+
+func (r *runtime) setState(state stateType) {
+	r.state.Store(state)
+}
+
+func (r *runtime) getState() stateType {
+	return r.state.Load().(stateType)
+}
+
+func (r *runtime) setError(err error) {
+	if err == nil {
+		r.err.Store(errNil)
+	} else {
+		// NOTE: For type safe.
+		r.err.Store(fmt.Errorf("%v", err))
+	}
+}
+
+func (r *runtime) getError() error {
+	err := r.err.Load()
+	if err == nil {
+		return nil
+	}
+	return err.(error)
+}
+
+func (r *runtime) needRestartServer(nextSpec *Spec) bool {
+	x := *r.spec
+	y := *nextSpec
+
+	// The change of options below need not restart the listener.
+	x.MaxConnections, y.MaxConnections = 0, 0
+	x.ConnectTimeout, y.ConnectTimeout = "", ""
+	x.IdleTimeout, y.IdleTimeout = "", ""
+	x.IPFilter, y.IPFilter = nil, nil
+	x.Pool, y.Pool = nil, nil
+
+	return !reflect.DeepEqual(x, y)
+}
+
+func (r *runtime) startServer() {
+	r.startNum++
+	r.setState(stateRunning)
+	r.setError(nil)
+
+	addr := fmt.Sprintf(":%d", r.spec.Port)
+
+	switch r.spec.Protocol {
+	case ProtocolUDP:
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			r.setState(stateFailed)
+			r.setError(err)
+			return
+		}
+
+		r.udpServer = newUDPServer(conn, r.spec.MaxConnections, r.getHandlerConfig, r.connStat)
+		go r.runUDPServer(r.udpServer, r.startNum)
+	default:
+		listener, err := gnet.Listen("tcp", addr)
+		if err != nil {
+			r.setState(stateFailed)
+			r.setError(err)
+			return
+		}
+
+		r.tcpListener = limitlistener.NewLimitListener(listener, r.spec.MaxConnections)
+		go r.runTCPServer(r.tcpListener, r.startNum)
+	}
+}
+
+func (r *runtime) runTCPServer(listener net.Listener, startNum uint64) {
+	err := serveTCP(listener, r.getHandlerConfig, r.connStat)
+	if err != nil {
+		r.eventChan <- &eventServeFailed{
+			err:      err,
+			startNum: startNum,
+		}
+	}
+}
+
+func (r *runtime) runUDPServer(server *udpServer, startNum uint64) {
+	err := server.serve()
+	if err != nil {
+		r.eventChan <- &eventServeFailed{
+			err:      err,
+			startNum: startNum,
+		}
+	}
+}
+
+func (r *runtime) closeServer() {
+	if r.tcpListener != nil {
+		err := r.tcpListener.Close()
+		if err != nil {
+			logger.Warnf("close tcp listener of %s failed: %v",
+				r.superSpec.Name(), err)
+		}
+		r.tcpListener = nil
+	}
+
+	if r.udpServer != nil {
+		r.udpServer.close()
+		r.udpServer = nil
+	}
+}
+
+func (r *runtime) checkFailed() {
+	ticker := time.NewTicker(checkFailedTimeout)
+	for range ticker.C {
+		state := r.getState()
+		if state == stateFailed {
+			r.eventChan <- &eventCheckFailed{}
+		} else if state == stateClosed {
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+func (r *runtime) handleEventCheckFailed(e *eventCheckFailed) {
+	if r.getState() == stateFailed {
+		r.closeServer()
+		r.startServer()
+	}
+}
+
+func (r *runtime) handleEventServeFailed(e *eventServeFailed) {
+	if r.startNum > e.startNum {
+		return
+	}
+	r.setState(stateFailed)
+	r.setError(e.err)
+}
+
+func (r *runtime) handleEventReload(e *eventReload) {
+	r.reload(e.nextSuperSpec)
+}
+
+func (r *runtime) handleEventClose(e *eventClose) {
+	r.closeServer()
+	if config := r.handlerConfig.Load(); config != nil {
+		config.(*handlerConfig).pool.close()
+	}
+	r.setState(stateClosed)
+	close(e.done)
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package layer4server
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/ipfilter"
+)
+
+const (
+	// ProtocolTCP is the protocol of TCP.
+	ProtocolTCP = "tcp"
+	// ProtocolUDP is the protocol of UDP.
+	ProtocolUDP = "udp"
+
+	defaultConnectTimeout = 5 * time.Second
+	// UDP is connectionless, so a session without any traffic
+	// must be released after a while.
+	defaultUDPIdleTimeout = 60 * time.Second
+)
+
+type (
+	// Spec describes the Layer4Server.
+	Spec struct {
+		Protocol       string         `yaml:"protocol" jsonschema:"required,enum=tcp,enum=udp"`
+		Port           uint16         `yaml:"port" jsonschema:"required,minimum=1"`
+		MaxConnections uint32         `yaml:"maxConnections" jsonschema:"omitempty,minimum=1"`
+		ConnectTimeout string         `yaml:"connectTimeout" jsonschema:"omitempty,format=duration"`
+		IdleTimeout    string         `yaml:"idleTimeout" jsonschema:"omitempty,format=duration"`
+		IPFilter       *ipfilter.Spec `yaml:"ipFilter,omitempty" jsonschema:"omitempty"`
+		Pool           *PoolSpec      `yaml:"pool" jsonschema:"required"`
+	}
+
+	// PoolSpec describes a pool of upstream servers.
+	PoolSpec struct {
+		ServersTags     []string     `yaml:"serversTags" jsonschema:"omitempty,uniqueItems=true"`
+		Servers         []*Server    `yaml:"servers" jsonschema:"omitempty"`
+		ServiceRegistry string       `yaml:"serviceRegistry" jsonschema:"omitempty"`
+		ServiceName     string       `yaml:"serviceName" jsonschema:"omitempty"`
+		LoadBalance     *LoadBalance `yaml:"loadBalance" jsonschema:"required"`
+		// ProxyProtocol is the version of PROXY protocol headers sent to
+		// upstream servers, empty means not to send them.
+		ProxyProtocol string `yaml:"proxyProtocol" jsonschema:"omitempty,enum=,enum=v1,enum=v2"`
+	}
+)
+
+// Validate validates Layer4Server Spec.
+func (spec *Spec) Validate() error {
+	if spec.Pool == nil {
+		return fmt.Errorf("pool is required")
+	}
+
+	if spec.Protocol == ProtocolUDP && spec.Pool.ProxyProtocol != "" {
+		return fmt.Errorf("proxyProtocol of pool is only supported by tcp")
+	}
+
+	return nil
+}
+
+// Validate validates PoolSpec.
+func (s PoolSpec) Validate() error {
+	if s.ServiceName == "" && len(s.Servers) == 0 {
+		return fmt.Errorf("both serviceName and servers are empty")
+	}
+
+	serversGotWeight := 0
+	for _, server := range s.Servers {
+		if _, _, err := net.SplitHostPort(server.Addr); err != nil {
+			return fmt.Errorf("invalid server address %s: %v", server.Addr, err)
+		}
+		if server.Weight > 0 {
+			serversGotWeight++
+		}
+	}
+	if serversGotWeight > 0 && serversGotWeight < len(s.Servers) {
+		return fmt.Errorf("not all servers have weight(%d/%d)",
+			serversGotWeight, len(s.Servers))
+	}
+
+	if s.ServiceName == "" {
+		servers := newStaticServers(s.Servers, s.ServersTags, s.LoadBalance)
+		if servers.len() == 0 {
+			return fmt.Errorf("serversTags picks none of servers")
+		}
+	}
+
+	return nil
+}
+
+func (spec *Spec) connectTimeout() time.Duration {
+	return parseDuration(spec.ConnectTimeout, defaultConnectTimeout)
+}
+
+// idleTimeout returns zero if there is no idle timeout.
+func (spec *Spec) idleTimeout() time.Duration {
+	if spec.Protocol == ProtocolUDP {
+		return parseDuration(spec.IdleTimeout, defaultUDPIdleTimeout)
+	}
+	return parseDuration(spec.IdleTimeout, 0)
+}
+
+func parseDuration(s string, defaultValue time.Duration) time.Duration {
+	if s == "" {
+		return defaultValue
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		logger.Errorf("BUG: parse duration %s failed: %v", s, err)
+		return defaultValue
+	}
+
+	return d
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package layer4server
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/proxyprotocol"
+)
+
+var copyBuffSize = 8 * os.Getpagesize()
+
+// serveTCP accepts connections until the listener is closed,
+// it returns nil if the listener is closed on purpose.
+func serveTCP(listener net.Listener, getConfig func() *handlerConfig, stat *connStat) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Temporary() {
+				logger.Warnf("accept tcp connection failed: %v", err)
+				continue
+			}
+
+			return err
+		}
+
+		go handleTCPConn(conn, getConfig(), stat)
+	}
+}
+
+func handleTCPConn(conn net.Conn, config *handlerConfig, stat *connStat) {
+	clientAddr := conn.RemoteAddr().String()
+	clientIP := hostOfAddr(clientAddr)
+
+	if config.ipFilter != nil && !config.ipFilter.Allow(clientIP) {
+		logger.Debugf("tcp connection from %s is not allowed", clientAddr)
+		stat.reject()
+		conn.Close()
+		return
+	}
+
+	server, err := config.pool.next(clientIP)
+	if err != nil {
+		logger.Warnf("pick upstream for %s failed: %v", clientAddr, err)
+		stat.fail()
+		conn.Close()
+		return
+	}
+
+	upstream, err := net.DialTimeout("tcp", server.Addr, config.connectTimeout)
+	if err != nil {
+		logger.Warnf("connect upstream %s for %s failed: %v", server.Addr, clientAddr, err)
+		stat.fail()
+		conn.Close()
+		return
+	}
+
+	if version := config.pool.spec.ProxyProtocol; version != "" {
+		err = proxyprotocol.WriteHeader(upstream, version, conn.RemoteAddr(), conn.LocalAddr())
+		if err != nil {
+			logger.Warnf("send PROXY protocol header to upstream %s for %s failed: %v", server.Addr, clientAddr, err)
+			stat.fail()
+			conn.Close()
+			upstream.Close()
+			return
+		}
+	}
+
+	c := stat.open(clientAddr, server.Addr)
+	defer c.close()
+
+	idle := newIdleChecker(config.idleTimeout)
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		copyConn(upstream, conn, idle, c.addBytesIn)
+	}()
+	go func() {
+		defer wg.Done()
+		copyConn(conn, upstream, idle, c.addBytesOut)
+	}()
+	wg.Wait()
+
+	conn.Close()
+	upstream.Close()
+}
+
+// idleChecker is shared by both directions of a connection,
+// the connection is idle only if there's no traffic in either direction.
+type idleChecker struct {
+	timeout    time.Duration
+	lastActive int64 // unix nano
+}
+
+func newIdleChecker(timeout time.Duration) *idleChecker {
+	return &idleChecker{
+		timeout:    timeout,
+		lastActive: time.Now().UnixNano(),
+	}
+}
+
+func (ic *idleChecker) active() {
+	atomic.StoreInt64(&ic.lastActive, time.Now().UnixNano())
+}
+
+// deadline returns zero time if there's no idle timeout.
+func (ic *idleChecker) deadline() time.Time {
+	if ic.timeout <= 0 {
+		return time.Time{}
+	}
+	lastActive := atomic.LoadInt64(&ic.lastActive)
+	return time.Unix(0, lastActive).Add(ic.timeout)
+}
+
+func (ic *idleChecker) expired() bool {
+	return ic.timeout > 0 && time.Now().After(ic.deadline())
+}
+
+// copyConn copies data from src to dst until EOF or an error happens.
+// It half-closes dst when finished, so the peer could get EOF
+// but the opposite direction keeps working.
+func copyConn(dst, src net.Conn, idle *idleChecker, onCopy func(n int)) {
+	buff := make([]byte, copyBuffSize)
+
+	for {
+		src.SetReadDeadline(idle.deadline())
+
+		n, err := src.Read(buff)
+		if n > 0 {
+			idle.active()
+			if _, werr := dst.Write(buff[:n]); werr != nil {
+				// Stop the opposite direction as well.
+				src.Close()
+				dst.Close()
+				return
+			}
+			onCopy(n)
+		}
+
+		if err == nil {
+			continue
+		}
+
+		// The opposite direction may be still active.
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() && !idle.expired() {
+			continue
+		}
+
+		if err != io.EOF {
+			// Idle timeout or broken connection, stop both directions.
+			src.Close()
+			dst.Close()
+			return
+		}
+
+		break
+	}
+
+	if cw, ok := dst.(interface{ CloseWrite() error }); !ok || cw.CloseWrite() != nil {
+		dst.Close()
+	}
+}
+
+func hostOfAddr(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -0,0 +1,234 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package layer4server
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+// maxUDPPacketSize is the max payload size of a UDP packet.
+const maxUDPPacketSize = 65507
+
+type (
+	// udpServer proxies UDP packets, every client address owns
+	// a session which has its dedicated upstream socket.
+	udpServer struct {
+		conn        net.PacketConn
+		getConfig   func() *handlerConfig
+		stat        *connStat
+		maxSessions int64
+
+		mutex    sync.Mutex
+		sessions map[string]*udpSession
+		closed   bool
+	}
+
+	udpSession struct {
+		server     *udpServer
+		clientAddr net.Addr
+		upstream   net.Conn
+		idle       *idleChecker
+		conn       *connection
+		closeOnce  sync.Once
+	}
+)
+
+func newUDPServer(conn net.PacketConn, maxSessions uint32,
+	getConfig func() *handlerConfig, stat *connStat) *udpServer {
+	return &udpServer{
+		conn:        conn,
+		getConfig:   getConfig,
+		stat:        stat,
+		maxSessions: int64(maxSessions),
+		sessions:    make(map[string]*udpSession),
+	}
+}
+
+// setMaxSessions sets the max sessions, zero means no limit.
+func (s *udpServer) setMaxSessions(n uint32) {
+	atomic.StoreInt64(&s.maxSessions, int64(n))
+}
+
+// serve reads packets until the server is closed,
+// it returns nil if the server is closed on purpose.
+func (s *udpServer) serve() error {
+	buff := make([]byte, maxUDPPacketSize)
+
+	for {
+		n, clientAddr, err := s.conn.ReadFrom(buff)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Temporary() {
+				logger.Warnf("read udp packet failed: %v", err)
+				continue
+			}
+
+			return err
+		}
+
+		session := s.getSession(clientAddr)
+		if session == nil {
+			continue
+		}
+
+		session.idle.active()
+		if _, err := session.upstream.Write(buff[:n]); err != nil {
+			logger.Warnf("write udp packet to upstream %s failed: %v",
+				session.conn.upstreamAddr, err)
+			session.close()
+			continue
+		}
+		session.conn.addBytesIn(n)
+	}
+}
+
+// getSession returns nil if the packet should be dropped.
+func (s *udpServer) getSession(clientAddr net.Addr) *udpSession {
+	key := clientAddr.String()
+
+	s.mutex.Lock()
+	session, exists := s.sessions[key]
+	s.mutex.Unlock()
+	if exists {
+		return session
+	}
+
+	config := s.getConfig()
+	clientIP := hostOfAddr(key)
+
+	if config.ipFilter != nil && !config.ipFilter.Allow(clientIP) {
+		logger.Debugf("udp packet from %s is not allowed", key)
+		s.stat.reject()
+		return nil
+	}
+
+	maxSessions := atomic.LoadInt64(&s.maxSessions)
+	s.mutex.Lock()
+	full := maxSessions > 0 && int64(len(s.sessions)) >= maxSessions
+	s.mutex.Unlock()
+	if full {
+		logger.Debugf("udp sessions reach the limit %d, drop packet from %s", maxSessions, key)
+		s.stat.reject()
+		return nil
+	}
+
+	server, err := config.pool.next(clientIP)
+	if err != nil {
+		logger.Warnf("pick upstream for %s failed: %v", key, err)
+		s.stat.fail()
+		return nil
+	}
+
+	upstream, err := net.DialTimeout("udp", server.Addr, config.connectTimeout)
+	if err != nil {
+		logger.Warnf("connect upstream %s for %s failed: %v", server.Addr, key, err)
+		s.stat.fail()
+		return nil
+	}
+
+	session = &udpSession{
+		server:     s,
+		clientAddr: clientAddr,
+		upstream:   upstream,
+		idle:       newIdleChecker(config.idleTimeout),
+		conn:       s.stat.open(key, server.Addr),
+	}
+
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		session.close()
+		return nil
+	}
+	s.sessions[key] = session
+	s.mutex.Unlock()
+
+	go session.serveUpstream()
+
+	return session
+}
+
+func (s *udpServer) removeSession(session *udpSession) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := session.clientAddr.String()
+	if s.sessions[key] == session {
+		delete(s.sessions, key)
+	}
+}
+
+func (s *udpServer) close() {
+	err := s.conn.Close()
+	if err != nil {
+		logger.Warnf("close udp listener failed: %v", err)
+	}
+
+	s.mutex.Lock()
+	s.closed = true
+	sessions := s.sessions
+	s.sessions = make(map[string]*udpSession)
+	s.mutex.Unlock()
+
+	for _, session := range sessions {
+		session.close()
+	}
+}
+
+// serveUpstream sends packets from upstream back to the client.
+func (us *udpSession) serveUpstream() {
+	defer us.close()
+
+	buff := make([]byte, maxUDPPacketSize)
+	for {
+		us.upstream.SetReadDeadline(us.idle.deadline())
+
+		n, err := us.upstream.Read(buff)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && !us.idle.expired() {
+				continue
+			}
+			return
+		}
+
+		us.idle.active()
+		if _, err := us.server.conn.WriteTo(buff[:n], us.clientAddr); err != nil {
+			logger.Warnf("write udp packet to client %s failed: %v", us.clientAddr, err)
+			return
+		}
+		us.conn.addBytesOut(n)
+	}
+}
+
+func (us *udpSession) close() {
+	us.closeOnce.Do(func() {
+		us.upstream.Close()
+		us.conn.close()
+		us.server.removeSession(us)
+	})
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logshipper
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	httpFormatNDJSON = "ndjson"
+	httpFormatJSON   = "json"
+)
+
+type httpWriter struct {
+	spec   *HTTPSpec
+	member string
+	client *http.Client
+}
+
+func newHTTPWriter(spec *HTTPSpec, member string) *httpWriter {
+	return &httpWriter{
+		spec:   spec,
+		member: member,
+		client: &http.Client{Timeout: parseDuration(spec.Timeout, defaultSinkTimeout)},
+	}
+}
+
+func (w *httpWriter) body(entries []*logger.Entry) ([]byte, string) {
+	buff := bytes.NewBuffer(nil)
+
+	if w.spec.Format == httpFormatJSON {
+		buff.WriteByte('[')
+		for i, entry := range entries {
+			if i != 0 {
+				buff.WriteByte(',')
+			}
+			buff.Write(marshalJSONEntry(entry, w.member))
+		}
+		buff.WriteByte(']')
+		return buff.Bytes(), "application/json"
+	}
+
+	for _, entry := range entries {
+		buff.Write(marshalJSONEntry(entry, w.member))
+		buff.WriteByte('\n')
+	}
+	return buff.Bytes(), "application/x-ndjson"
+}
+
+func (w *httpWriter) write(entries []*logger.Entry) error {
+	body, contentType := w.body(entries)
+
+	req, err := http.NewRequest(http.MethodPost, w.spec.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range w.spec.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s responded status code %d", w.spec.URL, resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (w *httpWriter) close() {
+	w.client.CloseIdleConnections()
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logshipper
+
+import (
+	"fmt"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+type kafkaWriter struct {
+	spec   *KafkaSpec
+	member string
+
+	producer sarama.SyncProducer
+}
+
+func newKafkaWriter(spec *KafkaSpec, member string) *kafkaWriter {
+	return &kafkaWriter{
+		spec:   spec,
+		member: member,
+	}
+}
+
+func (w *kafkaWriter) write(entries []*logger.Entry) error {
+	// NOTE: The producer is created lazily, so that the sink
+	// could recover after the brokers become available.
+	if w.producer == nil {
+		config := sarama.NewConfig()
+		config.ClientID = w.member
+		config.Version = sarama.V0_10_2_0
+		config.Producer.Return.Successes = true
+		config.Producer.Timeout = defaultSinkTimeout
+
+		producer, err := sarama.NewSyncProducer(w.spec.Brokers, config)
+		if err != nil {
+			return fmt.Errorf("start sarama producer failed(brokers: %v): %v", w.spec.Brokers, err)
+		}
+		w.producer = producer
+	}
+
+	msgs := make([]*sarama.ProducerMessage, 0, len(entries))
+	for _, entry := range entries {
+		msgs = append(msgs, &sarama.ProducerMessage{
+			Topic: w.spec.Topic,
+			Value: sarama.ByteEncoder(marshalJSONEntry(entry, w.member)),
+		})
+	}
+
+	err := w.producer.SendMessages(msgs)
+	if err != nil {
+		return fmt.Errorf("send messages to kafka failed: %v", err)
+	}
+
+	return nil
+}
+
+func (w *kafkaWriter) close() {
+	if w.producer != nil {
+		w.producer.Close()
+	}
+}
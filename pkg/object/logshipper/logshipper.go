@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logshipper
+
+import (
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Category is the category of LogShipper.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of LogShipper.
+	Kind = "LogShipper"
+)
+
+func init() {
+	supervisor.Register(&LogShipper{})
+}
+
+type (
+	// LogShipper ships the logs of the member to external sinks.
+	LogShipper struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		sinks []*sink
+	}
+
+	// Status is the status of LogShipper.
+	Status struct {
+		Sinks map[string]*SinkStatus `yaml:"sinks"`
+	}
+)
+
+// Category returns the category of LogShipper.
+func (ls *LogShipper) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of LogShipper.
+func (ls *LogShipper) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of LogShipper.
+func (ls *LogShipper) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Init initializes LogShipper.
+func (ls *LogShipper) Init(superSpec *supervisor.Spec) {
+	ls.superSpec, ls.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	ls.reload()
+}
+
+// Inherit inherits previous generation of LogShipper.
+func (ls *LogShipper) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	previousGeneration.Close()
+	ls.Init(superSpec)
+}
+
+func (ls *LogShipper) reload() {
+	member := ""
+	if super := ls.superSpec.Super(); super != nil {
+		member = super.Options().Name
+	}
+
+	sinks := make([]logger.Sink, 0, len(ls.spec.Sinks))
+	for _, spec := range ls.spec.Sinks {
+		var writer sinkWriter
+		switch spec.Kind {
+		case sinkKindSyslog:
+			writer = newSyslogWriter(spec.Syslog, member)
+		case sinkKindKafka:
+			writer = newKafkaWriter(spec.Kafka, member)
+		case sinkKindHTTP:
+			writer = newHTTPWriter(spec.HTTP, member)
+		default:
+			logger.Errorf("BUG: %s: unknown sink kind %s", ls.superSpec.Name(), spec.Kind)
+			continue
+		}
+
+		s := newSink(spec, writer)
+		ls.sinks = append(ls.sinks, s)
+		sinks = append(sinks, s)
+	}
+
+	logger.SetSinks(ls.superSpec.Name(), sinks)
+}
+
+// Status returns the status of LogShipper.
+func (ls *LogShipper) Status() *supervisor.Status {
+	s := &Status{
+		Sinks: map[string]*SinkStatus{},
+	}
+	for _, sink := range ls.sinks {
+		s.Sinks[sink.spec.Name] = sink.status()
+	}
+
+	return &supervisor.Status{
+		ObjectStatus: s,
+	}
+}
+
+// Close closes LogShipper.
+func (ls *LogShipper) Close() {
+	// NOTE: Remove the sinks from logger first, so that nothing
+	// would be written into them after closing.
+	logger.RemoveSinks(ls.superSpec.Name())
+
+	for _, s := range ls.sinks {
+		s.close()
+	}
+}
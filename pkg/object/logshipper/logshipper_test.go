@@ -0,0 +1,262 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logshipper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+type mockWriter struct {
+	mutex   sync.Mutex
+	entries []*logger.Entry
+	block   chan struct{}
+	err     error
+}
+
+func (w *mockWriter) write(entries []*logger.Entry) error {
+	if w.block != nil {
+		<-w.block
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.entries = append(w.entries, entries...)
+	return w.err
+}
+
+func (w *mockWriter) close() {}
+
+func (w *mockWriter) messages() []string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	msgs := []string{}
+	for _, e := range w.entries {
+		msgs = append(msgs, e.Message)
+	}
+	return msgs
+}
+
+func newEntry(msg string) *logger.Entry {
+	return &logger.Entry{
+		Log:     logger.LogAccess,
+		Level:   zapcore.InfoLevel,
+		Time:    time.Date(2021, 9, 1, 8, 30, 0, 123000000, time.UTC),
+		Message: msg,
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	cases := []struct {
+		spec  *SinkSpec
+		valid bool
+	}{
+		{&SinkSpec{Name: "a", Kind: sinkKindSyslog, Syslog: &SyslogSpec{Network: "udp", Address: "127.0.0.1:514"}}, true},
+		{&SinkSpec{Name: "a", Kind: sinkKindSyslog, Syslog: &SyslogSpec{Network: "udp", Address: "127.0.0.1:514", Facility: "local9"}}, false},
+		{&SinkSpec{Name: "a", Kind: sinkKindSyslog, HTTP: &HTTPSpec{URL: "http://127.0.0.1"}}, false},
+		{&SinkSpec{Name: "a", Kind: sinkKindHTTP, HTTP: &HTTPSpec{URL: "http://127.0.0.1"}, Kafka: &KafkaSpec{}}, false},
+		{&SinkSpec{Name: "a", Kind: sinkKindHTTP, HTTP: &HTTPSpec{URL: "http://127.0.0.1"}, Logs: []string{"access", "unknown"}}, false},
+		{&SinkSpec{Name: "a", Kind: sinkKindHTTP, HTTP: &HTTPSpec{URL: "http://127.0.0.1"}, BlockTimeout: "1s"}, false},
+		{&SinkSpec{Name: "a", Kind: sinkKindHTTP, HTTP: &HTTPSpec{URL: "http://127.0.0.1"}, BlockTimeout: "1s", DropPolicy: dropPolicyBlock}, true},
+	}
+
+	for i, c := range cases {
+		err := c.spec.Validate()
+		if c.valid && err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+
+	spec := &Spec{Sinks: []*SinkSpec{{Name: "a"}, {Name: "a"}}}
+	if spec.Validate() == nil {
+		t.Errorf("expected error of duplicated sinks")
+	}
+}
+
+func TestSinkEnabled(t *testing.T) {
+	s := newSink(&SinkSpec{Logs: []string{logger.LogAccess}, Level: "WARN"}, &mockWriter{})
+	defer s.close()
+
+	if s.Enabled(logger.LogAccess, zapcore.InfoLevel) {
+		t.Errorf("info level should be disabled")
+	}
+	if !s.Enabled(logger.LogAccess, zapcore.ErrorLevel) {
+		t.Errorf("error level of access log should be enabled")
+	}
+	if s.Enabled(logger.LogSystem, zapcore.ErrorLevel) {
+		t.Errorf("system log should be disabled")
+	}
+}
+
+func TestSinkDropPolicies(t *testing.T) {
+	for _, policy := range []string{dropPolicyDropNewest, dropPolicyDropOldest, dropPolicyBlock} {
+		// The first entry blocks the writer, the next two fill
+		// the buffer, and the last one is dropped by the policy.
+		w := &mockWriter{block: make(chan struct{})}
+		s := newSink(&SinkSpec{
+			BufferSize:   2,
+			BatchSize:    1,
+			DropPolicy:   policy,
+			BlockTimeout: "10ms",
+		}, w)
+
+		s.Write(newEntry("0"))
+		for len(s.entries) != 0 {
+			time.Sleep(time.Millisecond)
+		}
+		for i := 1; i <= 3; i++ {
+			s.Write(newEntry(fmt.Sprint(i)))
+		}
+
+		close(w.block)
+		s.close()
+
+		expected := "0,1,2"
+		if policy == dropPolicyDropOldest {
+			expected = "0,2,3"
+		}
+		if got := strings.Join(w.messages(), ","); got != expected {
+			t.Errorf("policy %s: expected %s, got %s", policy, expected, got)
+		}
+
+		status := s.status()
+		if status.Sent != 3 || status.Dropped != 1 {
+			t.Errorf("policy %s: unexpected status %+v", policy, status)
+		}
+	}
+}
+
+func TestSinkWriteFailed(t *testing.T) {
+	w := &mockWriter{err: fmt.Errorf("broken")}
+	s := newSink(&SinkSpec{BatchSize: 2}, w)
+	s.Write(newEntry("0"))
+	s.Write(newEntry("1"))
+	s.Write(newEntry("2"))
+	s.close()
+
+	status := s.status()
+	if status.Failed != 3 || status.Sent != 0 || status.LastError != "broken" {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestSyslogWriter(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w := newSyslogWriter(&SyslogSpec{
+		Network:  "udp",
+		Address:  conn.LocalAddr().String(),
+		Facility: "local1",
+	}, "member-1")
+	defer w.close()
+
+	entry := newEntry("hello")
+	entry.Level = zapcore.WarnLevel
+	if err := w.write([]*logger.Entry{entry}); err != nil {
+		t.Fatal(err)
+	}
+
+	buff := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// local1(17) * 8 + warning(4) = 140
+	re := regexp.MustCompile(`^<140>1 2021-09-01T08:30:00.123Z member-1 easegress \d+ access - hello$`)
+	if got := string(buff[:n]); !re.MatchString(got) {
+		t.Errorf("unexpected message: %s", got)
+	}
+}
+
+func TestHTTPWriter(t *testing.T) {
+	var body, contentType, auth string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buff, _ := io.ReadAll(r.Body)
+		body, contentType, auth = string(buff), r.Header.Get("Content-Type"), r.Header.Get("Authorization")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	spec := &HTTPSpec{
+		URL:     server.URL,
+		Headers: map[string]string{"Authorization": "Bearer token"},
+	}
+	w := newHTTPWriter(spec, "member-1")
+	defer w.close()
+
+	entries := []*logger.Entry{newEntry("a"), newEntry("b")}
+	if err := w.write(entries); err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/x-ndjson" || auth != "Bearer token" {
+		t.Errorf("unexpected headers: %s, %s", contentType, auth)
+	}
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %s", body)
+	}
+	e := &jsonEntry{}
+	if err := json.Unmarshal([]byte(lines[1]), e); err != nil {
+		t.Fatal(err)
+	}
+	expected := jsonEntry{Time: "2021-09-01T08:30:00.123Z", Level: "info", Log: "access", Member: "member-1", Message: "b"}
+	if *e != expected {
+		t.Errorf("expected %+v, got %+v", expected, *e)
+	}
+
+	spec.Format = httpFormatJSON
+	if err := w.write(entries); err != nil {
+		t.Fatal(err)
+	}
+	arr := []*jsonEntry{}
+	if err := json.Unmarshal([]byte(body), &arr); err != nil || len(arr) != 2 {
+		t.Errorf("unexpected body %s: %v", body, err)
+	}
+
+	status = http.StatusServiceUnavailable
+	if w.write(entries) == nil {
+		t.Errorf("expected error of status code %d", status)
+	}
+}
@@ -0,0 +1,230 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logshipper
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+type (
+	// sinkWriter writes the entries to the destination of the sink.
+	// NOTE: It must not log by the logger in case of being fed back.
+	sinkWriter interface {
+		write(entries []*logger.Entry) error
+		close()
+	}
+
+	// sink buffers the entries, and writes them in batches.
+	sink struct {
+		spec   *SinkSpec
+		writer sinkWriter
+
+		logs  map[string]struct{}
+		level zapcore.Level
+
+		entries chan *logger.Entry
+		done    chan struct{}
+		wg      sync.WaitGroup
+
+		sent    uint64
+		dropped uint64
+		failed  uint64
+
+		lastErr atomic.Value // string
+	}
+
+	// SinkStatus is the status of a sink.
+	SinkStatus struct {
+		Sent      uint64 `yaml:"sent"`
+		Dropped   uint64 `yaml:"dropped"`
+		Failed    uint64 `yaml:"failed"`
+		Buffered  int    `yaml:"buffered"`
+		LastError string `yaml:"lastError,omitempty"`
+	}
+
+	// jsonEntry is the entry in JSON sent by kafka and http sinks.
+	jsonEntry struct {
+		Time    string `json:"time"`
+		Level   string `json:"level"`
+		Log     string `json:"log"`
+		Member  string `json:"member"`
+		Message string `json:"message"`
+	}
+)
+
+func newSink(spec *SinkSpec, writer sinkWriter) *sink {
+	s := &sink{
+		spec:    spec,
+		writer:  writer,
+		logs:    map[string]struct{}{},
+		level:   spec.level(),
+		entries: make(chan *logger.Entry, spec.bufferSize()),
+		done:    make(chan struct{}),
+	}
+	s.lastErr.Store("")
+
+	for _, log := range spec.Logs {
+		s.logs[log] = struct{}{}
+	}
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s
+}
+
+// Enabled implements logger.Sink.
+func (s *sink) Enabled(log string, level zapcore.Level) bool {
+	if level < s.level {
+		return false
+	}
+	if len(s.logs) == 0 {
+		return true
+	}
+	_, exists := s.logs[log]
+	return exists
+}
+
+// Write implements logger.Sink.
+func (s *sink) Write(entry *logger.Entry) {
+	select {
+	case s.entries <- entry:
+		return
+	default:
+	}
+
+	switch s.spec.dropPolicy() {
+	case dropPolicyDropOldest:
+		for {
+			select {
+			case s.entries <- entry:
+				return
+			default:
+			}
+			select {
+			case <-s.entries:
+				atomic.AddUint64(&s.dropped, 1)
+			default:
+			}
+		}
+	case dropPolicyBlock:
+		timer := time.NewTimer(s.spec.blockTimeout())
+		defer timer.Stop()
+		select {
+		case s.entries <- entry:
+		case <-timer.C:
+			atomic.AddUint64(&s.dropped, 1)
+		case <-s.done:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+func (s *sink) run() {
+	defer s.wg.Done()
+
+	batchSize := s.spec.batchSize()
+	batch := make([]*logger.Entry, 0, batchSize)
+	ticker := time.NewTicker(s.spec.flushInterval())
+	defer ticker.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		err := s.writer.write(batch)
+		if err != nil {
+			atomic.AddUint64(&s.failed, uint64(len(batch)))
+			s.lastErr.Store(err.Error())
+		} else {
+			atomic.AddUint64(&s.sent, uint64(len(batch)))
+			s.lastErr.Store("")
+		}
+
+		batch = make([]*logger.Entry, 0, batchSize)
+	}
+
+	for {
+		select {
+		case <-s.done:
+			// Flush the buffered entries as many as possible.
+			for {
+				select {
+				case entry := <-s.entries:
+					batch = append(batch, entry)
+					if len(batch) >= batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		case entry := <-s.entries:
+			batch = append(batch, entry)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (s *sink) status() *SinkStatus {
+	return &SinkStatus{
+		Sent:      atomic.LoadUint64(&s.sent),
+		Dropped:   atomic.LoadUint64(&s.dropped),
+		Failed:    atomic.LoadUint64(&s.failed),
+		Buffered:  len(s.entries),
+		LastError: s.lastErr.Load().(string),
+	}
+}
+
+func (s *sink) close() {
+	close(s.done)
+	s.wg.Wait()
+	s.writer.close()
+}
+
+func marshalJSONEntry(entry *logger.Entry, member string) []byte {
+	buff, err := json.Marshal(&jsonEntry{
+		Time:    fasttime.Format(entry.Time, fasttime.RFC3339Milli),
+		Level:   entry.Level.String(),
+		Log:     entry.Log,
+		Member:  member,
+		Message: entry.Message,
+	})
+	if err != nil {
+		// NOTE: It's impossible for the struct of strings.
+		panic(fmt.Errorf("marshal %#v to json failed: %v", entry, err))
+	}
+	return buff
+}
@@ -0,0 +1,216 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logshipper
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	sinkKindSyslog = "syslog"
+	sinkKindKafka  = "kafka"
+	sinkKindHTTP   = "http"
+
+	// dropPolicyDropNewest drops the new entries if the buffer is full.
+	dropPolicyDropNewest = "dropNewest"
+	// dropPolicyDropOldest drops the oldest entries in the buffer
+	// to make room for the new ones.
+	dropPolicyDropOldest = "dropOldest"
+	// dropPolicyBlock blocks the logging until there is room in the
+	// buffer or the block timeout, after which the entry is dropped.
+	dropPolicyBlock = "block"
+
+	defaultBufferSize    = 1024
+	defaultBatchSize     = 100
+	defaultFlushInterval = time.Second
+	defaultBlockTimeout  = 100 * time.Millisecond
+	defaultSinkTimeout   = 10 * time.Second
+)
+
+type (
+	// Spec describes the LogShipper.
+	Spec struct {
+		Sinks []*SinkSpec `yaml:"sinks" jsonschema:"required,minItems=1"`
+	}
+
+	// SinkSpec describes a sink of logs.
+	SinkSpec struct {
+		Name string `yaml:"name" jsonschema:"required"`
+		Kind string `yaml:"kind" jsonschema:"required,enum=syslog,enum=kafka,enum=http"`
+		// Logs are the names of logs sent to the sink, empty means all.
+		Logs  []string `yaml:"logs" jsonschema:"omitempty,uniqueItems=true"`
+		Level string   `yaml:"level" jsonschema:"omitempty,enum=,enum=DEBUG,enum=INFO,enum=WARN,enum=ERROR"`
+
+		BufferSize    int    `yaml:"bufferSize" jsonschema:"omitempty,minimum=1"`
+		BatchSize     int    `yaml:"batchSize" jsonschema:"omitempty,minimum=1"`
+		FlushInterval string `yaml:"flushInterval" jsonschema:"omitempty,format=duration"`
+		DropPolicy    string `yaml:"dropPolicy" jsonschema:"omitempty,enum=,enum=dropNewest,enum=dropOldest,enum=block"`
+		BlockTimeout  string `yaml:"blockTimeout" jsonschema:"omitempty,format=duration"`
+
+		Syslog *SyslogSpec `yaml:"syslog,omitempty" jsonschema:"omitempty"`
+		Kafka  *KafkaSpec  `yaml:"kafka,omitempty" jsonschema:"omitempty"`
+		HTTP   *HTTPSpec   `yaml:"http,omitempty" jsonschema:"omitempty"`
+	}
+
+	// SyslogSpec describes the syslog sink, the messages are in RFC5424.
+	SyslogSpec struct {
+		Network  string `yaml:"network" jsonschema:"required,enum=udp,enum=tcp"`
+		Address  string `yaml:"address" jsonschema:"required,format=hostport"`
+		Facility string `yaml:"facility" jsonschema:"omitempty"`
+		AppName  string `yaml:"appName" jsonschema:"omitempty"`
+	}
+
+	// KafkaSpec describes the kafka sink.
+	KafkaSpec struct {
+		Brokers []string `yaml:"brokers" jsonschema:"required,uniqueItems=true"`
+		Topic   string   `yaml:"topic" jsonschema:"required"`
+	}
+
+	// HTTPSpec describes the HTTP bulk sink.
+	HTTPSpec struct {
+		URL     string            `yaml:"url" jsonschema:"required,format=url"`
+		Headers map[string]string `yaml:"headers" jsonschema:"omitempty"`
+		Timeout string            `yaml:"timeout" jsonschema:"omitempty,format=duration"`
+		// Format is the format of the body, ndjson is one entry in JSON
+		// per line, and json is an array of entries.
+		Format string `yaml:"format" jsonschema:"omitempty,enum=,enum=ndjson,enum=json"`
+	}
+)
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	names := map[string]struct{}{}
+	for _, s := range spec.Sinks {
+		if _, exists := names[s.Name]; exists {
+			return fmt.Errorf("sink %s is duplicated", s.Name)
+		}
+		names[s.Name] = struct{}{}
+	}
+
+	return nil
+}
+
+// Validate validates SinkSpec.
+func (spec *SinkSpec) Validate() error {
+	for _, log := range spec.Logs {
+		found := false
+		for _, l := range logger.Logs {
+			if log == l {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown log %s, available logs are %v", log, logger.Logs)
+		}
+	}
+
+	configs := 0
+	for _, config := range []bool{spec.Syslog != nil, spec.Kafka != nil, spec.HTTP != nil} {
+		if config {
+			configs++
+		}
+	}
+	if configs != 1 {
+		return fmt.Errorf("exactly one of syslog, kafka and http should be specified")
+	}
+
+	switch spec.Kind {
+	case sinkKindSyslog:
+		if spec.Syslog == nil {
+			return fmt.Errorf("syslog is required by kind %s", spec.Kind)
+		}
+		if spec.Syslog.Facility != "" {
+			if _, exists := syslogFacilities[spec.Syslog.Facility]; !exists {
+				return fmt.Errorf("unknown syslog facility %s", spec.Syslog.Facility)
+			}
+		}
+	case sinkKindKafka:
+		if spec.Kafka == nil {
+			return fmt.Errorf("kafka is required by kind %s", spec.Kind)
+		}
+	case sinkKindHTTP:
+		if spec.HTTP == nil {
+			return fmt.Errorf("http is required by kind %s", spec.Kind)
+		}
+	}
+
+	if spec.BlockTimeout != "" && spec.DropPolicy != dropPolicyBlock {
+		return fmt.Errorf("blockTimeout only works with dropPolicy %s", dropPolicyBlock)
+	}
+
+	return nil
+}
+
+func (spec *SinkSpec) level() zapcore.Level {
+	level := zapcore.InfoLevel
+	if spec.Level != "" {
+		level.UnmarshalText([]byte(spec.Level))
+	}
+	return level
+}
+
+func (spec *SinkSpec) bufferSize() int {
+	if spec.BufferSize == 0 {
+		return defaultBufferSize
+	}
+	return spec.BufferSize
+}
+
+func (spec *SinkSpec) batchSize() int {
+	if spec.BatchSize == 0 {
+		return defaultBatchSize
+	}
+	return spec.BatchSize
+}
+
+func parseDuration(s string, defaultValue time.Duration) time.Duration {
+	if s == "" {
+		return defaultValue
+	}
+	// NOTE: It has been validated by format=duration.
+	d, _ := time.ParseDuration(s)
+	return d
+}
+
+func (spec *SinkSpec) flushInterval() time.Duration {
+	return parseDuration(spec.FlushInterval, defaultFlushInterval)
+}
+
+func (spec *SinkSpec) blockTimeout() time.Duration {
+	return parseDuration(spec.BlockTimeout, defaultBlockTimeout)
+}
+
+func (spec *SinkSpec) dropPolicy() string {
+	if spec.DropPolicy == "" {
+		return dropPolicyDropNewest
+	}
+	return spec.DropPolicy
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logshipper
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	defaultSyslogFacility = "local0"
+	defaultSyslogAppName  = "easegress"
+)
+
+type syslogWriter struct {
+	spec     *SyslogSpec
+	hostname string
+	facility int
+	appName  string
+	procID   string
+
+	conn net.Conn
+}
+
+func newSyslogWriter(spec *SyslogSpec, hostname string) *syslogWriter {
+	w := &syslogWriter{
+		spec:     spec,
+		hostname: hostname,
+		facility: syslogFacilities[defaultSyslogFacility],
+		appName:  defaultSyslogAppName,
+		procID:   strconv.Itoa(os.Getpid()),
+	}
+	if spec.Facility != "" {
+		w.facility = syslogFacilities[spec.Facility]
+	}
+	if spec.AppName != "" {
+		w.appName = spec.AppName
+	}
+	return w
+}
+
+// syslogSeverity maps the level to the severity of syslog.
+func syslogSeverity(level zapcore.Level) int {
+	switch level {
+	case zapcore.DebugLevel:
+		return 7 // debug
+	case zapcore.InfoLevel:
+		return 6 // informational
+	case zapcore.WarnLevel:
+		return 4 // warning
+	case zapcore.ErrorLevel:
+		return 3 // error
+	case zapcore.DPanicLevel, zapcore.PanicLevel:
+		return 2 // critical
+	default:
+		return 0 // emergency
+	}
+}
+
+// format formats the entry in RFC5424:
+// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func (w *syslogWriter) format(entry *logger.Entry) []byte {
+	return []byte(fmt.Sprintf("<%d>1 %s %s %s %s %s - %s",
+		w.facility*8+syslogSeverity(entry.Level),
+		entry.Time.UTC().Format(time.RFC3339Nano),
+		w.hostname, w.appName, w.procID, entry.Log, entry.Message))
+}
+
+func (w *syslogWriter) write(entries []*logger.Entry) error {
+	if w.conn == nil {
+		conn, err := net.DialTimeout(w.spec.Network, w.spec.Address, defaultSinkTimeout)
+		if err != nil {
+			return fmt.Errorf("dial %s %s failed: %v", w.spec.Network, w.spec.Address, err)
+		}
+		w.conn = conn
+	}
+
+	w.conn.SetWriteDeadline(time.Now().Add(defaultSinkTimeout))
+
+	var err error
+	if w.spec.Network == "udp" {
+		// One message per datagram.
+		for _, entry := range entries {
+			if _, err = w.conn.Write(w.format(entry)); err != nil {
+				break
+			}
+		}
+	} else {
+		// Octet counting framing of RFC6587.
+		buff := bytes.NewBuffer(nil)
+		for _, entry := range entries {
+			msg := w.format(entry)
+			buff.WriteString(strconv.Itoa(len(msg)))
+			buff.WriteByte(' ')
+			buff.Write(msg)
+		}
+		_, err = w.conn.Write(buff.Bytes())
+	}
+
+	if err != nil {
+		w.conn.Close()
+		w.conn = nil
+		return fmt.Errorf("write to %s %s failed: %v", w.spec.Network, w.spec.Address, err)
+	}
+
+	return nil
+}
+
+func (w *syslogWriter) close() {
+	if w.conn != nil {
+		w.conn.Close()
+	}
+}
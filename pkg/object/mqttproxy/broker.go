@@ -32,6 +32,8 @@ import (
 	"github.com/eclipse/paho.mqtt.golang/packets"
 	"github.com/megaease/easegress/pkg/api"
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/prometheushelper"
+	"github.com/megaease/easegress/pkg/util/proxyprotocol"
 )
 
 type (
@@ -51,6 +53,8 @@ type (
 		sessMgr   *SessionManager
 		topicMgr  *TopicManager
 		memberURL func(string, string) ([]string, error)
+		// memberClient sends the messages to the other members.
+		memberClient *http.Client
 
 		// done is the channel for shutdowning this proxy.
 		done chan struct{}
@@ -66,21 +70,25 @@ type (
 	}
 )
 
+var connectionsGauge = prometheushelper.NewGauge("mqttproxy", "connections",
+	"The number of clients connected to the MQTT proxy.", []string{"mqtt_proxy"})
+
 func sha256Sum(data []byte) string {
 	sha256Bytes := sha256.Sum256(data)
 	return hex.EncodeToString(sha256Bytes[:])
 }
 
-func newBroker(spec *Spec, store storage, memberURL func(string, string) ([]string, error)) *Broker {
+func newBroker(spec *Spec, store storage, memberURL func(string, string) ([]string, error), memberClient *http.Client) *Broker {
 	broker := &Broker{
-		egName:     spec.EGName,
-		name:       spec.Name,
-		spec:       spec,
-		backend:    newBackendMQ(spec),
-		clients:    make(map[string]*Client),
-		sha256Auth: make(map[string]string),
-		memberURL:  memberURL,
-		done:       make(chan struct{}),
+		egName:       spec.EGName,
+		name:         spec.Name,
+		spec:         spec,
+		backend:      newBackendMQ(spec),
+		clients:      make(map[string]*Client),
+		sha256Auth:   make(map[string]string),
+		memberURL:    memberURL,
+		memberClient: memberClient,
+		done:         make(chan struct{}),
 	}
 
 	for _, a := range spec.Auth {
@@ -112,28 +120,29 @@ func newBroker(spec *Spec, store storage, memberURL func(string, string) ([]stri
 }
 
 func (b *Broker) setListener() error {
-	var l net.Listener
-	var err error
 	var cfg *tls.Config
 	addr := fmt.Sprintf(":%d", b.spec.Port)
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("gen mqtt tcp listener with addr %s failed: %v", addr, err)
+	}
+
+	// NOTE: PROXY protocol headers precede TLS handshakes.
+	if b.spec.ProxyProtocol != nil {
+		l = proxyprotocol.NewListener(l, b.spec.ProxyProtocol)
+	}
+
 	if b.spec.UseTLS {
 		cfg, err = b.spec.tlsConfig()
 		if err != nil {
+			l.Close()
 			return fmt.Errorf("invalid tls config for mqtt proxy: %v", err)
 		}
-		l, err = tls.Listen("tcp", addr, cfg)
-		if err != nil {
-			return fmt.Errorf("gen mqtt tls tcp listener with addr %v and cfg %v failed: %v", addr, cfg, err)
-		}
-	} else {
-		l, err = net.Listen("tcp", addr)
-		if err != nil {
-			return fmt.Errorf("gen mqtt tcp listener with addr %s failed: %v", addr, err)
-		}
+		l = tls.NewListener(l, cfg)
 	}
 	b.tlsCfg = cfg
 	b.listener = l
-	return err
+	return nil
 }
 
 func (b *Broker) run() {
@@ -206,6 +215,7 @@ func (b *Broker) handleConn(conn net.Conn) {
 	}
 	b.clients[client.info.cid] = client
 	b.setSession(client, connect)
+	connectionsGauge.WithLabelValues(b.name).Set(float64(len(b.clients)))
 	b.Unlock()
 
 	client.session.updateEGName(b.egName, b.name)
@@ -251,7 +261,7 @@ func (b *Broker) requestTransfer(egName, name string, data HTTPJsonData) {
 			logger.Errorf("make new request failed: %v", err)
 			continue
 		}
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := b.memberClient.Do(req)
 		if err != nil {
 			logger.Errorf("http client send msg failed:%v", err)
 		} else {
@@ -296,6 +306,7 @@ func (b *Broker) removeClient(clientID string) {
 	if val, ok := b.clients[clientID]; ok {
 		if val.disconnected() {
 			delete(b.clients, clientID)
+			connectionsGauge.WithLabelValues(b.name).Set(float64(len(b.clients)))
 		}
 	}
 	b.Unlock()
@@ -362,4 +373,5 @@ func (b *Broker) close() {
 		go v.closeAndDelSession()
 	}
 	b.clients = nil
+	connectionsGauge.DeleteLabelValues(b.name)
 }
@@ -46,6 +46,9 @@ func (m *mockCluster) GetRaw(key string) (*mvccpb.KeyValue, error) { return nil,
 func (m *mockCluster) GetRawPrefix(prefix string) (map[string]*mvccpb.KeyValue, error) {
 	return nil, nil
 }
+func (m *mockCluster) GetRawPrefixWithRevision(prefix string) (map[string]*mvccpb.KeyValue, int64, error) {
+	return nil, 0, nil
+}
 func (m *mockCluster) PutUnderLease(key, value string) error                      { return nil }
 func (m *mockCluster) PutAndDelete(map[string]*string) error                      { return nil }
 func (m *mockCluster) PutAndDeleteUnderLease(map[string]*string) error            { return nil }
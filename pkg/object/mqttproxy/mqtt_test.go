@@ -27,6 +27,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"strconv"
 	"sync"
@@ -35,7 +36,10 @@ import (
 
 	paho "github.com/eclipse/paho.mqtt.golang"
 	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
 	"gopkg.in/yaml.v2"
 )
 
@@ -92,7 +96,7 @@ func getBroker(name, userName, passBase64 string, port uint16) *Broker {
 			}
 		}
 		return urls, nil
-	})
+	}, http.DefaultClient)
 	return broker
 }
 
@@ -1054,7 +1058,7 @@ func TestHTTPTransfer(t *testing.T) {
 			}
 		}
 		return urls, nil
-	})
+	}, http.DefaultClient)
 	srv1 := newServer(":8889")
 	srv1.addHandlerFunc("/mqtt", broker1.topicsPublishHandler)
 	srv1.start()
@@ -1389,7 +1393,7 @@ func TestBrokerListen(t *testing.T) {
 	store := newStorage(nil)
 	broker := newBroker(spec, store, func(s, ss string) ([]string, error) {
 		return nil, nil
-	})
+	}, http.DefaultClient)
 	if broker != nil {
 		t.Errorf("invalid tls config should return nil broker")
 	}
@@ -1410,7 +1414,7 @@ func TestBrokerListen(t *testing.T) {
 	}
 	broker = newBroker(spec, store, func(s, ss string) ([]string, error) {
 		return nil, nil
-	})
+	}, http.DefaultClient)
 
 	if broker == nil {
 		t.Errorf("valid tls config should not return nil broker")
@@ -1418,7 +1422,7 @@ func TestBrokerListen(t *testing.T) {
 
 	broker1 := newBroker(spec, store, func(s, ss string) ([]string, error) {
 		return nil, nil
-	})
+	}, http.DefaultClient)
 	if broker1 != nil {
 		t.Errorf("not valid port should return nil broker")
 	}
@@ -1435,7 +1439,7 @@ func TestBrokerListen(t *testing.T) {
 	}
 	broker2 := newBroker(spec, store, func(s, ss string) ([]string, error) {
 		return nil, nil
-	})
+	}, http.DefaultClient)
 	if broker2 != nil {
 		t.Errorf("not valid port should return nil broker")
 	}
@@ -1479,3 +1483,33 @@ func TestMQTTProxy(t *testing.T) {
 	mp.broker = broker
 	mp.Close()
 }
+
+func TestRequestTransferCredential(t *testing.T) {
+	cls := clustertest.New(nil)
+
+	authorizations := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations <- r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	memberClient, err := api.NewMemberClient(&option.Options{}, cls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &Broker{
+		memberURL: func(egName, name string) ([]string, error) {
+			return []string{srv.URL + "/mqtt"}, nil
+		},
+		memberClient: memberClient,
+	}
+	b.requestTransfer("eg-1", "mqtt", HTTPJsonData{Topic: "a", Payload: "b"})
+
+	token, exists := cls.KVs()[cls.Layout().MemberToken()]
+	if !exists || token == "" {
+		t.Fatalf("member token is not created")
+	}
+	if authorization := <-authorizations; authorization != "Bearer "+token {
+		t.Errorf("expected the member token, got %q", authorization)
+	}
+}
@@ -21,7 +21,9 @@ import (
 	"fmt"
 	"net"
 	"net/url"
+	"strings"
 
+	"github.com/megaease/easegress/pkg/api"
 	"github.com/megaease/easegress/pkg/cluster"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/supervisor"
@@ -115,6 +117,9 @@ func memberURLFunc(superSpec *supervisor.Spec) func(string, string) ([]string, e
 				if err != nil {
 					return nil, fmt.Errorf("get url for %v failed: %v", memberStatus.Options.Name, err)
 				}
+				if memberStatus.Options.APICertFile != "" {
+					newURL = strings.Replace(newURL, "http://", "https://", 1)
+				}
 				urls = append(urls, newURL+"/apis/v1"+fmt.Sprintf(mqttAPIPrefix, name))
 			}
 		}
@@ -132,7 +137,12 @@ func (mp *MQTTProxy) Init(superSpec *supervisor.Spec) {
 	mp.superSpec, mp.spec = superSpec, spec
 
 	store := newStorage(superSpec.Super().Cluster())
-	mp.broker = newBroker(spec, store, memberURLFunc(superSpec))
+	memberClient, err := api.NewMemberClient(superSpec.Super().Options(), superSpec.Super().Cluster())
+	if err != nil {
+		logger.Errorf("create member client failed: %v", err)
+		return
+	}
+	mp.broker = newBroker(spec, store, memberURLFunc(superSpec), memberClient)
 	if mp.broker != nil {
 		mp.broker.registerAPIs()
 	}
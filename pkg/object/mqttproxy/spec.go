@@ -20,6 +20,9 @@ package mqttproxy
 import (
 	"crypto/tls"
 	"fmt"
+
+	"github.com/megaease/easegress/pkg/object/certificatestore"
+	"github.com/megaease/easegress/pkg/util/proxyprotocol"
 )
 
 const (
@@ -41,6 +44,12 @@ type (
 		UseTLS         bool          `yaml:"useTLS" jsonschema:"omitempty"`
 		Certificate    []Certificate `yaml:"certificate" jsonschema:"omitempty"`
 		TopicCacheSize int           `yaml:"topicCacheSize" jsonschema:"omitempty"`
+
+		// CertificateStore is the name of the CertificateStore to pick
+		// certificates from by SNI.
+		CertificateStore string `yaml:"certificateStore" jsonschema:"omitempty"`
+
+		ProxyProtocol *proxyprotocol.Spec `yaml:"proxyProtocol,omitempty" jsonschema:"omitempty"`
 	}
 
 	// Certificate describes TLS certifications.
@@ -97,11 +106,16 @@ func (spec *Spec) tlsConfig() (*tls.Config, error) {
 		}
 		certificates = append(certificates, cert)
 	}
-	if len(certificates) == 0 {
+	if len(certificates) == 0 && spec.CertificateStore == "" {
 		return nil, fmt.Errorf("none valid certs and secret")
 	}
 
-	return &tls.Config{Certificates: certificates}, nil
+	cfg := &tls.Config{Certificates: certificates}
+	if spec.CertificateStore != "" {
+		cfg.GetCertificate = certificatestore.GetCertificateFunc(spec.CertificateStore, len(certificates) == 0)
+	}
+
+	return cfg, nil
 }
 
 func sessionStoreKey(clientID string) string {
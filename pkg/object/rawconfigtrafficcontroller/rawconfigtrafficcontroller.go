@@ -23,6 +23,7 @@ import (
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
 	"github.com/megaease/easegress/pkg/object/httpserver"
+	"github.com/megaease/easegress/pkg/object/layer4server"
 	"github.com/megaease/easegress/pkg/object/trafficcontroller"
 	"github.com/megaease/easegress/pkg/protocol"
 	"github.com/megaease/easegress/pkg/supervisor"
@@ -141,6 +142,8 @@ func (rctc *RawConfigTrafficController) handleEvent(event *supervisor.ObjectEnti
 		switch kind {
 		case httpserver.Kind:
 			err = rctc.tc.DeleteHTTPServer(DefaultNamespace, name)
+		case layer4server.Kind:
+			err = rctc.tc.DeleteLayer4Server(DefaultNamespace, name)
 		case httppipeline.Kind:
 			err = rctc.tc.DeleteHTTPPipeline(DefaultNamespace, name)
 		default:
@@ -159,6 +162,8 @@ func (rctc *RawConfigTrafficController) handleEvent(event *supervisor.ObjectEnti
 		switch kind {
 		case httpserver.Kind:
 			_, err = rctc.tc.CreateHTTPServer(DefaultNamespace, entity)
+		case layer4server.Kind:
+			_, err = rctc.tc.CreateLayer4Server(DefaultNamespace, entity)
 		case httppipeline.Kind:
 			_, err = rctc.tc.CreateHTTPPipeline(DefaultNamespace, entity)
 		default:
@@ -177,6 +182,8 @@ func (rctc *RawConfigTrafficController) handleEvent(event *supervisor.ObjectEnti
 		switch kind {
 		case httpserver.Kind:
 			_, err = rctc.tc.UpdateHTTPServer(DefaultNamespace, entity)
+		case layer4server.Kind:
+			_, err = rctc.tc.UpdateLayer4Server(DefaultNamespace, entity)
 		case httppipeline.Kind:
 			_, err = rctc.tc.UpdateHTTPPipeline(DefaultNamespace, entity)
 		default:
@@ -195,6 +202,7 @@ func (rctc *RawConfigTrafficController) Status() *supervisor.Status {
 		Namespace:     rctc.namespace,
 		HTTPServers:   make(map[string]*trafficcontroller.HTTPServerStatus),
 		HTTPPipelines: make(map[string]*trafficcontroller.HTTPPipelineStatus),
+		Layer4Servers: make(map[string]*trafficcontroller.Layer4ServerStatus),
 	}
 
 	rctc.tc.WalkHTTPServers(rctc.namespace, func(entity *supervisor.ObjectEntity) bool {
@@ -205,6 +213,14 @@ func (rctc *RawConfigTrafficController) Status() *supervisor.Status {
 		return true
 	})
 
+	rctc.tc.WalkLayer4Servers(rctc.namespace, func(entity *supervisor.ObjectEntity) bool {
+		status.Layer4Servers[entity.Spec().Name()] = &trafficcontroller.Layer4ServerStatus{
+			Spec:   entity.Spec().RawSpec(),
+			Status: entity.Instance().Status().ObjectStatus.(*layer4server.Status),
+		}
+		return true
+	})
+
 	rctc.tc.WalkHTTPPipelines(rctc.namespace, func(entity *supervisor.ObjectEntity) bool {
 		status.HTTPPipelines[entity.Spec().Name()] = &trafficcontroller.HTTPPipelineStatus{
 			Spec:   entity.Spec().RawSpec(),
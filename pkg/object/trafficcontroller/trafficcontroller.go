@@ -25,6 +25,7 @@ import (
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
 	"github.com/megaease/easegress/pkg/object/httpserver"
+	"github.com/megaease/easegress/pkg/object/layer4server"
 	"github.com/megaease/easegress/pkg/protocol"
 	"github.com/megaease/easegress/pkg/supervisor"
 )
@@ -59,6 +60,7 @@ type (
 		// types of both: map[string]*supervisor.ObjectEntity
 		httpservers   sync.Map
 		httppipelines sync.Map
+		layer4servers sync.Map
 	}
 
 	// WalkFunc is the type of the function called for
@@ -80,6 +82,12 @@ type (
 		Status *httpserver.Status     `yaml:"status"`
 	}
 
+	// Layer4ServerStatus is the layer4 server status
+	Layer4ServerStatus struct {
+		Spec   map[string]interface{} `yaml:"spec"`
+		Status *layer4server.Status   `yaml:"status"`
+	}
+
 	// HTTPPipelineStatus is the HTTP pipeline status
 	HTTPPipelineStatus struct {
 		Spec   map[string]interface{} `yaml:"spec"`
@@ -92,6 +100,7 @@ type (
 		Namespace     string                         `yaml:"namespace"`
 		HTTPServers   map[string]*HTTPServerStatus   `yaml:"httpServers"`
 		HTTPPipelines map[string]*HTTPPipelineStatus `yaml:"httpPipelines"`
+		Layer4Servers map[string]*Layer4ServerStatus `yaml:"layer4Servers,omitempty"`
 	}
 )
 
@@ -387,6 +396,143 @@ func (tc *TrafficController) WalkHTTPPipelines(namespace string, walkFn WalkFunc
 	})
 }
 
+// CreateLayer4Server creates layer4 server
+func (tc *TrafficController) CreateLayer4Server(namespace string, entity *supervisor.ObjectEntity) (
+	*supervisor.ObjectEntity, error) {
+
+	if namespace == "" {
+		return nil, fmt.Errorf("empty namespace")
+	}
+
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+
+	space, exists := tc.namespaces[namespace]
+	if !exists {
+		space = newNamespace(namespace)
+		tc.namespaces[namespace] = space
+		logger.Infof("create namespace %s", namespace)
+	}
+
+	name := entity.Spec().Name()
+
+	entity.InitWithRecovery(space)
+	space.layer4servers.Store(name, entity)
+
+	logger.Infof("create layer4 server %s/%s", namespace, name)
+
+	return entity, nil
+}
+
+// UpdateLayer4Server updates layer4 server
+func (tc *TrafficController) UpdateLayer4Server(namespace string, entity *supervisor.ObjectEntity) (
+	*supervisor.ObjectEntity, error) {
+
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+
+	space, exists := tc.namespaces[namespace]
+	if !exists {
+		return nil, fmt.Errorf("namespace %s not found", namespace)
+	}
+
+	name := entity.Spec().Name()
+
+	previousEntity, exists := space.layer4servers.Load(name)
+	if !exists {
+		return nil, fmt.Errorf("layer4 server %s/%s not found", namespace, name)
+	}
+
+	entity.InheritWithRecovery(previousEntity.(*supervisor.ObjectEntity), space)
+	space.layer4servers.Store(name, entity)
+
+	logger.Infof("update layer4 server %s/%s", namespace, name)
+
+	return entity, nil
+}
+
+// DeleteLayer4Server deletes a layer4 server
+func (tc *TrafficController) DeleteLayer4Server(namespace, name string) error {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+
+	space, exists := tc.namespaces[namespace]
+	if !exists {
+		return fmt.Errorf("namespace %s not found", namespace)
+	}
+
+	entity, exists := space.layer4servers.LoadAndDelete(name)
+	if !exists {
+		return fmt.Errorf("layer4 server %s/%s not found", namespace, name)
+	}
+
+	entity.(*supervisor.ObjectEntity).CloseWithRecovery()
+	logger.Infof("delete layer4 server %s/%s", namespace, name)
+
+	tc._cleanSpace(namespace)
+
+	return nil
+}
+
+// GetLayer4Server gets layer4 server by its namespace and name
+func (tc *TrafficController) GetLayer4Server(namespace, name string) (*supervisor.ObjectEntity, bool) {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+
+	space, exists := tc.namespaces[namespace]
+	if !exists {
+		return nil, false
+	}
+
+	entity, exists := space.layer4servers.Load(name)
+	if !exists {
+		return nil, false
+	}
+
+	return entity.(*supervisor.ObjectEntity), exists
+}
+
+// ListLayer4Servers lists the layer4 servers
+func (tc *TrafficController) ListLayer4Servers(namespace string) []*supervisor.ObjectEntity {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+
+	space, exists := tc.namespaces[namespace]
+	if !exists {
+		return nil
+	}
+
+	entities := []*supervisor.ObjectEntity{}
+	space.layer4servers.Range(func(k, v interface{}) bool {
+		entities = append(entities, v.(*supervisor.ObjectEntity))
+		return true
+	})
+
+	return entities
+}
+
+// WalkLayer4Servers walks layer4 servers
+func (tc *TrafficController) WalkLayer4Servers(namespace string, walkFn WalkFunc) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Errorf("walkLayer4Servers recover from err: %v, stack trace:\n%s\n",
+				err, debug.Stack())
+		}
+	}()
+
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+
+	space, exists := tc.namespaces[namespace]
+	if !exists {
+		return
+	}
+
+	space.layer4servers.Range(func(k, v interface{}) bool {
+		return walkFn(v.(*supervisor.ObjectEntity))
+	})
+}
+
 // CreateHTTPPipelineForSpec creates a HTTP pipeline by a spec
 func (tc *TrafficController) CreateHTTPPipelineForSpec(namespace string, superSpec *supervisor.Spec) (
 	*supervisor.ObjectEntity, error) {
@@ -594,6 +740,13 @@ func (tc *TrafficController) Clean(namespace string) error {
 		return true
 	})
 
+	space.layer4servers.Range(func(k, v interface{}) bool {
+		v.(*supervisor.ObjectEntity).CloseWithRecovery()
+		logger.Infof("delete layer4 server %s/%s", namespace, k)
+		space.layer4servers.Delete(k)
+		return true
+	})
+
 	space.httppipelines.Range(func(k, v interface{}) bool {
 		v.(*supervisor.ObjectEntity).CloseWithRecovery()
 		logger.Infof("delete http pipeline %s/%s", namespace, k)
@@ -606,7 +759,7 @@ func (tc *TrafficController) Clean(namespace string) error {
 	return nil
 }
 
-// _cleanSpace must be called after deleting HTTPServer or HTTPPipeline.
+// _cleanSpace must be called after deleting HTTPServer, Layer4Server or HTTPPipeline.
 // It's caller's duty to keep concurrent safety.
 func (tc *TrafficController) _cleanSpace(namespace string) {
 	space, exists := tc.namespaces[namespace]
@@ -619,6 +772,10 @@ func (tc *TrafficController) _cleanSpace(namespace string) {
 		serverLen++
 		return false
 	})
+	space.layer4servers.Range(func(k, v interface{}) bool {
+		serverLen++
+		return false
+	})
 	space.httppipelines.Range(func(k, v interface{}) bool {
 		pipelineLen++
 		return false
@@ -653,6 +810,19 @@ func (tc *TrafficController) Status() *supervisor.Status {
 			return true
 		})
 
+		layer4Servers := make(map[string]*Layer4ServerStatus)
+		namespaceSpec.layer4servers.Range(func(key, value interface{}) bool {
+			k := key.(string)
+			v := value.(*supervisor.ObjectEntity)
+
+			layer4Servers[k] = &Layer4ServerStatus{
+				Spec:   v.Spec().RawSpec(),
+				Status: v.Instance().Status().ObjectStatus.(*layer4server.Status),
+			}
+
+			return true
+		})
+
 		httpPipelines := make(map[string]*HTTPPipelineStatus)
 		namespaceSpec.httppipelines.Range(func(key, value interface{}) bool {
 			k := key.(string)
@@ -670,6 +840,7 @@ func (tc *TrafficController) Status() *supervisor.Status {
 			Namespace:     namespace,
 			HTTPServers:   httpServers,
 			HTTPPipelines: httpPipelines,
+			Layer4Servers: layer4Servers,
 		})
 	}
 
@@ -693,6 +864,13 @@ func (tc *TrafficController) Close() {
 			return true
 		})
 
+		space.layer4servers.Range(func(k, v interface{}) bool {
+			entity := v.(*supervisor.ObjectEntity)
+			entity.CloseWithRecovery()
+			logger.Infof("delete layer4 server %s/%s", space.namespace, k)
+			return true
+		})
+
 		space.httppipelines.Range(func(k, v interface{}) bool {
 			entity := v.(*supervisor.ObjectEntity)
 			entity.CloseWithRecovery()
@@ -31,6 +31,7 @@ import (
 
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/proxyprotocol"
 )
 
 var (
@@ -156,17 +157,32 @@ func (p *Proxy) run() {
 		Handler: nil,
 	}
 
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		logger.Errorf("%s websocketserver listen on %s failed: %v", p.superSpec.Name(), addr, err)
+		return
+	}
+	if spec.ProxyProtocol != nil {
+		listener = proxyprotocol.NewListener(listener, spec.ProxyProtocol)
+	}
+
 	if spec.HTTPS {
 		tlsConfig, err := spec.tlsConfig()
 		if err != nil {
 			logger.Errorf("%s gen websocketserver's httpserver tlsConfig: %#v, failed: %v",
 				p.superSpec.Name(), spec, err)
+			listener.Close()
+			return
 		}
 		svr.TLSConfig = tlsConfig
+		if err := svr.ServeTLS(listener, "", ""); err != nil {
+			logger.Errorf("%s websocketserver ServeTLS failed: %v", p.superSpec.Name(), err)
+		}
+		return
 	}
 
-	if err := svr.ListenAndServe(); err != nil {
-		logger.Errorf("%s websocketserver ListenAndServe failed: %v", p.superSpec.Name(), err)
+	if err := svr.Serve(listener); err != nil {
+		logger.Errorf("%s websocketserver Serve failed: %v", p.superSpec.Name(), err)
 	}
 }
 
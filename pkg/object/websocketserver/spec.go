@@ -23,6 +23,9 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+
+	"github.com/megaease/easegress/pkg/object/certificatestore"
+	"github.com/megaease/easegress/pkg/util/proxyprotocol"
 )
 
 type (
@@ -35,8 +38,14 @@ type (
 		CertBase64 string `yaml:"certBase64" jsonschema:"omitempty,format=base64"`
 		KeyBase64  string `yaml:"keyBase64" jsonschema:"omitempty,format=base64"`
 
+		// CertificateStore is the name of the CertificateStore to pick
+		// certificates from by SNI.
+		CertificateStore string `yaml:"certificateStore" jsonschema:"omitempty"`
+
 		WssCertBase64 string `yaml:"wssCertBase64" jsonschema:"omitempty,format=base64"`
 		WssKeyBase64  string `yaml:"wssKeyBase64" jsonschema:"omitempty,format=base64"`
+
+		ProxyProtocol *proxyprotocol.Spec `yaml:"proxyProtocol,omitempty" jsonschema:"omitempty"`
 	}
 )
 
@@ -50,7 +59,7 @@ func (spec *Spec) Validate() error {
 		return fmt.Errorf("invalid ws backend url, spec: %#v", spec)
 	}
 
-	if spec.HTTPS {
+	if spec.HTTPS && spec.CertificateStore == "" {
 		if len(spec.CertBase64) == 0 || len(spec.KeyBase64) == 0 {
 			return fmt.Errorf("invalid certbase64 or keybase64 with https enable, spec: %#v", spec)
 		}
@@ -85,5 +94,19 @@ func (spec *Spec) wssTLSConfig() (*tls.Config, error) {
 }
 
 func (spec *Spec) tlsConfig() (*tls.Config, error) {
-	return validateTLS(spec.CertBase64, spec.KeyBase64)
+	if spec.CertificateStore == "" {
+		return validateTLS(spec.CertBase64, spec.KeyBase64)
+	}
+
+	tlsConfig := &tls.Config{}
+	if len(spec.CertBase64) != 0 && len(spec.KeyBase64) != 0 {
+		var err error
+		tlsConfig, err = validateTLS(spec.CertBase64, spec.KeyBase64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	tlsConfig.GetCertificate = certificatestore.GetCertificateFunc(spec.CertificateStore, len(tlsConfig.Certificates) == 0)
+
+	return tlsConfig, nil
 }
@@ -63,9 +63,15 @@ type Options struct {
 	ClusterInitialAdvertisePeerURLs []string          `yaml:"cluster-initial-advertise-peer-urls"`
 	ClusterJoinURLs                 []string          `yaml:"cluster-join-urls"`
 	APIAddr                         string            `yaml:"api-addr"`
+	APIAuthFile                     string            `yaml:"api-auth-file"`
+	APICertFile                     string            `yaml:"api-cert-file"`
+	APIKeyFile                      string            `yaml:"api-key-file"`
+	APIClientCAFile                 string            `yaml:"api-client-ca-file"`
+	APICAFile                       string            `yaml:"api-ca-file"`
 	Debug                           bool              `yaml:"debug"`
 	DisableAccessLog                bool              `yaml:"disable-access-log"`
 	InitialObjectConfigFiles        []string          `yaml:"initial-object-config-files"`
+	ObjectHistoryLimit              int               `yaml:"object-history-limit"`
 
 	// Path.
 	HomeDir   string `yaml:"home-dir"`
@@ -110,8 +116,14 @@ func New() *Options {
 	opt.flags.StringSliceVar(&opt.ClusterInitialAdvertisePeerURLs, "cluster-initial-advertise-peer-urls", []string{"http://localhost:2380"}, "List of this member’s peer URLs to advertise to the rest of the cluster.")
 	opt.flags.StringSliceVar(&opt.ClusterJoinURLs, "cluster-join-urls", nil, "List of URLs to join, when the first url is the same with any one of cluster-initial-advertise-peer-urls, it means to join itself, and this config will be treated empty.")
 	opt.flags.StringVar(&opt.APIAddr, "api-addr", "localhost:2381", "Address([host]:port) to listen on for administration traffic.")
+	opt.flags.StringVar(&opt.APIAuthFile, "api-auth-file", "", "Path to the authentication and authorization config file(yaml format) of the administration traffic, the administration is open to everyone if not specified.")
+	opt.flags.StringVar(&opt.APICertFile, "api-cert-file", "", "Path to the certificate file of the administration traffic, it's served over HTTPS if specified.")
+	opt.flags.StringVar(&opt.APIKeyFile, "api-key-file", "", "Path to the key file of the administration traffic.")
+	opt.flags.StringVar(&opt.APIClientCAFile, "api-client-ca-file", "", "Path to the client CA file of the administration traffic, clients must present certificates signed by it if specified.")
+	opt.flags.StringVar(&opt.APICAFile, "api-ca-file", "", "Path to the CA file to verify the administration traffic certificates of the other members, the client CA is used if not specified, and then the system CA pool.")
 	opt.flags.BoolVar(&opt.Debug, "debug", false, "Flag to set lowest log level from INFO downgrade DEBUG.")
 	opt.flags.StringSliceVar(&opt.InitialObjectConfigFiles, "initial-object-config-files", nil, "List of configuration files for initial objects, these objects will be created at startup if not already exist.")
+	opt.flags.IntVar(&opt.ObjectHistoryLimit, "object-history-limit", 10, "Max number of revisions kept in the history of every object, 0 means disabling the history.")
 
 	opt.flags.StringVar(&opt.HomeDir, "home-dir", "./", "Path to the home directory.")
 	opt.flags.StringVar(&opt.DataDir, "data-dir", "data", "Path to the data directory.")
@@ -314,6 +326,17 @@ func (opt *Options) validate() error {
 		return fmt.Errorf("invalid api-url: %v", err)
 	}
 
+	if (opt.APICertFile == "") != (opt.APIKeyFile == "") {
+		return fmt.Errorf("api-cert-file and api-key-file must be specified together")
+	}
+	if opt.APIClientCAFile != "" && opt.APICertFile == "" {
+		return fmt.Errorf("api-client-ca-file got empty api-cert-file")
+	}
+
+	if opt.ObjectHistoryLimit < 0 {
+		return fmt.Errorf("invalid object-history-limit: %d", opt.ObjectHistoryLimit)
+	}
+
 	// dirs
 	if opt.HomeDir == "" {
 		return fmt.Errorf("empty home-dir")
@@ -148,6 +148,30 @@ func ObjectKinds() []string {
 	return kinds
 }
 
+// CategoryKinds is the kinds of objects in a category.
+type CategoryKinds struct {
+	Category ObjectCategory `yaml:"category"`
+	Kinds    []string       `yaml:"kinds"`
+}
+
+// ObjectCategoryKinds returns all object kinds grouped by category,
+// and the categories are in the starting sequence.
+func ObjectCategoryKinds() []*CategoryKinds {
+	result := make([]*CategoryKinds, 0, len(objectOrderedCategories))
+	for _, category := range objectOrderedCategories {
+		ck := &CategoryKinds{Category: category, Kinds: []string{}}
+		for _, o := range objectRegistry {
+			if o.Category() == category {
+				ck.Kinds = append(ck.Kinds, o.Kind())
+			}
+		}
+		sort.Strings(ck.Kinds)
+		result = append(result, ck)
+	}
+
+	return result
+}
+
 // Register registers object.
 func Register(o Object) {
 	if o.Kind() == "" {
@@ -72,7 +72,12 @@ func (s *Supervisor) NewSpec(yamlConfig string) (spec *Spec, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			spec = nil
-			err = fmt.Errorf("%v", r)
+			// NOTE: Keep the validation result for the structured errors.
+			if vr, ok := r.(*v.ValidateRecorder); ok {
+				err = vr
+			} else {
+				err = fmt.Errorf("%v", r)
+			}
 		} else {
 			err = nil
 		}
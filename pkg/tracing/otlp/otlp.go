@@ -0,0 +1,219 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package otlp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/otel"
+	otbridge "go.opentelemetry.io/otel/bridge/opentracing"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlphttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/tracing/base"
+)
+
+const (
+	// ProtocolGRPC exports spans by OTLP over gRPC.
+	ProtocolGRPC = "grpc"
+	// ProtocolHTTP exports spans by OTLP over HTTP.
+	ProtocolHTTP = "http"
+
+	instrumentationName = "github.com/megaease/easegress"
+	shutdownTimeout     = 5 * time.Second
+)
+
+type (
+	// Spec describes OpenTelemetry Protocol exporter.
+	Spec struct {
+		Protocol    string            `yaml:"protocol" jsonschema:"required,enum=grpc,enum=http"`
+		Endpoint    string            `yaml:"endpoint" jsonschema:"required"`
+		URLPath     string            `yaml:"urlPath" jsonschema:"omitempty,pattern=^/"`
+		Insecure    bool              `yaml:"insecure" jsonschema:"omitempty"`
+		Headers     map[string]string `yaml:"headers" jsonschema:"omitempty"`
+		Compression string            `yaml:"compression,omitempty" jsonschema:"omitempty,enum=gzip"`
+		Timeout     string            `yaml:"timeout" jsonschema:"omitempty,format=duration"`
+
+		// Propagators are the formats to extract the trace context from
+		// inbound requests and inject it to outbound requests, the
+		// default value is tracecontext and baggage.
+		Propagators []string     `yaml:"propagators" jsonschema:"omitempty,uniqueItems=true"`
+		Sampler     *SamplerSpec `yaml:"sampler" jsonschema:"omitempty"`
+	}
+
+	// cancellableProcessor drops the spans with the cancel tag.
+	cancellableProcessor struct {
+		sdktrace.SpanProcessor
+	}
+
+	providerCloser struct {
+		provider *sdktrace.TracerProvider
+	}
+
+	// errorHandler logs the errors of OpenTelemetry, such as the
+	// failures of exporting spans.
+	errorHandler struct{}
+)
+
+var propagators = map[string]propagation.TextMapPropagator{
+	"tracecontext": propagation.TraceContext{},
+	"baggage":      propagation.Baggage{},
+	"b3":           b3.B3{InjectEncoding: b3.B3SingleHeader},
+	"b3multi":      b3.B3{InjectEncoding: b3.B3MultipleHeader},
+	"jaeger":       jaeger.Jaeger{},
+}
+
+var defaultPropagators = []string{"tracecontext", "baggage"}
+
+func init() {
+	otel.SetErrorHandler(errorHandler{})
+}
+
+func (errorHandler) Handle(err error) {
+	logger.Errorf("opentelemetry: %v", err)
+}
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	if spec.URLPath != "" && spec.Protocol != ProtocolHTTP {
+		return fmt.Errorf("urlPath is only for protocol %s", ProtocolHTTP)
+	}
+
+	for _, p := range spec.Propagators {
+		if _, ok := propagators[p]; !ok {
+			return fmt.Errorf("unknown propagator %s", p)
+		}
+	}
+
+	return nil
+}
+
+func (spec *Spec) timeout() time.Duration {
+	// NOTE: The format has been validated, and 0 means the default one.
+	d, _ := time.ParseDuration(spec.Timeout)
+	return d
+}
+
+func (spec *Spec) newDriver() otlp.ProtocolDriver {
+	if spec.Protocol == ProtocolHTTP {
+		opts := []otlphttp.Option{otlphttp.WithEndpoint(spec.Endpoint)}
+		if spec.URLPath != "" {
+			opts = append(opts, otlphttp.WithTracesURLPath(spec.URLPath))
+		}
+		if spec.Insecure {
+			opts = append(opts, otlphttp.WithInsecure())
+		}
+		if len(spec.Headers) != 0 {
+			opts = append(opts, otlphttp.WithHeaders(spec.Headers))
+		}
+		if spec.Compression == "gzip" {
+			opts = append(opts, otlphttp.WithCompression(otlp.GzipCompression))
+		}
+		if timeout := spec.timeout(); timeout > 0 {
+			opts = append(opts, otlphttp.WithTimeout(timeout))
+		}
+		return otlphttp.NewDriver(opts...)
+	}
+
+	opts := []otlpgrpc.Option{otlpgrpc.WithEndpoint(spec.Endpoint)}
+	if spec.Insecure {
+		opts = append(opts, otlpgrpc.WithInsecure())
+	}
+	if len(spec.Headers) != 0 {
+		opts = append(opts, otlpgrpc.WithHeaders(spec.Headers))
+	}
+	if spec.Compression != "" {
+		opts = append(opts, otlpgrpc.WithCompressor(spec.Compression))
+	}
+	if timeout := spec.timeout(); timeout > 0 {
+		opts = append(opts, otlpgrpc.WithTimeout(timeout))
+	}
+	return otlpgrpc.NewDriver(opts...)
+}
+
+func (spec *Spec) newPropagator(sampler sdktrace.Sampler) propagation.TextMapPropagator {
+	names := spec.Propagators
+	if len(names) == 0 {
+		names = defaultPropagators
+	}
+
+	ps := make([]propagation.TextMapPropagator, 0, len(names))
+	for _, name := range names {
+		ps = append(ps, propagators[name])
+	}
+	propagator := propagation.NewCompositeTextMapPropagator(ps...)
+
+	if spec.Sampler != nil && !spec.Sampler.ParentBased {
+		return &resamplingPropagator{TextMapPropagator: propagator, sampler: sampler}
+	}
+	return propagator
+}
+
+func (p *cancellableProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	for _, attr := range s.Attributes() {
+		if string(attr.Key) == base.CancelTagKey {
+			return
+		}
+	}
+	p.SpanProcessor.OnEnd(s)
+}
+
+func (c *providerCloser) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return c.provider.Shutdown(ctx)
+}
+
+// New creates OpenTelemetry tracer, which is bridged to OpenTracing.
+func New(serviceName string, spec *Spec) (opentracing.Tracer, io.Closer, error) {
+	exporter, err := otlp.NewExporter(context.Background(), spec.newDriver())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sampler := spec.Sampler.newSampler()
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(&cancellableProcessor{
+			SpanProcessor: sdktrace.NewBatchSpanProcessor(exporter),
+		}),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.ServiceNameKey.String(serviceName))),
+		// NOTE: The bridge treats all parents as remote ones, so every
+		// span except the root one follows the decision of its parent.
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+	)
+
+	tracer, _ := otbridge.NewTracerPair(provider.Tracer(instrumentationName))
+	tracer.SetTextMapPropagator(spec.newPropagator(sampler))
+	tracer.SetWarningHandler(func(msg string) {
+		logger.Warnf("opentelemetry bridge: %s", msg)
+	})
+
+	return tracer, &providerCloser{provider: provider}, nil
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package otlp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/tracing/base"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+const upstreamTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+func newTestTracer(t *testing.T, spec *Spec) (opentracing.Tracer, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	spec.Protocol = ProtocolHTTP
+	spec.Endpoint = strings.TrimPrefix(server.URL, "http://")
+	spec.Insecure = true
+	tracer, closer, err := New("test", spec)
+	if err != nil {
+		t.Fatalf("create tracer failed: %v", err)
+	}
+
+	return tracer, func() {
+		closer.Close()
+		server.Close()
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	spec := Spec{Protocol: ProtocolGRPC, Endpoint: "localhost:4317", URLPath: "/v1/traces"}
+	if spec.Validate() == nil {
+		t.Error("urlPath of grpc should be invalid")
+	}
+
+	spec = Spec{Protocol: ProtocolHTTP, Endpoint: "localhost:4318", Propagators: []string{"b3", "zipkin"}}
+	if spec.Validate() == nil {
+		t.Error("unknown propagator should be invalid")
+	}
+
+	spec.Propagators = []string{"tracecontext", "b3multi", "jaeger"}
+	if err := spec.Validate(); err != nil {
+		t.Errorf("spec should be valid: %v", err)
+	}
+
+	sampler := SamplerSpec{Type: SamplerRatio, RateLimit: 10}
+	if sampler.Validate() == nil {
+		t.Error("rateLimit of ratio sampler should be invalid")
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	tracer, closeFn := newTestTracer(t, &Spec{
+		Propagators: []string{"tracecontext", "b3"},
+	})
+	defer closeFn()
+
+	inbound := http.Header{}
+	inbound.Set("traceparent", "00-"+upstreamTraceID+"-00f067aa0ba902b7-01")
+	parent, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(inbound))
+	if err != nil {
+		t.Fatalf("extract failed: %v", err)
+	}
+
+	span := tracer.StartSpan("test", opentracing.ChildOf(parent))
+	defer span.Finish()
+
+	outbound := http.Header{}
+	err = tracer.Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(outbound))
+	if err != nil {
+		t.Fatalf("inject failed: %v", err)
+	}
+
+	traceparent := outbound.Get("traceparent")
+	if !strings.HasPrefix(traceparent, "00-"+upstreamTraceID+"-") || !strings.HasSuffix(traceparent, "-01") {
+		t.Errorf("unexpected traceparent: %s", traceparent)
+	}
+	if strings.Contains(traceparent, "00f067aa0ba902b7") {
+		t.Errorf("span ID should be the one of the new span: %s", traceparent)
+	}
+	if b3 := outbound.Get("b3"); !strings.HasPrefix(b3, upstreamTraceID+"-") {
+		t.Errorf("unexpected b3: %s", b3)
+	}
+}
+
+func TestResampling(t *testing.T) {
+	tracer, closeFn := newTestTracer(t, &Spec{
+		Sampler: &SamplerSpec{Type: SamplerNever},
+	})
+	defer closeFn()
+
+	inbound := http.Header{}
+	inbound.Set("traceparent", "00-"+upstreamTraceID+"-00f067aa0ba902b7-01")
+	parent, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(inbound))
+	if err != nil {
+		t.Fatalf("extract failed: %v", err)
+	}
+
+	span := tracer.StartSpan("test", opentracing.ChildOf(parent))
+	defer span.Finish()
+
+	outbound := http.Header{}
+	tracer.Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(outbound))
+	traceparent := outbound.Get("traceparent")
+	if !strings.HasPrefix(traceparent, "00-"+upstreamTraceID+"-") || !strings.HasSuffix(traceparent, "-00") {
+		t.Errorf("trace should be kept but not sampled: %s", traceparent)
+	}
+}
+
+func TestRateLimitedSampler(t *testing.T) {
+	sampler := newRateLimitedSampler(2)
+
+	sampled := 0
+	for i := 0; i < 10; i++ {
+		result := sampler.ShouldSample(sdktrace.SamplingParameters{ParentContext: context.Background()})
+		if result.Decision == sdktrace.RecordAndSample {
+			sampled++
+		}
+	}
+
+	if sampled != 2 {
+		t.Errorf("sampled %d traces, but the limit is 2", sampled)
+	}
+}
+
+func TestCancellableProcessor(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(&cancellableProcessor{
+		SpanProcessor: sdktrace.NewSimpleSpanProcessor(exporter),
+	}))
+	tracer := provider.Tracer("test")
+
+	_, span := tracer.Start(context.Background(), "kept")
+	span.End()
+
+	_, span = tracer.Start(context.Background(), "cancelled")
+	span.SetAttributes(attribute.String(base.CancelTagKey, "yes"))
+	span.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "kept" {
+		t.Errorf("only the span without cancel tag should be exported, got %d spans", len(spans))
+	}
+}
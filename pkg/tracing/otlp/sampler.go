@@ -0,0 +1,171 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package otlp
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+const (
+	// SamplerAlways samples all traces.
+	SamplerAlways = "always"
+	// SamplerNever samples no traces.
+	SamplerNever = "never"
+	// SamplerRatio samples the ratio of traces by trace ID.
+	SamplerRatio = "ratio"
+	// SamplerRateLimited samples at most rateLimit traces per second.
+	SamplerRateLimited = "rateLimited"
+)
+
+type (
+	// SamplerSpec describes the sampler of the traces started by Easegress.
+	//
+	// The sampling decision of the upstream is respected if ParentBased
+	// is true, otherwise the sampler makes its own decision, but the
+	// trace ID of the upstream is still kept.
+	SamplerSpec struct {
+		Type        string  `yaml:"type" jsonschema:"required,enum=always,enum=never,enum=ratio,enum=rateLimited"`
+		Ratio       float64 `yaml:"ratio" jsonschema:"omitempty,minimum=0,maximum=1"`
+		RateLimit   float64 `yaml:"rateLimit" jsonschema:"omitempty,minimum=0"`
+		ParentBased bool    `yaml:"parentBased" jsonschema:"omitempty"`
+	}
+
+	// rateLimitedSampler samples traces with a token bucket, whose
+	// capacity is the larger one of the rate and 1.
+	rateLimitedSampler struct {
+		mutex    sync.Mutex
+		rate     float64
+		capacity float64
+		balance  float64
+		last     time.Time
+	}
+
+	// resamplingPropagator replaces the sampling decision in the
+	// extracted span context by the one of the sampler.
+	resamplingPropagator struct {
+		propagation.TextMapPropagator
+		sampler sdktrace.Sampler
+	}
+)
+
+// Validate validates SamplerSpec.
+func (spec SamplerSpec) Validate() error {
+	switch spec.Type {
+	case SamplerRatio:
+		if spec.RateLimit != 0 {
+			return fmt.Errorf("rateLimit is only for sampler %s", SamplerRateLimited)
+		}
+	case SamplerRateLimited:
+		if spec.Ratio != 0 {
+			return fmt.Errorf("ratio is only for sampler %s", SamplerRatio)
+		}
+	default:
+		if spec.Ratio != 0 || spec.RateLimit != 0 {
+			return fmt.Errorf("ratio and rateLimit are not for sampler %s", spec.Type)
+		}
+	}
+
+	return nil
+}
+
+// newSampler creates the sampler for root spans, it samples all traces
+// if the spec is nil.
+func (spec *SamplerSpec) newSampler() sdktrace.Sampler {
+	if spec == nil {
+		return sdktrace.AlwaysSample()
+	}
+
+	switch spec.Type {
+	case SamplerNever:
+		return sdktrace.NeverSample()
+	case SamplerRatio:
+		return sdktrace.TraceIDRatioBased(spec.Ratio)
+	case SamplerRateLimited:
+		return newRateLimitedSampler(spec.RateLimit)
+	default:
+		return sdktrace.AlwaysSample()
+	}
+}
+
+func newRateLimitedSampler(rate float64) *rateLimitedSampler {
+	capacity := math.Max(rate, 1)
+	return &rateLimitedSampler{
+		rate:     rate,
+		capacity: capacity,
+		balance:  capacity,
+		last:     fasttime.Now(),
+	}
+}
+
+func (s *rateLimitedSampler) take() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := fasttime.Now()
+	s.balance = math.Min(s.capacity, s.balance+now.Sub(s.last).Seconds()*s.rate)
+	s.last = now
+
+	if s.balance < 1 {
+		return false
+	}
+	s.balance--
+	return true
+}
+
+func (s *rateLimitedSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	result := sdktrace.SamplingResult{
+		Decision:   sdktrace.Drop,
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+	if s.take() {
+		result.Decision = sdktrace.RecordAndSample
+	}
+	return result
+}
+
+func (s *rateLimitedSampler) Description() string {
+	return fmt.Sprintf("RateLimited{%g}", s.rate)
+}
+
+func (p *resamplingPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	ctx = p.TextMapPropagator.Extract(ctx, carrier)
+
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ctx
+	}
+
+	result := p.sampler.ShouldSample(sdktrace.SamplingParameters{
+		ParentContext: context.Background(),
+		TraceID:       sc.TraceID(),
+	})
+	sampled := result.Decision == sdktrace.RecordAndSample
+	sc = sc.WithTraceFlags(sc.TraceFlags().WithSampled(sampled))
+
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
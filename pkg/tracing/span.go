@@ -18,6 +18,8 @@
 package tracing
 
 import (
+	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -65,6 +67,10 @@ type (
 
 		// SetTag sets tag key and value.
 		SetTag(key string, value string)
+
+		// TraceID returns the trace id of the span,
+		// it returns empty string if the tracing is disabled.
+		TraceID() string
 	}
 
 	span struct {
@@ -85,8 +91,20 @@ func NewSpanWithStart(tracer *Tracing, name string, startAt time.Time) Span {
 	return newSpanWithStart(tracer, name, startAt)
 }
 
-func newSpanWithStart(tracer *Tracing, name string, startAt time.Time) Span {
-	newSpan := tracer.StartSpan(name, opentracing.StartTime(startAt))
+// NewSpanFromHTTPHeader creates a span with specify start time, the span
+// continues the trace propagated by the header if there is one.
+func NewSpanFromHTTPHeader(tracer *Tracing, name string, startAt time.Time, header http.Header) Span {
+	parent, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header))
+	if err != nil {
+		return newSpanWithStart(tracer, name, startAt)
+	}
+	return newSpanWithStart(tracer, name, startAt, opentracing.ChildOf(parent))
+}
+
+func newSpanWithStart(tracer *Tracing, name string, startAt time.Time,
+	opts ...opentracing.StartSpanOption) Span {
+	opts = append(opts, opentracing.StartTime(startAt))
+	newSpan := tracer.StartSpan(name, opts...)
 	for tagKey, tagValue := range tracer.tags {
 		newSpan.SetTag(tagKey, tagValue)
 	}
@@ -150,3 +168,35 @@ func (s *span) LogKV(kv ...interface{}) {
 func (s *span) SetTag(key string, value string) {
 	s.span.SetTag(key, value)
 }
+
+// NOTE: The SpanContext of OpenTracing doesn't expose the trace id,
+// so it's read from the headers injected by the tracer, which are in
+// the formats of W3C, B3 and Jaeger.
+func (s *span) TraceID() string {
+	header := http.Header{}
+	err := s.tracer.Inject(s.span.Context(), opentracing.HTTPHeaders,
+		opentracing.HTTPHeadersCarrier(header))
+	if err != nil {
+		return ""
+	}
+
+	if v := header.Get("traceparent"); v != "" {
+		// version-traceid-spanid-flags
+		if fields := strings.Split(v, "-"); len(fields) == 4 {
+			return fields[1]
+		}
+	}
+	if v := header.Get("X-B3-TraceId"); v != "" {
+		return v
+	}
+	if v := header.Get("b3"); v != "" {
+		// traceid-spanid-sampled-parentspanid
+		return strings.Split(v, "-")[0]
+	}
+	if v := header.Get("uber-trace-id"); v != "" {
+		// traceid:spanid:parentspanid:flags
+		return strings.Split(v, ":")[0]
+	}
+
+	return ""
+}
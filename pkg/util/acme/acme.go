@@ -0,0 +1,675 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package acme provides the certificate manager obtaining and renewing
+// TLS certificates automatically from ACME directories like Let's Encrypt.
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/acme"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/yamltool"
+)
+
+const (
+	defaultRenewBefore = 30 * 24 * time.Hour
+
+	checkInterval = time.Hour
+	retryInterval = 10 * time.Minute
+	orderTimeout  = 5 * time.Minute
+
+	accountKeyName = "acme_account+key"
+	lockName       = "lock"
+
+	challengeTLSALPN01 = "tls-alpn-01"
+	challengeHTTP01    = "http-01"
+
+	challengePathPrefix = "/.well-known/acme-challenge/"
+)
+
+var (
+	managersMutex sync.Mutex
+	// managers is keyed by the marshalled spec, so the servers sharing
+	// the same spec share the same manager, which is necessary for
+	// the HTTP-01 challenges answered by the plain HTTP servers.
+	managers = map[string]*Manager{}
+)
+
+type (
+	// Spec describes the ACME certificate manager.
+	Spec struct {
+		// DirectoryURL is the URL of the ACME directory, the default is the
+		// production directory of Let's Encrypt.
+		DirectoryURL string   `yaml:"directoryURL" jsonschema:"omitempty,format=uri"`
+		Email        string   `yaml:"email" jsonschema:"omitempty,format=email"`
+		Domains      []string `yaml:"domains" jsonschema:"required,minItems=1,uniqueItems=true"`
+		RenewBefore  string   `yaml:"renewBefore" jsonschema:"omitempty,format=duration"`
+
+		// CACertBase64 is the CA certificate to verify the TLS certificate
+		// of the ACME directory, it's useful for the test directories like Pebble.
+		CACertBase64 string `yaml:"caCertBase64" jsonschema:"omitempty,format=base64"`
+	}
+
+	// Manager obtains certificates of the domains from the ACME directory,
+	// the account key, the certificates and the challenge tokens are stored
+	// in the cluster, so all members share them and any member is able to
+	// answer the challenges. Orders are placed under a cluster lock, so only
+	// one member obtains or renews a certificate at a time.
+	Manager struct {
+		key  string
+		refs int // guarded by managersMutex
+
+		spec        *Spec
+		domains     map[string]struct{}
+		cls         cluster.Cluster
+		prefix      string
+		renewBefore time.Duration
+
+		// client and registered are only used by the checking goroutine.
+		client     *acme.Client
+		registered bool
+
+		// http01 is non-zero once HTTPHandler is called.
+		http01 int32
+
+		certsMutex sync.RWMutex
+		certs      map[string]*tls.Certificate
+
+		ctx    context.Context
+		cancel context.CancelFunc
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	if spec.DirectoryURL != "" {
+		u, err := url.Parse(spec.DirectoryURL)
+		if err != nil {
+			return fmt.Errorf("invalid directoryURL %s: %v", spec.DirectoryURL, err)
+		}
+		if u.Scheme != "https" && u.Scheme != "http" {
+			return fmt.Errorf("invalid directoryURL %s: scheme must be https or http", spec.DirectoryURL)
+		}
+	}
+
+	if len(spec.Domains) == 0 {
+		return fmt.Errorf("domains are empty")
+	}
+	for _, domain := range spec.Domains {
+		if strings.Contains(domain, "*") {
+			return fmt.Errorf("wildcard domain %s is not supported by HTTP-01 and TLS-ALPN-01 challenges", domain)
+		}
+	}
+
+	if spec.RenewBefore != "" {
+		if _, err := time.ParseDuration(spec.RenewBefore); err != nil {
+			return fmt.Errorf("invalid renewBefore %s: %v", spec.RenewBefore, err)
+		}
+	}
+
+	if spec.CACertBase64 != "" {
+		if _, err := spec.caCertPool(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (spec *Spec) directoryURL() string {
+	if spec.DirectoryURL == "" {
+		return acme.LetsEncryptURL
+	}
+	return spec.DirectoryURL
+}
+
+func (spec *Spec) caCertPool() (*x509.CertPool, error) {
+	pem, err := base64.StdEncoding.DecodeString(spec.CACertBase64)
+	if err != nil {
+		return nil, fmt.Errorf("decode caCertBase64 failed: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("caCertBase64 contains no valid certificate")
+	}
+	return pool, nil
+}
+
+// GetManager returns the manager of the spec, the same manager is returned
+// for the same spec. The caller must call Close of the manager once it's
+// not used anymore.
+func GetManager(spec *Spec, cls cluster.Cluster) (*Manager, error) {
+	key := string(yamltool.Marshal(spec))
+
+	managersMutex.Lock()
+	defer managersMutex.Unlock()
+
+	if m, exists := managers[key]; exists {
+		m.refs++
+		return m, nil
+	}
+
+	m, err := newManager(spec, cls)
+	if err != nil {
+		return nil, err
+	}
+	m.key, m.refs = key, 1
+	managers[key] = m
+
+	go m.run()
+
+	return m, nil
+}
+
+func newManager(spec *Spec, cls cluster.Cluster) (*Manager, error) {
+	directoryURL := spec.directoryURL()
+	u, err := url.Parse(directoryURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid directoryURL %s: %v", directoryURL, err)
+	}
+
+	client := &acme.Client{
+		DirectoryURL: directoryURL,
+		UserAgent:    "easegress",
+	}
+	if spec.CACertBase64 != "" {
+		pool, err := spec.caCertPool()
+		if err != nil {
+			return nil, err
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+		client.HTTPClient = &http.Client{Transport: transport}
+	}
+
+	renewBefore := defaultRenewBefore
+	if spec.RenewBefore != "" {
+		renewBefore, err = time.ParseDuration(spec.RenewBefore)
+		if err != nil {
+			return nil, fmt.Errorf("invalid renewBefore %s: %v", spec.RenewBefore, err)
+		}
+	}
+
+	m := &Manager{
+		spec:        spec,
+		domains:     make(map[string]struct{}, len(spec.Domains)),
+		cls:         cls,
+		prefix:      cls.Layout().ACMEPrefix(u.Host),
+		renewBefore: renewBefore,
+		client:      client,
+		certs:       map[string]*tls.Certificate{},
+	}
+	for _, domain := range spec.Domains {
+		m.domains[normalizeServerName(domain)] = struct{}{}
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+
+	return m, nil
+}
+
+func normalizeServerName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+// Close releases the manager, it stops obtaining and renewing certificates
+// once all the users of the manager closed it.
+func (m *Manager) Close() {
+	managersMutex.Lock()
+	defer managersMutex.Unlock()
+
+	m.refs--
+	if m.refs > 0 {
+		return
+	}
+
+	if managers[m.key] == m {
+		delete(managers, m.key)
+	}
+	m.cancel()
+}
+
+func (m *Manager) run() {
+	for {
+		interval := checkInterval
+		if err := m.check(); err != nil {
+			logger.Errorf("check certificates of %v failed: %v", m.spec.Domains, err)
+			interval = retryInterval
+		}
+
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// check loads certificates of all domains from the cluster, and obtains
+// the missing or expiring ones.
+func (m *Manager) check() error {
+	var errs []string
+	for _, domain := range m.spec.Domains {
+		domain = normalizeServerName(domain)
+		if err := m.checkDomain(domain); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", domain, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (m *Manager) checkDomain(domain string) error {
+	cert, err := m.loadCert(domain)
+	if err == nil {
+		m.setCert(domain, cert)
+		if !m.needRenew(cert) {
+			return nil
+		}
+	}
+
+	mutex, err := m.cls.Mutex(m.prefix + lockName)
+	if err != nil {
+		return err
+	}
+	if err := mutex.Lock(); err != nil {
+		return fmt.Errorf("lock failed: %v", err)
+	}
+	defer func() {
+		if err := mutex.Unlock(); err != nil {
+			logger.Errorf("unlock %s failed: %v", m.prefix+lockName, err)
+		}
+	}()
+
+	// NOTE: Another member may have obtained the certificate
+	// while we were waiting for the lock.
+	cert, err = m.loadCert(domain)
+	if err == nil && !m.needRenew(cert) {
+		m.setCert(domain, cert)
+		return nil
+	}
+
+	cert, err = m.obtain(domain)
+	if err != nil {
+		return err
+	}
+	m.setCert(domain, cert)
+
+	return nil
+}
+
+func (m *Manager) needRenew(cert *tls.Certificate) bool {
+	return time.Now().Add(m.renewBefore).After(cert.Leaf.NotAfter)
+}
+
+func (m *Manager) setCert(domain string, cert *tls.Certificate) {
+	m.certsMutex.Lock()
+	m.certs[domain] = cert
+	m.certsMutex.Unlock()
+}
+
+// loadCert loads the certificate stored under the name from the cluster.
+func (m *Manager) loadCert(name string) (*tls.Certificate, error) {
+	value, err := m.cls.Get(m.prefix + name)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, fmt.Errorf("not found")
+	}
+
+	// NOTE: The private key block is skipped when parsing certificates,
+	// and vice versa, so the whole data is passed twice.
+	cert, err := tls.X509KeyPair([]byte(*value), []byte(*value))
+	if err != nil {
+		return nil, err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return &cert, nil
+}
+
+func encodeCert(key *ecdsa.PrivateKey, der [][]byte) (string, error) {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	buff := &strings.Builder{}
+	pem.Encode(buff, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	for _, b := range der {
+		pem.Encode(buff, &pem.Block{Type: "CERTIFICATE", Bytes: b})
+	}
+	return buff.String(), nil
+}
+
+// obtain obtains the certificate of the domain from the ACME directory
+// and stores it in the cluster, the caller must hold the cluster lock.
+func (m *Manager) obtain(domain string) (*tls.Certificate, error) {
+	ctx, cancel := context.WithTimeout(m.ctx, orderTimeout)
+	defer cancel()
+
+	if err := m.register(ctx); err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domain},
+		DNSNames: []string{domain},
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+
+	challenges := []string{challengeTLSALPN01}
+	if atomic.LoadInt32(&m.http01) != 0 {
+		challenges = append(challenges, challengeHTTP01)
+	}
+
+	var der [][]byte
+	for _, challenge := range challenges {
+		der, err = m.order(ctx, domain, challenge, csr)
+		if err == nil {
+			break
+		}
+		logger.Warnf("order certificate of %s by %s challenge failed: %v", domain, challenge, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := encodeCert(key, der)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.cls.Put(m.prefix+domain, data); err != nil {
+		return nil, err
+	}
+
+	return m.loadCert(domain)
+}
+
+// register loads or creates the account key shared by all members,
+// and registers the account to the ACME directory.
+func (m *Manager) register(ctx context.Context) error {
+	if m.registered {
+		return nil
+	}
+
+	key, err := m.accountKey()
+	if err != nil {
+		return err
+	}
+	m.client.Key = key
+
+	account := &acme.Account{}
+	if m.spec.Email != "" {
+		account.Contact = []string{"mailto:" + m.spec.Email}
+	}
+	_, err = m.client.Register(ctx, account, acme.AcceptTOS)
+	if err != nil && err != acme.ErrAccountAlreadyExists {
+		return fmt.Errorf("register account failed: %v", err)
+	}
+
+	m.registered = true
+	return nil
+}
+
+func (m *Manager) accountKey() (*ecdsa.PrivateKey, error) {
+	name := m.prefix + accountKeyName
+
+	value, err := m.cls.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if value != nil {
+		block, _ := pem.Decode([]byte(*value))
+		if block == nil {
+			return nil, fmt.Errorf("invalid account key")
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	if err := m.cls.Put(name, string(data)); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (m *Manager) order(ctx context.Context, domain, challenge string, csr []byte) ([][]byte, error) {
+	order, err := m.client.AuthorizeOrder(ctx, acme.DomainIDs(domain))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, authzURL := range order.AuthzURLs {
+		authz, err := m.client.GetAuthorization(ctx, authzURL)
+		if err != nil {
+			return nil, err
+		}
+		if authz.Status == acme.StatusValid {
+			continue
+		}
+
+		var chal *acme.Challenge
+		for _, c := range authz.Challenges {
+			if c.Type == challenge {
+				chal = c
+				break
+			}
+		}
+		if chal == nil {
+			return nil, fmt.Errorf("challenge %s is not offered", challenge)
+		}
+
+		name, err := m.fulfill(domain, chal)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := m.cls.Delete(name); err != nil {
+				logger.Errorf("delete %s failed: %v", name, err)
+			}
+		}()
+
+		if _, err := m.client.Accept(ctx, chal); err != nil {
+			return nil, err
+		}
+		if _, err := m.client.WaitAuthorization(ctx, authz.URI); err != nil {
+			return nil, err
+		}
+	}
+
+	order, err = m.client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return nil, err
+	}
+	der, _, err := m.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	return der, err
+}
+
+// fulfill stores the challenge response in the cluster, so that it's
+// answered by any member, and returns the name of the response.
+func (m *Manager) fulfill(domain string, chal *acme.Challenge) (string, error) {
+	var name, data string
+
+	switch chal.Type {
+	case challengeTLSALPN01:
+		cert, err := m.client.TLSALPN01ChallengeCert(chal.Token, domain)
+		if err != nil {
+			return "", err
+		}
+		name = m.prefix + domain + "+token"
+		data, err = encodeCert(cert.PrivateKey.(*ecdsa.PrivateKey), cert.Certificate)
+		if err != nil {
+			return "", err
+		}
+	case challengeHTTP01:
+		resp, err := m.client.HTTP01ChallengeResponse(chal.Token)
+		if err != nil {
+			return "", err
+		}
+		name, data = m.prefix+chal.Token+"+http-01", resp
+	default:
+		return "", fmt.Errorf("unsupported challenge %s", chal.Type)
+	}
+
+	if err := m.cls.Put(name, data); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// Managed returns whether the server name is managed by the manager.
+func (m *Manager) Managed(serverName string) bool {
+	_, exists := m.domains[normalizeServerName(serverName)]
+	return exists
+}
+
+// GetCertificate is the tls.Config.GetCertificate of the managed domains,
+// both the certificates and the TLS-ALPN-01 challenges are served by it.
+// It returns nil without error for the server names not managed, so that
+// the static certificates in tls.Config.Certificates are used for them.
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if !m.Managed(hello.ServerName) {
+		return nil, nil
+	}
+	domain := normalizeServerName(hello.ServerName)
+
+	if len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == acme.ALPNProto {
+		cert, err := m.loadCert(domain + "+token")
+		if err != nil {
+			return nil, fmt.Errorf("challenge certificate of %s: %v", domain, err)
+		}
+		return cert, nil
+	}
+
+	m.certsMutex.RLock()
+	cert := m.certs[domain]
+	m.certsMutex.RUnlock()
+	if cert != nil {
+		return cert, nil
+	}
+
+	// NOTE: The certificate may be obtained by another member
+	// after the last check.
+	cert, err := m.loadCert(domain)
+	if err != nil {
+		return nil, fmt.Errorf("certificate of %s is not ready: %v", domain, err)
+	}
+	m.setCert(domain, cert)
+
+	return cert, nil
+}
+
+// TLSConfig sets up the tls.Config to serve certificates of the managed
+// domains and TLS-ALPN-01 challenges, the certificates of the other server
+// names are still served by the original GetCertificate or Certificates.
+func (m *Manager) TLSConfig(tlsConfig *tls.Config) {
+	next := tlsConfig.GetCertificate
+	tlsConfig.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if m.Managed(hello.ServerName) {
+			return m.GetCertificate(hello)
+		}
+		if next != nil {
+			return next(hello)
+		}
+		// NOTE: crypto/tls falls back to tlsConfig.Certificates.
+		return nil, nil
+	}
+
+	for _, proto := range tlsConfig.NextProtos {
+		if proto == acme.ALPNProto {
+			return
+		}
+	}
+	tlsConfig.NextProtos = append(tlsConfig.NextProtos, acme.ALPNProto)
+}
+
+// HTTPHandler returns the handler answering HTTP-01 challenges, and passes
+// the other requests to the next handler. Once it's called, the manager
+// uses HTTP-01 challenges besides TLS-ALPN-01 ones.
+func (m *Manager) HTTPHandler(next http.Handler) http.Handler {
+	atomic.StoreInt32(&m.http01, 1)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, challengePathPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !m.Managed(host) {
+			http.Error(w, "host not configured", http.StatusForbidden)
+			return
+		}
+
+		token := strings.TrimPrefix(r.URL.Path, challengePathPrefix)
+		value, err := m.cls.Get(m.prefix + token + "+http-01")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if value == nil {
+			http.Error(w, "token not found", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(*value))
+	})
+}
@@ -0,0 +1,630 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func TestSpecValidate(t *testing.T) {
+	cases := []struct {
+		spec  Spec
+		valid bool
+	}{
+		{Spec{Domains: []string{"example.com"}}, true},
+		{Spec{Domains: []string{"example.com"}, DirectoryURL: "https://localhost:14000/dir", RenewBefore: "720h"}, true},
+		{Spec{}, false},
+		{Spec{Domains: []string{"*.example.com"}}, false},
+		{Spec{Domains: []string{"example.com"}, DirectoryURL: "ftp://localhost/dir"}, false},
+		{Spec{Domains: []string{"example.com"}, RenewBefore: "30 days"}, false},
+		{Spec{Domains: []string{"example.com"}, CACertBase64: "bm90IGEgY2VydA=="}, false},
+	}
+
+	for i, c := range cases {
+		err := c.spec.Validate()
+		if c.valid && err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("case %d: expected an error", i)
+		}
+	}
+}
+
+func TestGetManager(t *testing.T) {
+	cls := clustertest.New(nil)
+	directory := newFakeDirectory(t)
+	defer directory.Close()
+
+	spec := func(domain string) *Spec {
+		return &Spec{DirectoryURL: directory.URL + "/dir", Domains: []string{domain}}
+	}
+
+	m1, err := GetManager(spec("a.example.com"), cls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, err := GetManager(spec("a.example.com"), cls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m3, err := GetManager(spec("b.example.com"), cls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m3.Close()
+
+	if m1 != m2 {
+		t.Error("managers of the same spec are different")
+	}
+	if m1 == m3 {
+		t.Error("managers of different specs are the same")
+	}
+
+	if !m1.Managed("A.Example.com.") {
+		t.Error("a.example.com should be managed")
+	}
+	if m1.Managed("b.example.com") {
+		t.Error("b.example.com should not be managed")
+	}
+
+	m1.Close()
+	if m, _ := GetManager(spec("a.example.com"), cls); m != m2 {
+		t.Error("manager is released while it's still used")
+	} else {
+		m.Close()
+	}
+
+	m2.Close()
+	managersMutex.Lock()
+	_, exists := managers[m2.key]
+	managersMutex.Unlock()
+	if exists {
+		t.Error("manager is not removed after all users closed it")
+	}
+	if m2.ctx.Err() == nil {
+		t.Error("manager is not stopped after all users closed it")
+	}
+}
+
+func cachedCert(t *testing.T, domain string, notAfter time.Time) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buff := &strings.Builder{}
+	pem.Encode(buff, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	pem.Encode(buff, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return buff.String()
+}
+
+func TestGetCertificate(t *testing.T) {
+	cls := clustertest.New(nil)
+	spec := &Spec{
+		DirectoryURL: "https://localhost:14000/dir",
+		Domains:      []string{"cert.example.com"},
+	}
+
+	// The certificate issued by another member.
+	cls.Put("/acme/localhost:14000/cert.example.com", cachedCert(t, "cert.example.com", time.Now().Add(90*24*time.Hour)))
+
+	m, err := newManager(spec, cls)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tlsConfig := &tls.Config{NextProtos: []string{"h2"}}
+	m.TLSConfig(tlsConfig)
+	if len(tlsConfig.NextProtos) != 2 || tlsConfig.NextProtos[1] != "acme-tls/1" {
+		t.Errorf("unexpected next protos: %v", tlsConfig.NextProtos)
+	}
+
+	cert, err := tlsConfig.GetCertificate(&tls.ClientHelloInfo{
+		ServerName:   "cert.example.com",
+		CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert == nil || cert.Leaf.Subject.CommonName != "cert.example.com" {
+		t.Fatalf("unexpected certificate: %v", cert)
+	}
+
+	cert, err = tlsConfig.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.example.com"})
+	if cert != nil || err != nil {
+		t.Errorf("expected no certificate and no error for unmanaged domain, got %v, %v", cert, err)
+	}
+
+	// The static certificates are served for the unmanaged domains.
+	static := cachedCert(t, "static.example.com", time.Now().Add(90*24*time.Hour))
+	staticCert, err := tls.X509KeyPair([]byte(static), []byte(static))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig = &tls.Config{Certificates: []tls.Certificate{staticCert}}
+	m.TLSConfig(tlsConfig)
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	go tls.Server(serverConn, tlsConfig).Handshake()
+	client := tls.Client(clientConn, &tls.Config{ServerName: "static.example.com", InsecureSkipVerify: true})
+	if err := client.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	if cn := client.ConnectionState().PeerCertificates[0].Subject.CommonName; cn != "static.example.com" {
+		t.Errorf("expected the static certificate, got %s", cn)
+	}
+}
+
+func TestHTTPHandler(t *testing.T) {
+	cls := clustertest.New(nil)
+	spec := &Spec{
+		DirectoryURL: "https://localhost:14000/dir",
+		Domains:      []string{"http.example.com"},
+	}
+
+	// The token put by another member.
+	cls.Put("/acme/localhost:14000/token+http-01", "token.thumbprint")
+
+	m, err := newManager(spec, cls)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := m.HTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "next")
+	}))
+
+	serve := func(host, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://"+host+path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("http.example.com", "/.well-known/acme-challenge/token")
+	if w.Code != http.StatusOK || w.Body.String() != "token.thumbprint" {
+		t.Errorf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+
+	w = serve("http.example.com", "/.well-known/acme-challenge/unknown")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+
+	w = serve("other.example.com", "/.well-known/acme-challenge/token")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", w.Code)
+	}
+
+	w = serve("http.example.com", "/api")
+	if w.Body.String() != "next" {
+		t.Errorf("expected the request to be passed to the next handler, got %q", w.Body.String())
+	}
+}
+
+// fakeDirectory is a minimal in-process ACME directory, it validates
+// challenges synchronously by the handlers of the managers, and doesn't
+// verify the signatures of requests.
+type fakeDirectory struct {
+	*httptest.Server
+
+	t      *testing.T
+	caKey  *ecdsa.PrivateKey
+	caCert *x509.Certificate
+
+	mutex      sync.Mutex
+	challenges []string
+	orders     []*fakeOrder
+	issued     int
+
+	httpHandler    http.Handler
+	getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+}
+
+type fakeOrder struct {
+	domain string
+	authz  string
+	cert   []byte
+}
+
+func newFakeDirectory(t *testing.T, challenges ...string) *fakeDirectory {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake ACME CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &fakeDirectory{
+		t:          t,
+		caKey:      key,
+		caCert:     caCert,
+		challenges: challenges,
+	}
+	d.Server = httptest.NewServer(d)
+	return d
+}
+
+func (d *fakeDirectory) writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (d *fakeDirectory) orderJSON(id int) interface{} {
+	o := d.orders[id]
+
+	status := "pending"
+	switch {
+	case o.cert != nil:
+		status = "valid"
+	case o.authz == "valid":
+		status = "ready"
+	case o.authz == "invalid":
+		status = "invalid"
+	}
+
+	v := map[string]interface{}{
+		"status":         status,
+		"identifiers":    []map[string]string{{"type": "dns", "value": o.domain}},
+		"authorizations": []string{fmt.Sprintf("%s/authz/%d", d.URL, id)},
+		"finalize":       fmt.Sprintf("%s/finalize/%d", d.URL, id),
+	}
+	if o.cert != nil {
+		v["certificate"] = fmt.Sprintf("%s/cert/%d", d.URL, id)
+	}
+	return v
+}
+
+func (d *fakeDirectory) authzJSON(id int) interface{} {
+	o := d.orders[id]
+
+	challenges := []map[string]string{}
+	for _, typ := range d.challenges {
+		challenges = append(challenges, map[string]string{
+			"type":   typ,
+			"url":    fmt.Sprintf("%s/chal/%d/%s", d.URL, id, typ),
+			"token":  fmt.Sprintf("token%d", id),
+			"status": o.authz,
+		})
+	}
+
+	return map[string]interface{}{
+		"status":     o.authz,
+		"identifier": map[string]string{"type": "dns", "value": o.domain},
+		"challenges": challenges,
+	}
+}
+
+func (d *fakeDirectory) validate(id int, typ string) bool {
+	o := d.orders[id]
+	token := fmt.Sprintf("token%d", id)
+
+	switch typ {
+	case challengeHTTP01:
+		if d.httpHandler == nil {
+			return false
+		}
+		req := httptest.NewRequest(http.MethodGet, "http://"+o.domain+challengePathPrefix+token, nil)
+		w := httptest.NewRecorder()
+		d.httpHandler.ServeHTTP(w, req)
+		return w.Code == http.StatusOK && strings.HasPrefix(w.Body.String(), token+".")
+	case challengeTLSALPN01:
+		if d.getCertificate == nil {
+			return false
+		}
+		cert, err := d.getCertificate(&tls.ClientHelloInfo{
+			ServerName:      o.domain,
+			SupportedProtos: []string{acme.ALPNProto},
+		})
+		if err != nil || cert == nil {
+			return false
+		}
+		for _, ext := range cert.Leaf.Extensions {
+			// id-pe-acmeIdentifier of RFC 8737.
+			if ext.Id.Equal(asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}) {
+				return len(cert.Leaf.DNSNames) == 1 && cert.Leaf.DNSNames[0] == o.domain
+			}
+		}
+	}
+
+	return false
+}
+
+func (d *fakeDirectory) issue(id int, csrDER []byte) {
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		d.t.Errorf("invalid csr: %v", err)
+		return
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(int64(100 + id)),
+		Subject:      csr.Subject,
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, d.caCert, csr.PublicKey, d.caKey)
+	if err != nil {
+		d.t.Errorf("create certificate failed: %v", err)
+		return
+	}
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	cert = append(cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: d.caCert.Raw})...)
+	d.orders[id].cert = cert
+	d.issued++
+}
+
+func (d *fakeDirectory) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce%d", time.Now().UnixNano()))
+
+	switch r.URL.Path {
+	case "/dir":
+		d.writeJSON(w, http.StatusOK, map[string]string{
+			"newNonce":   d.URL + "/nonce",
+			"newAccount": d.URL + "/account",
+			"newOrder":   d.URL + "/order",
+			"revokeCert": d.URL + "/revoke",
+			"keyChange":  d.URL + "/key",
+		})
+		return
+	case "/nonce":
+		return
+	}
+
+	var jws struct {
+		Payload string `json:"payload"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		d.t.Errorf("invalid request to %s: %v", r.URL.Path, err)
+		return
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	id := -1
+	if len(parts) > 1 {
+		fmt.Sscanf(parts[1], "%d", &id)
+	}
+
+	switch parts[0] {
+	case "account":
+		w.Header().Set("Location", d.URL+"/account/1")
+		d.writeJSON(w, http.StatusCreated, map[string]string{"status": "valid"})
+	case "order":
+		if id < 0 {
+			var req struct {
+				Identifiers []struct{ Value string }
+			}
+			json.Unmarshal(payload, &req)
+			id = len(d.orders)
+			d.orders = append(d.orders, &fakeOrder{domain: req.Identifiers[0].Value, authz: "pending"})
+			w.Header().Set("Location", fmt.Sprintf("%s/order/%d", d.URL, id))
+			d.writeJSON(w, http.StatusCreated, d.orderJSON(id))
+			return
+		}
+		d.writeJSON(w, http.StatusOK, d.orderJSON(id))
+	case "authz":
+		d.writeJSON(w, http.StatusOK, d.authzJSON(id))
+	case "chal":
+		typ := parts[2]
+		if d.validate(id, typ) {
+			d.orders[id].authz = "valid"
+		} else {
+			d.orders[id].authz = "invalid"
+		}
+		d.writeJSON(w, http.StatusOK, map[string]string{
+			"type":   typ,
+			"url":    d.URL + r.URL.Path,
+			"token":  fmt.Sprintf("token%d", id),
+			"status": d.orders[id].authz,
+		})
+	case "finalize":
+		var req struct{ CSR string }
+		json.Unmarshal(payload, &req)
+		csr, _ := base64.RawURLEncoding.DecodeString(req.CSR)
+		d.issue(id, csr)
+		w.Header().Set("Location", fmt.Sprintf("%s/order/%d", d.URL, id))
+		d.writeJSON(w, http.StatusOK, d.orderJSON(id))
+	case "cert":
+		w.Write(d.orders[id].cert)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (d *fakeDirectory) issuedCount() int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.issued
+}
+
+func TestObtainCertificate(t *testing.T) {
+	for _, challenge := range []string{challengeTLSALPN01, challengeHTTP01} {
+		cls := clustertest.New(nil)
+		directory := newFakeDirectory(t, challenge)
+		spec := &Spec{
+			DirectoryURL: directory.URL + "/dir",
+			Domains:      []string{"www.example.com"},
+		}
+
+		// Two members sharing the cluster.
+		m1, err := newManager(spec, cls)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m2, err := newManager(spec, cls)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if challenge == challengeHTTP01 {
+			directory.httpHandler = m1.HTTPHandler(http.NotFoundHandler())
+			m2.HTTPHandler(http.NotFoundHandler())
+		} else {
+			directory.getCertificate = m2.GetCertificate
+		}
+
+		wg := &sync.WaitGroup{}
+		for _, m := range []*Manager{m1, m2} {
+			wg.Add(1)
+			go func(m *Manager) {
+				defer wg.Done()
+				if err := m.check(); err != nil {
+					t.Errorf("%s: check failed: %v", challenge, err)
+				}
+			}(m)
+		}
+		wg.Wait()
+
+		if n := directory.issuedCount(); n != 1 {
+			t.Errorf("%s: expected 1 certificate issued, got %d", challenge, n)
+		}
+
+		hello := &tls.ClientHelloInfo{ServerName: "www.example.com"}
+		for i, m := range []*Manager{m1, m2} {
+			cert, err := m.GetCertificate(hello)
+			if err != nil {
+				t.Fatalf("%s: manager %d: %v", challenge, i, err)
+			}
+			if cert.Leaf.Issuer.CommonName != "Fake ACME CA" || cert.Leaf.SerialNumber.Int64() < 100 {
+				t.Errorf("%s: manager %d: unexpected certificate %v", challenge, i, cert.Leaf.Subject)
+			}
+		}
+
+		for key := range cls.KVs() {
+			if strings.HasSuffix(key, "+token") || strings.HasSuffix(key, "+http-01") {
+				t.Errorf("%s: challenge response %s is not deleted", challenge, key)
+			}
+		}
+		if _, exists := cls.KVs()[m1.prefix+accountKeyName]; !exists {
+			t.Errorf("%s: account key is not stored", challenge)
+		}
+
+		m1.cancel()
+		m2.cancel()
+		directory.Close()
+	}
+}
+
+func TestRenewCertificate(t *testing.T) {
+	cls := clustertest.New(nil)
+	directory := newFakeDirectory(t, challengeTLSALPN01)
+	defer directory.Close()
+
+	spec := &Spec{
+		DirectoryURL: directory.URL + "/dir",
+		Domains:      []string{"renew.example.com"},
+		RenewBefore:  "48h",
+	}
+	m, err := newManager(spec, cls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.cancel()
+	directory.getCertificate = m.GetCertificate
+
+	cls.Put(m.prefix+"renew.example.com", cachedCert(t, "renew.example.com", time.Now().Add(24*time.Hour)))
+
+	hello := &tls.ClientHelloInfo{ServerName: "renew.example.com"}
+	cert, err := m.GetCertificate(hello)
+	if err != nil || cert.Leaf.Issuer.CommonName == "Fake ACME CA" {
+		t.Fatalf("expected the cached certificate, got %v, %v", cert, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := m.check(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := directory.issuedCount(); n != 1 {
+		t.Errorf("expected 1 certificate issued, got %d", n)
+	}
+
+	cert, err = m.GetCertificate(hello)
+	if err != nil || cert.Leaf.Issuer.CommonName != "Fake ACME CA" {
+		t.Fatalf("expected the renewed certificate, got %v, %v", cert, err)
+	}
+}
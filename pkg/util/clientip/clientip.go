@@ -0,0 +1,194 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package clientip resolves the address of the client of an HTTP request
+// which may go through several proxies, only the headers set by trusted
+// proxies are taken into account.
+package clientip
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/util/ipfilter"
+)
+
+const (
+	// HeaderXForwardedFor is the de-facto standard header appended by proxies.
+	HeaderXForwardedFor = "X-Forwarded-For"
+	// HeaderForwarded is the standard header defined by RFC 7239.
+	HeaderForwarded = "Forwarded"
+	// HeaderXRealIP is the header carrying the single client address set by
+	// proxies like Nginx.
+	HeaderXRealIP = "X-Real-IP"
+	// HeaderCFConnectingIP is the header carrying the client address set by Cloudflare.
+	HeaderCFConnectingIP = "CF-Connecting-IP"
+)
+
+type (
+	// Spec describes how to resolve the client address.
+	Spec struct {
+		// TrustedCIDRs are the addresses of the proxies in front of Easegress,
+		// the header is ignored if the peer is not one of them.
+		TrustedCIDRs []string `yaml:"trustedCIDRs" jsonschema:"omitempty,uniqueItems=true,format=ipcidr-array"`
+		Header       string   `yaml:"header" jsonschema:"omitempty,enum=,enum=X-Forwarded-For,enum=Forwarded,enum=X-Real-IP,enum=CF-Connecting-IP"`
+	}
+
+	// Resolver resolves the client address of requests.
+	Resolver struct {
+		header  string
+		trusted []*net.IPNet
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	_, err := ipfilter.ParseCIDRs(spec.TrustedCIDRs)
+	return err
+}
+
+// New creates a Resolver, the spec must be valid.
+func New(spec *Spec) *Resolver {
+	trusted, _ := ipfilter.ParseCIDRs(spec.TrustedCIDRs)
+
+	header := spec.Header
+	if header == "" {
+		header = HeaderXForwardedFor
+	}
+
+	return &Resolver{header: header, trusted: trusted}
+}
+
+func (r *Resolver) isTrusted(ip net.IP) bool {
+	for _, ipNet := range r.trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the client address of the request. It is the peer address
+// unless the peer is a trusted proxy, in which case the header is examined:
+// for X-Forwarded-For and Forwarded, the hops are walked from right to left
+// and the first one which is not a trusted proxy is the client.
+func (r *Resolver) Resolve(req *http.Request) string {
+	peer := peerIP(req.RemoteAddr)
+	if peer == nil {
+		return req.RemoteAddr
+	}
+	if !r.isTrusted(peer) {
+		return peer.String()
+	}
+
+	var hops []string
+	switch r.header {
+	case HeaderXForwardedFor:
+		hops = xForwardedForHops(req.Header.Values(HeaderXForwardedFor))
+	case HeaderForwarded:
+		hops = forwardedHops(req.Header.Values(HeaderForwarded))
+	default:
+		// The single value headers are overwritten rather than appended
+		// by the proxies, so the value is the client address as long as
+		// the peer is trusted.
+		if ip := parseIP(req.Header.Get(r.header)); ip != nil {
+			return ip.String()
+		}
+		return peer.String()
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := parseIP(hops[i])
+		if ip == nil {
+			// The hop is unknown, obfuscated or forged, the nearest
+			// valid address is the most reliable one.
+			break
+		}
+
+		client = ip
+		if !r.isTrusted(ip) {
+			break
+		}
+	}
+
+	return client.String()
+}
+
+// PeerIP returns the IP of the direct peer of the request.
+func PeerIP(req *http.Request) string {
+	if ip := peerIP(req.RemoteAddr); ip != nil {
+		return ip.String()
+	}
+	return req.RemoteAddr
+}
+
+func peerIP(remoteAddr string) net.IP {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+func xForwardedForHops(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for _, hop := range strings.Split(v, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// forwardedHops extracts the for parameters of the Forwarded headers,
+// e.g. for=192.0.2.60;proto=http;by=203.0.113.43, for="[2001:db8::17]:4711"
+func forwardedHops(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			hop := ""
+			for _, pair := range strings.Split(element, ";") {
+				kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+					hop = strings.Trim(kv[1], `"`)
+					break
+				}
+			}
+			// NOTE: Keep the element without for parameter as an invalid
+			// hop, so that it won't be skipped silently.
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// parseIP parses an address with optional port, IPv6 addresses with
+// port must be bracketed.
+func parseIP(addr string) net.IP {
+	addr = strings.TrimSpace(addr)
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip
+	}
+
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return net.ParseIP(host)
+	}
+
+	return net.ParseIP(strings.Trim(addr, "[]"))
+}
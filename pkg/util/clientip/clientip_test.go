@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clientip
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSpecValidate(t *testing.T) {
+	if err := (Spec{TrustedCIDRs: []string{"10.0.0.0/8", "127.0.0.1", "::1"}}).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := (Spec{TrustedCIDRs: []string{"10.0.0.0/33"}}).Validate(); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	trusted := []string{"10.0.0.0/8", "2001:db8::/32"}
+
+	cases := []struct {
+		header     string
+		remoteAddr string
+		values     []string
+		want       string
+	}{
+		// untrusted peer, the header is ignored
+		{HeaderXForwardedFor, "1.1.1.1:1234", []string{"2.2.2.2"}, "1.1.1.1"},
+		{HeaderXRealIP, "1.1.1.1:1234", []string{"2.2.2.2"}, "1.1.1.1"},
+		// trusted peer without header
+		{HeaderXForwardedFor, "10.0.0.1:1234", nil, "10.0.0.1"},
+		// the spoofed leftmost hop is skipped
+		{HeaderXForwardedFor, "10.0.0.1:1234", []string{"9.9.9.9, 2.2.2.2, 10.0.0.2"}, "2.2.2.2"},
+		{HeaderXForwardedFor, "10.0.0.1:1234", []string{"9.9.9.9", "2.2.2.2, 10.0.0.2"}, "2.2.2.2"},
+		// all hops are trusted
+		{HeaderXForwardedFor, "10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		// invalid hop
+		{HeaderXForwardedFor, "10.0.0.1:1234", []string{"2.2.2.2, unknown, 10.0.0.2"}, "10.0.0.2"},
+		{HeaderForwarded, "10.0.0.1:1234", []string{`for=9.9.9.9, for=2.2.2.2;proto=https, For="[2001:db8::1]:4711"`}, "2.2.2.2"},
+		{HeaderForwarded, "[2001:db8::2]:1234", []string{`for="[2001:db9::1]:4711";by=10.0.0.1`}, "2001:db9::1"},
+		{HeaderForwarded, "10.0.0.1:1234", []string{`for=_hidden, for=10.0.0.2`}, "10.0.0.2"},
+		{HeaderXRealIP, "10.0.0.1:1234", []string{"2.2.2.2"}, "2.2.2.2"},
+		{HeaderXRealIP, "10.0.0.1:1234", []string{"bad"}, "10.0.0.1"},
+		{HeaderCFConnectingIP, "10.0.0.1:1234", []string{"2.2.2.2"}, "2.2.2.2"},
+		// the other headers are ignored
+		{HeaderCFConnectingIP, "10.0.0.1:1234", nil, "10.0.0.1"},
+	}
+
+	for i, c := range cases {
+		r := New(&Spec{TrustedCIDRs: trusted, Header: c.header})
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		req.RemoteAddr = c.remoteAddr
+		for _, v := range c.values {
+			req.Header.Add(c.header, v)
+		}
+		if c.header != HeaderXForwardedFor {
+			req.Header.Set(HeaderXForwardedFor, "3.3.3.3")
+		}
+
+		if got := r.Resolve(req); got != c.want {
+			t.Errorf("case %d: want %s, got %s", i, c.want, got)
+		}
+	}
+}
+
+func TestDefaultHeader(t *testing.T) {
+	r := New(&Spec{TrustedCIDRs: []string{"10.0.0.1"}})
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set(HeaderXForwardedFor, "2.2.2.2")
+	if got := r.Resolve(req); got != "2.2.2.2" {
+		t.Errorf("want 2.2.2.2, got %s", got)
+	}
+
+	if got := PeerIP(req); got != "10.0.0.1" {
+		t.Errorf("want 10.0.0.1, got %s", got)
+	}
+}
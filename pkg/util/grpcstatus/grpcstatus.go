@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package grpcstatus provides helpers to recognize gRPC traffic
+// carried by HTTP/2 and to read gRPC status codes.
+//
+// Reference: https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md
+package grpcstatus
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+const (
+	// ContentType is the base content type of gRPC.
+	ContentType = "application/grpc"
+
+	// MinCode is the minimum gRPC status code (OK).
+	MinCode = 0
+	// MaxCode is the maximum gRPC status code (UNAUTHENTICATED).
+	MaxCode = 16
+)
+
+// IsGRPCContentType returns whether the content type is gRPC,
+// such as application/grpc, application/grpc+proto, application/grpc;charset=utf-8.
+func IsGRPCContentType(contentType string) bool {
+	if !strings.HasPrefix(contentType, ContentType) {
+		return false
+	}
+
+	if len(contentType) == len(ContentType) {
+		return true
+	}
+
+	switch contentType[len(ContentType)] {
+	case '+', ';':
+		return true
+	default:
+		return false
+	}
+}
+
+// IsGRPC returns whether the header belongs to a gRPC request or response.
+func IsGRPC(h *httpheader.HTTPHeader) bool {
+	return IsGRPCContentType(h.Get(httpheader.KeyContentType))
+}
+
+// IsGRPCStd is the same as IsGRPC but for the header of standard library.
+func IsGRPCStd(h http.Header) bool {
+	return IsGRPCContentType(h.Get(httpheader.KeyContentType))
+}
+
+// FromHeader returns the gRPC status code carried in the header.
+// For a Trailers-Only response, the status is in the header,
+// otherwise it is in the trailer.
+func FromHeader(h *httpheader.HTTPHeader) (int, bool) {
+	v := h.Get(httpheader.KeyGRPCStatus)
+	if v == "" {
+		return 0, false
+	}
+
+	code, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, false
+	}
+
+	return code, true
+}
+
+// ValidateCodes validates gRPC status codes.
+func ValidateCodes(codes []int) error {
+	for _, code := range codes {
+		if code < MinCode || code > MaxCode {
+			return fmt.Errorf("invalid grpc status code: %d", code)
+		}
+	}
+
+	return nil
+}
+
+// InCodes returns whether the header carries a gRPC status code within codes.
+func InCodes(h *httpheader.HTTPHeader, codes []int) bool {
+	if len(codes) == 0 {
+		return false
+	}
+
+	code, ok := FromHeader(h)
+	if !ok {
+		return false
+	}
+
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpcstatus
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+func TestIsGRPCContentType(t *testing.T) {
+	cases := map[string]bool{
+		"application/grpc":               true,
+		"application/grpc+proto":         true,
+		"application/grpc;charset=utf-8": true,
+		"application/grpc-web":           false,
+		"application/json":               false,
+		"":                               false,
+	}
+
+	for contentType, want := range cases {
+		if got := IsGRPCContentType(contentType); got != want {
+			t.Errorf("%q: want %v, got %v", contentType, want, got)
+		}
+	}
+}
+
+func TestInCodes(t *testing.T) {
+	h := httpheader.New(http.Header{})
+	if InCodes(h, []int{14}) {
+		t.Errorf("header without grpc status should not be in codes")
+	}
+
+	h.Set(httpheader.KeyGRPCStatus, "14")
+	if code, ok := FromHeader(h); !ok || code != 14 {
+		t.Errorf("want 14, got %d", code)
+	}
+	if !InCodes(h, []int{4, 14}) {
+		t.Errorf("14 should be in codes")
+	}
+	if InCodes(h, []int{4}) {
+		t.Errorf("14 should not be in codes")
+	}
+
+	h.Set(httpheader.KeyGRPCStatus, "invalid")
+	if _, ok := FromHeader(h); ok {
+		t.Errorf("invalid grpc status should not be parsed")
+	}
+}
+
+func TestValidateCodes(t *testing.T) {
+	if err := ValidateCodes([]int{0, 16}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if ValidateCodes([]int{17}) == nil {
+		t.Errorf("17 should be invalid")
+	}
+}
@@ -26,9 +26,27 @@ const (
 	KeyContentEncoding = "Content-Encoding"
 	// KeyContentLength is the key of Content-Length.
 	KeyContentLength = "Content-Length"
+	// KeyContentType is the key of Content-Type.
+	KeyContentType = "Content-Type"
 	// KeyVary is the key of Vary.
 	KeyVary = "Vary"
+	// KeyRetryAfter is the key of Retry-After.
+	KeyRetryAfter = "Retry-After"
+	// KeyLocation is the key of Location.
+	KeyLocation = "Location"
 
 	// KeyXForwardedFor is the key of X-Forwarded-For.
 	KeyXForwardedFor = "X-Forwarded-For"
+
+	// KeyXRateLimitLimit is the key of X-RateLimit-Limit.
+	KeyXRateLimitLimit = "X-RateLimit-Limit"
+	// KeyXRateLimitRemaining is the key of X-RateLimit-Remaining.
+	KeyXRateLimitRemaining = "X-RateLimit-Remaining"
+	// KeyXRateLimitReset is the key of X-RateLimit-Reset.
+	KeyXRateLimitReset = "X-RateLimit-Reset"
+
+	// KeyGRPCStatus is the key of Grpc-Status.
+	KeyGRPCStatus = "Grpc-Status"
+	// KeyGRPCMessage is the key of Grpc-Message.
+	KeyGRPCMessage = "Grpc-Message"
 )
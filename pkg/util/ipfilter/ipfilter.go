@@ -18,6 +18,7 @@
 package ipfilter
 
 import (
+	"fmt"
 	"net"
 	"strings"
 
@@ -55,6 +56,30 @@ type (
 	}
 )
 
+// ParseCIDRs parses IPs and CIDRs into networks, an IP is the network of
+// itself. Addresses with colons are IPv6 ones, so the IPv4-mapped address
+// such as ::ffff:1.2.3.4 is a network of 128 bits, the same as IPFilter.
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	result := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if ip := net.ParseIP(cidr); ip != nil {
+			bits := 8 * net.IPv4len
+			if strings.Contains(cidr, ":") {
+				bits = 8 * net.IPv6len
+			}
+			cidr = fmt.Sprintf("%s/%d", cidr, bits)
+		}
+
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %s: %v", cidr, err)
+		}
+		result = append(result, ipNet)
+	}
+
+	return result, nil
+}
+
 // New creates an IPFilter.
 func New(spec *Spec) *IPFilter {
 	rangerFromIPCIDRs := func(ipcidrs []string) cidranger.Ranger {
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ipfilter
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseCIDRs(t *testing.T) {
+	cases := []struct {
+		cidr     string
+		ones     int
+		contains string
+		excludes string
+	}{
+		{"1.2.3.4", 32, "1.2.3.4", "1.2.3.5"},
+		{"10.0.0.0/8", 8, "10.1.2.3", "11.0.0.1"},
+		{"2001:db8::1", 128, "2001:db8::1", "2001:db8::2"},
+		{"2001:db8::/32", 32, "2001:db8:1::1", "2001:db9::1"},
+		// NOTE: It must not be a network of 32 bits in IPv6.
+		{"::ffff:1.2.3.4", 128, "1.2.3.4", "::ffff:1.2.3.5"},
+	}
+
+	for _, c := range cases {
+		nets, err := ParseCIDRs([]string{c.cidr})
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.cidr, err)
+			continue
+		}
+		if ones, _ := nets[0].Mask.Size(); ones != c.ones {
+			t.Errorf("%s: expected %d ones in mask, got %d", c.cidr, c.ones, ones)
+		}
+		if !nets[0].Contains(net.ParseIP(c.contains)) {
+			t.Errorf("%s should contain %s", c.cidr, c.contains)
+		}
+		if nets[0].Contains(net.ParseIP(c.excludes)) {
+			t.Errorf("%s should not contain %s", c.cidr, c.excludes)
+		}
+	}
+
+	for _, cidr := range []string{"1.2.3.4/33", "1.2.3", ""} {
+		if _, err := ParseCIDRs([]string{cidr}); err == nil {
+			t.Errorf("%q should be invalid", cidr)
+		}
+	}
+}
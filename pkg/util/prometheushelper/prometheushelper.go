@@ -0,0 +1,195 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package prometheushelper provides the Prometheus metrics of Easegress.
+//
+// Metrics are registered to a private registry and created only once by
+// name, so objects and filters can get them again after being reloaded.
+package prometheushelper
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+// Namespace is the namespace of all metrics of Easegress.
+const Namespace = "easegress"
+
+// memberNameLabel is added to all metrics when they are gathered.
+const memberNameLabel = "member_name"
+
+// DurationBuckets are the buckets of latency histograms in seconds.
+var DurationBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+var (
+	registry = prometheus.NewRegistry()
+
+	mutex   sync.Mutex
+	metrics = map[string]prometheus.Collector{}
+)
+
+func init() {
+	registry.MustRegister(collectors.NewGoCollector())
+	registry.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+}
+
+func fullName(subsystem, name string) string {
+	return prometheus.BuildFQName(Namespace, subsystem, name)
+}
+
+// getOrRegister returns the collector of the name if it exists,
+// or registers the one created by fn.
+func getOrRegister(name string, fn func() prometheus.Collector) prometheus.Collector {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if c, ok := metrics[name]; ok {
+		return c
+	}
+
+	c := fn()
+	if err := registry.Register(c); err != nil {
+		logger.Errorf("BUG: register prometheus metric %s failed: %v", name, err)
+	}
+	metrics[name] = c
+
+	return c
+}
+
+// NewCounter returns the counter vector of the name, it panics if
+// a metric of the same name but a different type exists.
+func NewCounter(subsystem, name, help string, labels []string) *prometheus.CounterVec {
+	fqName := fullName(subsystem, name)
+	return getOrRegister(fqName, func() prometheus.Collector {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: subsystem,
+			Name:      name,
+			Help:      help,
+		}, labels)
+	}).(*prometheus.CounterVec)
+}
+
+// NewGauge returns the gauge vector of the name, it panics if
+// a metric of the same name but a different type exists.
+func NewGauge(subsystem, name, help string, labels []string) *prometheus.GaugeVec {
+	fqName := fullName(subsystem, name)
+	return getOrRegister(fqName, func() prometheus.Collector {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: subsystem,
+			Name:      name,
+			Help:      help,
+		}, labels)
+	}).(*prometheus.GaugeVec)
+}
+
+// NewHistogram returns the histogram vector of the name, it panics if
+// a metric of the same name but a different type exists.
+func NewHistogram(subsystem, name, help string, labels []string, buckets []float64) *prometheus.HistogramVec {
+	fqName := fullName(subsystem, name)
+	return getOrRegister(fqName, func() prometheus.Collector {
+		return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: subsystem,
+			Name:      name,
+			Help:      help,
+			Buckets:   buckets,
+		}, labels)
+	}).(*prometheus.HistogramVec)
+}
+
+type (
+	// Series remembers the series exported to metric vectors by an object
+	// or a filter. Metrics are shared by all of them and live forever, so
+	// the series must be deleted after the exporter is closed, otherwise
+	// the last values are exported forever.
+	Series struct {
+		series sync.Map
+	}
+
+	seriesKey struct {
+		vec    *prometheus.MetricVec
+		labels string
+	}
+)
+
+// NewSeries creates a Series.
+func NewSeries() *Series {
+	return &Series{}
+}
+
+// Add remembers the series of the label values in the vector.
+func (s *Series) Add(vec *prometheus.MetricVec, lvs ...string) {
+	key := seriesKey{vec: vec, labels: strings.Join(lvs, "\xff")}
+	if _, ok := s.series.Load(key); !ok {
+		s.series.Store(key, append([]string(nil), lvs...))
+	}
+}
+
+// Delete deletes the series whose label values match, it deletes all
+// series if match is nil.
+func (s *Series) Delete(match func(lvs []string) bool) {
+	s.series.Range(func(k, v interface{}) bool {
+		lvs := v.([]string)
+		if match == nil || match(lvs) {
+			k.(seriesKey).vec.DeleteLabelValues(lvs...)
+			s.series.Delete(k)
+		}
+		return true
+	})
+}
+
+// memberGatherer adds the member name label to all metrics.
+type memberGatherer struct {
+	gatherer   prometheus.Gatherer
+	memberName string
+}
+
+func (g *memberGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.gatherer.Gather()
+
+	name, value := memberNameLabel, g.memberName
+	for _, family := range families {
+		for _, m := range family.Metric {
+			m.Label = append(m.Label, &dto.LabelPair{Name: &name, Value: &value})
+			sort.Slice(m.Label, func(i, j int) bool {
+				return m.Label[i].GetName() < m.Label[j].GetName()
+			})
+		}
+	}
+
+	return families, err
+}
+
+// Handler returns the HTTP handler which exposes all metrics
+// in the Prometheus exposition format.
+func Handler(memberName string) http.Handler {
+	gatherer := &memberGatherer{gatherer: registry, memberName: memberName}
+	return promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{
+		ErrorHandling: promhttp.ContinueOnError,
+	})
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package prometheushelper
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func TestGetOrRegister(t *testing.T) {
+	c1 := NewCounter("test", "counter_total", "test counter", []string{"name"})
+	c2 := NewCounter("test", "counter_total", "test counter", []string{"name"})
+	if c1 != c2 {
+		t.Error("counters of the same name should be the same one")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("getting a metric with a different type should panic")
+		}
+	}()
+	NewGauge("test", "counter_total", "test gauge", []string{"name"})
+}
+
+func TestHandler(t *testing.T) {
+	NewCounter("test", "handler_total", "test counter", []string{"name"}).WithLabelValues("foo").Add(3)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	Handler("member-1").ServeHTTP(w, r)
+
+	body, _ := io.ReadAll(w.Result().Body)
+	expected := `easegress_test_handler_total{member_name="member-1",name="foo"} 3`
+	if !strings.Contains(string(body), expected) {
+		t.Errorf("metrics should contain %q, got:\n%s", expected, body)
+	}
+}
+
+func TestSeries(t *testing.T) {
+	counter := NewCounter("test", "series_total", "test counter", []string{"name", "code"})
+	gauge := NewGauge("test", "series", "test gauge", []string{"name"})
+
+	s := NewSeries()
+	for _, lvs := range [][]string{{"foo", "200"}, {"foo", "500"}, {"bar", "200"}} {
+		counter.WithLabelValues(lvs...).Inc()
+		s.Add(counter.MetricVec, lvs...)
+	}
+	gauge.WithLabelValues("foo").Set(1)
+	s.Add(gauge.MetricVec, "foo")
+
+	count := func() int {
+		families, _ := registry.Gather()
+		n := 0
+		for _, family := range families {
+			if strings.HasPrefix(family.GetName(), "easegress_test_series") {
+				n += len(family.Metric)
+			}
+		}
+		return n
+	}
+
+	s.Delete(func(lvs []string) bool { return lvs[0] == "foo" })
+	if n := count(); n != 1 {
+		t.Errorf("expected 1 series left, got %d", n)
+	}
+
+	s.Delete(nil)
+	if n := count(); n != 0 {
+		t.Errorf("expected no series left, got %d", n)
+	}
+}
@@ -0,0 +1,193 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package proxyprotocol parses and writes PROXY protocol headers,
+// which carry the addresses of the original client connections through
+// layer 4 load balancers.
+// Reference: https://www.haproxy.org/download/2.4/doc/proxy-protocol.txt
+package proxyprotocol
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	proxyproto "github.com/pires/go-proxyproto"
+
+	"github.com/megaease/easegress/pkg/util/ipfilter"
+)
+
+const (
+	// Version1 is the human-readable version of PROXY protocol.
+	Version1 = "v1"
+	// Version2 is the binary version of PROXY protocol.
+	Version2 = "v2"
+
+	defaultHeaderTimeout = time.Second
+)
+
+type (
+	// Listener parses PROXY protocol headers of the connections,
+	// its spec could be updated without closing it.
+	Listener struct {
+		net.Listener
+		config atomic.Value // *listenerConfig, nil means disabled
+	}
+
+	listenerConfig struct {
+		trusted       []*net.IPNet
+		trustedPolicy proxyproto.Policy
+		headerTimeout time.Duration
+	}
+
+	// connListener accepts the connection accepted by another listener.
+	connListener struct {
+		net.Listener
+		conn net.Conn
+	}
+
+	// Spec describes PROXY protocol on a listener.
+	Spec struct {
+		// TrustedCIDRs are the sources allowed to send PROXY protocol headers,
+		// they are usually the addresses of the load balancers.
+		TrustedCIDRs []string `yaml:"trustedCIDRs" jsonschema:"required,minItems=1,uniqueItems=true,format=ipcidr-array"`
+		// Required rejects the connections from trusted sources without headers.
+		Required      bool   `yaml:"required" jsonschema:"omitempty"`
+		HeaderTimeout string `yaml:"headerTimeout" jsonschema:"omitempty,format=duration"`
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	if _, err := ipfilter.ParseCIDRs(spec.TrustedCIDRs); err != nil {
+		return err
+	}
+
+	if spec.HeaderTimeout != "" {
+		if _, err := time.ParseDuration(spec.HeaderTimeout); err != nil {
+			return fmt.Errorf("invalid headerTimeout %s: %v", spec.HeaderTimeout, err)
+		}
+	}
+
+	return nil
+}
+
+// NewListener wraps the listener to parse PROXY protocol headers of the
+// connections from trusted sources, the RemoteAddr and LocalAddr of these
+// connections become the addresses in the headers. The connections from
+// untrusted sources fail on the first read if they send headers, so that
+// clients can't spoof their addresses. A nil spec disables PROXY protocol,
+// the connections are returned as they are.
+func NewListener(l net.Listener, spec *Spec) *Listener {
+	listener := &Listener{Listener: l}
+	listener.SetSpec(spec)
+	return listener
+}
+
+// SetSpec updates the spec of the listener, it applies to the connections
+// accepted afterwards, a nil spec disables PROXY protocol.
+func (l *Listener) SetSpec(spec *Spec) {
+	if spec == nil {
+		l.config.Store((*listenerConfig)(nil))
+		return
+	}
+
+	trusted, err := ipfilter.ParseCIDRs(spec.TrustedCIDRs)
+	if err != nil {
+		// NOTE: It has been validated, just defensive programming here.
+		trusted = nil
+	}
+
+	headerTimeout := defaultHeaderTimeout
+	if spec.HeaderTimeout != "" {
+		if d, err := time.ParseDuration(spec.HeaderTimeout); err == nil {
+			headerTimeout = d
+		}
+	}
+
+	trustedPolicy := proxyproto.USE
+	if spec.Required {
+		trustedPolicy = proxyproto.REQUIRE
+	}
+
+	l.config.Store(&listenerConfig{
+		trusted:       trusted,
+		trustedPolicy: trustedPolicy,
+		headerTimeout: headerTimeout,
+	})
+}
+
+// Accept accepts a connection, and wraps it to parse the PROXY
+// protocol header if PROXY protocol is enabled.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	config := l.config.Load().(*listenerConfig)
+	if config == nil {
+		return conn, nil
+	}
+
+	// NOTE: The header timeout of a connection can only be set by
+	// proxyproto.Listener, so the connection is accepted through one.
+	pl := &proxyproto.Listener{
+		Listener:          &connListener{Listener: l.Listener, conn: conn},
+		Policy:            config.policy,
+		ReadHeaderTimeout: config.headerTimeout,
+	}
+	return pl.Accept()
+}
+
+func (c *listenerConfig) policy(upstream net.Addr) (proxyproto.Policy, error) {
+	tcpAddr, ok := upstream.(*net.TCPAddr)
+	if !ok {
+		return proxyproto.REJECT, nil
+	}
+	for _, ipNet := range c.trusted {
+		if ipNet.Contains(tcpAddr.IP) {
+			return c.trustedPolicy, nil
+		}
+	}
+	return proxyproto.REJECT, nil
+}
+
+// Accept returns the connection.
+func (l *connListener) Accept() (net.Conn, error) {
+	return l.conn, nil
+}
+
+// WriteHeader writes the PROXY protocol header of the connection from src
+// to dst, the header of version 1 is "PROXY UNKNOWN" if the addresses
+// aren't TCP ones.
+func WriteHeader(w io.Writer, version string, src, dst net.Addr) error {
+	var v byte
+	switch version {
+	case Version1:
+		v = 1
+	case Version2:
+		v = 2
+	default:
+		return fmt.Errorf("unsupported PROXY protocol version %s", version)
+	}
+
+	_, err := proxyproto.HeaderProxyFromAddrs(v, src, dst).WriteTo(w)
+	return err
+}
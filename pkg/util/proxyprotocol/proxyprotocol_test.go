@@ -0,0 +1,203 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxyprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	proxyproto "github.com/pires/go-proxyproto"
+)
+
+func TestSpecValidate(t *testing.T) {
+	cases := []struct {
+		spec  Spec
+		valid bool
+	}{
+		{Spec{TrustedCIDRs: []string{"10.0.0.0/8", "127.0.0.1", "::1"}}, true},
+		{Spec{TrustedCIDRs: []string{"10.0.0.0/8"}, HeaderTimeout: "3s"}, true},
+		{Spec{TrustedCIDRs: []string{"10.0.0.0/33"}}, false},
+		{Spec{TrustedCIDRs: []string{"10.0.0.0/8"}, HeaderTimeout: "3"}, false},
+	}
+
+	for i, c := range cases {
+		err := c.spec.Validate()
+		if c.valid && err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("case %d: expected an error", i)
+		}
+	}
+}
+
+type acceptResult struct {
+	remoteAddr string
+	data       string
+	err        error
+}
+
+// serveOne accepts one connection from the listener wrapped with spec,
+// and reads a line from it after the client sends header and data.
+func serveOne(t *testing.T, spec *Spec, header []byte, data string) *acceptResult {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl := NewListener(l, spec)
+	defer pl.Close()
+
+	return serveOn(t, pl, header, data)
+}
+
+// serveOn is like serveOne, but accepts the connection from l.
+func serveOn(t *testing.T, l net.Listener, header []byte, data string) *acceptResult {
+	resultChan := make(chan *acceptResult, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			resultChan <- &acceptResult{err: err}
+			return
+		}
+		defer conn.Close()
+
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		resultChan <- &acceptResult{
+			remoteAddr: conn.RemoteAddr().String(),
+			data:       line,
+			err:        err,
+		}
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write(header)
+	conn.Write([]byte(data))
+
+	select {
+	case r := <-resultChan:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+		return nil
+	}
+}
+
+func header(t *testing.T, version string) []byte {
+	buff := bytes.NewBuffer(nil)
+	src := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51234}
+	dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443}
+	if err := WriteHeader(buff, version, src, dst); err != nil {
+		t.Fatal(err)
+	}
+	return buff.Bytes()
+}
+
+func TestListener(t *testing.T) {
+	trusted := &Spec{TrustedCIDRs: []string{"127.0.0.0/8"}}
+	untrusted := &Spec{TrustedCIDRs: []string{"10.0.0.0/8"}}
+	required := &Spec{TrustedCIDRs: []string{"127.0.0.1"}, Required: true, HeaderTimeout: "100ms"}
+
+	for _, version := range []string{Version1, Version2} {
+		r := serveOne(t, trusted, header(t, version), "hello\n")
+		if r.err != nil || r.remoteAddr != "203.0.113.7:51234" || r.data != "hello\n" {
+			t.Errorf("%s from trusted source: unexpected result %+v", version, r)
+		}
+
+		r = serveOne(t, untrusted, header(t, version), "hello\n")
+		if r.err == nil {
+			t.Errorf("%s from untrusted source: expected an error, got %+v", version, r)
+		}
+	}
+
+	r := serveOne(t, trusted, nil, "hello\n")
+	if r.err != nil || r.remoteAddr == "203.0.113.7:51234" || r.data != "hello\n" {
+		t.Errorf("no header from trusted source: unexpected result %+v", r)
+	}
+
+	r = serveOne(t, untrusted, nil, "hello\n")
+	if r.err != nil || r.data != "hello\n" {
+		t.Errorf("no header from untrusted source: unexpected result %+v", r)
+	}
+
+	r = serveOne(t, required, nil, "hello\n")
+	if r.err == nil {
+		t.Errorf("no header when required: expected an error, got %+v", r)
+	}
+}
+
+func TestListenerSetSpec(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl := NewListener(l, nil)
+	defer pl.Close()
+
+	// The header is passed through as data if PROXY protocol is disabled.
+	r := serveOn(t, pl, header(t, Version1), "hello\n")
+	if r.err != nil || r.data != string(header(t, Version1)) {
+		t.Errorf("disabled: unexpected result %+v", r)
+	}
+
+	pl.SetSpec(&Spec{TrustedCIDRs: []string{"127.0.0.0/8"}})
+	r = serveOn(t, pl, header(t, Version1), "hello\n")
+	if r.err != nil || r.remoteAddr != "203.0.113.7:51234" || r.data != "hello\n" {
+		t.Errorf("enabled: unexpected result %+v", r)
+	}
+
+	pl.SetSpec(&Spec{TrustedCIDRs: []string{"10.0.0.0/8"}})
+	r = serveOn(t, pl, header(t, Version1), "hello\n")
+	if r.err == nil {
+		t.Errorf("untrusted: expected an error, got %+v", r)
+	}
+}
+
+func TestWriteHeader(t *testing.T) {
+	v1 := header(t, Version1)
+	if string(v1) != "PROXY TCP4 203.0.113.7 10.0.0.1 51234 443\r\n" {
+		t.Errorf("unexpected v1 header %q", v1)
+	}
+
+	h, err := proxyproto.Read(bufio.NewReader(bytes.NewReader(header(t, Version2))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Version != 2 || h.SourceAddr.String() != "203.0.113.7:51234" || h.DestinationAddr.String() != "10.0.0.1:443" {
+		t.Errorf("unexpected v2 header %+v", h)
+	}
+
+	buff := bytes.NewBuffer(nil)
+	if err := WriteHeader(buff, Version1, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if buff.String() != "PROXY UNKNOWN\r\n" {
+		t.Errorf("unexpected header of unknown addresses %q", buff.String())
+	}
+
+	if err := WriteHeader(io.Discard, "v3", nil, nil); err == nil {
+		t.Error("expected an error for unsupported version")
+	}
+}
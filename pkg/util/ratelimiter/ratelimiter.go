@@ -42,6 +42,16 @@ type (
 		State string
 	}
 
+	// Quota is the quota of a rate limiter in current cycle
+	Quota struct {
+		// Limit is the number of permissions in one cycle
+		Limit int
+		// Remaining is the number of free permissions in current cycle
+		Remaining int
+		// Reset is the duration until the beginning of next cycle
+		Reset time.Duration
+	}
+
 	// EventListenerFunc is a listener function to listen state transit event
 	EventListenerFunc func(event *Event)
 
@@ -186,6 +196,36 @@ func (rl *RateLimiter) AcquirePermission() (bool, time.Duration) {
 	return true, timeToWait
 }
 
+// Quota returns the quota of current cycle
+func (rl *RateLimiter) Quota() Quota {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	now := nowFunc()
+	limit := rl.policy.LimitForPeriod
+	cycle := int(now.Sub(rl.startTime) / rl.policy.LimitRefreshPeriod)
+	d := rl.policy.LimitRefreshPeriod * time.Duration(cycle+1)
+
+	quota := Quota{
+		Limit:     limit,
+		Remaining: limit,
+		Reset:     rl.startTime.Add(d).Sub(now),
+	}
+	if rl.state == StateDisabled {
+		return quota
+	}
+
+	// tokens includes the tokens reserved for the following cycles
+	tokens := rl.tokens - (cycle-rl.cycle)*limit
+	if tokens >= limit {
+		quota.Remaining = 0
+	} else if tokens > 0 {
+		quota.Remaining = limit - tokens
+	}
+
+	return quota
+}
+
 // WaitPermission waits a permission from the rate limiter
 // returns true if the request is permitted and false if timed out
 func (rl *RateLimiter) WaitPermission() bool {
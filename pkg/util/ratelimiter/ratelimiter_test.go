@@ -181,3 +181,30 @@ func TestRateLimiter(t *testing.T) {
 	}
 	limiter.SetState(StateDisabled)
 }
+
+func TestQuota(t *testing.T) {
+	policy := NewPolicy(50, 10, 5)
+	limiter := New(policy)
+
+	for i := 0; i < 3; i++ {
+		limiter.AcquirePermission()
+	}
+	quota := limiter.Quota()
+	if quota.Limit != 5 || quota.Remaining != 2 || quota.Reset != 10*time.Millisecond {
+		t.Errorf("unexpected quota: %+v", quota)
+	}
+
+	// 2 of the tokens are reserved for next cycle
+	for i := 0; i < 4; i++ {
+		limiter.AcquirePermission()
+	}
+	if quota = limiter.Quota(); quota.Remaining != 0 {
+		t.Errorf("unexpected quota: %+v", quota)
+	}
+
+	now = now.Add(time.Millisecond * 14)
+	quota = limiter.Quota()
+	if quota.Remaining != 3 || quota.Reset != 6*time.Millisecond {
+		t.Errorf("unexpected quota: %+v", quota)
+	}
+}
@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package routeaction provides the actions handling requests in the router
+// directly, instead of passing them to the backends.
+package routeaction
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+type (
+	// Redirect redirects the requests matching the path. The host is
+	// expanded with the captures of hostRegexp of the rule, the path and
+	// query are expanded with the captures of pathRegexp, such as $1 and ${name}.
+	// The empty parts keep the original values.
+	Redirect struct {
+		Code       int    `yaml:"code" jsonschema:"omitempty"`
+		Scheme     string `yaml:"scheme" jsonschema:"omitempty,enum=,enum=http,enum=https"`
+		Host       string `yaml:"host" jsonschema:"omitempty"`
+		Path       string `yaml:"path" jsonschema:"omitempty,pattern=^/"`
+		Query      string `yaml:"query" jsonschema:"omitempty"`
+		StripQuery bool   `yaml:"stripQuery" jsonschema:"omitempty"`
+	}
+
+	// Response responds the requests matching the path directly.
+	Response struct {
+		Code    int               `yaml:"code" jsonschema:"required,format=httpcode"`
+		Headers map[string]string `yaml:"headers" jsonschema:"omitempty"`
+		Body    string            `yaml:"body" jsonschema:"omitempty"`
+	}
+)
+
+// Validate checks there is exactly one of backend, redirect and response.
+func Validate(backend string, redirect *Redirect, response *Response) error {
+	actions := 0
+	if backend != "" {
+		actions++
+	}
+	if redirect != nil {
+		actions++
+	}
+	if response != nil {
+		actions++
+	}
+	if actions != 1 {
+		return fmt.Errorf("there must be exactly one of backend, redirect and response")
+	}
+
+	return nil
+}
+
+// Validate validates Redirect.
+func (r Redirect) Validate() error {
+	switch r.Code {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return fmt.Errorf("invalid redirect code %d", r.Code)
+	}
+
+	if r.StripQuery && r.Query != "" {
+		return fmt.Errorf("stripQuery can't be used with query")
+	}
+
+	return nil
+}
+
+// Handle responds the redirection of the request, hostRE and pathRE are
+// the regexps of the rule and the path matching the request, they are nil
+// if not configured.
+func (r *Redirect) Handle(ctx context.HTTPContext, hostRE, pathRE *regexp.Regexp) {
+	req := ctx.Request()
+
+	u := &url.URL{
+		Scheme:   "http",
+		Host:     req.Host(),
+		Path:     req.Path(),
+		RawQuery: req.Query(),
+	}
+	if req.Std().TLS != nil {
+		u.Scheme = "https"
+	}
+
+	hostname, port := u.Host, ""
+	if h, p, err := net.SplitHostPort(u.Host); err == nil {
+		hostname, port = h, p
+	}
+
+	if r.Scheme != "" && r.Scheme != u.Scheme {
+		u.Scheme = r.Scheme
+		// NOTE: The port belongs to the original scheme.
+		port = ""
+		u.Host = joinHostPort(hostname, port)
+	}
+	if r.Host != "" {
+		u.Host = expandCaptures(hostRE, hostname, r.Host)
+		if _, _, err := net.SplitHostPort(u.Host); err != nil {
+			u.Host = joinHostPort(u.Host, port)
+		}
+	}
+
+	if r.Path != "" {
+		u.Path = expandCaptures(pathRE, req.Path(), r.Path)
+	}
+	if r.StripQuery {
+		u.RawQuery = ""
+	} else if r.Query != "" {
+		u.RawQuery = expandCaptures(pathRE, req.Path(), r.Query)
+	}
+
+	code := r.Code
+	if code == 0 {
+		code = http.StatusMovedPermanently
+	}
+
+	ctx.Response().Header().Set(httpheader.KeyLocation, u.String())
+	ctx.Response().SetStatusCode(code)
+}
+
+// Handle responds the request with the fixed response.
+func (r *Response) Handle(ctx context.HTTPContext) {
+	w := ctx.Response()
+	w.SetStatusCode(r.Code)
+	for key, value := range r.Headers {
+		w.Header().Set(key, value)
+	}
+	w.SetBody(strings.NewReader(r.Body))
+}
+
+// joinHostPort joins the host and the optional port,
+// the IPv6 host is enclosed in square brackets.
+func joinHostPort(host, port string) string {
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if port != "" {
+		return net.JoinHostPort(host, port)
+	}
+	if strings.Contains(host, ":") {
+		return "[" + host + "]"
+	}
+	return host
+}
+
+// expandCaptures expands the template with the captures of re matching s,
+// such as $1 and ${name}. The template is returned as it is if re is nil
+// or it doesn't match s.
+func expandCaptures(re *regexp.Regexp, s, template string) string {
+	if re == nil {
+		return template
+	}
+
+	match := re.FindStringSubmatchIndex(s)
+	if match == nil {
+		return template
+	}
+
+	return string(re.ExpandString(nil, template, s, match))
+}
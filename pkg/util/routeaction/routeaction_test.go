@@ -0,0 +1,288 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package routeaction
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+func newContext(url string) context.HTTPContext {
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	return context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "")
+}
+
+func TestValidate(t *testing.T) {
+	redirect, response := &Redirect{}, &Response{Code: 200}
+
+	cases := []struct {
+		backend  string
+		redirect *Redirect
+		response *Response
+		valid    bool
+	}{
+		{"pipeline", nil, nil, true},
+		{"", redirect, nil, true},
+		{"", nil, response, true},
+		{"", nil, nil, false},
+		{"pipeline", redirect, nil, false},
+		{"pipeline", nil, response, false},
+		{"", redirect, response, false},
+		{"pipeline", redirect, response, false},
+	}
+
+	for i, c := range cases {
+		err := Validate(c.backend, c.redirect, c.response)
+		if c.valid && err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("case %d: expected an error", i)
+		}
+	}
+}
+
+func TestRedirectValidate(t *testing.T) {
+	cases := []struct {
+		redirect Redirect
+		valid    bool
+	}{
+		{Redirect{}, true},
+		{Redirect{Code: 301}, true},
+		{Redirect{Code: 302}, true},
+		{Redirect{Code: 303}, true},
+		{Redirect{Code: 307}, true},
+		{Redirect{Code: 308}, true},
+		{Redirect{Code: 200}, false},
+		{Redirect{Code: 300}, false},
+		{Redirect{Code: 304}, false},
+		{Redirect{Code: 404}, false},
+		{Redirect{StripQuery: true}, true},
+		{Redirect{Query: "a=1"}, true},
+		{Redirect{StripQuery: true, Query: "a=1"}, false},
+	}
+
+	for i, c := range cases {
+		err := c.redirect.Validate()
+		if c.valid && err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("case %d: expected an error", i)
+		}
+	}
+}
+
+func TestRedirectHandle(t *testing.T) {
+	cases := []struct {
+		name       string
+		url        string
+		hostRegexp string
+		pathRegexp string
+		redirect   Redirect
+		location   string
+		code       int
+	}{
+		{
+			name:     "default code",
+			url:      "http://example.com/a?x=1",
+			redirect: Redirect{Path: "/b"},
+			location: "http://example.com/b?x=1",
+			code:     http.StatusMovedPermanently,
+		},
+		{
+			name:     "to https drops port",
+			url:      "http://example.com:8080/a?x=1",
+			redirect: Redirect{Scheme: "https"},
+			location: "https://example.com/a?x=1",
+			code:     http.StatusMovedPermanently,
+		},
+		{
+			name:     "to https drops port of ipv6",
+			url:      "http://[::1]:8080/a",
+			redirect: Redirect{Scheme: "https", Code: http.StatusFound},
+			location: "https://[::1]/a",
+			code:     http.StatusFound,
+		},
+		{
+			name:     "to http drops port",
+			url:      "https://example.com:8443/a",
+			redirect: Redirect{Scheme: "http"},
+			location: "http://example.com/a",
+			code:     http.StatusMovedPermanently,
+		},
+		{
+			name:     "same scheme keeps port",
+			url:      "http://example.com:8080/a",
+			redirect: Redirect{Scheme: "http", Path: "/b"},
+			location: "http://example.com:8080/b",
+			code:     http.StatusMovedPermanently,
+		},
+		{
+			name:     "host keeps port",
+			url:      "http://example.com:8080/a",
+			redirect: Redirect{Host: "example.org"},
+			location: "http://example.org:8080/a",
+			code:     http.StatusMovedPermanently,
+		},
+		{
+			name:     "ipv6 host keeps port",
+			url:      "http://[::1]:8080/a",
+			redirect: Redirect{Host: "::2"},
+			location: "http://[::2]:8080/a",
+			code:     http.StatusMovedPermanently,
+		},
+		{
+			name:     "host with port",
+			url:      "http://example.com:8080/a",
+			redirect: Redirect{Host: "example.org:9090"},
+			location: "http://example.org:9090/a",
+			code:     http.StatusMovedPermanently,
+		},
+		{
+			name:     "scheme and host drop port",
+			url:      "http://example.com:8080/a",
+			redirect: Redirect{Scheme: "https", Host: "example.org"},
+			location: "https://example.org/a",
+			code:     http.StatusMovedPermanently,
+		},
+		{
+			name:       "host captures",
+			url:        "http://www.example.com:8080/a",
+			hostRegexp: `^www\.(.+)$`,
+			redirect:   Redirect{Host: "$1"},
+			location:   "http://example.com:8080/a",
+			code:       http.StatusMovedPermanently,
+		},
+		{
+			name:       "named host captures",
+			url:        "https://api.example.com/a",
+			hostRegexp: `^(?P<sub>[a-z]+)\.example\.com$`,
+			redirect:   Redirect{Host: "${sub}.example.org"},
+			location:   "https://api.example.org/a",
+			code:       http.StatusMovedPermanently,
+		},
+		{
+			name:       "path captures",
+			url:        "http://example.com/old/a/b?x=1",
+			pathRegexp: `^/old/(?P<rest>.*)$`,
+			redirect:   Redirect{Code: http.StatusPermanentRedirect, Path: "/new/${rest}"},
+			location:   "http://example.com/new/a/b?x=1",
+			code:       http.StatusPermanentRedirect,
+		},
+		{
+			name:       "query captures",
+			url:        "http://example.com/item/42?x=1",
+			pathRegexp: `^/item/(\d+)$`,
+			redirect:   Redirect{Path: "/items", Query: "id=$1"},
+			location:   "http://example.com/items?id=42",
+			code:       http.StatusMovedPermanently,
+		},
+		{
+			name:     "strip query",
+			url:      "http://example.com/a?x=1",
+			redirect: Redirect{StripQuery: true},
+			location: "http://example.com/a",
+			code:     http.StatusMovedPermanently,
+		},
+		{
+			name:       "no match keeps template",
+			url:        "http://example.com/a",
+			pathRegexp: `^/b/(.*)$`,
+			redirect:   Redirect{Path: "/c"},
+			location:   "http://example.com/c",
+			code:       http.StatusMovedPermanently,
+		},
+	}
+
+	for _, c := range cases {
+		var hostRE, pathRE *regexp.Regexp
+		if c.hostRegexp != "" {
+			hostRE = regexp.MustCompile(c.hostRegexp)
+		}
+		if c.pathRegexp != "" {
+			pathRE = regexp.MustCompile(c.pathRegexp)
+		}
+
+		ctx := newContext(c.url)
+		c.redirect.Handle(ctx, hostRE, pathRE)
+
+		if code := ctx.Response().StatusCode(); code != c.code {
+			t.Errorf("%s: expected code %d, got %d", c.name, c.code, code)
+		}
+		if location := ctx.Response().Header().Get(httpheader.KeyLocation); location != c.location {
+			t.Errorf("%s: expected location %s, got %s", c.name, c.location, location)
+		}
+	}
+}
+
+// TestRedirectReused checks the redirect serves every request the same way,
+// since the router caches the matched path and reuses its redirect.
+func TestRedirectReused(t *testing.T) {
+	redirect := &Redirect{Path: "/new/$1"}
+	pathRE := regexp.MustCompile(`^/old/(.*)$`)
+
+	for i := 0; i < 2; i++ {
+		for _, c := range []struct{ url, location string }{
+			{"http://example.com:8080/old/a", "http://example.com:8080/new/a"},
+			{"http://example.com:8080/old/b", "http://example.com:8080/new/b"},
+		} {
+			ctx := newContext(c.url)
+			redirect.Handle(ctx, nil, pathRE)
+			if location := ctx.Response().Header().Get(httpheader.KeyLocation); location != c.location {
+				t.Errorf("hit %d: expected location %s, got %s", i+1, c.location, location)
+			}
+		}
+	}
+
+	if *redirect != (Redirect{Path: "/new/$1"}) {
+		t.Errorf("redirect is modified: %+v", redirect)
+	}
+}
+
+func TestResponseHandle(t *testing.T) {
+	response := &Response{
+		Code:    http.StatusOK,
+		Headers: map[string]string{"Content-Type": "text/plain"},
+		Body:    "ok",
+	}
+
+	for i := 0; i < 2; i++ {
+		ctx := newContext("http://example.com/healthz")
+		response.Handle(ctx)
+
+		w := ctx.Response()
+		if w.StatusCode() != http.StatusOK {
+			t.Errorf("expected code 200, got %d", w.StatusCode())
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "text/plain" {
+			t.Errorf("expected content type text/plain, got %s", ct)
+		}
+		body, _ := io.ReadAll(w.Body())
+		if string(body) != "ok" {
+			t.Errorf("expected body ok, got %q", body)
+		}
+	}
+}
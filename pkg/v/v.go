@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"strings"
 	"sync"
 
 	genjs "github.com/alecthomas/jsonschema"
@@ -128,7 +129,7 @@ func Validate(v interface{}) *ValidateRecorder {
 	vr.recordJSONSchema(result)
 
 	val := reflect.ValueOf(v)
-	traverseGo(&val, nil, vr.record)
+	traverseGo(&val, nil, "", vr.record)
 
 	return vr
 }
@@ -181,7 +182,9 @@ func getSchemaMeta(t reflect.Type) (*schemaMeta, error) {
 // 2. It does not traverse unexposed subfields of the struct.
 // 3. It passes nil to the argument StructField when it's not a struct field.
 // 4. It stops when encoutering nil.
-func traverseGo(val *reflect.Value, field *reflect.StructField, fn func(*reflect.Value, *reflect.StructField)) {
+// 5. It passes the path of the value in yaml, such as filters.0.name.
+func traverseGo(val *reflect.Value, field *reflect.StructField, path string,
+	fn func(*reflect.Value, *reflect.StructField, string)) {
 	t := val.Type()
 
 	switch t.Kind() {
@@ -192,7 +195,7 @@ func traverseGo(val *reflect.Value, field *reflect.StructField, fn func(*reflect
 		}
 	}
 
-	fn(val, field)
+	fn(val, field, path)
 
 	switch t.Kind() {
 	case reflect.Struct:
@@ -205,22 +208,48 @@ func traverseGo(val *reflect.Value, field *reflect.StructField, fn func(*reflect
 			if subfield.Type.Kind() == reflect.Ptr && subval.IsNil() {
 				continue
 			}
-			traverseGo(&subval, &subfield, fn)
+			traverseGo(&subval, &subfield, fieldPath(path, &subfield), fn)
 		}
 	case reflect.Array, reflect.Slice:
 		for i := 0; i < val.Len(); i++ {
 			subval := val.Index(i)
-			traverseGo(&subval, nil, fn)
+			traverseGo(&subval, nil, joinPath(path, fmt.Sprintf("%d", i)), fn)
 		}
 	case reflect.Map:
 		iter := val.MapRange()
 		for iter.Next() {
 			k, v := iter.Key(), iter.Value()
-			traverseGo(&k, nil, fn)
-			traverseGo(&v, nil, fn)
+			traverseGo(&k, nil, path, fn)
+			traverseGo(&v, nil, joinPath(path, fmt.Sprintf("%v", k.Interface())), fn)
 		}
 	case reflect.Ptr:
 		child := val.Elem()
-		traverseGo(&child, nil, fn)
+		traverseGo(&child, nil, path, fn)
 	}
 }
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// fieldPath follows the rules of yaml.v2, the inline fields
+// share the path of the parent, and the default name of a field
+// is its lowercased name.
+func fieldPath(path string, field *reflect.StructField) string {
+	tags := strings.Split(field.Tag.Get("yaml"), ",")
+	for _, tag := range tags[1:] {
+		if tag == "inline" {
+			return path
+		}
+	}
+
+	name := tags[0]
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+
+	return joinPath(path, name)
+}
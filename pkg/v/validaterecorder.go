@@ -52,12 +52,47 @@ type (
 
 		// SystemErr stands internal error, which often means bugs.
 		SystemErr string `yaml:"systemErr,omitempty"`
+
+		fieldErrs []*FieldError
+	}
+
+	// FieldError is a validation error located at a field.
+	FieldError struct {
+		// Field is the path of the field, such as filters.0.maxBytes,
+		// it's empty if the error is about the whole value.
+		Field string `yaml:"field,omitempty"`
+		// Type is one of jsonschema, format, general and system.
+		Type    string `yaml:"type"`
+		Message string `yaml:"message"`
 	}
 )
 
+// Types of FieldError.
+const (
+	ErrTypeJSONSchema = "jsonschema"
+	ErrTypeFormat     = "format"
+	ErrTypeGeneral    = "general"
+	ErrTypeSystem     = "system"
+)
+
+// FieldErrors returns the errors along with the fields they are located at.
+func (vr *ValidateRecorder) FieldErrors() []*FieldError {
+	return vr.fieldErrs
+}
+
+func (vr *ValidateRecorder) recordField(field, typ, message string) {
+	vr.fieldErrs = append(vr.fieldErrs, &FieldError{Field: field, Type: typ, Message: message})
+}
+
 func (vr *ValidateRecorder) recordJSONSchema(result *loadjs.Result) {
 	for _, err := range result.Errors() {
 		vr.JSONSchemaErrs = append(vr.JSONSchemaErrs, err.String())
+
+		field := err.Field()
+		if field == loadjs.STRING_CONTEXT_ROOT {
+			field = ""
+		}
+		vr.recordField(field, ErrTypeJSONSchema, err.Description())
 	}
 }
 
@@ -90,12 +125,12 @@ func requiredFromField(field *reflect.StructField) bool {
 	}
 }
 
-func (vr *ValidateRecorder) record(val *reflect.Value, field *reflect.StructField) {
-	vr.recordFormat(val, field)
-	vr.recordGeneral(val, field)
+func (vr *ValidateRecorder) record(val *reflect.Value, field *reflect.StructField, path string) {
+	vr.recordFormat(val, field, path)
+	vr.recordGeneral(val, field, path)
 }
 
-func (vr *ValidateRecorder) recordFormat(val *reflect.Value, field *reflect.StructField) {
+func (vr *ValidateRecorder) recordFormat(val *reflect.Value, field *reflect.StructField, path string) {
 	if field == nil {
 		return
 	}
@@ -128,11 +163,12 @@ func (vr *ValidateRecorder) recordFormat(val *reflect.Value, field *reflect.Stru
 				fmt.Sprintf("%s: %s",
 					getFieldYAMLName(field),
 					err.Error()))
+			vr.recordField(path, ErrTypeFormat, err.Error())
 		}
 	}
 }
 
-func (vr *ValidateRecorder) recordGeneral(val *reflect.Value, field *reflect.StructField) {
+func (vr *ValidateRecorder) recordGeneral(val *reflect.Value, field *reflect.StructField, path string) {
 	fieldName := val.Type().String()
 	if field != nil {
 		fieldName = getFieldYAMLName(field)
@@ -157,12 +193,14 @@ func (vr *ValidateRecorder) recordGeneral(val *reflect.Value, field *reflect.Str
 		vr.GeneralErrs = append(vr.GeneralErrs, fmt.Sprintf("%s: %s",
 			fieldName,
 			err.Error()))
+		vr.recordField(path, ErrTypeGeneral, err.Error())
 	}
 }
 
 func (vr *ValidateRecorder) recordSystem(err error) {
 	if err != nil {
 		vr.SystemErr = err.Error()
+		vr.recordField("", ErrTypeSystem, err.Error())
 	}
 }
 